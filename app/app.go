@@ -1,6 +1,7 @@
 package app
 
 import (
+	"context"
 	"github.com/gofiber/fiber"
 	"github.com/jinzhu/gorm"
 	"net/http"
@@ -8,6 +9,7 @@ import (
 	"time"
 	"toolkit/app/core/cache"
 	"toolkit/app/core/observance"
+	"toolkit/app/core/server"
 	"toolkit/app/core/toolkit"
 )
 
@@ -36,6 +38,31 @@ func Serve() {
 	}
 	obs := toolkit.MustNewObs(obsConfig)
 	defer obs.PanicRecover()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := obs.Close(ctx); err != nil {
+			obs.Logger.WithError(err).Error("failed to close observance")
+		}
+	}()
+
+	// Set up the admin server with the debug endpoints.
+	if adminAddr := os.Getenv("ADMIN_ADDR"); adminAddr != "" {
+		adminServer := toolkit.MustStartAdminServer(obs, toolkit.AdminConfig{
+			Addr:     adminAddr,
+			Token:    os.Getenv("ADMIN_TOKEN"),
+			AppName:  obsConfig.AppName,
+			Version:  obsConfig.Version,
+			Settings: obsConfig,
+		})
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := adminServer.Shutdown(ctx); err != nil {
+				obs.Logger.WithError(err).Error("failed to shut down admin server")
+			}
+		}()
+	}
 
 	// Set up DB connection and run migrations.
 	dbConfig := toolkit.DBConfig{
@@ -56,7 +83,25 @@ func Serve() {
 	toolkit.MustEnsureDBMigrations("migrations", dbConfig)
 
 	// Set up REDIS newCache.
-	newCache := toolkit.MustNewCache(os.Getenv("REDIS_HOST"), os.Getenv("REDIS_PORT"), "testPrefix")
+	cacheConfig := toolkit.CacheConfig{
+		Host:     os.Getenv("REDIS_HOST"),
+		Port:     os.Getenv("REDIS_PORT"),
+		Password: os.Getenv("REDIS_PASSWORD"),
+		Prefix:   "testPrefix",
+	}
+	if redisURL := os.Getenv("REDIS_URL"); redisURL != "" {
+		var err error
+		prefix := cacheConfig.Prefix
+		cacheConfig, err = cache.ParseURL(redisURL)
+		if err != nil {
+			panic(err)
+		}
+		// The prefix is only replaced if the URL contains one.
+		if cacheConfig.Prefix == "" {
+			cacheConfig.Prefix = prefix
+		}
+	}
+	newCache := toolkit.MustNewCache(cacheConfig)
 	defer func() {
 		if err := newCache.Close(); err != nil {
 			obs.Logger.WithError(err).Error("failed to close REDIS connection")
@@ -87,7 +132,7 @@ func startFiberRoutes(addr string, obs *observance.Obs, db *gorm.DB, cache cache
 		}
 
 		// Nonsense cache usage example
-		err = cache.SetJSON("latestNewUser", newUser, 0)
+		err = cache.SetJSON(server.RequestContext(c), "latestNewUser", newUser, 0)
 		if err != nil {
 			_ = c.JSON(map[string]string{"msg": err.(string)})
 		}
@@ -0,0 +1,253 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	rpprof "runtime/pprof"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"toolkit/app/core/observance"
+)
+
+// DefaultAddr is the bind address of the admin server if none was configured.
+// It only listens on the loopback interface so the debug endpoints are not reachable from outside by accident.
+const DefaultAddr = "127.0.0.1:8081"
+
+// Config contains the settings of the admin server.
+type Config struct {
+	// Addr is the address the admin server listens on, e.g. ":8081".
+	Addr string
+	// Username and Password activate basic auth for all endpoints (optional). The password must not be empty.
+	Username string
+	Password string
+	// Token activates authentication via the header "Authorization: Bearer <token>" (optional).
+	// If basic auth is configured as well, either of them is accepted.
+	Token string
+	// AppName and Version are shown in the build info.
+	AppName string
+	Version string
+	// Settings is the effective config of the service that is served under /config.
+	// Values of fields that look like secrets (password, token, key etc.) and credentials in URLs are redacted.
+	Settings interface{}
+}
+
+// Server is an HTTP server for operating the service that is separate from the public server:
+//
+//	/debug/pprof/     profiles of net/http/pprof
+//	/debug/goroutines dump of the stacks of all goroutines
+//	/debug/runtime    runtime stats like memory usage and number of goroutines
+//	/buildinfo        app name, version, Go version and VCS revision
+//	/config           effective config with redacted secrets
+//	/loglevel         current log level (GET) and changing it at runtime (PUT with {"level": "debug"})
+//	/metrics          metrics in the Prometheus text format (if Prometheus is used)
+type Server struct {
+	obs      *observance.Obs
+	config   Config
+	server   *http.Server
+	listener net.Listener
+	started  time.Time
+}
+
+// New creates a new admin server, it needs to be started with Start.
+// It returns an error if a username is configured without a password.
+func New(obs *observance.Obs, config Config) (*Server, error) {
+	if config.Username != "" && config.Password == "" {
+		return nil, errors.New("admin server password is required if a username is configured")
+	}
+	if config.Addr == "" {
+		config.Addr = DefaultAddr
+	}
+
+	s := &Server{
+		obs:     obs,
+		config:  config,
+		started: time.Now(),
+	}
+	s.server = &http.Server{
+		Handler:      s.Handler(),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 2 * time.Minute, // CPU profiles and traces take 30s by default.
+	}
+	return s, nil
+}
+
+// Handler returns the handler with all endpoints including the authentication.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/goroutines", s.goroutines)
+	mux.HandleFunc("/debug/runtime", s.runtimeStats)
+	mux.HandleFunc("/buildinfo", s.buildInfo)
+	mux.HandleFunc("/config", s.settings)
+	mux.HandleFunc("/loglevel", s.logLevel)
+	mux.HandleFunc("/metrics", s.metrics)
+	return s.authenticate(mux)
+}
+
+// Start starts listening on the configured address. The requests are served in the background.
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.config.Addr)
+	if err != nil {
+		return errors.Wrap(err, "admin server could not listen")
+	}
+	s.listener = listener
+
+	if s.config.Token == "" && s.config.Username == "" {
+		s.obs.Logger.WithField("addr", listener.Addr().String()).Warn("admin server is not protected by authentication")
+	}
+
+	go func() {
+		if err := s.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			s.obs.Logger.WithError(err).Error("admin server stopped")
+		}
+	}()
+	return nil
+}
+
+// Addr returns the address the server is listening on, e.g. to find out the port if ":0" was configured.
+func (s *Server) Addr() string {
+	if s.listener == nil {
+		return s.config.Addr
+	}
+	return s.listener.Addr().String()
+}
+
+// Shutdown stops the server gracefully.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	if s.config.Token == "" && s.config.Username == "" {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.config.Token != "" {
+			header := r.Header.Get("Authorization")
+			if strings.HasPrefix(header, "Bearer ") && equal(strings.TrimPrefix(header, "Bearer "), s.config.Token) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		if s.config.Username != "" {
+			username, password, ok := r.BasicAuth()
+			if ok && equal(username, s.config.Username) && equal(password, s.config.Password) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="admin"`)
+		}
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	})
+}
+
+func (s *Server) goroutines(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_ = rpprof.Lookup("goroutine").WriteTo(w, 2)
+}
+
+func (s *Server) runtimeStats(w http.ResponseWriter, r *http.Request) {
+	memStats := runtime.MemStats{}
+	runtime.ReadMemStats(&memStats)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"uptime":       time.Since(s.started).String(),
+		"goroutines":   runtime.NumGoroutine(),
+		"cpus":         runtime.NumCPU(),
+		"gomaxprocs":   runtime.GOMAXPROCS(0),
+		"heapAlloc":    memStats.HeapAlloc,
+		"heapSys":      memStats.HeapSys,
+		"heapObjects":  memStats.HeapObjects,
+		"totalAlloc":   memStats.TotalAlloc,
+		"sys":          memStats.Sys,
+		"numGC":        memStats.NumGC,
+		"pauseTotalNs": memStats.PauseTotalNs,
+	})
+}
+
+func (s *Server) buildInfo(w http.ResponseWriter, r *http.Request) {
+	info := map[string]string{
+		"app":       s.config.AppName,
+		"version":   s.config.Version,
+		"goversion": runtime.Version(),
+	}
+	if buildInfo, ok := debug.ReadBuildInfo(); ok {
+		info["module"] = buildInfo.Main.Path
+	}
+	if revision := observance.VCSRevision(); revision != "" {
+		info["revision"] = revision
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+func (s *Server) settings(w http.ResponseWriter, r *http.Request) {
+	settings, err := redact(s.config.Settings)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, settings)
+}
+
+func (s *Server) logLevel(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		leveler, ok := s.obs.Logger.(interface{ SetLevel(string) error })
+		if !ok {
+			writeJSON(w, http.StatusNotImplemented, map[string]string{"error": "the logger does not support changing the level"})
+			return
+		}
+
+		body := struct {
+			Level string `json:"level"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+			return
+		}
+		previous := s.obs.Logger.Level()
+		if err := leveler.SetLevel(body.Level); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		s.obs.Logger.WithFields(observance.Fields{"previous": previous, "level": body.Level}).Warn("log level changed")
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"level": s.obs.Logger.Level()})
+}
+
+func (s *Server) metrics(w http.ResponseWriter, r *http.Request) {
+	handler, ok := s.obs.Metrics.(interface{ Handler() http.Handler })
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	handler.Handler().ServeHTTP(w, r)
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+// equal compares the strings in constant time.
+func equal(a string, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
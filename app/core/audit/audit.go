@@ -0,0 +1,385 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"toolkit/app/core/observance"
+)
+
+// Default values that are used if the corresponding config value is not set.
+const (
+	DefaultQueueSize     = 1000
+	DefaultBatchSize     = 100
+	DefaultFlushInterval = time.Second
+	DefaultMaxPending    = 10000
+	maxRetryDelay        = 30 * time.Second
+)
+
+// Entry describes one change that needs to be recorded for compliance reasons.
+type Entry struct {
+	Time       time.Time `json:"time"`
+	Actor      string    `json:"actor"`
+	Action     string    `json:"action"`
+	Resource   string    `json:"resource"`
+	ResourceID string    `json:"resourceId,omitempty"`
+	RequestID  string    `json:"requestId,omitempty"`
+	Changes    []Change  `json:"changes,omitempty"`
+}
+
+// Change contains the value of a field before and after the action.
+type Change struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Diff compares the JSON representation of the two values and returns the changes of all top level fields.
+// Either value can be nil, e.g. before is nil for created resources. The changes are sorted by field name.
+func Diff(before interface{}, after interface{}) ([]Change, error) {
+	beforeFields, err := toFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := toFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []Change{}
+	for field, beforeValue := range beforeFields {
+		afterValue := afterFields[field]
+		if !reflect.DeepEqual(beforeValue, afterValue) {
+			changes = append(changes, Change{Field: field, Before: beforeValue, After: afterValue})
+		}
+	}
+	for field, afterValue := range afterFields {
+		if _, ok := beforeFields[field]; !ok {
+			changes = append(changes, Change{Field: field, After: afterValue})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes, nil
+}
+
+func toFields(value interface{}) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	if value == nil {
+		return fields, nil
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return nil, fmt.Errorf("audit diff needs values that are encoded as JSON objects: %w", err)
+	}
+	return fields, nil
+}
+
+type actorKey struct{}
+
+// ContextWithActor returns a copy of the context that contains the actor, e.g. the ID of the authenticated user.
+func ContextWithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor stored in the context or an empty string.
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// Config contains the settings of the Auditor.
+type Config struct {
+	// QueueSize is the number of entries that can be waiting to be written. If the queue is full,
+	// Record blocks until there is space again, entries are never dropped.
+	QueueSize int
+	// BatchSize is the maximum number of entries written to the sink at once.
+	BatchSize int
+	// FlushInterval is the maximum time an entry waits in the queue before it is written.
+	FlushInterval time.Duration
+	// MaxPending is the maximum number of entries the background writer holds while the sink is failing.
+	// If it is reached, no further entries are taken from the queue, so Record blocks once the queue is full
+	// until the context of Record is done or the Auditor is closed.
+	MaxPending int
+}
+
+// Auditor records audit entries asynchronously. The entries are written to the sink in batches in the background.
+// Failed writes are retried until they succeed or the Auditor is closed.
+type Auditor struct {
+	sink    Sink
+	logger  observance.Logger
+	config  Config
+	queue   chan Entry
+	flush   chan chan error
+	stop    chan struct{}
+	stopped chan struct{}
+	pending []Entry
+	mutex   sync.RWMutex
+	closed  bool
+	// closing is closed at the start of Close so a Record that waits for space in the queue gives up.
+	closing     chan struct{}
+	closingOnce sync.Once
+	// writeCtx is passed to the sink by the background writer, it is canceled if Close gives up waiting.
+	writeCtx     context.Context
+	cancelWrites context.CancelFunc
+}
+
+// New creates a new Auditor and starts writing to the sink in the background.
+func New(sink Sink, logger observance.Logger, config Config) *Auditor {
+	if config.QueueSize <= 0 {
+		config.QueueSize = DefaultQueueSize
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultBatchSize
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = DefaultFlushInterval
+	}
+	if config.MaxPending < config.BatchSize {
+		config.MaxPending = DefaultMaxPending
+		if config.MaxPending < config.BatchSize {
+			config.MaxPending = config.BatchSize
+		}
+	}
+
+	writeCtx, cancelWrites := context.WithCancel(context.Background())
+	a := &Auditor{
+		sink:         sink,
+		logger:       logger,
+		config:       config,
+		queue:        make(chan Entry, config.QueueSize),
+		flush:        make(chan chan error),
+		stop:         make(chan struct{}),
+		stopped:      make(chan struct{}),
+		closing:      make(chan struct{}),
+		writeCtx:     writeCtx,
+		cancelWrites: cancelWrites,
+	}
+	go a.continuouslyWrite()
+	return a
+}
+
+// Record queues the entry for writing. The time, the actor and the request ID are taken from the context
+// if they are not set in the entry. If the queue is full, Record waits for space. After Close was called or
+// if the context is done while waiting, the entry is written to the logger instead.
+func (a *Auditor) Record(ctx context.Context, entry Entry) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	if entry.Actor == "" {
+		entry.Actor = ActorFromContext(ctx)
+	}
+	if entry.RequestID == "" {
+		entry.RequestID = observance.RequestIDFromContext(ctx)
+	}
+
+	// The read lock prevents Close from closing the queue during the send, Close signals closing
+	// before it takes the write lock so the send never blocks it.
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	if a.closed {
+		a.logUndelivered([]Entry{entry})
+		return
+	}
+	select {
+	case a.queue <- entry:
+	case <-a.closing:
+		a.logUndelivered([]Entry{entry})
+	case <-ctx.Done():
+		a.logUndelivered([]Entry{entry})
+	}
+}
+
+// RecordChange records an action together with the diff between the before and after state of the resource.
+func (a *Auditor) RecordChange(ctx context.Context, action string, resource string, resourceID string, before interface{}, after interface{}) error {
+	changes, err := Diff(before, after)
+	if err != nil {
+		return err
+	}
+	a.Record(ctx, Entry{Action: action, Resource: resource, ResourceID: resourceID, Changes: changes})
+	return nil
+}
+
+// Flush writes all entries recorded so far. It returns the error of the sink if writing failed,
+// the entries stay queued and are retried in that case.
+func (a *Auditor) Flush(ctx context.Context) error {
+	result := make(chan error, 1)
+	select {
+	case a.flush <- result:
+	case <-a.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close writes all queued entries and stops the background writer. It should be called when the service shuts down.
+// If the entries can not be written before the context is done, they are written to the logger
+// so they are not lost and an error is returned. If the sink does not return in time, its write is canceled
+// and the entries of that write are logged as soon as it returns.
+func (a *Auditor) Close(ctx context.Context) error {
+	a.closingOnce.Do(func() { close(a.closing) })
+	a.mutex.Lock()
+	if a.closed {
+		a.mutex.Unlock()
+		return nil
+	}
+	a.closed = true
+	a.mutex.Unlock()
+	defer a.cancelWrites()
+
+	close(a.stop)
+	select {
+	case <-a.stopped:
+	case <-ctx.Done():
+		a.cancelWrites()
+		// The queue is not closed since the writer might still read from it.
+		queued := []Entry{}
+		for len(a.queue) > 0 {
+			queued = append(queued, <-a.queue)
+		}
+		a.logUndelivered(queued)
+		return fmt.Errorf("audit writer did not stop, the queued entries were logged: %w", ctx.Err())
+	}
+
+	// Drain the queue after the writer stopped, Record does not add entries anymore.
+	close(a.queue)
+	for entry := range a.queue {
+		a.pending = append(a.pending, entry)
+	}
+
+	delay := 100 * time.Millisecond
+	for len(a.pending) > 0 {
+		if err := a.writePending(ctx); err == nil {
+			break
+		}
+		select {
+		case <-time.After(delay):
+			delay = nextDelay(delay)
+		case <-ctx.Done():
+			count := len(a.pending)
+			a.logUndelivered(a.pending)
+			a.pending = nil
+			return fmt.Errorf("%d audit entries could not be written to the sink: %w", count, ctx.Err())
+		}
+	}
+	return nil
+}
+
+// continuouslyWrite collects the entries and writes them in batches until the Auditor is closed.
+// If Close gave up waiting, the entries that were not written are logged when the writer stops.
+func (a *Auditor) continuouslyWrite() {
+	defer close(a.stopped)
+	defer func() {
+		if a.writeCtx.Err() != nil {
+			a.logUndelivered(a.pending)
+			a.pending = nil
+		}
+	}()
+	ticker := time.NewTicker(a.config.FlushInterval)
+	defer ticker.Stop()
+
+	delay := 100 * time.Millisecond
+	var retryAt time.Time
+	for {
+		// While the sink is failing, entries stay in the queue if too many are pending.
+		queue := a.queue
+		if len(a.pending) >= a.config.MaxPending {
+			queue = nil
+		}
+
+		select {
+		case <-a.stop:
+			return
+		default:
+		}
+
+		select {
+		case entry := <-queue:
+			a.pending = append(a.pending, entry)
+			if len(a.pending) < a.config.BatchSize || time.Now().Before(retryAt) {
+				continue
+			}
+		case result := <-a.flush:
+			a.drainQueue()
+			result <- a.writePending(a.writeCtx)
+			continue
+		case <-ticker.C:
+			if time.Now().Before(retryAt) {
+				continue
+			}
+		case <-a.stop:
+			return
+		}
+
+		if err := a.writePending(a.writeCtx); err != nil {
+			a.logger.WithFields(observance.Fields{
+				"error":   err.Error(),
+				"pending": len(a.pending),
+				"retryIn": delay.String(),
+			}).Warn("failed to write audit entries")
+			retryAt = time.Now().Add(delay)
+			delay = nextDelay(delay)
+			continue
+		}
+		retryAt = time.Time{}
+		delay = 100 * time.Millisecond
+	}
+}
+
+func (a *Auditor) drainQueue() {
+	for len(a.pending) < a.config.MaxPending {
+		select {
+		case entry := <-a.queue:
+			a.pending = append(a.pending, entry)
+		default:
+			return
+		}
+	}
+}
+
+// writePending writes the pending entries in batches. Entries that were written are removed from the pending list.
+func (a *Auditor) writePending(ctx context.Context) error {
+	for len(a.pending) > 0 {
+		size := len(a.pending)
+		if size > a.config.BatchSize {
+			size = a.config.BatchSize
+		}
+		if err := a.sink.Write(ctx, a.pending[:size]); err != nil {
+			return err
+		}
+		a.pending = a.pending[size:]
+	}
+	a.pending = nil
+	return nil
+}
+
+// logUndelivered writes the entries to the logger as last resort.
+func (a *Auditor) logUndelivered(entries []Entry) {
+	for _, entry := range entries {
+		encoded, _ := json.Marshal(entry)
+		a.logger.WithField("audit", string(encoded)).Error("audit entry could not be written to the sink")
+	}
+}
+
+func nextDelay(delay time.Duration) time.Duration {
+	delay *= 2
+	if delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+	return delay
+}
@@ -0,0 +1,379 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofiber/fiber"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"toolkit/app/core/observance"
+	"toolkit/app/core/server"
+)
+
+type invoice struct {
+	Number string  `json:"number"`
+	Amount float64 `json:"amount"`
+	Paid   bool    `json:"paid"`
+	Note   string  `json:"note,omitempty"`
+}
+
+func TestDiff(t *testing.T) {
+	t.Run("changed, added and removed fields", func(t *testing.T) {
+		before := invoice{Number: "R-1", Amount: 10, Note: "draft"}
+		after := map[string]interface{}{"number": "R-1", "amount": 12.5, "paid": false, "dueDate": "2020-06-01"}
+		changes, err := Diff(before, after)
+		require.NoError(t, err)
+		assert.Equal(t, []Change{
+			{Field: "amount", Before: float64(10), After: 12.5},
+			{Field: "dueDate", After: "2020-06-01"},
+			{Field: "note", Before: "draft"},
+		}, changes)
+	})
+
+	t.Run("created resource", func(t *testing.T) {
+		changes, err := Diff(nil, invoice{Number: "R-2", Amount: 5})
+		require.NoError(t, err)
+		assert.Len(t, changes, 3)
+	})
+
+	t.Run("values that are not objects", func(t *testing.T) {
+		_, err := Diff("before", "after")
+		assert.Error(t, err)
+	})
+}
+
+func TestAuditor(t *testing.T) {
+	t.Run("fills the entry from the context", func(t *testing.T) {
+		sink := &sinkStub{}
+		auditor := New(sink, observance.NewTestLogger(), Config{})
+		ctx := observance.ContextWithRequestID(ContextWithActor(context.Background(), "user-1"), "testRequestId")
+
+		require.NoError(t, auditor.RecordChange(ctx, "update", "invoice", "42", invoice{Amount: 1}, invoice{Amount: 2}))
+		require.NoError(t, auditor.Flush(context.Background()))
+
+		entries := sink.Entries()
+		require.Len(t, entries, 1)
+		assert.Equal(t, "user-1", entries[0].Actor)
+		assert.Equal(t, "testRequestId", entries[0].RequestID)
+		assert.Equal(t, "update", entries[0].Action)
+		assert.Equal(t, "42", entries[0].ResourceID)
+		assert.Equal(t, []Change{{Field: "amount", Before: float64(1), After: float64(2)}}, entries[0].Changes)
+		assert.WithinDuration(t, time.Now(), entries[0].Time, time.Minute)
+		require.NoError(t, auditor.Close(context.Background()))
+	})
+
+	t.Run("writes in batches in the background", func(t *testing.T) {
+		sink := &sinkStub{}
+		auditor := New(sink, observance.NewTestLogger(), Config{BatchSize: 2, FlushInterval: time.Hour})
+		for i := 0; i < 5; i++ {
+			auditor.Record(context.Background(), Entry{Action: "create", Resource: "invoice"})
+		}
+		assert.Eventually(t, func() bool { return len(sink.Entries()) == 4 }, time.Second, time.Millisecond)
+		require.NoError(t, auditor.Close(context.Background()))
+		assert.Len(t, sink.Entries(), 5)
+		assert.Equal(t, []int{2, 2, 1}, sink.Batches())
+	})
+
+	t.Run("failed writes are retried and delivered on close", func(t *testing.T) {
+		sink := &sinkStub{failures: 2}
+		logger := observance.NewTestLogger()
+		auditor := New(sink, logger, Config{FlushInterval: time.Millisecond})
+		auditor.Record(context.Background(), Entry{Action: "delete", Resource: "invoice"})
+		assert.Eventually(t, func() bool { return len(logger.Entries()) > 0 }, time.Second, time.Millisecond)
+		logger.AssertLogged(t, "warn", "failed to write audit entries", observance.Fields{"pending": 1})
+
+		require.NoError(t, auditor.Close(context.Background()))
+		assert.Len(t, sink.Entries(), 1)
+	})
+
+	t.Run("entries are logged if they can not be delivered", func(t *testing.T) {
+		sink := &sinkStub{failures: 1000}
+		logger := observance.NewTestLogger()
+		auditor := New(sink, logger, Config{FlushInterval: time.Hour})
+		auditor.Record(context.Background(), Entry{Actor: "user-1", Action: "delete", Resource: "invoice"})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		err := auditor.Close(ctx)
+		assert.EqualError(t, err, "1 audit entries could not be written to the sink: context deadline exceeded")
+		logger.AssertLogged(t, "error", "audit entry could not be written to the sink", nil)
+		assert.Contains(t, logger.LastEntry().Data["audit"], `"actor":"user-1"`)
+
+		// Entries recorded after closing are logged as well.
+		auditor.Record(context.Background(), Entry{Action: "late"})
+		assert.Contains(t, logger.LastEntry().Data["audit"], `"action":"late"`)
+	})
+
+	t.Run("close does not wait for a stuck sink", func(t *testing.T) {
+		sink := &blockingSink{started: make(chan struct{}), canceled: make(chan struct{})}
+		logger := observance.NewTestLogger()
+		auditor := New(sink, logger, Config{BatchSize: 1})
+		auditor.Record(context.Background(), Entry{Action: "first"})
+		<-sink.started
+		auditor.Record(context.Background(), Entry{Action: "second"})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		err := auditor.Close(ctx)
+		assert.EqualError(t, err, "audit writer did not stop, the queued entries were logged: context deadline exceeded")
+		assert.Contains(t, logger.LastEntry().Data["audit"], `"action":"second"`)
+
+		// The write of the sink is canceled and its entries are logged when it returns.
+		<-sink.canceled
+		assert.Eventually(t, func() bool {
+			audit, _ := logger.LastEntry().Data["audit"].(string)
+			return strings.Contains(audit, `"action":"first"`)
+		}, time.Second, time.Millisecond)
+	})
+
+	t.Run("pending entries are limited", func(t *testing.T) {
+		sink := &sinkStub{failures: 1000}
+		auditor := New(sink, observance.NewTestLogger(), Config{QueueSize: 1, BatchSize: 1, MaxPending: 2, FlushInterval: time.Millisecond})
+		for i := 0; i < 3; i++ {
+			auditor.Record(context.Background(), Entry{Action: "create"})
+		}
+
+		recorded := make(chan struct{})
+		go func() {
+			auditor.Record(context.Background(), Entry{Action: "create"})
+			close(recorded)
+		}()
+		select {
+		case <-recorded:
+			t.Fatal("entry was taken from the queue although too many are pending")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		sink.mutex.Lock()
+		sink.failures = 0
+		sink.mutex.Unlock()
+		<-recorded
+		require.NoError(t, auditor.Close(context.Background()))
+		assert.Len(t, sink.Entries(), 4)
+	})
+	t.Run("close is not blocked by a waiting record", func(t *testing.T) {
+		logger := observance.NewTestLogger()
+		auditor := New(&sinkStub{failures: 1000}, logger, Config{QueueSize: 1, BatchSize: 1, MaxPending: 1, FlushInterval: time.Millisecond})
+		for i := 0; i < 2; i++ {
+			auditor.Record(context.Background(), Entry{Action: "create"})
+		}
+		recorded := make(chan struct{})
+		go func() {
+			auditor.Record(context.Background(), Entry{Action: "update"})
+			close(recorded)
+		}()
+		time.Sleep(20 * time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		closed := make(chan error)
+		go func() { closed <- auditor.Close(ctx) }()
+		select {
+		case err := <-closed:
+			assert.Error(t, err)
+		case <-time.After(2 * time.Second):
+			t.Fatal("close did not return")
+		}
+		<-recorded
+		logger.AssertLogged(t, "error", "audit entry could not be written to the sink", nil)
+	})
+
+	t.Run("record gives up when the context is done", func(t *testing.T) {
+		logger := observance.NewTestLogger()
+		auditor := New(&sinkStub{failures: 1000}, logger, Config{QueueSize: 1, BatchSize: 1, MaxPending: 1, FlushInterval: time.Millisecond})
+		for i := 0; i < 2; i++ {
+			auditor.Record(context.Background(), Entry{Action: "create"})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		auditor.Record(ctx, Entry{Action: "update"})
+		logger.AssertLogged(t, "error", "audit entry could not be written to the sink", nil)
+		assert.Contains(t, logger.LastEntry().Data["audit"], `"action":"update"`)
+
+		closeCtx, cancelClose := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancelClose()
+		assert.Error(t, auditor.Close(closeCtx))
+	})
+
+}
+
+// blockingSink blocks until the context is canceled.
+type blockingSink struct {
+	started  chan struct{}
+	canceled chan struct{}
+	once     sync.Once
+}
+
+func (s *blockingSink) Write(ctx context.Context, entries []Entry) error {
+	s.once.Do(func() { close(s.started) })
+	<-ctx.Done()
+	close(s.canceled)
+	return ctx.Err()
+}
+
+func TestSinks(t *testing.T) {
+	entry := Entry{
+		Time:       time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC),
+		Actor:      "user-1",
+		Action:     "update",
+		Resource:   "invoice",
+		ResourceID: "42",
+		RequestID:  "testRequestId",
+		Changes:    []Change{{Field: "paid", Before: false, After: true}},
+	}
+
+	t.Run("file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "audit.log")
+		sink, err := NewFileSink(path)
+		require.NoError(t, err)
+		require.NoError(t, sink.Write(context.Background(), []Entry{entry, entry}))
+
+		content, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+		require.Len(t, lines, 2)
+		assert.JSONEq(t, `{
+			"time": "2020-06-01T12:00:00Z",
+			"actor": "user-1",
+			"action": "update",
+			"resource": "invoice",
+			"resourceId": "42",
+			"requestId": "testRequestId",
+			"changes": [{"field": "paid", "before": false, "after": true}]
+		}`, lines[0])
+	})
+
+	t.Run("logger", func(t *testing.T) {
+		logger := observance.NewTestLogger()
+		require.NoError(t, NewLoggerSink(logger).Write(context.Background(), []Entry{entry}))
+		logger.AssertLogged(t, "info", "audit: update invoice", observance.Fields{
+			"audit":      true,
+			"actor":      "user-1",
+			"resourceId": "42",
+			"requestId":  "testRequestId",
+		})
+	})
+
+	t.Run("database", func(t *testing.T) {
+		sqlDB, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		db, err := gorm.Open("mysql", sqlDB)
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO `audit_logs`").
+			WithArgs(entry.Time, "user-1", "update", "invoice", "42", "testRequestId", `[{"field":"paid","before":false,"after":true}]`).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		require.NoError(t, NewDBSink(db).Write(context.Background(), []Entry{entry}))
+		require.NoError(t, mock.ExpectationsWereMet())
+
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO `audit_logs`").WillReturnError(errors.New("connection lost"))
+		mock.ExpectRollback()
+		err = NewDBSink(db).Write(context.Background(), []Entry{entry})
+		assert.EqualError(t, err, "could not insert audit entry: connection lost")
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestMigrations(t *testing.T) {
+	for _, dialect := range []string{"mysql", "postgres"} {
+		source, err := migrationSource(dialect)
+		require.NoError(t, err)
+		version, err := source.First()
+		require.NoError(t, err)
+		assert.Equal(t, uint(1), version)
+
+		up, _, err := source.ReadUp(version)
+		require.NoError(t, err)
+		content, err := ioutil.ReadAll(up)
+		require.NoError(t, err)
+		assert.Contains(t, string(content), "audit_logs")
+	}
+
+	_, err := migrationSource("sqlite")
+	assert.EqualError(t, err, `no audit migrations for dialect "sqlite"`)
+}
+
+func TestMiddleware(t *testing.T) {
+	sink := &sinkStub{}
+	auditor := New(sink, observance.NewTestLogger(), Config{})
+	obs := &observance.Obs{Logger: observance.NewTestLogger()}
+
+	app := fiber.New()
+	app.Use(server.Tracing(obs))
+	app.Use(func(c *fiber.Ctx) {
+		c.Locals("userId", 7)
+		c.Next()
+	})
+	app.Use(Middleware(ActorFromLocals("userId")))
+	app.Post("/invoices", func(c *fiber.Ctx) {
+		auditor.Record(server.RequestContext(c), Entry{Action: "create", Resource: "invoice"})
+		c.SendStatus(http.StatusCreated)
+	})
+
+	req := httptest.NewRequest("POST", "/invoices", bytes.NewBufferString("{}"))
+	req.Header.Set(fiber.HeaderXRequestID, "testRequestId")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.NoError(t, auditor.Close(context.Background()))
+
+	entries := sink.Entries()
+	require.Len(t, entries, 1)
+	assert.Equal(t, "7", entries[0].Actor)
+	assert.Equal(t, "testRequestId", entries[0].RequestID)
+}
+
+// sinkStub records the written entries, the first writes fail if failures is set.
+type sinkStub struct {
+	entries  []Entry
+	batches  []int
+	failures int
+	mutex    sync.Mutex
+}
+
+func (s *sinkStub) Write(ctx context.Context, entries []Entry) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("sink not available")
+	}
+	// Copy the entries to make sure the auditor does not rely on the slice after writing.
+	encoded, _ := json.Marshal(entries)
+	copied := []Entry{}
+	_ = json.Unmarshal(encoded, &copied)
+	s.entries = append(s.entries, copied...)
+	s.batches = append(s.batches, len(entries))
+	return nil
+}
+
+func (s *sinkStub) Entries() []Entry {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.entries
+}
+
+func (s *sinkStub) Batches() []int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.batches
+}
@@ -0,0 +1,34 @@
+package audit
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber"
+	"toolkit/app/core/server"
+)
+
+// Middleware stores the actor returned by the given function in the request context (see server.RequestContext),
+// so all entries recorded with that context contain the actor. It needs to be applied after the authentication.
+func Middleware(actor func(c *fiber.Ctx) string) func(*fiber.Ctx) {
+	return func(c *fiber.Ctx) {
+		if name := actor(c); name != "" {
+			server.SetRequestContext(c, ContextWithActor(server.RequestContext(c), name))
+		}
+		c.Next()
+	}
+}
+
+// ActorFromLocals can be used with Middleware to read the actor from the Fiber locals that were set by the authentication.
+// Strings are used as they are, other values are formatted with fmt.Sprint (e.g. numeric user IDs or fmt.Stringer).
+func ActorFromLocals(key string) func(c *fiber.Ctx) string {
+	return func(c *fiber.Ctx) string {
+		switch value := c.Locals(key).(type) {
+		case nil:
+			return ""
+		case string:
+			return value
+		default:
+			return fmt.Sprint(value)
+		}
+	}
+}
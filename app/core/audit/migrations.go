@@ -0,0 +1,98 @@
+package audit
+
+import (
+	"fmt"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/source"
+	bindata "github.com/golang-migrate/migrate/v4/source/go_bindata"
+	"github.com/pkg/errors"
+	"toolkit/app/core/database"
+)
+
+// MigrationsTable is the table in which the version of the audit migrations is stored.
+// It is separate from the migrations table of the service so the version numbers do not collide.
+const MigrationsTable = "audit_schema_migrations"
+
+// migrations contains the bundled migrations per dialect.
+var migrations = map[string]map[string]string{
+	database.DialectMysql: {
+		"1_create_audit_logs.up.sql": "CREATE TABLE IF NOT EXISTS `audit_logs` (\n" +
+			"  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,\n" +
+			"  `created_at` DATETIME(6) NOT NULL,\n" +
+			"  `actor` VARCHAR(255) NOT NULL,\n" +
+			"  `action` VARCHAR(255) NOT NULL,\n" +
+			"  `resource` VARCHAR(255) NOT NULL,\n" +
+			"  `resource_id` VARCHAR(255) NOT NULL,\n" +
+			"  `request_id` VARCHAR(255) NOT NULL,\n" +
+			"  `changes` LONGTEXT NOT NULL,\n" +
+			"  PRIMARY KEY (`id`),\n" +
+			"  INDEX `audit_logs_resource` (`resource`, `resource_id`),\n" +
+			"  INDEX `audit_logs_actor` (`actor`)\n" +
+			") ENGINE = InnoDB;\n",
+		"1_create_audit_logs.down.sql": "DROP TABLE IF EXISTS `audit_logs`;\n",
+	},
+	database.DialectPostgres: {
+		"1_create_audit_logs.up.sql": "CREATE TABLE IF NOT EXISTS audit_logs (\n" +
+			"  id BIGSERIAL PRIMARY KEY,\n" +
+			"  created_at TIMESTAMP WITH TIME ZONE NOT NULL,\n" +
+			"  actor VARCHAR(255) NOT NULL,\n" +
+			"  action VARCHAR(255) NOT NULL,\n" +
+			"  resource VARCHAR(255) NOT NULL,\n" +
+			"  resource_id VARCHAR(255) NOT NULL,\n" +
+			"  request_id VARCHAR(255) NOT NULL,\n" +
+			"  changes TEXT NOT NULL\n" +
+			");\n" +
+			"CREATE INDEX IF NOT EXISTS audit_logs_resource ON audit_logs (resource, resource_id);\n" +
+			"CREATE INDEX IF NOT EXISTS audit_logs_actor ON audit_logs (actor);\n",
+		"1_create_audit_logs.down.sql": "DROP TABLE IF EXISTS audit_logs;\n",
+	},
+}
+
+// EnsureMigrations creates or updates the audit table with the migrations bundled in this package.
+func EnsureMigrations(config database.Config) (returnErr error) {
+	sourceDriver, err := migrationSource(config.Dialect)
+	if err != nil {
+		return err
+	}
+
+	databaseURL := config.Dialect + "://" + config.MigrationURL() + "&x-migrations-table=" + MigrationsTable
+	m, err := migrate.NewWithSourceInstance("go-bindata", sourceDriver, databaseURL)
+	if err != nil {
+		return errors.Wrap(err, "could not set up audit migrations")
+	}
+
+	defer func() {
+		sErr, dErr := m.Close()
+		if sErr != nil && returnErr == nil {
+			returnErr = sErr
+		}
+		if dErr != nil && returnErr == nil {
+			returnErr = dErr
+		}
+	}()
+
+	err = m.Up()
+	if err != nil && err != migrate.ErrNoChange {
+		return errors.Wrap(err, "audit migrations failed")
+	}
+	return nil
+}
+
+func migrationSource(dialect string) (source.Driver, error) {
+	files, ok := migrations[dialect]
+	if !ok {
+		return nil, fmt.Errorf("no audit migrations for dialect %q", dialect)
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	return bindata.WithInstance(bindata.Resource(names, func(name string) ([]byte, error) {
+		content, ok := files[name]
+		if !ok {
+			return nil, fmt.Errorf("audit migration %q not found", name)
+		}
+		return []byte(content), nil
+	}))
+}
@@ -0,0 +1,147 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+	"toolkit/app/core/observance"
+)
+
+// Sink is the destination the audit entries are written to.
+type Sink interface {
+	Write(ctx context.Context, entries []Entry) error
+}
+
+// TableName is the name of the table the DBSink writes to. It is created by the bundled migrations (see EnsureMigrations).
+const TableName = "audit_logs"
+
+// DBSink writes the entries to the audit table.
+type DBSink struct {
+	db *gorm.DB
+}
+
+// NewDBSink creates a new sink that inserts the entries into the audit table using the given DB connection.
+func NewDBSink(db *gorm.DB) *DBSink {
+	return &DBSink{db: db}
+}
+
+// auditLog is the row of the audit table.
+type auditLog struct {
+	ID         uint64 `gorm:"primary_key"`
+	CreatedAt  time.Time
+	Actor      string
+	Action     string
+	Resource   string
+	ResourceID string
+	RequestID  string
+	Changes    string
+}
+
+func (auditLog) TableName() string {
+	return TableName
+}
+
+// Write inserts all entries in one transaction.
+func (s *DBSink) Write(ctx context.Context, entries []Entry) error {
+	rows := make([]auditLog, 0, len(entries))
+	for _, entry := range entries {
+		changes, err := json.Marshal(entry.Changes)
+		if err != nil {
+			return errors.Wrap(err, "could not encode audit changes")
+		}
+		rows = append(rows, auditLog{
+			CreatedAt:  entry.Time,
+			Actor:      entry.Actor,
+			Action:     entry.Action,
+			Resource:   entry.Resource,
+			ResourceID: entry.ResourceID,
+			RequestID:  entry.RequestID,
+			Changes:    string(changes),
+		})
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for i := range rows {
+			if err := tx.Create(&rows[i]).Error; err != nil {
+				return errors.Wrap(err, "could not insert audit entry")
+			}
+		}
+		return nil
+	})
+}
+
+// WriterSink writes the entries as JSON lines to the given writer.
+type WriterSink struct {
+	writer io.Writer
+	mutex  sync.Mutex
+}
+
+// NewWriterSink creates a new sink that writes one JSON object per entry to the writer.
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{writer: w}
+}
+
+// NewFileSink creates a new sink that appends one JSON object per entry to the file with the given path.
+func NewFileSink(path string) (*WriterSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not open file for audit log")
+	}
+	return NewWriterSink(file), nil
+}
+
+// Write writes the entries to the writer. If the writer is a file, it is synced to disk afterwards.
+func (s *WriterSink) Write(ctx context.Context, entries []Entry) error {
+	buffer := bytes.Buffer{}
+	encoder := json.NewEncoder(&buffer)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, err := s.writer.Write(buffer.Bytes()); err != nil {
+		return err
+	}
+	if file, ok := s.writer.(*os.File); ok {
+		return file.Sync()
+	}
+	return nil
+}
+
+// LoggerSink writes every entry as log message with level info.
+type LoggerSink struct {
+	logger observance.Logger
+}
+
+// NewLoggerSink creates a new sink that writes to the logger. All fields of the entry are added as log fields,
+// the field "audit" is always true so the entries can be filtered in the log management.
+func NewLoggerSink(logger observance.Logger) *LoggerSink {
+	return &LoggerSink{logger: logger}
+}
+
+// Write logs the entries.
+func (s *LoggerSink) Write(ctx context.Context, entries []Entry) error {
+	for _, entry := range entries {
+		s.logger.WithFields(observance.Fields{
+			"audit":      true,
+			"occurredAt": entry.Time.Format(time.RFC3339Nano),
+			"actor":      entry.Actor,
+			"action":     entry.Action,
+			"resource":   entry.Resource,
+			"resourceId": entry.ResourceID,
+			"requestId":  entry.RequestID,
+			"changes":    entry.Changes,
+		}).Info("audit: " + entry.Action + " " + entry.Resource)
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package cache
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type batchOperation int
+
+const (
+	batchSet batchOperation = iota
+	batchGet
+	batchIncr
+	batchDel
+	batchExpire
+)
+
+// Batcher is implemented by caches that can execute a Batch in one round trip, see ExecBatch.
+type Batcher interface {
+	// Exec executes the commands of the batch. It returns the first error except ErrNotFound,
+	// the result of every command is available via its BatchResult.
+	Exec(ctx context.Context, batch *Batch) error
+}
+
+// ExecBatch executes the batch with Exec if the cache implements Batcher. Otherwise, e.g. for mocks,
+// the commands are executed one by one via the methods of the Cache interface, transactions are not supported then.
+func ExecBatch(ctx context.Context, cache Cache, batch *Batch) error {
+	if batcher, ok := cache.(Batcher); ok {
+		return batcher.Exec(ctx, batch)
+	}
+	if batch.transaction {
+		return errors.New("cache does not support transactions")
+	}
+
+	for _, command := range batch.commands {
+		switch command.operation {
+		case batchSet:
+			command.err = cache.Set(ctx, command.key, command.value, command.expiration)
+		case batchGet:
+			command.result, command.err = cache.Get(ctx, command.key)
+		case batchIncr:
+			var value int64
+			value, command.err = cache.Incr(ctx, command.key)
+			command.result = strconv.FormatInt(value, 10)
+		case batchDel:
+			command.err = cache.Del(ctx, command.key)
+		case batchExpire:
+			// Not atomic, the value could be changed in between.
+			var value string
+			value, command.err = cache.Get(ctx, command.key)
+			if command.err == nil {
+				if command.expiration <= 0 {
+					command.err = cache.Del(ctx, command.key)
+				} else {
+					command.err = cache.Set(ctx, command.key, value, command.expiration)
+				}
+			}
+		}
+	}
+	return batch.err()
+}
+
+// Batch collects commands that are sent to the cache together via ExecBatch, so they only need one round trip.
+// The prefix of the cache is applied to all keys. The results are available after Exec returned.
+type Batch struct {
+	transaction bool
+	commands    []*BatchResult
+}
+
+// NewBatch creates a Batch whose commands are sent in one pipeline. Other clients can run commands in between.
+func NewBatch() *Batch {
+	return &Batch{}
+}
+
+// NewTransaction creates a Batch whose commands are executed atomically (MULTI/EXEC in REDIS).
+// With REDIS Cluster all keys of a transaction must be in the same slot, see HashTag.
+func NewTransaction() *Batch {
+	return &Batch{transaction: true}
+}
+
+// Set adds a command that saves a key value pair. Zero expiration means the key has no expiration time.
+func (b *Batch) Set(key string, value string, expiration time.Duration) *BatchResult {
+	return b.add(&BatchResult{operation: batchSet, key: key, value: value, expiration: expiration})
+}
+
+// Get adds a command that retrieves a value. The result is ErrNotFound if the key does not exist.
+func (b *Batch) Get(key string) *BatchResult {
+	return b.add(&BatchResult{operation: batchGet, key: key})
+}
+
+// Incr adds a command that increments a value, the result contains the new value.
+func (b *Batch) Incr(key string) *BatchResult {
+	return b.add(&BatchResult{operation: batchIncr, key: key})
+}
+
+// Del adds a command that deletes a key.
+func (b *Batch) Del(key string) *BatchResult {
+	return b.add(&BatchResult{operation: batchDel, key: key})
+}
+
+// Expire adds a command that sets the expiration time of a key, the key is deleted if it is not positive.
+// The result is ErrNotFound if the key does not exist.
+func (b *Batch) Expire(key string, expiration time.Duration) *BatchResult {
+	return b.add(&BatchResult{operation: batchExpire, key: key, expiration: expiration})
+}
+
+// Len returns the number of commands in the batch.
+func (b *Batch) Len() int {
+	return len(b.commands)
+}
+
+func (b *Batch) add(result *BatchResult) *BatchResult {
+	b.commands = append(b.commands, result)
+	return result
+}
+
+// err returns the first error of the commands except ErrNotFound, since misses are reported per command.
+func (b *Batch) err() error {
+	for _, command := range b.commands {
+		if command.err != nil && command.err != ErrNotFound {
+			return command.err
+		}
+	}
+	return nil
+}
+
+// BatchResult holds the result of a command in a Batch after it was executed.
+type BatchResult struct {
+	operation  batchOperation
+	key        string
+	value      string
+	expiration time.Duration
+	result     string
+	err        error
+}
+
+// Key returns the key of the command without prefix.
+func (r *BatchResult) Key() string {
+	return r.key
+}
+
+// Err returns the error of the command.
+func (r *BatchResult) Err() error {
+	return r.err
+}
+
+// Result returns the value returned by Get or Incr.
+func (r *BatchResult) Result() (string, error) {
+	return r.result, r.err
+}
+
+// Int returns the value returned by Get or Incr as integer.
+func (r *BatchResult) Int() (int64, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	return strconv.ParseInt(r.result, 10, 64)
+}
+
+// writes returns whether the command changes the value of the key.
+func (r *BatchResult) writes() bool {
+	return r.operation != batchGet
+}
+
+// decodeJSONMany parses the values into result which must be a pointer to a slice or to a map with string keys.
+// A slice gets one element per key in the same order, the elements of missing keys keep their zero value.
+// A map only gets entries for the keys that were found. It returns the missing keys.
+func decodeJSONMany(encoding Encoding, keys []string, values map[string]string, result interface{}) ([]string, error) {
+	target := reflect.ValueOf(result)
+	if target.Kind() != reflect.Ptr || target.IsNil() {
+		return nil, errors.New("result must be a pointer to a slice or map")
+	}
+	target = target.Elem()
+
+	switch {
+	case target.Kind() == reflect.Slice:
+		target.Set(reflect.MakeSlice(target.Type(), len(keys), len(keys)))
+	case target.Kind() == reflect.Map && target.Type().Key().Kind() == reflect.String:
+		if target.IsNil() {
+			target.Set(reflect.MakeMapWithSize(target.Type(), len(values)))
+		}
+	default:
+		return nil, errors.Errorf("result must be a pointer to a slice or map with string keys, got %s", target.Type())
+	}
+
+	missing := []string{}
+	for i, key := range keys {
+		value, ok := values[key]
+		if !ok {
+			missing = append(missing, key)
+			continue
+		}
+
+		// Elements that are pointers, e.g. protobuf messages, are decoded into a new value directly.
+		elementType := target.Type().Elem()
+		var element reflect.Value
+		if elementType.Kind() == reflect.Ptr {
+			element = reflect.New(elementType.Elem())
+		} else {
+			element = reflect.New(elementType)
+		}
+		if err := encoding.Decode(value, element.Interface()); err != nil {
+			return nil, errors.Wrapf(err, "could not parse value of key %q", key)
+		}
+		if elementType.Kind() != reflect.Ptr {
+			element = element.Elem()
+		}
+		if target.Kind() == reflect.Slice {
+			target.Index(i).Set(element)
+		} else {
+			target.SetMapIndex(reflect.ValueOf(key).Convert(target.Type().Key()), element)
+		}
+	}
+	return missing, nil
+}
@@ -0,0 +1,219 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"toolkit/app/core/observance"
+)
+
+// withBatchCaches runs the test with all Cache implementations that support batches.
+func withBatchCaches(t *testing.T, fn func(t *testing.T, c Cache, ttl func(key string) time.Duration)) {
+	t.Run("redis", func(t *testing.T) {
+		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
+			fn(t, client, func(key string) time.Duration { return redis.TTL("testPrefix:" + key) })
+		})
+	})
+
+	t.Run("memory", func(t *testing.T) {
+		memory := NewMemory(MemoryConfig{Prefix: "testPrefix"})
+		fn(t, memory, func(key string) time.Duration {
+			ttl, _ := memory.TTL(context.Background(), key)
+			return ttl.Round(time.Second)
+		})
+	})
+
+	t.Run("near", func(t *testing.T) {
+		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
+			near, err := NewNear(client, observance.NewTestMeasurer(), observance.NewTestLogger(), NearConfig{})
+			require.NoError(t, err)
+			defer near.Close()
+			fn(t, near, func(key string) time.Duration { return redis.TTL("testPrefix:" + key) })
+		})
+	})
+}
+
+func TestMultiKeyOperations(t *testing.T) {
+	ctx := context.Background()
+
+	withBatchCaches(t, func(t *testing.T, c Cache, ttl func(key string) time.Duration) {
+		require.NoError(t, c.MSet(ctx, map[string]string{"a": "1", "b": "2", "c": "3"}, time.Minute))
+		assert.Equal(t, time.Minute, ttl("b"))
+
+		values, err := c.MGet(ctx, "a", "missing", "c")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"a": "1", "c": "3"}, values)
+
+		values, err = c.MGet(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, values)
+
+		require.NoError(t, c.DelMany(ctx, "a", "b", "missing"))
+		values, err = c.MGet(ctx, "a", "b", "c")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"c": "3"}, values)
+	})
+}
+
+func TestMGetJSON(t *testing.T) {
+	ctx := context.Background()
+
+	withBatchCaches(t, func(t *testing.T, c Cache, _ func(key string) time.Duration) {
+		require.NoError(t, c.SetJSON(ctx, "user:1", testUser{Name: "one"}, 0))
+		require.NoError(t, c.SetJSON(ctx, "user:3", testUser{Name: "three"}, 0))
+		keys := []string{"user:1", "user:2", "user:3"}
+
+		users := []testUser{}
+		missing, err := c.MGetJSON(ctx, keys, &users)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"user:2"}, missing)
+		assert.Equal(t, []testUser{{Name: "one"}, {}, {Name: "three"}}, users)
+
+		pointers := []*testUser{}
+		_, err = c.MGetJSON(ctx, keys, &pointers)
+		require.NoError(t, err)
+		assert.Equal(t, "one", pointers[0].Name)
+		assert.Nil(t, pointers[1])
+
+		userMap := map[string]testUser{}
+		missing, err = c.MGetJSON(ctx, keys, &userMap)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"user:2"}, missing)
+		assert.Equal(t, map[string]testUser{"user:1": {Name: "one"}, "user:3": {Name: "three"}}, userMap)
+
+		_, err = c.MGetJSON(ctx, keys, users)
+		assert.EqualError(t, err, "result must be a pointer to a slice or map")
+		_, err = c.MGetJSON(ctx, keys, &testUser{})
+		assert.Error(t, err)
+
+		require.NoError(t, c.Set(ctx, "user:2", "invalid", 0))
+		_, err = c.MGetJSON(ctx, keys, &users)
+		assert.Contains(t, err.Error(), `could not parse value of key "user:2"`)
+	})
+}
+
+func TestExecBatch(t *testing.T) {
+	ctx := context.Background()
+
+	for name, newBatch := range map[string]func() *Batch{"pipeline": NewBatch, "transaction": NewTransaction} {
+		newBatch := newBatch
+		t.Run(name, func(t *testing.T) {
+			withBatchCaches(t, func(t *testing.T, c Cache, ttl func(key string) time.Duration) {
+				require.NoError(t, c.Set(ctx, "existing", "value", 0))
+				require.NoError(t, c.Set(ctx, "deleted", "value", 0))
+
+				batch := newBatch()
+				set := batch.Set("key", "value", time.Minute)
+				get := batch.Get("key")
+				missing := batch.Get("missing")
+				incr := batch.Incr("counter")
+				del := batch.Del("deleted")
+				expire := batch.Expire("existing", time.Hour)
+				expireMissing := batch.Expire("missing", time.Hour)
+				assert.Equal(t, 7, batch.Len())
+
+				require.NoError(t, ExecBatch(ctx, c, batch))
+				assert.NoError(t, set.Err())
+				result, err := get.Result()
+				require.NoError(t, err)
+				assert.Equal(t, "value", result)
+				assert.Equal(t, "key", get.Key())
+				assert.Equal(t, ErrNotFound, missing.Err())
+				counter, err := incr.Int()
+				require.NoError(t, err)
+				assert.Equal(t, int64(1), counter)
+				assert.NoError(t, del.Err())
+				assert.NoError(t, expire.Err())
+				assert.Equal(t, ErrNotFound, expireMissing.Err())
+
+				assert.Equal(t, time.Minute, ttl("key"))
+				assert.Equal(t, time.Hour, ttl("existing"))
+				_, err = c.Get(ctx, "deleted")
+				assert.Equal(t, ErrNotFound, err)
+			})
+		})
+	}
+
+	t.Run("returns the first error", func(t *testing.T) {
+		withBatchCaches(t, func(t *testing.T, c Cache, _ func(key string) time.Duration) {
+			require.NoError(t, c.Set(ctx, "text", "value", 0))
+			batch := NewBatch()
+			incr := batch.Incr("text")
+			set := batch.Set("key", "value", 0)
+			assert.Error(t, ExecBatch(ctx, c, batch))
+			assert.Error(t, incr.Err())
+			assert.NoError(t, set.Err())
+		})
+	})
+
+	t.Run("near cache invalidates written keys", func(t *testing.T) {
+		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
+			near, err := NewNear(client, observance.NewTestMeasurer(), observance.NewTestLogger(), NearConfig{})
+			require.NoError(t, err)
+			defer near.Close()
+
+			require.NoError(t, near.Set(ctx, "key", "old", 0))
+			_, err = near.Get(ctx, "key")
+			require.NoError(t, err)
+			batch := NewBatch()
+			batch.Set("key", "new", 0)
+			require.NoError(t, ExecBatch(ctx, near, batch))
+			result, err := near.Get(ctx, "key")
+			require.NoError(t, err)
+			assert.Equal(t, "new", result)
+		})
+	})
+
+}
+
+func TestNearCacheMGet(t *testing.T) {
+	ctx := context.Background()
+	withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
+		metrics := observance.NewTestMeasurer()
+		near, err := NewNear(client, metrics, observance.NewTestLogger(), NearConfig{})
+		require.NoError(t, err)
+		defer near.Close()
+
+		require.NoError(t, redis.Set("testPrefix:a", "1"))
+		require.NoError(t, redis.Set("testPrefix:b", "2"))
+		_, err = near.Get(ctx, "a")
+		require.NoError(t, err)
+
+		values, err := near.MGet(ctx, "a", "b", "c")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"a": "1", "b": "2"}, values)
+		metrics.AssertCounter(t, MetricNearLocalRequests, observance.Labels{"cache": "", "result": ResultHit}, 1)
+		metrics.AssertCounter(t, MetricNearLocalRequests, observance.Labels{"cache": "", "result": ResultMiss}, 3)
+
+		// b is served locally now, so changes in REDIS are not seen until the local TTL expired.
+		require.NoError(t, redis.Set("testPrefix:b", "changed"))
+		values, err = near.MGet(ctx, "b")
+		require.NoError(t, err)
+		assert.Equal(t, "2", values["b"])
+
+		require.NoError(t, near.MSet(ctx, map[string]string{"b": "3"}, 0))
+		values, err = near.MGet(ctx, "b")
+		require.NoError(t, err)
+		assert.Equal(t, "3", values["b"])
+	})
+}
+
+func TestMGetCluster(t *testing.T) {
+	server, err := miniredis.Run()
+	require.NoError(t, err)
+	defer server.Close()
+
+	client, err := NewRedisWithConfig(Config{Mode: ModeCluster, Addrs: []string{server.Addr()}})
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx := context.Background()
+	require.NoError(t, client.MSet(ctx, map[string]string{"a": "1", "b": "2"}, 0))
+	values, err := client.MGet(ctx, "a", "b", "c")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "1", "b": "2"}, values)
+}
@@ -1,9 +1,10 @@
 package cache
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v7"
@@ -17,27 +18,36 @@ var (
 )
 
 // Cache defines basic cache operations including methods for setting and getting JSON objects.
+// All operations take a context so they are canceled together with the request and can create trace spans.
 type Cache interface {
 	Prefix() string
-	Set(key string, value string, expiration time.Duration) error
-	Get(key string) (string, error)
-	SetBool(key string, value bool, expiration time.Duration) error
-	GetBool(key string) (bool, error)
-	SetInt(key string, value int64, expiration time.Duration) error
-	GetInt(key string) (int64, error)
-	Incr(key string) (int64, error)
-	SetJSON(key string, value interface{}, expiration time.Duration) error
-	GetJSON(key string, result interface{}) error
-	Del(key string) error
+	Set(ctx context.Context, key string, value string, expiration time.Duration) error
+	Get(ctx context.Context, key string) (string, error)
+	SetBool(ctx context.Context, key string, value bool, expiration time.Duration) error
+	GetBool(ctx context.Context, key string) (bool, error)
+	SetInt(ctx context.Context, key string, value int64, expiration time.Duration) error
+	GetInt(ctx context.Context, key string) (int64, error)
+	Incr(ctx context.Context, key string) (int64, error)
+	SetJSON(ctx context.Context, key string, value interface{}, expiration time.Duration) error
+	GetJSON(ctx context.Context, key string, result interface{}) error
+	Del(ctx context.Context, key string) error
 	Close() error
-	TTL(key string) (time.Duration, error)
+	TTL(ctx context.Context, key string) (time.Duration, error)
+	// MGet returns the values of all keys that were found, missing keys are not contained in the result.
+	MGet(ctx context.Context, keys ...string) (map[string]string, error)
+	MSet(ctx context.Context, values map[string]string, expiration time.Duration) error
+	// MGetJSON parses the values into a pointer to a slice or map and returns the keys that were not found.
+	MGetJSON(ctx context.Context, keys []string, result interface{}) ([]string, error)
+	DelMany(ctx context.Context, keys ...string) error
 }
 
 // RedisClient wraps the REDIS client to provide an implementation of the Cache interface.
 // It allows defining a prefix that is applied to the key for all operations (optional).
+// Depending on the Mode in the config, Redis is a standalone, Sentinel (failover) or Cluster client.
 type RedisClient struct {
-	prefix string
-	Redis  *redis.Client
+	prefix   string
+	encoding Encoding
+	Redis    redis.UniversalClient
 }
 
 // Prefix returns the prefix string that was defined for the REDIS client.
@@ -45,22 +55,53 @@ func (r *RedisClient) Prefix() string {
 	return r.prefix
 }
 
-// NewRedis creates a new RedisClient.
+// Encoding returns the encoding of SetJSON, GetJSON and MGetJSON.
+func (r *RedisClient) Encoding() Encoding {
+	return r.encoding
+}
+
+// Client returns the underlying REDIS client that uses the given context for all commands,
+// e.g. for commands that are not covered by the Cache interface. The prefix is not applied automatically.
+func (r *RedisClient) Client(ctx context.Context) redis.Cmdable {
+	switch client := r.Redis.(type) {
+	case *redis.Client:
+		return client.WithContext(ctx)
+	case *redis.ClusterClient:
+		return client.WithContext(ctx)
+	case *redis.Ring:
+		return client.WithContext(ctx)
+	default:
+		return client
+	}
+}
+
+// NewRedis creates a new RedisClient with the default connection options.
 func NewRedis(redisHost string, redisPort string, prefix string) (*RedisClient, error) {
-	redisURL := fmt.Sprintf("%s:%s", redisHost, redisPort)
-	opts := redis.Options{
-		Addr: redisURL,
+	return NewRedisWithConfig(Config{
+		Host:   redisHost,
+		Port:   redisPort,
+		Prefix: prefix,
+	})
+}
+
+// NewRedisWithConfig creates a new RedisClient with the connection options from the config.
+func NewRedisWithConfig(config Config) (*RedisClient, error) {
+	client, err := config.newClient()
+	if err != nil {
+		return nil, err
 	}
 
-	client := redis.NewClient(&opts)
-	_, err := client.Ping().Result()
+	client.AddHook(tracingHook{})
+	_, err = client.Ping().Result()
 	if err != nil {
+		client.Close()
 		return nil, fmt.Errorf("could not ping REDIS: %w", err)
 	}
 
 	redisClient := &RedisClient{
-		prefix: prefix,
-		Redis:  client,
+		prefix:   config.Prefix,
+		encoding: config.Encoding,
+		Redis:    client,
 	}
 	return redisClient, nil
 }
@@ -69,15 +110,16 @@ func NewRedis(redisHost string, redisPort string, prefix string) (*RedisClient,
 // If the client was set up with a prefix it will be added in front of the key.
 // Redis `SET key value [expiration]` command.
 // Use expiration for `SETEX`-like behavior. Zero expiration means the key has no expiration time.
-func (r *RedisClient) Set(key string, value string, expiration time.Duration) error {
-	return r.Redis.Set(r.prefixedKey(key), value, expiration).Err()
+func (r *RedisClient) Set(ctx context.Context, key string, value string, expiration time.Duration) error {
+	return r.Client(ctx).Set(r.prefixedKey(key), value, expiration).Err()
 }
 
 // Get retrieves a value from REDIS.
+// The context is used for the command, it is canceled if the context is done and it can contain the parent span.
 // If the client was set up with a prefix it will be added in front of the key.
 // If the value was not found ErrNotFound will be returned.
-func (r *RedisClient) Get(key string) (string, error) {
-	result, err := r.Redis.Get(r.prefixedKey(key)).Result()
+func (r *RedisClient) Get(ctx context.Context, key string) (string, error) {
+	result, err := r.Client(ctx).Get(r.prefixedKey(key)).Result()
 	if err == redis.Nil {
 		return "", ErrNotFound
 	}
@@ -87,14 +129,14 @@ func (r *RedisClient) Get(key string) (string, error) {
 // SetBool saves a boolean value to REDIS.
 // If the client was set up with a prefix it will be added in front of the key.
 // Zero expiration means the key has no expiration time.
-func (r *RedisClient) SetBool(key string, value bool, expiration time.Duration) error {
-	return r.Set(key, strconv.FormatBool(value), expiration)
+func (r *RedisClient) SetBool(ctx context.Context, key string, value bool, expiration time.Duration) error {
+	return r.Set(ctx, key, strconv.FormatBool(value), expiration)
 }
 
 // GetBool retrieves a boolean value from REDIS.
 // If the client was set up with a prefix it will be added in front of the key.
-func (r *RedisClient) GetBool(key string) (bool, error) {
-	result, err := r.Get(key)
+func (r *RedisClient) GetBool(ctx context.Context, key string) (bool, error) {
+	result, err := r.Get(ctx, key)
 	if err != nil {
 		return false, err
 	}
@@ -105,14 +147,14 @@ func (r *RedisClient) GetBool(key string) (bool, error) {
 // SetInt saves an integer value to REDIS.
 // If the client was set up with a prefix it will be added in front of the key.
 // Zero expiration means the key has no expiration time.
-func (r *RedisClient) SetInt(key string, value int64, expiration time.Duration) error {
-	return r.Set(key, strconv.FormatInt(value, 10), expiration)
+func (r *RedisClient) SetInt(ctx context.Context, key string, value int64, expiration time.Duration) error {
+	return r.Set(ctx, key, strconv.FormatInt(value, 10), expiration)
 }
 
 // GetInt retrieves an integer value from REDIS.
 // If the client was set up with a prefix it will be added in front of the key.
-func (r *RedisClient) GetInt(key string) (int64, error) {
-	result, err := r.Get(key)
+func (r *RedisClient) GetInt(ctx context.Context, key string) (int64, error) {
+	result, err := r.Get(ctx, key)
 	if err != nil {
 		return 0, err
 	}
@@ -123,36 +165,37 @@ func (r *RedisClient) GetInt(key string) (int64, error) {
 // Incr increments a value in REDIS.
 // If the client was set up with a prefix it will be added in front of the key.
 // It returns the new (incremented) value.
-func (r *RedisClient) Incr(key string) (int64, error) {
-	return r.Redis.Incr(r.prefixedKey(key)).Result()
+func (r *RedisClient) Incr(ctx context.Context, key string) (int64, error) {
+	return r.Client(ctx).Incr(r.prefixedKey(key)).Result()
 }
 
-// SetJSON saves JSON data as string to REDIS.
+// SetJSON saves JSON data as string to REDIS. If an Encoding was configured, it is used instead of JSON.
 // If the client was set up with a prefix it will be added in front of the key.
 // Zero expiration means the key has no expiration time.
-func (r *RedisClient) SetJSON(key string, value interface{}, expiration time.Duration) error {
-	bytes, err := json.Marshal(value)
+func (r *RedisClient) SetJSON(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	encoded, err := r.encoding.Encode(value)
 	if err != nil {
 		return err
 	}
-	return r.Set(key, string(bytes[:]), expiration)
+	return r.Set(ctx, key, encoded, expiration)
 }
 
 // GetJSON retrieves stringified JSON data from REDIS and parses it into the provided struct.
+// Values that were stored with another Encoding are detected by their header and decoded as well.
 // If the client was set up with a prefix it will be added in front of the key.
-func (r *RedisClient) GetJSON(key string, result interface{}) error {
-	resultStr, err := r.Get(key)
+func (r *RedisClient) GetJSON(ctx context.Context, key string, result interface{}) error {
+	resultStr, err := r.Get(ctx, key)
 	if err != nil {
 		return err
 	}
 
-	return json.Unmarshal([]byte(resultStr), &result)
+	return r.encoding.Decode(resultStr, result)
 }
 
 // Del deletes a key value pair from REDIS.
 // If the client was set up with a prefix it will be added in front of the key.
-func (r *RedisClient) Del(key string) error {
-	return r.Redis.Del(r.prefixedKey(key)).Err()
+func (r *RedisClient) Del(ctx context.Context, key string) error {
+	return r.Client(ctx).Del(r.prefixedKey(key)).Err()
 }
 
 // Close closes the connection to the REDIS server.
@@ -162,8 +205,8 @@ func (r *RedisClient) Close() error {
 
 // TTL returns remaining time to live of the given key found in REDIS.
 // If the key doesn't exist, it returns ErrNotFound.
-func (r *RedisClient) TTL(key string) (time.Duration, error) {
-	result, err := r.Redis.TTL(r.prefixedKey(key)).Result()
+func (r *RedisClient) TTL(ctx context.Context, key string) (time.Duration, error) {
+	result, err := r.Client(ctx).TTL(r.prefixedKey(key)).Result()
 	if err != nil {
 		return 0, err
 	}
@@ -179,11 +222,172 @@ func (r *RedisClient) TTL(key string) (time.Duration, error) {
 	return result, nil
 }
 
+// MGet retrieves the values of multiple keys in one round trip.
+// If the client was set up with a prefix it will be added in front of the keys.
+// Keys that were not found are not contained in the result.
+func (r *RedisClient) MGet(ctx context.Context, keys ...string) (map[string]string, error) {
+	result := make(map[string]string, len(keys))
+	if len(keys) == 0 {
+		return result, nil
+	}
+
+	if _, ok := r.Redis.(*redis.ClusterClient); ok {
+		// MGET fails for keys in different slots, the pipeline sends the GETs to the right nodes.
+		batch := NewBatch()
+		for _, key := range keys {
+			batch.Get(key)
+		}
+		if err := r.Exec(ctx, batch); err != nil {
+			return nil, err
+		}
+		for _, command := range batch.commands {
+			if command.err == nil {
+				result[command.key] = command.result
+			}
+		}
+		return result, nil
+	}
+
+	prefixedKeys := make([]string, len(keys))
+	for i, key := range keys {
+		prefixedKeys[i] = r.prefixedKey(key)
+	}
+	values, err := r.Client(ctx).MGet(prefixedKeys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, value := range values {
+		if value, ok := value.(string); ok {
+			result[keys[i]] = value
+		}
+	}
+	return result, nil
+}
+
+// MSet saves multiple key value pairs with the same expiration in one round trip.
+// If the client was set up with a prefix it will be added in front of the keys.
+// Zero expiration means the keys have no expiration time.
+func (r *RedisClient) MSet(ctx context.Context, values map[string]string, expiration time.Duration) error {
+	batch := NewBatch()
+	for key, value := range values {
+		batch.Set(key, value, expiration)
+	}
+	return r.Exec(ctx, batch)
+}
+
+// MGetJSON retrieves stringified JSON data of multiple keys and parses it into result,
+// which must be a pointer to a slice or to a map with string keys. A slice gets one element per key in the
+// same order, the elements of missing keys keep their zero value. It returns the keys that were not found.
+func (r *RedisClient) MGetJSON(ctx context.Context, keys []string, result interface{}) ([]string, error) {
+	values, err := r.MGet(ctx, keys...)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSONMany(r.encoding, keys, values, result)
+}
+
+// DelMany deletes multiple keys in one round trip.
+// If the client was set up with a prefix it will be added in front of the keys.
+func (r *RedisClient) DelMany(ctx context.Context, keys ...string) error {
+	batch := NewBatch()
+	for _, key := range keys {
+		batch.Del(key)
+	}
+	return r.Exec(ctx, batch)
+}
+
+// Exec sends the commands of the batch in a pipeline or, for transactions, in MULTI/EXEC.
+// If the client was set up with a prefix it will be added in front of the keys.
+func (r *RedisClient) Exec(ctx context.Context, batch *Batch) error {
+	if batch.Len() == 0 {
+		return nil
+	}
+
+	client := r.Client(ctx)
+	pipe := client.Pipeline()
+	if batch.transaction {
+		pipe = client.TxPipeline()
+	}
+
+	cmds := make([]redis.Cmder, len(batch.commands))
+	for i, command := range batch.commands {
+		key := r.prefixedKey(command.key)
+		switch command.operation {
+		case batchSet:
+			cmds[i] = pipe.Set(key, command.value, command.expiration)
+		case batchGet:
+			cmds[i] = pipe.Get(key)
+		case batchIncr:
+			cmds[i] = pipe.Incr(key)
+		case batchDel:
+			cmds[i] = pipe.Del(key)
+		case batchExpire:
+			cmds[i] = pipe.PExpire(key, command.expiration)
+		}
+	}
+
+	// The error of the first failed command is returned by batch.err, redis.Nil is not an error here.
+	_, _ = pipe.Exec()
+	for i, command := range batch.commands {
+		switch cmd := cmds[i].(type) {
+		case *redis.StringCmd:
+			command.result, command.err = cmd.Result()
+			if command.err == redis.Nil {
+				command.err = ErrNotFound
+			}
+		case *redis.IntCmd:
+			value, err := cmd.Result()
+			command.result, command.err = strconv.FormatInt(value, 10), err
+		case *redis.BoolCmd:
+			found, err := cmd.Result()
+			command.err = err
+			if err == nil && !found {
+				command.err = ErrNotFound
+			}
+		default:
+			command.err = cmds[i].Err()
+		}
+	}
+	return batch.err()
+}
+
+// PrefixedKey returns the key with the prefix of the client, e.g. for commands sent with Client.
+func (r *RedisClient) PrefixedKey(key string) string {
+	return r.prefixedKey(key)
+}
+
 // prefixedKey adds the prefix in front of the key separated with ":".
 // If no prefix was provided for the client than the key is returned as is.
+// REDIS Cluster assigns keys to slots by the first hash tag ("{...}") in the key. If both the prefix and the key
+// contain a hash tag, the braces of the prefix are removed so the hash tag of the key defines the slot.
+// Without hash tag in the key, a hash tag in the prefix puts all keys of the client into the same slot.
 func (r *RedisClient) prefixedKey(key string) string {
 	if r.prefix == "" {
 		return key
 	}
+	if hashTag(key) != "" && hashTag(r.prefix) != "" {
+		return strings.NewReplacer("{", "", "}", "").Replace(r.prefix) + ":" + key
+	}
 	return r.prefix + ":" + key
 }
+
+// HashTag wraps the value in braces so it is used as hash tag, e.g. "user:" + HashTag("42") + ":profile".
+// All keys with the same hash tag are stored in the same slot of a REDIS Cluster, so they can be used together
+// in multi-key operations.
+func HashTag(value string) string {
+	return "{" + value + "}"
+}
+
+// hashTag returns the hash tag of the key the way REDIS Cluster determines it: the content between the first "{"
+// and the next "}" if it is not empty.
+func hashTag(key string) string {
+	start := strings.Index(key, "{")
+	if start < 0 {
+		return ""
+	}
+	end := strings.Index(key[start+1:], "}")
+	if end <= 0 {
+		return ""
+	}
+	return key[start+1 : start+1+end]
+}
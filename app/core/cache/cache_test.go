@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -37,7 +38,7 @@ func TestPrefix(t *testing.T) {
 func TestSet(t *testing.T) {
 	t.Run("success", func(t *testing.T) {
 		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
-			err := client.Set("someKey", "someValue", 10*time.Minute)
+			err := client.Set(context.Background(), "someKey", "someValue", 10*time.Minute)
 			assert.NoError(t, err)
 			redis.CheckGet(t, "testPrefix:someKey", "someValue")
 
@@ -50,7 +51,7 @@ func TestSet(t *testing.T) {
 	t.Run("success, no prefix", func(t *testing.T) {
 		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
 			client.prefix = ""
-			err := client.Set("someKey", "someValue", 10*time.Minute)
+			err := client.Set(context.Background(), "someKey", "someValue", 10*time.Minute)
 			assert.NoError(t, err)
 			redis.CheckGet(t, "someKey", "someValue")
 		})
@@ -59,7 +60,7 @@ func TestSet(t *testing.T) {
 	t.Run("failure", func(t *testing.T) {
 		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
 			redis.Close()
-			err := client.Set("someKey", "someValue", 10*time.Minute)
+			err := client.Set(context.Background(), "someKey", "someValue", 10*time.Minute)
 			assert.Error(t, err)
 		})
 	})
@@ -70,7 +71,7 @@ func TestGet(t *testing.T) {
 		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
 			err := redis.Set("testPrefix:someKey", "someValue")
 			assert.NoError(t, err)
-			result, err := client.Get("someKey")
+			result, err := client.Get(context.Background(), "someKey")
 			assert.NoError(t, err)
 			assert.Equal(t, "someValue", result)
 		})
@@ -78,7 +79,7 @@ func TestGet(t *testing.T) {
 
 	t.Run("key not found", func(t *testing.T) {
 		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
-			_, err := client.Get("someKey")
+			_, err := client.Get(context.Background(), "someKey")
 			assert.Error(t, ErrNotFound, err)
 		})
 	})
@@ -88,7 +89,7 @@ func TestGet(t *testing.T) {
 			err := redis.Set("testPrefix:someKey", "someValue")
 			assert.NoError(t, err)
 			redis.Close()
-			_, err = client.Get("someKey")
+			_, err = client.Get(context.Background(), "someKey")
 			assert.Error(t, err)
 		})
 	})
@@ -96,7 +97,7 @@ func TestGet(t *testing.T) {
 
 func TestSetBool(t *testing.T) {
 	withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
-		err := client.SetBool("someKey", true, 10*time.Minute)
+		err := client.SetBool(context.Background(), "someKey", true, 10*time.Minute)
 		assert.NoError(t, err, "error in test setup")
 		redis.CheckGet(t, "testPrefix:someKey", "true")
 	})
@@ -107,7 +108,7 @@ func TestGetBool(t *testing.T) {
 		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
 			err := redis.Set("testPrefix:someKey", "true")
 			assert.NoError(t, err)
-			result, err := client.GetBool("someKey")
+			result, err := client.GetBool(context.Background(), "someKey")
 			assert.NoError(t, err)
 			assert.True(t, result)
 		})
@@ -117,14 +118,14 @@ func TestGetBool(t *testing.T) {
 		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
 			err := redis.Set("testPrefix:someKey", "wrong")
 			assert.NoError(t, err)
-			_, err = client.GetBool("someKey")
+			_, err = client.GetBool(context.Background(), "someKey")
 			assert.Error(t, err)
 		})
 	})
 
 	t.Run("value not found", func(t *testing.T) {
 		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
-			_, err := client.GetBool("someKey")
+			_, err := client.GetBool(context.Background(), "someKey")
 			assert.Equal(t, ErrNotFound, err)
 		})
 	})
@@ -132,7 +133,7 @@ func TestGetBool(t *testing.T) {
 
 func TestSetInt(t *testing.T) {
 	withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
-		err := client.SetInt("someKey", 100, 10*time.Minute)
+		err := client.SetInt(context.Background(), "someKey", 100, 10*time.Minute)
 		require.NoError(t, err, "error in test setup")
 		redis.CheckGet(t, "testPrefix:someKey", "100")
 	})
@@ -143,7 +144,7 @@ func TestGetInt(t *testing.T) {
 		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
 			err := redis.Set("testPrefix:someKey", "100")
 			require.NoError(t, err)
-			result, err := client.GetInt("someKey")
+			result, err := client.GetInt(context.Background(), "someKey")
 			require.NoError(t, err)
 			assert.Equal(t, int64(100), result)
 		})
@@ -153,7 +154,7 @@ func TestGetInt(t *testing.T) {
 		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
 			err := redis.Set("testPrefix:someKey", "invalid int")
 			require.NoError(t, err)
-			_, err = client.GetInt("someKey")
+			_, err = client.GetInt(context.Background(), "someKey")
 			require.Error(t, err)
 		})
 	})
@@ -161,11 +162,11 @@ func TestGetInt(t *testing.T) {
 
 func TestIncr(t *testing.T) {
 	withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
-		value, err := client.Incr("someKey")
+		value, err := client.Incr(context.Background(), "someKey")
 		require.NoError(t, err, "error in test setup")
 		assert.Equal(t, int64(1), value)
 
-		value, err = client.Incr("someKey")
+		value, err = client.Incr(context.Background(), "someKey")
 		require.NoError(t, err, "error in test setup")
 		assert.Equal(t, int64(2), value)
 
@@ -181,7 +182,7 @@ func TestSetJSON(t *testing.T) {
 
 	t.Run("success", func(t *testing.T) {
 		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
-			err := client.SetJSON("someKey", value, 10*time.Minute)
+			err := client.SetJSON(context.Background(), "someKey", value, 10*time.Minute)
 			assert.NoError(t, err)
 			result, err := redis.Get("testPrefix:someKey")
 			assert.NoError(t, err)
@@ -191,7 +192,7 @@ func TestSetJSON(t *testing.T) {
 
 	t.Run("invalid value", func(t *testing.T) {
 		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
-			err := client.SetJSON("someKey", make(chan int), 10*time.Minute)
+			err := client.SetJSON(context.Background(), "someKey", make(chan int), 10*time.Minute)
 			assert.Error(t, err)
 		})
 	})
@@ -199,7 +200,7 @@ func TestSetJSON(t *testing.T) {
 	t.Run("failure", func(t *testing.T) {
 		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
 			redis.Close()
-			err := client.SetJSON("someKey", value, 10*time.Minute)
+			err := client.SetJSON(context.Background(), "someKey", value, 10*time.Minute)
 			assert.Error(t, err)
 		})
 	})
@@ -212,7 +213,7 @@ func TestGetJSON(t *testing.T) {
 			assert.NoError(t, err)
 
 			result := &testStruct{}
-			err = client.GetJSON("someKey", result)
+			err = client.GetJSON(context.Background(), "someKey", result)
 			assert.NoError(t, err)
 			assert.Equal(t, "Kathryn Janeway", result.Name)
 			assert.Equal(t, 42, result.Age)
@@ -225,7 +226,7 @@ func TestGetJSON(t *testing.T) {
 			assert.NoError(t, err)
 
 			result := &testStruct{}
-			err = client.GetJSON("someKey", result)
+			err = client.GetJSON(context.Background(), "someKey", result)
 			assert.Error(t, err)
 		})
 	})
@@ -233,7 +234,7 @@ func TestGetJSON(t *testing.T) {
 	t.Run("value not found", func(t *testing.T) {
 		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
 			result := &testStruct{}
-			err := client.GetJSON("foo", result)
+			err := client.GetJSON(context.Background(), "foo", result)
 			assert.Equal(t, ErrNotFound, err)
 		})
 	})
@@ -246,7 +247,7 @@ func TestDel(t *testing.T) {
 			assert.NoError(t, err)
 			assert.True(t, redis.Exists("testPrefix:someKey"))
 
-			err = client.Del("someKey")
+			err = client.Del(context.Background(), "someKey")
 			assert.NoError(t, err)
 			assert.False(t, redis.Exists("testPrefix:someKey"))
 		})
@@ -260,7 +261,7 @@ func TestTTL(t *testing.T) {
 			require.NoError(t, err)
 			redis.SetTTL("testPrefix:someKey", 1*time.Second)
 
-			result, err := client.TTL("someKey")
+			result, err := client.TTL(context.Background(), "someKey")
 
 			require.NoError(t, err)
 			assert.Equal(t, 1*time.Second, result)
@@ -269,7 +270,7 @@ func TestTTL(t *testing.T) {
 
 	t.Run("not found", func(t *testing.T) {
 		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
-			_, err := client.TTL("someKey")
+			_, err := client.TTL(context.Background(), "someKey")
 
 			require.Error(t, err)
 			assert.Equal(t, ErrNotFound, err)
@@ -281,7 +282,7 @@ func TestTTL(t *testing.T) {
 			err := redis.Set("testPrefix:someKey", "100")
 			require.NoError(t, err)
 
-			_, err = client.TTL("someKey")
+			_, err = client.TTL(context.Background(), "someKey")
 
 			require.Error(t, err)
 			assert.Equal(t, ErrNoTTLSet, err)
@@ -291,7 +292,7 @@ func TestTTL(t *testing.T) {
 	t.Run("failure", func(t *testing.T) {
 		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
 			redis.Close()
-			_, err := client.TTL("someKey")
+			_, err := client.TTL(context.Background(), "someKey")
 
 			require.Error(t, err)
 			assert.NotEqual(t, ErrNotFound, err)
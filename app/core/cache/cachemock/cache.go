@@ -1,6 +1,7 @@
 package cachemock
 
 import (
+	"context"
 	"time"
 
 	"github.com/stretchr/testify/mock"
@@ -19,43 +20,43 @@ func (m *Cache) Close() error {
 }
 
 // Del is a mock implementation of cache.Cache#Del.
-func (m *Cache) Del(key string) error {
-	args := m.Called(key)
+func (m *Cache) Del(ctx context.Context, key string) error {
+	args := m.Called(ctx, key)
 
 	return args.Error(0)
 }
 
 // Get is a mock implementation of cache.Cache#Get.
-func (m *Cache) Get(key string) (string, error) {
-	args := m.Called(key)
+func (m *Cache) Get(ctx context.Context, key string) (string, error) {
+	args := m.Called(ctx, key)
 
 	return args.String(0), args.Error(1)
 }
 
 // GetBool is a mock implementation of cache.Cache#GetBool.
-func (m *Cache) GetBool(key string) (bool, error) {
-	args := m.Called(key)
+func (m *Cache) GetBool(ctx context.Context, key string) (bool, error) {
+	args := m.Called(ctx, key)
 
 	return args.Bool(0), args.Error(1)
 }
 
 // GetInt is a mock implementation of cache.Cache#GetInt.
-func (m *Cache) GetInt(key string) (int64, error) {
-	args := m.Called(key)
+func (m *Cache) GetInt(ctx context.Context, key string) (int64, error) {
+	args := m.Called(ctx, key)
 
 	return args.Get(0).(int64), args.Error(1)
 }
 
 // GetJSON is a mock implementation of cache.Cache#GetJSON.
-func (m *Cache) GetJSON(key string, result interface{}) error {
-	args := m.Called(key, result)
+func (m *Cache) GetJSON(ctx context.Context, key string, result interface{}) error {
+	args := m.Called(ctx, key, result)
 
 	return args.Error(0)
 }
 
 // Incr is a mock implementation of cache.Cache#Incr.
-func (m *Cache) Incr(key string) (int64, error) {
-	args := m.Called(key)
+func (m *Cache) Incr(ctx context.Context, key string) (int64, error) {
+	args := m.Called(ctx, key)
 
 	return args.Get(0).(int64), args.Error(1)
 }
@@ -68,36 +69,66 @@ func (m *Cache) Prefix() string {
 }
 
 // Set is a mock implementation of cache.Cache#Set.
-func (m *Cache) Set(key string, value string, expiration time.Duration) error {
-	args := m.Called(key, value, expiration)
+func (m *Cache) Set(ctx context.Context, key string, value string, expiration time.Duration) error {
+	args := m.Called(ctx, key, value, expiration)
 
 	return args.Error(0)
 }
 
 // SetBool is a mock implementation of cache.Cache#SetBool.
-func (m *Cache) SetBool(key string, value bool, expiration time.Duration) error {
-	args := m.Called(key, value, expiration)
+func (m *Cache) SetBool(ctx context.Context, key string, value bool, expiration time.Duration) error {
+	args := m.Called(ctx, key, value, expiration)
 
 	return args.Error(0)
 }
 
 // SetInt is a mock implementation of cache.Cache#SetInt.
-func (m *Cache) SetInt(key string, value int64, expiration time.Duration) error {
-	args := m.Called(key, value, expiration)
+func (m *Cache) SetInt(ctx context.Context, key string, value int64, expiration time.Duration) error {
+	args := m.Called(ctx, key, value, expiration)
 
 	return args.Error(0)
 }
 
 // TTL is a mock implementation of cache.Cache#TTL.
-func (m *Cache) TTL(key string) (time.Duration, error) {
-	args := m.Called(key)
+func (m *Cache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	args := m.Called(ctx, key)
 
 	return args.Get(0).(time.Duration), args.Error(1)
 }
 
 // SetJSON is a mock implementation of cache.Cache#SetJSON.
-func (m *Cache) SetJSON(key string, value interface{}, expiration time.Duration) error {
-	args := m.Called(key, value, expiration)
+func (m *Cache) SetJSON(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	args := m.Called(ctx, key, value, expiration)
+
+	return args.Error(0)
+}
+
+// MGet is a mock implementation of cache.Cache#MGet.
+func (m *Cache) MGet(ctx context.Context, keys ...string) (map[string]string, error) {
+	args := m.Called(ctx, keys)
+
+	result, _ := args.Get(0).(map[string]string)
+	return result, args.Error(1)
+}
+
+// MSet is a mock implementation of cache.Cache#MSet.
+func (m *Cache) MSet(ctx context.Context, values map[string]string, expiration time.Duration) error {
+	args := m.Called(ctx, values, expiration)
+
+	return args.Error(0)
+}
+
+// MGetJSON is a mock implementation of cache.Cache#MGetJSON.
+func (m *Cache) MGetJSON(ctx context.Context, keys []string, result interface{}) ([]string, error) {
+	args := m.Called(ctx, keys, result)
+
+	missing, _ := args.Get(0).([]string)
+	return missing, args.Error(1)
+}
+
+// DelMany is a mock implementation of cache.Cache#DelMany.
+func (m *Cache) DelMany(ctx context.Context, keys ...string) error {
+	args := m.Called(ctx, keys)
 
 	return args.Error(0)
 }
@@ -0,0 +1,172 @@
+package cachemock
+
+import (
+	"context"
+
+	"github.com/stretchr/testify/mock"
+	"toolkit/app/core/cache"
+)
+
+// Collections is a mock implementation of the cache.Collections interface.
+type Collections struct {
+	mock.Mock
+}
+
+// HSet is a mock implementation of cache.Collections#HSet.
+func (m *Collections) HSet(ctx context.Context, key string, values map[string]string) error {
+	args := m.Called(ctx, key, values)
+
+	return args.Error(0)
+}
+
+// HGet is a mock implementation of cache.Collections#HGet.
+func (m *Collections) HGet(ctx context.Context, key string, field string) (string, error) {
+	args := m.Called(ctx, key, field)
+
+	return args.String(0), args.Error(1)
+}
+
+// HGetAll is a mock implementation of cache.Collections#HGetAll.
+func (m *Collections) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	args := m.Called(ctx, key)
+
+	result, _ := args.Get(0).(map[string]string)
+	return result, args.Error(1)
+}
+
+// HDel is a mock implementation of cache.Collections#HDel.
+func (m *Collections) HDel(ctx context.Context, key string, fields ...string) error {
+	args := m.Called(ctx, key, fields)
+
+	return args.Error(0)
+}
+
+// HIncrBy is a mock implementation of cache.Collections#HIncrBy.
+func (m *Collections) HIncrBy(ctx context.Context, key string, field string, increment int64) (int64, error) {
+	args := m.Called(ctx, key, field, increment)
+
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// LPush is a mock implementation of cache.Collections#LPush.
+func (m *Collections) LPush(ctx context.Context, key string, values ...string) (int64, error) {
+	args := m.Called(ctx, key, values)
+
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// RPush is a mock implementation of cache.Collections#RPush.
+func (m *Collections) RPush(ctx context.Context, key string, values ...string) (int64, error) {
+	args := m.Called(ctx, key, values)
+
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// LPop is a mock implementation of cache.Collections#LPop.
+func (m *Collections) LPop(ctx context.Context, key string) (string, error) {
+	args := m.Called(ctx, key)
+
+	return args.String(0), args.Error(1)
+}
+
+// RPop is a mock implementation of cache.Collections#RPop.
+func (m *Collections) RPop(ctx context.Context, key string) (string, error) {
+	args := m.Called(ctx, key)
+
+	return args.String(0), args.Error(1)
+}
+
+// LRange is a mock implementation of cache.Collections#LRange.
+func (m *Collections) LRange(ctx context.Context, key string, start int64, stop int64) ([]string, error) {
+	args := m.Called(ctx, key, start, stop)
+
+	result, _ := args.Get(0).([]string)
+	return result, args.Error(1)
+}
+
+// LTrim is a mock implementation of cache.Collections#LTrim.
+func (m *Collections) LTrim(ctx context.Context, key string, start int64, stop int64) error {
+	args := m.Called(ctx, key, start, stop)
+
+	return args.Error(0)
+}
+
+// LLen is a mock implementation of cache.Collections#LLen.
+func (m *Collections) LLen(ctx context.Context, key string) (int64, error) {
+	args := m.Called(ctx, key)
+
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// SAdd is a mock implementation of cache.Collections#SAdd.
+func (m *Collections) SAdd(ctx context.Context, key string, members ...string) (int64, error) {
+	args := m.Called(ctx, key, members)
+
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// SRem is a mock implementation of cache.Collections#SRem.
+func (m *Collections) SRem(ctx context.Context, key string, members ...string) (int64, error) {
+	args := m.Called(ctx, key, members)
+
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// SMembers is a mock implementation of cache.Collections#SMembers.
+func (m *Collections) SMembers(ctx context.Context, key string) ([]string, error) {
+	args := m.Called(ctx, key)
+
+	result, _ := args.Get(0).([]string)
+	return result, args.Error(1)
+}
+
+// SIsMember is a mock implementation of cache.Collections#SIsMember.
+func (m *Collections) SIsMember(ctx context.Context, key string, member string) (bool, error) {
+	args := m.Called(ctx, key, member)
+
+	return args.Bool(0), args.Error(1)
+}
+
+// ZAdd is a mock implementation of cache.Collections#ZAdd.
+func (m *Collections) ZAdd(ctx context.Context, key string, members ...cache.ZMember) (int64, error) {
+	args := m.Called(ctx, key, members)
+
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// ZRem is a mock implementation of cache.Collections#ZRem.
+func (m *Collections) ZRem(ctx context.Context, key string, members ...string) (int64, error) {
+	args := m.Called(ctx, key, members)
+
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// ZRange is a mock implementation of cache.Collections#ZRange.
+func (m *Collections) ZRange(ctx context.Context, key string, start int64, stop int64) ([]cache.ZMember, error) {
+	args := m.Called(ctx, key, start, stop)
+
+	result, _ := args.Get(0).([]cache.ZMember)
+	return result, args.Error(1)
+}
+
+// ZRangeByScore is a mock implementation of cache.Collections#ZRangeByScore.
+func (m *Collections) ZRangeByScore(ctx context.Context, key string, min float64, max float64) ([]cache.ZMember, error) {
+	args := m.Called(ctx, key, min, max)
+
+	result, _ := args.Get(0).([]cache.ZMember)
+	return result, args.Error(1)
+}
+
+// ZRank is a mock implementation of cache.Collections#ZRank.
+func (m *Collections) ZRank(ctx context.Context, key string, member string) (int64, error) {
+	args := m.Called(ctx, key, member)
+
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// ZScore is a mock implementation of cache.Collections#ZScore.
+func (m *Collections) ZScore(ctx context.Context, key string, member string) (float64, error) {
+	args := m.Called(ctx, key, member)
+
+	return args.Get(0).(float64), args.Error(1)
+}
@@ -0,0 +1,103 @@
+package cachemock
+
+import (
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// LegacyCache is a mock implementation of the cache.LegacyCache interface.
+type LegacyCache struct {
+	mock.Mock
+}
+
+// Close is a mock implementation of cache.LegacyCache#Close.
+func (m *LegacyCache) Close() error {
+	args := m.Called()
+
+	return args.Error(0)
+}
+
+// Del is a mock implementation of cache.LegacyCache#Del.
+func (m *LegacyCache) Del(key string) error {
+	args := m.Called(key)
+
+	return args.Error(0)
+}
+
+// Get is a mock implementation of cache.LegacyCache#Get.
+func (m *LegacyCache) Get(key string) (string, error) {
+	args := m.Called(key)
+
+	return args.String(0), args.Error(1)
+}
+
+// GetBool is a mock implementation of cache.LegacyCache#GetBool.
+func (m *LegacyCache) GetBool(key string) (bool, error) {
+	args := m.Called(key)
+
+	return args.Bool(0), args.Error(1)
+}
+
+// GetInt is a mock implementation of cache.LegacyCache#GetInt.
+func (m *LegacyCache) GetInt(key string) (int64, error) {
+	args := m.Called(key)
+
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// GetJSON is a mock implementation of cache.LegacyCache#GetJSON.
+func (m *LegacyCache) GetJSON(key string, result interface{}) error {
+	args := m.Called(key, result)
+
+	return args.Error(0)
+}
+
+// Incr is a mock implementation of cache.LegacyCache#Incr.
+func (m *LegacyCache) Incr(key string) (int64, error) {
+	args := m.Called(key)
+
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// Prefix is a mock implementation of cache.LegacyCache#Prefix.
+func (m *LegacyCache) Prefix() string {
+	args := m.Called()
+
+	return args.String(0)
+}
+
+// Set is a mock implementation of cache.LegacyCache#Set.
+func (m *LegacyCache) Set(key string, value string, expiration time.Duration) error {
+	args := m.Called(key, value, expiration)
+
+	return args.Error(0)
+}
+
+// SetBool is a mock implementation of cache.LegacyCache#SetBool.
+func (m *LegacyCache) SetBool(key string, value bool, expiration time.Duration) error {
+	args := m.Called(key, value, expiration)
+
+	return args.Error(0)
+}
+
+// SetInt is a mock implementation of cache.LegacyCache#SetInt.
+func (m *LegacyCache) SetInt(key string, value int64, expiration time.Duration) error {
+	args := m.Called(key, value, expiration)
+
+	return args.Error(0)
+}
+
+// TTL is a mock implementation of cache.LegacyCache#TTL.
+func (m *LegacyCache) TTL(key string) (time.Duration, error) {
+	args := m.Called(key)
+
+	return args.Get(0).(time.Duration), args.Error(1)
+}
+
+// SetJSON is a mock implementation of cache.LegacyCache#SetJSON.
+func (m *LegacyCache) SetJSON(key string, value interface{}, expiration time.Duration) error {
+	args := m.Called(key, value, expiration)
+
+	return args.Error(0)
+}
@@ -0,0 +1,47 @@
+package cachemock
+
+import (
+	"context"
+
+	"github.com/stretchr/testify/mock"
+	"toolkit/app/core/cache"
+)
+
+// PubSub is a mock implementation of the cache.PubSub interface.
+type PubSub struct {
+	mock.Mock
+}
+
+// Publish is a mock implementation of cache.PubSub#Publish.
+func (m *PubSub) Publish(ctx context.Context, channel string, payload string) error {
+	args := m.Called(ctx, channel, payload)
+
+	return args.Error(0)
+}
+
+// PublishJSON is a mock implementation of cache.PubSub#PublishJSON.
+func (m *PubSub) PublishJSON(ctx context.Context, channel string, value interface{}) error {
+	args := m.Called(ctx, channel, value)
+
+	return args.Error(0)
+}
+
+// Subscribe is a mock implementation of cache.PubSub#Subscribe.
+func (m *PubSub) Subscribe(ctx context.Context, channels []string, handler cache.MessageHandler) (cache.Subscription, error) {
+	args := m.Called(ctx, channels, handler)
+
+	result, _ := args.Get(0).(cache.Subscription)
+	return result, args.Error(1)
+}
+
+// Subscription is a mock implementation of the cache.Subscription interface.
+type Subscription struct {
+	mock.Mock
+}
+
+// Close is a mock implementation of cache.Subscription#Close.
+func (m *Subscription) Close() error {
+	args := m.Called()
+
+	return args.Error(0)
+}
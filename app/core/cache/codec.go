@@ -0,0 +1,295 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"sync"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+	"github.com/vmihailenco/msgpack/v4"
+	"google.golang.org/protobuf/proto"
+)
+
+// DefaultCompressionThreshold is the minimum size of encoded values that are compressed if no threshold was configured.
+const DefaultCompressionThreshold = 1024
+
+// headerMarker is set in the first byte of all values that start with a header. Values without the marker
+// are JSON, e.g. values that were stored before a codec was configured. JSON never starts with such a byte.
+const headerMarker = 0x80
+
+// Codec serializes the values of SetJSON, GetJSON and MGetJSON.
+type Codec interface {
+	// ID identifies the codec in the header of the stored values. It must be between 1 and 15 and never change,
+	// otherwise values that are already stored can not be decoded anymore.
+	ID() byte
+	Marshal(value interface{}) ([]byte, error)
+	Unmarshal(data []byte, result interface{}) error
+}
+
+// Available codecs.
+var (
+	JSONCodec     Codec = jsonCodec{}
+	MsgpackCodec  Codec = msgpackCodec{}
+	GobCodec      Codec = gobCodec{}
+	ProtobufCodec Codec = protobufCodec{}
+)
+
+// codecs contains the codecs by name for the configuration and by ID for decoding.
+var codecs = map[string]Codec{
+	"json":     JSONCodec,
+	"msgpack":  MsgpackCodec,
+	"gob":      GobCodec,
+	"protobuf": ProtobufCodec,
+}
+
+// Compression defines the compression algorithm of the values, its value is stored in the header.
+type Compression byte
+
+// Available compression algorithms.
+const (
+	CompressionNone   Compression = 0
+	CompressionSnappy Compression = 1
+	CompressionZstd   Compression = 2
+)
+
+var compressions = map[string]Compression{
+	"":       CompressionNone,
+	"none":   CompressionNone,
+	"snappy": CompressionSnappy,
+	"zstd":   CompressionZstd,
+}
+
+// Encoding defines how SetJSON, GetJSON and MGetJSON serialize the values. The zero value stores plain JSON.
+// Other codecs and compressed values are stored with a header byte that identifies the codec and the compression,
+// so values are decoded correctly after the encoding was changed, e.g. during a rollout.
+type Encoding struct {
+	// Codec encodes the values, JSONCodec is used if it is nil.
+	Codec Codec
+	// Compression compresses encoded values that are at least CompressionThreshold bytes large.
+	Compression Compression
+	// CompressionThreshold is the minimum size in bytes of encoded values that are compressed (default 1024).
+	CompressionThreshold int
+}
+
+// encodingOf returns the Encoding of the cache or plain JSON if the cache does not provide it.
+func encodingOf(cache Cache) Encoding {
+	if c, ok := cache.(interface{ Encoding() Encoding }); ok {
+		return c.Encoding()
+	}
+	return Encoding{}
+}
+
+// ParseEncoding creates an Encoding from the name of the codec ("json", "msgpack", "gob" or "protobuf")
+// and of the compression ("none", "snappy" or "zstd"). Empty names select JSON without compression.
+func ParseEncoding(codec string, compression string, compressionThreshold int) (Encoding, error) {
+	encoding := Encoding{CompressionThreshold: compressionThreshold}
+	if codec != "" {
+		var ok bool
+		if encoding.Codec, ok = codecs[codec]; !ok {
+			return encoding, errors.Errorf("unknown codec %q", codec)
+		}
+	}
+
+	var ok bool
+	if encoding.Compression, ok = compressions[compression]; !ok {
+		return encoding, errors.Errorf("unknown compression %q", compression)
+	}
+	return encoding, nil
+}
+
+// Encode serializes the value and compresses it if it exceeds the threshold.
+// Uncompressed JSON is stored without header so it can still be read by clients without Encoding.
+func (e Encoding) Encode(value interface{}) (string, error) {
+	codec := e.codec()
+	if codec.ID() == 0 || codec.ID() > 0x0F {
+		return "", errors.Errorf("invalid codec ID %d", codec.ID())
+	}
+	data, err := codec.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	compression := e.Compression
+	threshold := e.CompressionThreshold
+	if threshold <= 0 {
+		threshold = DefaultCompressionThreshold
+	}
+	if len(data) < threshold {
+		compression = CompressionNone
+	}
+	if compression == CompressionNone && codec.ID() == JSONCodec.ID() {
+		return string(data), nil
+	}
+
+	compressed, err := compress(compression, data)
+	if err != nil {
+		return "", err
+	}
+	header := headerMarker | byte(compression)<<4 | codec.ID()
+	return string(append([]byte{header}, compressed...)), nil
+}
+
+// Decode parses a value that was serialized with any of the available codecs or as plain JSON.
+func (e Encoding) Decode(value string, result interface{}) error {
+	if value == "" || value[0]&headerMarker == 0 {
+		return json.Unmarshal([]byte(value), result)
+	}
+
+	header := value[0]
+	codec := e.codec()
+	if codec.ID() != header&0x0F {
+		codec = codecByID(header & 0x0F)
+		if codec == nil {
+			return errors.Errorf("unknown codec ID %d", header&0x0F)
+		}
+	}
+
+	data, err := decompress(Compression(header&0x70>>4), []byte(value[1:]))
+	if err != nil {
+		return err
+	}
+	return codec.Unmarshal(data, result)
+}
+
+func (e Encoding) codec() Codec {
+	if e.Codec == nil {
+		return JSONCodec
+	}
+	return e.Codec
+}
+
+func codecByID(id byte) Codec {
+	for _, codec := range codecs {
+		if codec.ID() == id {
+			return codec
+		}
+	}
+	return nil
+}
+
+// The zstd encoder and decoder are safe for concurrent use and expensive to create, so they are shared.
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+	zstdErr     error
+)
+
+func zstdCoders() (*zstd.Encoder, *zstd.Decoder, error) {
+	zstdOnce.Do(func() {
+		zstdEncoder, zstdErr = zstd.NewWriter(nil)
+		if zstdErr != nil {
+			return
+		}
+		zstdDecoder, zstdErr = zstd.NewReader(nil)
+	})
+	return zstdEncoder, zstdDecoder, zstdErr
+}
+
+func compress(compression Compression, data []byte) ([]byte, error) {
+	switch compression {
+	case CompressionNone:
+		return data, nil
+	case CompressionSnappy:
+		return snappy.Encode(nil, data), nil
+	case CompressionZstd:
+		encoder, _, err := zstdCoders()
+		if err != nil {
+			return nil, err
+		}
+		return encoder.EncodeAll(data, nil), nil
+	default:
+		return nil, errors.Errorf("unknown compression %d", compression)
+	}
+}
+
+func decompress(compression Compression, data []byte) ([]byte, error) {
+	switch compression {
+	case CompressionNone:
+		return data, nil
+	case CompressionSnappy:
+		result, err := snappy.Decode(nil, data)
+		return result, errors.Wrap(err, "could not decompress value")
+	case CompressionZstd:
+		_, decoder, err := zstdCoders()
+		if err != nil {
+			return nil, err
+		}
+		result, err := decoder.DecodeAll(data, nil)
+		return result, errors.Wrap(err, "could not decompress value")
+	default:
+		return nil, errors.Errorf("unknown compression %d", compression)
+	}
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ID() byte {
+	return 1
+}
+
+func (jsonCodec) Marshal(value interface{}) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (jsonCodec) Unmarshal(data []byte, result interface{}) error {
+	return json.Unmarshal(data, result)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) ID() byte {
+	return 2
+}
+
+func (msgpackCodec) Marshal(value interface{}) ([]byte, error) {
+	return msgpack.Marshal(value)
+}
+
+func (msgpackCodec) Unmarshal(data []byte, result interface{}) error {
+	return msgpack.Unmarshal(data, result)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) ID() byte {
+	return 3
+}
+
+func (gobCodec) Marshal(value interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(value); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, result interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(result)
+}
+
+// protobufCodec only supports values that implement proto.Message.
+type protobufCodec struct{}
+
+func (protobufCodec) ID() byte {
+	return 4
+}
+
+func (protobufCodec) Marshal(value interface{}) ([]byte, error) {
+	message, ok := value.(proto.Message)
+	if !ok {
+		return nil, errors.Errorf("protobuf codec requires a proto.Message, got %T", value)
+	}
+	return proto.Marshal(message)
+}
+
+func (protobufCodec) Unmarshal(data []byte, result interface{}) error {
+	message, ok := result.(proto.Message)
+	if !ok {
+		return errors.Errorf("protobuf codec requires a proto.Message, got %T", result)
+	}
+	return proto.Unmarshal(data, message)
+}
@@ -0,0 +1,210 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"toolkit/app/core/observance"
+)
+
+type codecTestValue struct {
+	Name  string
+	Count int
+	Tags  []string
+}
+
+func TestEncoding(t *testing.T) {
+	value := codecTestValue{Name: "test", Count: 3, Tags: []string{"a", "b"}}
+	large := codecTestValue{Name: strings.Repeat("large", 500)}
+
+	t.Run("round trips", func(t *testing.T) {
+		for _, codec := range []string{"json", "msgpack", "gob"} {
+			for _, compression := range []string{"none", "snappy", "zstd"} {
+				encoding, err := ParseEncoding(codec, compression, 0)
+				require.NoError(t, err)
+
+				for _, v := range []codecTestValue{value, large} {
+					encoded, err := encoding.Encode(v)
+					require.NoError(t, err)
+					result := codecTestValue{}
+					require.NoError(t, encoding.Decode(encoded, &result), codec+" "+compression)
+					assert.Equal(t, v, result, codec+" "+compression)
+				}
+			}
+		}
+	})
+
+	t.Run("header", func(t *testing.T) {
+		encoded, err := Encoding{}.Encode(value)
+		require.NoError(t, err)
+		assert.Equal(t, `{"Name":"test","Count":3,"Tags":["a","b"]}`, encoded, "plain JSON without header")
+
+		encoded, err = Encoding{Codec: MsgpackCodec}.Encode(value)
+		require.NoError(t, err)
+		assert.Equal(t, byte(0x82), encoded[0])
+
+		encoding := Encoding{Codec: GobCodec, Compression: CompressionZstd, CompressionThreshold: 100}
+		encoded, err = encoding.Encode(value)
+		require.NoError(t, err)
+		assert.Equal(t, byte(0x83), encoded[0], "not compressed below the threshold")
+
+		encoded, err = encoding.Encode(large)
+		require.NoError(t, err)
+		assert.Equal(t, byte(0xA3), encoded[0])
+		uncompressed, err := Encoding{Codec: GobCodec}.Encode(large)
+		require.NoError(t, err)
+		assert.Less(t, len(encoded), len(uncompressed)/5)
+
+		encoded, err = Encoding{Compression: CompressionSnappy}.Encode(large)
+		require.NoError(t, err)
+		assert.Equal(t, byte(0x91), encoded[0])
+	})
+
+	t.Run("decodes values of other encodings", func(t *testing.T) {
+		encoded, err := Encoding{Codec: MsgpackCodec, Compression: CompressionSnappy, CompressionThreshold: 1}.Encode(value)
+		require.NoError(t, err)
+		result := codecTestValue{}
+		require.NoError(t, Encoding{}.Decode(encoded, &result))
+		assert.Equal(t, value, result)
+
+		result = codecTestValue{}
+		require.NoError(t, Encoding{Codec: GobCodec}.Decode(`{"Name":"legacy"}`, &result))
+		assert.Equal(t, codecTestValue{Name: "legacy"}, result)
+	})
+
+	t.Run("protobuf", func(t *testing.T) {
+		encoding := Encoding{Codec: ProtobufCodec, Compression: CompressionZstd, CompressionThreshold: 10}
+		encoded, err := encoding.Encode(&wrapperspb.StringValue{Value: strings.Repeat("value", 10)})
+		require.NoError(t, err)
+		result := &wrapperspb.StringValue{}
+		require.NoError(t, encoding.Decode(encoded, result))
+		assert.True(t, proto.Equal(&wrapperspb.StringValue{Value: strings.Repeat("value", 10)}, result))
+
+		_, err = encoding.Encode(value)
+		assert.EqualError(t, err, "protobuf codec requires a proto.Message, got cache.codecTestValue")
+		err = encoding.Decode(encoded, &value)
+		assert.EqualError(t, err, "protobuf codec requires a proto.Message, got *cache.codecTestValue")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := ParseEncoding("xml", "", 0)
+		assert.EqualError(t, err, `unknown codec "xml"`)
+		_, err = ParseEncoding("json", "lz4", 0)
+		assert.EqualError(t, err, `unknown compression "lz4"`)
+
+		result := codecTestValue{}
+		assert.EqualError(t, Encoding{}.Decode("\x8F", &result), "unknown codec ID 15")
+		assert.EqualError(t, Encoding{}.Decode("\xF1{}", &result), "unknown compression 7")
+		assert.Error(t, Encoding{}.Decode("\x91invalid", &result))
+	})
+}
+
+func TestCacheEncoding(t *testing.T) {
+	ctx := context.Background()
+	value := codecTestValue{Name: "test", Count: 3}
+	large := codecTestValue{Name: strings.Repeat("large", 500)}
+	msgpack := Encoding{Codec: MsgpackCodec}
+
+	t.Run("redis", func(t *testing.T) {
+		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
+			require.NoError(t, client.Set(ctx, "legacy", `{"Name":"legacy"}`, time.Minute))
+			client.encoding = msgpack
+			require.NoError(t, client.SetJSON(ctx, "key", value, time.Minute))
+			stored, err := redis.Get("testPrefix:key")
+			require.NoError(t, err)
+			assert.Equal(t, byte(0x82), stored[0])
+
+			// A client that still uses JSON can read the values during the rollout.
+			client.encoding = Encoding{}
+			result := codecTestValue{}
+			require.NoError(t, client.GetJSON(ctx, "key", &result))
+			assert.Equal(t, value, result)
+
+			client.encoding = msgpack
+			results := []codecTestValue{}
+			missing, err := client.MGetJSON(ctx, []string{"legacy", "key"}, &results)
+			require.NoError(t, err)
+			assert.Empty(t, missing)
+			assert.Equal(t, []codecTestValue{{Name: "legacy"}, value}, results)
+		})
+	})
+
+	t.Run("memory", func(t *testing.T) {
+		memory := NewMemory(MemoryConfig{Encoding: msgpack})
+		require.NoError(t, memory.SetJSON(ctx, "key", value, time.Minute))
+		stored, err := memory.Get(ctx, "key")
+		require.NoError(t, err)
+		assert.Equal(t, byte(0x82), stored[0])
+
+		result := codecTestValue{}
+		require.NoError(t, memory.GetJSON(ctx, "key", &result))
+		assert.Equal(t, value, result)
+	})
+
+	t.Run("loader", func(t *testing.T) {
+		encodings := []Encoding{
+			{Codec: MsgpackCodec, Compression: CompressionZstd, CompressionThreshold: 100},
+			{Codec: GobCodec},
+			{Codec: ProtobufCodec, Compression: CompressionSnappy, CompressionThreshold: 100},
+		}
+		for _, encoding := range encodings {
+			memory := NewMemory(MemoryConfig{Encoding: encoding})
+			instrumented := NewInstrumented(memory, observance.NewTestMeasurer(), observance.NewTestLogger(), InstrumentationConfig{})
+			loader := NewLoader(instrumented, observance.NewTestLogger(), LoaderConfig{})
+
+			var loaded, result interface{} = large, &codecTestValue{}
+			if encoding.Codec == ProtobufCodec {
+				loaded, result = &wrapperspb.StringValue{Value: large.Name}, &wrapperspb.StringValue{}
+			}
+			load := func(ctx context.Context) (interface{}, error) { return loaded, nil }
+			require.NoError(t, loader.GetOrSetJSON(ctx, "key", time.Minute, result, load))
+
+			stored, err := memory.Get(ctx, "key")
+			require.NoError(t, err)
+			assert.NotEqual(t, byte('{'), stored[0], "not stored as JSON")
+			if encoding.Compression != CompressionNone {
+				assert.Equal(t, encoding.Compression, Compression(stored[0]>>4&0x07), "compressed")
+				assert.Less(t, len(stored), len(large.Name)/5)
+			}
+
+			// Read from the cache.
+			require.NoError(t, loader.GetOrSetJSON(ctx, "key", time.Minute, result, func(ctx context.Context) (interface{}, error) {
+				return nil, errors.New("not called")
+			}))
+			if encoding.Codec == ProtobufCodec {
+				assert.Equal(t, large.Name, result.(*wrapperspb.StringValue).GetValue())
+			} else {
+				assert.Equal(t, large, *result.(*codecTestValue))
+			}
+		}
+	})
+
+	t.Run("near with protobuf", func(t *testing.T) {
+		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
+			client.encoding = Encoding{Codec: ProtobufCodec}
+			near, err := NewNear(client, observance.NewTestMeasurer(), observance.NewTestLogger(), NearConfig{})
+			require.NoError(t, err)
+			defer near.Close()
+
+			require.NoError(t, near.SetJSON(ctx, "a", &wrapperspb.StringValue{Value: "first"}, time.Minute))
+			require.NoError(t, near.SetJSON(ctx, "b", &wrapperspb.StringValue{Value: "second"}, time.Minute))
+			result := &wrapperspb.StringValue{}
+			require.NoError(t, near.GetJSON(ctx, "a", result))
+			assert.Equal(t, "first", result.GetValue())
+
+			results := map[string]*wrapperspb.StringValue{}
+			missing, err := near.MGetJSON(ctx, []string{"a", "b", "c"}, &results)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"c"}, missing)
+			assert.Equal(t, "second", results["b"].GetValue())
+		})
+	})
+}
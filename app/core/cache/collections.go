@@ -0,0 +1,296 @@
+package cache
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/pkg/errors"
+)
+
+// ErrWrongType is returned if an operation is used on a key that holds a different type of value,
+// e.g. HGet on a list.
+var ErrWrongType = errors.New("key holds the wrong type of value")
+
+// Collections defines operations on hashes, lists, sets and sorted sets. Like for the Cache interface,
+// the prefix is added in front of all keys. Collections are deleted when their last element is removed,
+// the expiration time can be set via Expire in a Batch and TTL works like for other keys.
+type Collections interface {
+	// HSet sets the fields of the hash.
+	HSet(ctx context.Context, key string, values map[string]string) error
+	// HGet returns ErrNotFound if the hash or the field does not exist.
+	HGet(ctx context.Context, key string, field string) (string, error)
+	// HGetAll returns an empty map if the hash does not exist.
+	HGetAll(ctx context.Context, key string) (map[string]string, error)
+	HDel(ctx context.Context, key string, fields ...string) error
+	// HIncrBy increments the integer value of the field and returns the new value.
+	HIncrBy(ctx context.Context, key string, field string, increment int64) (int64, error)
+
+	// LPush and RPush add the values at the head or tail of the list and return the new length.
+	LPush(ctx context.Context, key string, values ...string) (int64, error)
+	RPush(ctx context.Context, key string, values ...string) (int64, error)
+	// LPop and RPop remove the first or last element and return ErrNotFound if the list is empty.
+	LPop(ctx context.Context, key string) (string, error)
+	RPop(ctx context.Context, key string) (string, error)
+	// LRange returns the elements between the start and stop index (inclusive).
+	// Negative indexes count from the end, -1 is the last element.
+	LRange(ctx context.Context, key string, start int64, stop int64) ([]string, error)
+	// LTrim removes all elements that are not between the start and stop index (inclusive), see LRange.
+	LTrim(ctx context.Context, key string, start int64, stop int64) error
+	LLen(ctx context.Context, key string) (int64, error)
+
+	// SAdd adds the members to the set and returns the number of members that were not in the set before.
+	SAdd(ctx context.Context, key string, members ...string) (int64, error)
+	// SRem removes the members from the set and returns the number of members that were removed.
+	SRem(ctx context.Context, key string, members ...string) (int64, error)
+	// SMembers returns the members in no particular order.
+	SMembers(ctx context.Context, key string) ([]string, error)
+	SIsMember(ctx context.Context, key string, member string) (bool, error)
+
+	// ZAdd adds the members or updates their score and returns the number of members that were added.
+	ZAdd(ctx context.Context, key string, members ...ZMember) (int64, error)
+	ZRem(ctx context.Context, key string, members ...string) (int64, error)
+	// ZRange returns the members between the start and stop rank (inclusive) ordered by score, see LRange.
+	ZRange(ctx context.Context, key string, start int64, stop int64) ([]ZMember, error)
+	// ZRangeByScore returns the members with a score between min and max (inclusive) ordered by score.
+	// Use math.Inf for open ranges.
+	ZRangeByScore(ctx context.Context, key string, min float64, max float64) ([]ZMember, error)
+	// ZRank returns the position of the member ordered by score starting with 0.
+	// It returns ErrNotFound if the member is not in the sorted set.
+	ZRank(ctx context.Context, key string, member string) (int64, error)
+	// ZScore returns ErrNotFound if the member is not in the sorted set.
+	ZScore(ctx context.Context, key string, member string) (float64, error)
+}
+
+// ZMember is a member of a sorted set. Members with the same score are ordered lexicographically.
+type ZMember struct {
+	Member string
+	Score  float64
+}
+
+// HSet sets the fields of the hash in REDIS.
+// If the client was set up with a prefix it will be added in front of the key.
+func (r *RedisClient) HSet(ctx context.Context, key string, values map[string]string) error {
+	if len(values) == 0 {
+		return nil
+	}
+	fields := make([]interface{}, 0, 2*len(values))
+	for field, value := range values {
+		fields = append(fields, field, value)
+	}
+	return redisError(r.Client(ctx).HSet(r.prefixedKey(key), fields...).Err())
+}
+
+// HGet retrieves a field of a hash from REDIS.
+// If the client was set up with a prefix it will be added in front of the key.
+func (r *RedisClient) HGet(ctx context.Context, key string, field string) (string, error) {
+	result, err := r.Client(ctx).HGet(r.prefixedKey(key), field).Result()
+	return result, redisError(err)
+}
+
+// HGetAll retrieves all fields of a hash from REDIS.
+// If the client was set up with a prefix it will be added in front of the key.
+func (r *RedisClient) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	result, err := r.Client(ctx).HGetAll(r.prefixedKey(key)).Result()
+	return result, redisError(err)
+}
+
+// HDel deletes fields of a hash in REDIS.
+// If the client was set up with a prefix it will be added in front of the key.
+func (r *RedisClient) HDel(ctx context.Context, key string, fields ...string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	return redisError(r.Client(ctx).HDel(r.prefixedKey(key), fields...).Err())
+}
+
+// HIncrBy increments a field of a hash in REDIS.
+// If the client was set up with a prefix it will be added in front of the key.
+func (r *RedisClient) HIncrBy(ctx context.Context, key string, field string, increment int64) (int64, error) {
+	result, err := r.Client(ctx).HIncrBy(r.prefixedKey(key), field, increment).Result()
+	return result, redisError(err)
+}
+
+// LPush adds values at the head of a list in REDIS.
+// If the client was set up with a prefix it will be added in front of the key.
+func (r *RedisClient) LPush(ctx context.Context, key string, values ...string) (int64, error) {
+	if len(values) == 0 {
+		return r.LLen(ctx, key)
+	}
+	result, err := r.Client(ctx).LPush(r.prefixedKey(key), toInterfaces(values)...).Result()
+	return result, redisError(err)
+}
+
+// RPush adds values at the tail of a list in REDIS.
+// If the client was set up with a prefix it will be added in front of the key.
+func (r *RedisClient) RPush(ctx context.Context, key string, values ...string) (int64, error) {
+	if len(values) == 0 {
+		return r.LLen(ctx, key)
+	}
+	result, err := r.Client(ctx).RPush(r.prefixedKey(key), toInterfaces(values)...).Result()
+	return result, redisError(err)
+}
+
+// LPop removes the first element of a list in REDIS.
+// If the client was set up with a prefix it will be added in front of the key.
+func (r *RedisClient) LPop(ctx context.Context, key string) (string, error) {
+	result, err := r.Client(ctx).LPop(r.prefixedKey(key)).Result()
+	return result, redisError(err)
+}
+
+// RPop removes the last element of a list in REDIS.
+// If the client was set up with a prefix it will be added in front of the key.
+func (r *RedisClient) RPop(ctx context.Context, key string) (string, error) {
+	result, err := r.Client(ctx).RPop(r.prefixedKey(key)).Result()
+	return result, redisError(err)
+}
+
+// LRange retrieves a range of elements of a list from REDIS.
+// If the client was set up with a prefix it will be added in front of the key.
+func (r *RedisClient) LRange(ctx context.Context, key string, start int64, stop int64) ([]string, error) {
+	result, err := r.Client(ctx).LRange(r.prefixedKey(key), start, stop).Result()
+	return result, redisError(err)
+}
+
+// LTrim trims a list in REDIS to the range of elements.
+// If the client was set up with a prefix it will be added in front of the key.
+func (r *RedisClient) LTrim(ctx context.Context, key string, start int64, stop int64) error {
+	return redisError(r.Client(ctx).LTrim(r.prefixedKey(key), start, stop).Err())
+}
+
+// LLen returns the length of a list in REDIS.
+// If the client was set up with a prefix it will be added in front of the key.
+func (r *RedisClient) LLen(ctx context.Context, key string) (int64, error) {
+	result, err := r.Client(ctx).LLen(r.prefixedKey(key)).Result()
+	return result, redisError(err)
+}
+
+// SAdd adds members to a set in REDIS.
+// If the client was set up with a prefix it will be added in front of the key.
+func (r *RedisClient) SAdd(ctx context.Context, key string, members ...string) (int64, error) {
+	if len(members) == 0 {
+		return 0, nil
+	}
+	result, err := r.Client(ctx).SAdd(r.prefixedKey(key), toInterfaces(members)...).Result()
+	return result, redisError(err)
+}
+
+// SRem removes members from a set in REDIS.
+// If the client was set up with a prefix it will be added in front of the key.
+func (r *RedisClient) SRem(ctx context.Context, key string, members ...string) (int64, error) {
+	if len(members) == 0 {
+		return 0, nil
+	}
+	result, err := r.Client(ctx).SRem(r.prefixedKey(key), toInterfaces(members)...).Result()
+	return result, redisError(err)
+}
+
+// SMembers retrieves all members of a set from REDIS.
+// If the client was set up with a prefix it will be added in front of the key.
+func (r *RedisClient) SMembers(ctx context.Context, key string) ([]string, error) {
+	result, err := r.Client(ctx).SMembers(r.prefixedKey(key)).Result()
+	return result, redisError(err)
+}
+
+// SIsMember checks whether the member is in a set in REDIS.
+// If the client was set up with a prefix it will be added in front of the key.
+func (r *RedisClient) SIsMember(ctx context.Context, key string, member string) (bool, error) {
+	result, err := r.Client(ctx).SIsMember(r.prefixedKey(key), member).Result()
+	return result, redisError(err)
+}
+
+// ZAdd adds members to a sorted set in REDIS.
+// If the client was set up with a prefix it will be added in front of the key.
+func (r *RedisClient) ZAdd(ctx context.Context, key string, members ...ZMember) (int64, error) {
+	if len(members) == 0 {
+		return 0, nil
+	}
+	zMembers := make([]*redis.Z, len(members))
+	for i, member := range members {
+		zMembers[i] = &redis.Z{Score: member.Score, Member: member.Member}
+	}
+	result, err := r.Client(ctx).ZAdd(r.prefixedKey(key), zMembers...).Result()
+	return result, redisError(err)
+}
+
+// ZRem removes members from a sorted set in REDIS.
+// If the client was set up with a prefix it will be added in front of the key.
+func (r *RedisClient) ZRem(ctx context.Context, key string, members ...string) (int64, error) {
+	if len(members) == 0 {
+		return 0, nil
+	}
+	result, err := r.Client(ctx).ZRem(r.prefixedKey(key), toInterfaces(members)...).Result()
+	return result, redisError(err)
+}
+
+// ZRange retrieves a range of members of a sorted set by rank from REDIS.
+// If the client was set up with a prefix it will be added in front of the key.
+func (r *RedisClient) ZRange(ctx context.Context, key string, start int64, stop int64) ([]ZMember, error) {
+	result, err := r.Client(ctx).ZRangeWithScores(r.prefixedKey(key), start, stop).Result()
+	return toZMembers(result), redisError(err)
+}
+
+// ZRangeByScore retrieves the members of a sorted set with a score between min and max from REDIS.
+// If the client was set up with a prefix it will be added in front of the key.
+func (r *RedisClient) ZRangeByScore(ctx context.Context, key string, min float64, max float64) ([]ZMember, error) {
+	result, err := r.Client(ctx).ZRangeByScoreWithScores(r.prefixedKey(key), &redis.ZRangeBy{
+		Min: formatScore(min),
+		Max: formatScore(max),
+	}).Result()
+	return toZMembers(result), redisError(err)
+}
+
+// ZRank returns the rank of a member of a sorted set in REDIS.
+// If the client was set up with a prefix it will be added in front of the key.
+func (r *RedisClient) ZRank(ctx context.Context, key string, member string) (int64, error) {
+	result, err := r.Client(ctx).ZRank(r.prefixedKey(key), member).Result()
+	return result, redisError(err)
+}
+
+// ZScore returns the score of a member of a sorted set in REDIS.
+// If the client was set up with a prefix it will be added in front of the key.
+func (r *RedisClient) ZScore(ctx context.Context, key string, member string) (float64, error) {
+	result, err := r.Client(ctx).ZScore(r.prefixedKey(key), member).Result()
+	return result, redisError(err)
+}
+
+// redisError converts the errors of the REDIS client to the errors of the cache package.
+func redisError(err error) error {
+	switch {
+	case err == redis.Nil:
+		return ErrNotFound
+	case err != nil && strings.HasPrefix(err.Error(), "WRONGTYPE"):
+		return ErrWrongType
+	default:
+		return err
+	}
+}
+
+func toInterfaces(values []string) []interface{} {
+	result := make([]interface{}, len(values))
+	for i, value := range values {
+		result[i] = value
+	}
+	return result
+}
+
+func toZMembers(members []redis.Z) []ZMember {
+	result := make([]ZMember, len(members))
+	for i, member := range members {
+		result[i] = ZMember{Member: member.Member.(string), Score: member.Score}
+	}
+	return result
+}
+
+// formatScore formats the score for REDIS, infinite values are "-inf" and "+inf".
+func formatScore(score float64) string {
+	switch {
+	case math.IsInf(score, -1):
+		return "-inf"
+	case math.IsInf(score, 1):
+		return "+inf"
+	}
+	return strconv.FormatFloat(score, 'g', -1, 64)
+}
@@ -0,0 +1,236 @@
+package cache
+
+import (
+	"context"
+	"math"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"toolkit/app/core/observance"
+)
+
+// collectionCache is implemented by the caches that support collections.
+type collectionCache interface {
+	Cache
+	Collections
+}
+
+// withCollections runs the test with REDIS, the in-memory cache and the decorators.
+func withCollections(t *testing.T, fn func(t *testing.T, c collectionCache)) {
+	t.Run("redis", func(t *testing.T) {
+		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
+			fn(t, client)
+		})
+	})
+
+	t.Run("memory", func(t *testing.T) {
+		fn(t, NewMemory(MemoryConfig{Prefix: "testPrefix"}))
+	})
+
+	t.Run("instrumented", func(t *testing.T) {
+		memory := NewMemory(MemoryConfig{Prefix: "testPrefix"})
+		fn(t, NewInstrumented(memory, observance.NewTestMeasurer(), observance.NewTestLogger(), InstrumentationConfig{}))
+	})
+
+	t.Run("near", func(t *testing.T) {
+		redis, err := miniredis.Run()
+		require.NoError(t, err)
+		defer redis.Close()
+		c := newNearCache(t, redis, observance.NewTestMeasurer())
+		defer c.Close()
+		fn(t, c)
+	})
+}
+
+func TestHashes(t *testing.T) {
+	ctx := context.Background()
+
+	withCollections(t, func(t *testing.T, c collectionCache) {
+		_, err := c.HGet(ctx, "user", "name")
+		assert.Equal(t, ErrNotFound, err)
+		all, err := c.HGetAll(ctx, "user")
+		require.NoError(t, err)
+		assert.Empty(t, all)
+
+		require.NoError(t, c.HSet(ctx, "user", map[string]string{"name": "Jane", "city": "Berlin"}))
+		name, err := c.HGet(ctx, "user", "name")
+		require.NoError(t, err)
+		assert.Equal(t, "Jane", name)
+		_, err = c.HGet(ctx, "user", "missing")
+		assert.Equal(t, ErrNotFound, err)
+
+		visits, err := c.HIncrBy(ctx, "user", "visits", 2)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), visits)
+		visits, err = c.HIncrBy(ctx, "user", "visits", -1)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), visits)
+		_, err = c.HIncrBy(ctx, "user", "name", 1)
+		assert.Error(t, err)
+
+		require.NoError(t, c.HDel(ctx, "user", "city", "missing"))
+		all, err = c.HGetAll(ctx, "user")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"name": "Jane", "visits": "1"}, all)
+
+		require.NoError(t, c.HDel(ctx, "user", "name", "visits"))
+		_, err = c.TTL(ctx, "user")
+		assert.Equal(t, ErrNotFound, err, "empty hash is deleted")
+	})
+}
+
+func TestLists(t *testing.T) {
+	ctx := context.Background()
+
+	withCollections(t, func(t *testing.T, c collectionCache) {
+		_, err := c.LPop(ctx, "queue")
+		assert.Equal(t, ErrNotFound, err)
+
+		length, err := c.RPush(ctx, "queue", "b", "c")
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), length)
+		length, err = c.LPush(ctx, "queue", "a", "0")
+		require.NoError(t, err)
+		assert.Equal(t, int64(4), length)
+
+		items, err := c.LRange(ctx, "queue", 0, -1)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"0", "a", "b", "c"}, items)
+		items, err = c.LRange(ctx, "queue", -2, 10)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"b", "c"}, items)
+		items, err = c.LRange(ctx, "queue", 3, 1)
+		require.NoError(t, err)
+		assert.Empty(t, items)
+
+		first, err := c.LPop(ctx, "queue")
+		require.NoError(t, err)
+		assert.Equal(t, "0", first)
+		last, err := c.RPop(ctx, "queue")
+		require.NoError(t, err)
+		assert.Equal(t, "c", last)
+
+		require.NoError(t, c.LTrim(ctx, "queue", 1, -1))
+		length, err = c.LLen(ctx, "queue")
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), length)
+
+		require.NoError(t, c.LTrim(ctx, "queue", 5, 10))
+		length, err = c.LLen(ctx, "queue")
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), length)
+	})
+}
+
+func TestSets(t *testing.T) {
+	ctx := context.Background()
+
+	withCollections(t, func(t *testing.T, c collectionCache) {
+		added, err := c.SAdd(ctx, "tags", "go", "redis", "go")
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), added)
+		added, err = c.SAdd(ctx, "tags", "go", "cache")
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), added)
+
+		members, err := c.SMembers(ctx, "tags")
+		require.NoError(t, err)
+		sort.Strings(members)
+		assert.Equal(t, []string{"cache", "go", "redis"}, members)
+
+		found, err := c.SIsMember(ctx, "tags", "go")
+		require.NoError(t, err)
+		assert.True(t, found)
+		found, err = c.SIsMember(ctx, "missing", "go")
+		require.NoError(t, err)
+		assert.False(t, found)
+
+		removed, err := c.SRem(ctx, "tags", "go", "missing")
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), removed)
+		members, err = c.SMembers(ctx, "missing")
+		require.NoError(t, err)
+		assert.Empty(t, members)
+	})
+}
+
+func TestSortedSets(t *testing.T) {
+	ctx := context.Background()
+
+	withCollections(t, func(t *testing.T, c collectionCache) {
+		added, err := c.ZAdd(ctx, "scores", ZMember{Member: "b", Score: 20}, ZMember{Member: "a", Score: 10}, ZMember{Member: "c", Score: 20})
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), added)
+		added, err = c.ZAdd(ctx, "scores", ZMember{Member: "a", Score: 30})
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), added)
+
+		members, err := c.ZRange(ctx, "scores", 0, -1)
+		require.NoError(t, err)
+		assert.Equal(t, []ZMember{{"b", 20}, {"c", 20}, {"a", 30}}, members)
+
+		members, err = c.ZRangeByScore(ctx, "scores", 20, 25)
+		require.NoError(t, err)
+		assert.Equal(t, []ZMember{{"b", 20}, {"c", 20}}, members)
+		members, err = c.ZRangeByScore(ctx, "scores", 21, math.Inf(1))
+		require.NoError(t, err)
+		assert.Equal(t, []ZMember{{"a", 30}}, members)
+		members, err = c.ZRangeByScore(ctx, "scores", math.Inf(-1), 10)
+		require.NoError(t, err)
+		assert.Empty(t, members)
+
+		rank, err := c.ZRank(ctx, "scores", "a")
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), rank)
+		_, err = c.ZRank(ctx, "scores", "missing")
+		assert.Equal(t, ErrNotFound, err)
+
+		score, err := c.ZScore(ctx, "scores", "c")
+		require.NoError(t, err)
+		assert.Equal(t, float64(20), score)
+		_, err = c.ZScore(ctx, "missing", "c")
+		assert.Equal(t, ErrNotFound, err)
+
+		removed, err := c.ZRem(ctx, "scores", "a", "missing")
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), removed)
+	})
+}
+
+func TestCollectionTypes(t *testing.T) {
+	ctx := context.Background()
+
+	withCollections(t, func(t *testing.T, c collectionCache) {
+		require.NoError(t, c.Set(ctx, "string", "value", 0))
+		_, err := c.HGet(ctx, "string", "field")
+		assert.Equal(t, ErrWrongType, err)
+		_, err = c.LPush(ctx, "string", "value")
+		assert.Equal(t, ErrWrongType, err)
+
+		_, err = c.SAdd(ctx, "set", "member")
+		require.NoError(t, err)
+		_, err = c.ZAdd(ctx, "set", ZMember{Member: "member"})
+		assert.Equal(t, ErrWrongType, err)
+		_, err = c.Incr(ctx, "set")
+		assert.Error(t, err)
+		values, err := c.MGet(ctx, "set", "string")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"string": "value"}, values)
+
+		batch := NewBatch()
+		batch.Expire("set", time.Minute)
+		require.NoError(t, ExecBatch(ctx, c, batch))
+		ttl, err := c.TTL(ctx, "set")
+		require.NoError(t, err)
+		assert.Equal(t, time.Minute, ttl.Round(time.Second))
+
+		require.NoError(t, c.Set(ctx, "set", "overwritten", 0))
+		result, err := c.Get(ctx, "set")
+		require.NoError(t, err)
+		assert.Equal(t, "overwritten", result)
+	})
+}
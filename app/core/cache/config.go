@@ -0,0 +1,297 @@
+package cache
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/pkg/errors"
+)
+
+const defaultRedisPort = "6379"
+
+// Modes of the REDIS setup.
+const (
+	// ModeStandalone connects to a single REDIS server (default).
+	ModeStandalone = "standalone"
+	// ModeSentinel asks the sentinels for the current master and follows failovers.
+	ModeSentinel = "sentinel"
+	// ModeCluster connects to a REDIS Cluster and routes the commands to the node that holds the key.
+	ModeCluster = "cluster"
+)
+
+// Config holds all configuration values for the REDIS setup.
+// All fields except Host (or Addrs) are optional, the defaults of the REDIS client are used for unset values.
+type Config struct {
+	// Mode is ModeStandalone (default), ModeSentinel or ModeCluster.
+	Mode string
+	Host string
+	Port string // default 6379
+	// Addrs lists the addresses ("host:port") of the sentinels or of the cluster nodes that are used to discover
+	// the cluster. Host and Port are added to the list if they are set.
+	Addrs []string
+	// MasterName is the name of the master monitored by the sentinels, it is required for ModeSentinel.
+	MasterName string
+	// SentinelPassword is used to authenticate with the sentinels if they require a password.
+	SentinelPassword string
+	// Username is only needed for REDIS 6 ACLs, otherwise only the Password is used.
+	Username string
+	Password string
+	DB       int // not supported by REDIS Cluster
+	// Prefix is added in front of all keys separated with ":".
+	Prefix string
+	// Encoding defines how SetJSON serializes the values, plain JSON is used by default.
+	Encoding Encoding
+
+	// TLS enables TLS for the connection. TLSServerName overrides the name used to verify the certificate and
+	// TLSCACertFile can point to a PEM file with the CA certificates if the server certificate is not signed by a public CA.
+	TLS                   bool
+	TLSServerName         string
+	TLSCACertFile         string
+	TLSInsecureSkipVerify bool
+
+	PoolSize     int
+	MinIdleConns int
+	PoolTimeout  time.Duration
+	IdleTimeout  time.Duration
+	MaxConnAge   time.Duration
+	MaxRetries   int
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+}
+
+// ParseURL creates a Config from a URL in the format
+// "redis://[[username]:password@]host[:port][/db][?option=value]" or "rediss://..." for TLS.
+// The supported options are mode, master_name, sentinel_password, addr (can be repeated to add further
+// sentinels or cluster nodes), prefix, pool_size, min_idle_conns, pool_timeout, idle_timeout, max_conn_age,
+// max_retries, dial_timeout, read_timeout, write_timeout, tls_server_name, tls_ca_cert_file,
+// tls_insecure_skip_verify, codec, compression and compression_threshold (see ParseEncoding).
+// Durations use the format of time.ParseDuration, e.g. "500ms".
+func ParseURL(redisURL string) (Config, error) {
+	config := Config{}
+	u, err := url.Parse(redisURL)
+	if err != nil {
+		return config, errors.Wrap(err, "invalid REDIS URL")
+	}
+
+	switch u.Scheme {
+	case "redis":
+	case "rediss":
+		config.TLS = true
+	default:
+		return config, errors.Errorf("invalid REDIS URL scheme %q", u.Scheme)
+	}
+
+	if u.User != nil {
+		// Like in go-redis, "redis://name@host" sets the username, password-only auth needs "redis://:password@host".
+		config.Username = u.User.Username()
+		config.Password, _ = u.User.Password()
+	}
+
+	config.Host = u.Hostname()
+	config.Port = u.Port()
+	if config.Host == "" {
+		return config, errors.New("REDIS URL does not contain a host")
+	}
+
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		config.DB, err = strconv.Atoi(db)
+		if err != nil {
+			return config, errors.Errorf("invalid REDIS DB %q", db)
+		}
+	}
+
+	if err := config.parseOptions(u.Query()); err != nil {
+		return config, err
+	}
+	return config, nil
+}
+
+func (c *Config) parseOptions(query url.Values) error {
+	options := optionParser{query: query, known: map[string]bool{}}
+	c.Mode = options.value("mode")
+	c.MasterName = options.value("master_name")
+	c.SentinelPassword = options.value("sentinel_password")
+	options.known["addr"] = true
+	c.Addrs = query["addr"]
+	c.Prefix = options.value("prefix")
+	c.TLSServerName = options.value("tls_server_name")
+	c.TLSCACertFile = options.value("tls_ca_cert_file")
+	c.TLSInsecureSkipVerify = options.bool("tls_insecure_skip_verify")
+	c.PoolSize = options.int("pool_size")
+	c.MinIdleConns = options.int("min_idle_conns")
+	c.PoolTimeout = options.duration("pool_timeout")
+	c.IdleTimeout = options.duration("idle_timeout")
+	c.MaxConnAge = options.duration("max_conn_age")
+	c.MaxRetries = options.int("max_retries")
+	c.DialTimeout = options.duration("dial_timeout")
+	c.ReadTimeout = options.duration("read_timeout")
+	c.WriteTimeout = options.duration("write_timeout")
+	codec, compression := options.value("codec"), options.value("compression")
+	encoding, err := ParseEncoding(codec, compression, options.int("compression_threshold"))
+	if err != nil {
+		return errors.Wrap(err, "invalid REDIS URL option")
+	}
+	c.Encoding = encoding
+
+	for name := range query {
+		if !options.known[name] {
+			return errors.Errorf("unknown REDIS URL option %q", name)
+		}
+	}
+	return options.err
+}
+
+// Addr returns the address in the format "host:port".
+func (c *Config) Addr() string {
+	port := c.Port
+	if port == "" {
+		port = defaultRedisPort
+	}
+	return net.JoinHostPort(c.Host, port)
+}
+
+// UniversalOptions returns the options for the REDIS client. They contain the addresses of the sentinels
+// or cluster nodes or, in standalone mode, the address of the server.
+func (c *Config) UniversalOptions() (*redis.UniversalOptions, error) {
+	options := &redis.UniversalOptions{
+		Addrs:        c.addrs(),
+		MasterName:   c.MasterName,
+		Username:     c.Username,
+		Password:     c.Password,
+		DB:           c.DB,
+		PoolSize:     c.PoolSize,
+		MinIdleConns: c.MinIdleConns,
+		PoolTimeout:  c.PoolTimeout,
+		IdleTimeout:  c.IdleTimeout,
+		MaxConnAge:   c.MaxConnAge,
+		MaxRetries:   c.MaxRetries,
+		DialTimeout:  c.DialTimeout,
+		ReadTimeout:  c.ReadTimeout,
+		WriteTimeout: c.WriteTimeout,
+	}
+
+	if c.TLS {
+		tlsConfig, err := c.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		options.TLSConfig = tlsConfig
+	}
+	return options, nil
+}
+
+// newClient creates the REDIS client for the configured mode.
+func (c *Config) newClient() (redis.UniversalClient, error) {
+	options, err := c.UniversalOptions()
+	if err != nil {
+		return nil, err
+	}
+	if len(options.Addrs) == 0 {
+		return nil, errors.New("REDIS host is missing")
+	}
+
+	switch c.Mode {
+	case "", ModeStandalone:
+		return redis.NewClient(options.Simple()), nil
+	case ModeSentinel:
+		if c.MasterName == "" {
+			return nil, errors.New("REDIS master name is required for sentinel mode")
+		}
+		failoverOptions := options.Failover()
+		failoverOptions.SentinelPassword = c.SentinelPassword
+		return redis.NewFailoverClient(failoverOptions), nil
+	case ModeCluster:
+		if c.DB != 0 {
+			return nil, errors.New("REDIS Cluster does not support selecting a DB")
+		}
+		return redis.NewClusterClient(options.Cluster()), nil
+	default:
+		return nil, errors.Errorf("unknown REDIS mode %q", c.Mode)
+	}
+}
+
+// addrs returns the address of Host and Port followed by Addrs.
+func (c *Config) addrs() []string {
+	addrs := []string{}
+	if c.Host != "" {
+		addrs = append(addrs, c.Addr())
+	}
+	return append(addrs, c.Addrs...)
+}
+
+func (c *Config) tlsConfig() (*tls.Config, error) {
+	// Without server name, the host of the address that is dialed is verified.
+	tlsConfig := &tls.Config{
+		ServerName:         c.TLSServerName,
+		InsecureSkipVerify: c.TLSInsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if c.TLSCACertFile != "" {
+		pem, err := ioutil.ReadFile(c.TLSCACertFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not read REDIS CA certificates")
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no valid certificates found in %s", c.TLSCACertFile)
+		}
+	}
+	return tlsConfig, nil
+}
+
+// optionParser parses the query parameters of a REDIS URL and keeps the first error.
+type optionParser struct {
+	query url.Values
+	known map[string]bool
+	err   error
+}
+
+func (p *optionParser) value(name string) string {
+	p.known[name] = true
+	return p.query.Get(name)
+}
+
+func (p *optionParser) int(name string) int {
+	value := p.value(name)
+	if value == "" || p.err != nil {
+		return 0
+	}
+	result, err := strconv.Atoi(value)
+	if err != nil {
+		p.err = errors.Errorf("invalid value %q for REDIS URL option %s", value, name)
+	}
+	return result
+}
+
+func (p *optionParser) duration(name string) time.Duration {
+	value := p.value(name)
+	if value == "" || p.err != nil {
+		return 0
+	}
+	result, err := time.ParseDuration(value)
+	if err != nil {
+		p.err = errors.Errorf("invalid value %q for REDIS URL option %s", value, name)
+	}
+	return result
+}
+
+func (p *optionParser) bool(name string) bool {
+	value := p.value(name)
+	if value == "" || p.err != nil {
+		return false
+	}
+	result, err := strconv.ParseBool(value)
+	if err != nil {
+		p.err = errors.Errorf("invalid value %q for REDIS URL option %s", value, name)
+	}
+	return result
+}
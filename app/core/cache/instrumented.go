@@ -0,0 +1,286 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"toolkit/app/core/observance"
+)
+
+// Names of the metrics recorded by InstrumentedCache.
+const (
+	MetricOperations        = "cache_operations_total"
+	MetricOperationDuration = "cache_operation_duration_seconds"
+)
+
+// Values of the "result" label recorded by InstrumentedCache.
+const (
+	ResultHit   = "hit"
+	ResultMiss  = "miss"
+	ResultOK    = "ok"
+	ResultError = "error"
+)
+
+// otherKeyPrefix is used as "prefix" label for all keys whose prefix was not configured.
+const otherKeyPrefix = "other"
+
+// InstrumentationConfig holds the settings for InstrumentedCache.
+type InstrumentationConfig struct {
+	// Name is added as label "cache" to all metrics so multiple caches can be told apart (optional).
+	Name string
+	// KeyPrefixes lists the key prefixes (the part of the key before the first ":") that should be
+	// used as "prefix" label. All other keys are reported as "other" to keep the number of label values bounded.
+	KeyPrefixes []string
+}
+
+// InstrumentedCache wraps a Cache and records metrics for every operation.
+// Per operation it counts hits, misses (ErrNotFound), successful writes and errors and it
+// tracks the latency as histogram. Errors are additionally logged with level "warning".
+type InstrumentedCache struct {
+	cache       Cache
+	metrics     observance.Measurer
+	logger      observance.Logger
+	name        string
+	keyPrefixes map[string]bool
+}
+
+// NewInstrumented creates a new InstrumentedCache that wraps the given cache.
+func NewInstrumented(cache Cache, metrics observance.Measurer, logger observance.Logger, config InstrumentationConfig) *InstrumentedCache {
+	keyPrefixes := make(map[string]bool, len(config.KeyPrefixes))
+	for _, prefix := range config.KeyPrefixes {
+		keyPrefixes[prefix] = true
+	}
+
+	return &InstrumentedCache{
+		cache:       cache,
+		metrics:     metrics,
+		logger:      logger,
+		name:        config.Name,
+		keyPrefixes: keyPrefixes,
+	}
+}
+
+// Prefix returns the prefix of the wrapped cache.
+func (c *InstrumentedCache) Prefix() string {
+	return c.cache.Prefix()
+}
+
+// Encoding returns the encoding of the wrapped cache.
+func (c *InstrumentedCache) Encoding() Encoding {
+	return encodingOf(c.cache)
+}
+
+// Set calls Set of the wrapped cache and records the metrics.
+func (c *InstrumentedCache) Set(ctx context.Context, key string, value string, expiration time.Duration) error {
+	start := time.Now()
+	err := c.cache.Set(ctx, key, value, expiration)
+	c.recordWrite("set", key, start, err)
+	return err
+}
+
+// Get calls Get of the wrapped cache and records the metrics.
+func (c *InstrumentedCache) Get(ctx context.Context, key string) (string, error) {
+	start := time.Now()
+	result, err := c.cache.Get(ctx, key)
+	c.recordRead("get", key, start, err)
+	return result, err
+}
+
+// SetBool calls SetBool of the wrapped cache and records the metrics.
+func (c *InstrumentedCache) SetBool(ctx context.Context, key string, value bool, expiration time.Duration) error {
+	start := time.Now()
+	err := c.cache.SetBool(ctx, key, value, expiration)
+	c.recordWrite("set_bool", key, start, err)
+	return err
+}
+
+// GetBool calls GetBool of the wrapped cache and records the metrics.
+func (c *InstrumentedCache) GetBool(ctx context.Context, key string) (bool, error) {
+	start := time.Now()
+	result, err := c.cache.GetBool(ctx, key)
+	c.recordRead("get_bool", key, start, err)
+	return result, err
+}
+
+// SetInt calls SetInt of the wrapped cache and records the metrics.
+func (c *InstrumentedCache) SetInt(ctx context.Context, key string, value int64, expiration time.Duration) error {
+	start := time.Now()
+	err := c.cache.SetInt(ctx, key, value, expiration)
+	c.recordWrite("set_int", key, start, err)
+	return err
+}
+
+// GetInt calls GetInt of the wrapped cache and records the metrics.
+func (c *InstrumentedCache) GetInt(ctx context.Context, key string) (int64, error) {
+	start := time.Now()
+	result, err := c.cache.GetInt(ctx, key)
+	c.recordRead("get_int", key, start, err)
+	return result, err
+}
+
+// Incr calls Incr of the wrapped cache and records the metrics.
+func (c *InstrumentedCache) Incr(ctx context.Context, key string) (int64, error) {
+	start := time.Now()
+	result, err := c.cache.Incr(ctx, key)
+	c.recordWrite("incr", key, start, err)
+	return result, err
+}
+
+// SetJSON calls SetJSON of the wrapped cache and records the metrics.
+func (c *InstrumentedCache) SetJSON(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	start := time.Now()
+	err := c.cache.SetJSON(ctx, key, value, expiration)
+	c.recordWrite("set_json", key, start, err)
+	return err
+}
+
+// GetJSON calls GetJSON of the wrapped cache and records the metrics.
+func (c *InstrumentedCache) GetJSON(ctx context.Context, key string, result interface{}) error {
+	start := time.Now()
+	err := c.cache.GetJSON(ctx, key, result)
+	c.recordRead("get_json", key, start, err)
+	return err
+}
+
+// Del calls Del of the wrapped cache and records the metrics.
+func (c *InstrumentedCache) Del(ctx context.Context, key string) error {
+	start := time.Now()
+	err := c.cache.Del(ctx, key)
+	c.recordWrite("del", key, start, err)
+	return err
+}
+
+// Close closes the wrapped cache.
+func (c *InstrumentedCache) Close() error {
+	return c.cache.Close()
+}
+
+// TTL calls TTL of the wrapped cache and records the metrics.
+// ErrNoTTLSet is not counted as error since the key was found.
+func (c *InstrumentedCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	start := time.Now()
+	result, err := c.cache.TTL(ctx, key)
+	if err == ErrNoTTLSet {
+		c.record("ttl", key, start, ResultHit, nil)
+		return result, err
+	}
+	c.recordRead("ttl", key, start, err)
+	return result, err
+}
+
+// MGet calls MGet of the wrapped cache and records the metrics. The result is "miss" if any key was not found,
+// the "prefix" label is taken from the first key.
+func (c *InstrumentedCache) MGet(ctx context.Context, keys ...string) (map[string]string, error) {
+	start := time.Now()
+	result, err := c.cache.MGet(ctx, keys...)
+	c.recordMany("mget", keys, start, len(result) < len(keys), err)
+	return result, err
+}
+
+// MSet calls MSet of the wrapped cache and records the metrics. The "prefix" label is taken from any of the keys.
+func (c *InstrumentedCache) MSet(ctx context.Context, values map[string]string, expiration time.Duration) error {
+	start := time.Now()
+	err := c.cache.MSet(ctx, values, expiration)
+	key := ""
+	for key = range values {
+		break
+	}
+	c.recordWrite("mset", key, start, err)
+	return err
+}
+
+// MGetJSON calls MGetJSON of the wrapped cache and records the metrics, see MGet.
+func (c *InstrumentedCache) MGetJSON(ctx context.Context, keys []string, result interface{}) ([]string, error) {
+	start := time.Now()
+	missing, err := c.cache.MGetJSON(ctx, keys, result)
+	c.recordMany("mget_json", keys, start, len(missing) > 0, err)
+	return missing, err
+}
+
+// DelMany calls DelMany of the wrapped cache and records the metrics.
+func (c *InstrumentedCache) DelMany(ctx context.Context, keys ...string) error {
+	start := time.Now()
+	err := c.cache.DelMany(ctx, keys...)
+	c.recordWrite("del_many", firstKey(keys), start, err)
+	return err
+}
+
+// Exec executes the batch with the wrapped cache and records the metrics, see ExecBatch.
+// The "prefix" label is taken from the first command.
+func (c *InstrumentedCache) Exec(ctx context.Context, batch *Batch) error {
+	start := time.Now()
+	err := ExecBatch(ctx, c.cache, batch)
+	key := ""
+	if batch.Len() > 0 {
+		key = batch.commands[0].key
+	}
+	c.recordWrite("exec", key, start, err)
+	return err
+}
+
+func (c *InstrumentedCache) recordRead(operation string, key string, start time.Time, err error) {
+	if err == ErrNotFound {
+		c.record(operation, key, start, ResultMiss, nil)
+		return
+	}
+	c.record(operation, key, start, ResultHit, err)
+}
+
+func (c *InstrumentedCache) recordMany(operation string, keys []string, start time.Time, missed bool, err error) {
+	if missed && err == nil {
+		c.record(operation, firstKey(keys), start, ResultMiss, nil)
+		return
+	}
+	c.record(operation, firstKey(keys), start, ResultHit, err)
+}
+
+func (c *InstrumentedCache) recordWrite(operation string, key string, start time.Time, err error) {
+	c.record(operation, key, start, ResultOK, err)
+}
+
+// record tracks the duration and the result of the operation. If err is not nil the result is always "error".
+func (c *InstrumentedCache) record(operation string, key string, start time.Time, result string, err error) {
+	prefix := c.keyPrefix(key)
+	c.metrics.ObserveDurationSince(MetricOperationDuration, start, observance.Labels{
+		"cache":     c.name,
+		"operation": operation,
+		"prefix":    prefix,
+	})
+
+	if err != nil {
+		result = ResultError
+		c.logger.WithFields(observance.Fields{
+			"cache":     c.name,
+			"operation": operation,
+			"key":       key,
+		}).WithError(err).Warn("cache operation failed")
+	}
+
+	c.metrics.IncrementWithLabels(MetricOperations, observance.Labels{
+		"cache":     c.name,
+		"operation": operation,
+		"prefix":    prefix,
+		"result":    result,
+	})
+}
+
+// keyPrefix returns the part of the key before the first ":" if it was configured as key prefix, otherwise "other".
+func (c *InstrumentedCache) keyPrefix(key string) string {
+	prefix := key
+	if i := strings.Index(key, ":"); i >= 0 {
+		prefix = key[:i]
+	}
+
+	if c.keyPrefixes[prefix] {
+		return prefix
+	}
+	return otherKeyPrefix
+}
+
+func firstKey(keys []string) string {
+	if len(keys) == 0 {
+		return ""
+	}
+	return keys[0]
+}
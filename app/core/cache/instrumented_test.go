@@ -0,0 +1,155 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"toolkit/app/core/observance"
+)
+
+type recordedMetric struct {
+	name   string
+	labels observance.Labels
+}
+
+// measurerStub records the labeled counters and histograms, all other methods are no-ops.
+type measurerStub struct {
+	counters   []recordedMetric
+	histograms []recordedMetric
+}
+
+func (m *measurerStub) Increment(name string)                                 {}
+func (m *measurerStub) SetGauge(name string, value float64)                   {}
+func (m *measurerStub) SetGaugeInt64(name string, value int64)                {}
+func (m *measurerStub) SetGaugeWithLabels(string, float64, observance.Labels) {}
+func (m *measurerStub) DurationSince(name string, start time.Time)            {}
+func (m *measurerStub) Observe(string, float64, observance.Labels)            {}
+
+func (m *measurerStub) IncrementWithLabels(name string, labels observance.Labels) {
+	m.counters = append(m.counters, recordedMetric{name, labels})
+}
+
+func (m *measurerStub) ObserveDurationSince(name string, start time.Time, labels observance.Labels) {
+	m.histograms = append(m.histograms, recordedMetric{name, labels})
+}
+
+func TestInstrumentedCache(t *testing.T) {
+	t.Run("implements Cache", func(t *testing.T) {
+		assert.Implements(t, (*Cache)(nil), &InstrumentedCache{})
+		assert.Implements(t, (*Collections)(nil), &InstrumentedCache{})
+	})
+
+	t.Run("hit and miss", func(t *testing.T) {
+		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
+			metrics := &measurerStub{}
+			c := NewInstrumented(client, metrics, observance.NewTestLogger(), InstrumentationConfig{
+				Name:        "main",
+				KeyPrefixes: []string{"user"},
+			})
+
+			require.NoError(t, redis.Set("testPrefix:user:1", "someValue"))
+			result, err := c.Get(context.Background(), "user:1")
+			require.NoError(t, err)
+			assert.Equal(t, "someValue", result)
+
+			_, err = c.Get(context.Background(), "feature:1")
+			assert.Equal(t, ErrNotFound, err)
+
+			require.Len(t, metrics.counters, 2)
+			assert.Equal(t, MetricOperations, metrics.counters[0].name)
+			assert.Equal(t, observance.Labels{"cache": "main", "operation": "get", "prefix": "user", "result": "hit"}, metrics.counters[0].labels)
+			assert.Equal(t, observance.Labels{"cache": "main", "operation": "get", "prefix": "other", "result": "miss"}, metrics.counters[1].labels)
+
+			require.Len(t, metrics.histograms, 2)
+			assert.Equal(t, MetricOperationDuration, metrics.histograms[0].name)
+			assert.Equal(t, observance.Labels{"cache": "main", "operation": "get", "prefix": "user"}, metrics.histograms[0].labels)
+		})
+	})
+
+	t.Run("write", func(t *testing.T) {
+		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
+			metrics := &measurerStub{}
+			c := NewInstrumented(client, metrics, observance.NewTestLogger(), InstrumentationConfig{})
+
+			err := c.SetJSON(context.Background(), "someKey", testStruct{Name: "Kathryn Janeway"}, time.Minute)
+			require.NoError(t, err)
+
+			require.Len(t, metrics.counters, 1)
+			assert.Equal(t, observance.Labels{"cache": "", "operation": "set_json", "prefix": "other", "result": "ok"}, metrics.counters[0].labels)
+		})
+	})
+
+	t.Run("TTL not set counts as hit", func(t *testing.T) {
+		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
+			metrics := &measurerStub{}
+			c := NewInstrumented(client, metrics, observance.NewTestLogger(), InstrumentationConfig{})
+
+			require.NoError(t, redis.Set("testPrefix:someKey", "100"))
+			_, err := c.TTL(context.Background(), "someKey")
+			assert.Equal(t, ErrNoTTLSet, err)
+
+			require.Len(t, metrics.counters, 1)
+			assert.Equal(t, "hit", metrics.counters[0].labels["result"])
+		})
+	})
+
+	t.Run("multi-key operations", func(t *testing.T) {
+		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
+			metrics := &measurerStub{}
+			c := NewInstrumented(client, metrics, observance.NewTestLogger(), InstrumentationConfig{KeyPrefixes: []string{"user"}})
+			ctx := context.Background()
+
+			require.NoError(t, c.MSet(ctx, map[string]string{"user:1": "one"}, 0))
+			_, err := c.MGet(ctx, "user:1")
+			require.NoError(t, err)
+			_, err = c.MGet(ctx, "user:1", "user:2")
+			require.NoError(t, err)
+			batch := NewBatch()
+			batch.Del("user:1")
+			require.NoError(t, c.Exec(ctx, batch))
+
+			require.Len(t, metrics.counters, 4)
+			assert.Equal(t, observance.Labels{"cache": "", "operation": "mset", "prefix": "user", "result": "ok"}, metrics.counters[0].labels)
+			assert.Equal(t, observance.Labels{"cache": "", "operation": "mget", "prefix": "user", "result": "hit"}, metrics.counters[1].labels)
+			assert.Equal(t, observance.Labels{"cache": "", "operation": "mget", "prefix": "user", "result": "miss"}, metrics.counters[2].labels)
+			assert.Equal(t, observance.Labels{"cache": "", "operation": "exec", "prefix": "user", "result": "ok"}, metrics.counters[3].labels)
+		})
+	})
+
+	t.Run("collections", func(t *testing.T) {
+		metrics := &measurerStub{}
+		c := NewInstrumented(NewMemory(MemoryConfig{}), metrics, observance.NewTestLogger(), InstrumentationConfig{KeyPrefixes: []string{"user"}})
+		ctx := context.Background()
+
+		require.NoError(t, c.HSet(ctx, "user:1", map[string]string{"name": "Jane"}))
+		_, err := c.HGet(ctx, "user:1", "age")
+		assert.Equal(t, ErrNotFound, err)
+		_, err = c.LPop(ctx, "user:2")
+		assert.Equal(t, ErrNotFound, err)
+		_, err = c.LPush(ctx, "user:1", "a")
+		assert.Equal(t, ErrWrongType, err)
+
+		require.Len(t, metrics.counters, 4)
+		assert.Equal(t, observance.Labels{"cache": "", "operation": "hset", "prefix": "user", "result": "ok"}, metrics.counters[0].labels)
+		assert.Equal(t, observance.Labels{"cache": "", "operation": "hget", "prefix": "user", "result": "miss"}, metrics.counters[1].labels)
+		assert.Equal(t, observance.Labels{"cache": "", "operation": "lpop", "prefix": "user", "result": "miss"}, metrics.counters[2].labels)
+		assert.Equal(t, observance.Labels{"cache": "", "operation": "lpush", "prefix": "user", "result": "error"}, metrics.counters[3].labels)
+		require.Len(t, metrics.histograms, 4)
+	})
+
+	t.Run("collections of a cache without collections", func(t *testing.T) {
+		metrics := &measurerStub{}
+		// Embedding the interface hides the collection methods of the memory cache.
+		wrapped := struct{ Cache }{NewMemory(MemoryConfig{})}
+		c := NewInstrumented(wrapped, metrics, observance.NewTestLogger(), InstrumentationConfig{})
+
+		_, err := c.SAdd(context.Background(), "tags", "a")
+		assert.Equal(t, ErrCollectionsNotSupported, err)
+		require.Len(t, metrics.counters, 1)
+		assert.Equal(t, "error", metrics.counters[0].labels["result"])
+	})
+}
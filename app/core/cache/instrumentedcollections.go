@@ -0,0 +1,282 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrCollectionsNotSupported is returned by the Collections methods of InstrumentedCache
+// if the wrapped cache does not implement Collections, e.g. a mock of the Cache interface.
+var ErrCollectionsNotSupported = errors.New("cache does not support collections")
+
+// collections returns the wrapped cache as Collections.
+func (c *InstrumentedCache) collections() (Collections, error) {
+	collections, ok := c.cache.(Collections)
+	if !ok {
+		return nil, ErrCollectionsNotSupported
+	}
+	return collections, nil
+}
+
+// HSet calls HSet of the wrapped cache and records the metrics.
+func (c *InstrumentedCache) HSet(ctx context.Context, key string, values map[string]string) error {
+	start := time.Now()
+	collections, err := c.collections()
+	if err == nil {
+		err = collections.HSet(ctx, key, values)
+	}
+	c.recordWrite("hset", key, start, err)
+	return err
+}
+
+// HGet calls HGet of the wrapped cache and records the metrics.
+func (c *InstrumentedCache) HGet(ctx context.Context, key string, field string) (string, error) {
+	start := time.Now()
+	var result string
+	collections, err := c.collections()
+	if err == nil {
+		result, err = collections.HGet(ctx, key, field)
+	}
+	c.recordRead("hget", key, start, err)
+	return result, err
+}
+
+// HGetAll calls HGetAll of the wrapped cache and records the metrics.
+func (c *InstrumentedCache) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	start := time.Now()
+	var result map[string]string
+	collections, err := c.collections()
+	if err == nil {
+		result, err = collections.HGetAll(ctx, key)
+	}
+	c.recordRead("hget_all", key, start, err)
+	return result, err
+}
+
+// HDel calls HDel of the wrapped cache and records the metrics.
+func (c *InstrumentedCache) HDel(ctx context.Context, key string, fields ...string) error {
+	start := time.Now()
+	collections, err := c.collections()
+	if err == nil {
+		err = collections.HDel(ctx, key, fields...)
+	}
+	c.recordWrite("hdel", key, start, err)
+	return err
+}
+
+// HIncrBy calls HIncrBy of the wrapped cache and records the metrics.
+func (c *InstrumentedCache) HIncrBy(ctx context.Context, key string, field string, increment int64) (int64, error) {
+	start := time.Now()
+	var result int64
+	collections, err := c.collections()
+	if err == nil {
+		result, err = collections.HIncrBy(ctx, key, field, increment)
+	}
+	c.recordWrite("hincr_by", key, start, err)
+	return result, err
+}
+
+// LPush calls LPush of the wrapped cache and records the metrics.
+func (c *InstrumentedCache) LPush(ctx context.Context, key string, values ...string) (int64, error) {
+	start := time.Now()
+	var result int64
+	collections, err := c.collections()
+	if err == nil {
+		result, err = collections.LPush(ctx, key, values...)
+	}
+	c.recordWrite("lpush", key, start, err)
+	return result, err
+}
+
+// RPush calls RPush of the wrapped cache and records the metrics.
+func (c *InstrumentedCache) RPush(ctx context.Context, key string, values ...string) (int64, error) {
+	start := time.Now()
+	var result int64
+	collections, err := c.collections()
+	if err == nil {
+		result, err = collections.RPush(ctx, key, values...)
+	}
+	c.recordWrite("rpush", key, start, err)
+	return result, err
+}
+
+// LPop calls LPop of the wrapped cache and records the metrics. An empty list is recorded as miss.
+func (c *InstrumentedCache) LPop(ctx context.Context, key string) (string, error) {
+	start := time.Now()
+	var result string
+	collections, err := c.collections()
+	if err == nil {
+		result, err = collections.LPop(ctx, key)
+	}
+	c.recordRead("lpop", key, start, err)
+	return result, err
+}
+
+// RPop calls RPop of the wrapped cache and records the metrics. An empty list is recorded as miss.
+func (c *InstrumentedCache) RPop(ctx context.Context, key string) (string, error) {
+	start := time.Now()
+	var result string
+	collections, err := c.collections()
+	if err == nil {
+		result, err = collections.RPop(ctx, key)
+	}
+	c.recordRead("rpop", key, start, err)
+	return result, err
+}
+
+// LRange calls LRange of the wrapped cache and records the metrics.
+func (c *InstrumentedCache) LRange(ctx context.Context, key string, start int64, stop int64) ([]string, error) {
+	startTime := time.Now()
+	var result []string
+	collections, err := c.collections()
+	if err == nil {
+		result, err = collections.LRange(ctx, key, start, stop)
+	}
+	c.recordRead("lrange", key, startTime, err)
+	return result, err
+}
+
+// LTrim calls LTrim of the wrapped cache and records the metrics.
+func (c *InstrumentedCache) LTrim(ctx context.Context, key string, start int64, stop int64) error {
+	startTime := time.Now()
+	collections, err := c.collections()
+	if err == nil {
+		err = collections.LTrim(ctx, key, start, stop)
+	}
+	c.recordWrite("ltrim", key, startTime, err)
+	return err
+}
+
+// LLen calls LLen of the wrapped cache and records the metrics.
+func (c *InstrumentedCache) LLen(ctx context.Context, key string) (int64, error) {
+	start := time.Now()
+	var result int64
+	collections, err := c.collections()
+	if err == nil {
+		result, err = collections.LLen(ctx, key)
+	}
+	c.recordRead("llen", key, start, err)
+	return result, err
+}
+
+// SAdd calls SAdd of the wrapped cache and records the metrics.
+func (c *InstrumentedCache) SAdd(ctx context.Context, key string, members ...string) (int64, error) {
+	start := time.Now()
+	var result int64
+	collections, err := c.collections()
+	if err == nil {
+		result, err = collections.SAdd(ctx, key, members...)
+	}
+	c.recordWrite("sadd", key, start, err)
+	return result, err
+}
+
+// SRem calls SRem of the wrapped cache and records the metrics.
+func (c *InstrumentedCache) SRem(ctx context.Context, key string, members ...string) (int64, error) {
+	start := time.Now()
+	var result int64
+	collections, err := c.collections()
+	if err == nil {
+		result, err = collections.SRem(ctx, key, members...)
+	}
+	c.recordWrite("srem", key, start, err)
+	return result, err
+}
+
+// SMembers calls SMembers of the wrapped cache and records the metrics.
+func (c *InstrumentedCache) SMembers(ctx context.Context, key string) ([]string, error) {
+	start := time.Now()
+	var result []string
+	collections, err := c.collections()
+	if err == nil {
+		result, err = collections.SMembers(ctx, key)
+	}
+	c.recordRead("smembers", key, start, err)
+	return result, err
+}
+
+// SIsMember calls SIsMember of the wrapped cache and records the metrics.
+func (c *InstrumentedCache) SIsMember(ctx context.Context, key string, member string) (bool, error) {
+	start := time.Now()
+	var result bool
+	collections, err := c.collections()
+	if err == nil {
+		result, err = collections.SIsMember(ctx, key, member)
+	}
+	c.recordRead("sis_member", key, start, err)
+	return result, err
+}
+
+// ZAdd calls ZAdd of the wrapped cache and records the metrics.
+func (c *InstrumentedCache) ZAdd(ctx context.Context, key string, members ...ZMember) (int64, error) {
+	start := time.Now()
+	var result int64
+	collections, err := c.collections()
+	if err == nil {
+		result, err = collections.ZAdd(ctx, key, members...)
+	}
+	c.recordWrite("zadd", key, start, err)
+	return result, err
+}
+
+// ZRem calls ZRem of the wrapped cache and records the metrics.
+func (c *InstrumentedCache) ZRem(ctx context.Context, key string, members ...string) (int64, error) {
+	start := time.Now()
+	var result int64
+	collections, err := c.collections()
+	if err == nil {
+		result, err = collections.ZRem(ctx, key, members...)
+	}
+	c.recordWrite("zrem", key, start, err)
+	return result, err
+}
+
+// ZRange calls ZRange of the wrapped cache and records the metrics.
+func (c *InstrumentedCache) ZRange(ctx context.Context, key string, start int64, stop int64) ([]ZMember, error) {
+	startTime := time.Now()
+	var result []ZMember
+	collections, err := c.collections()
+	if err == nil {
+		result, err = collections.ZRange(ctx, key, start, stop)
+	}
+	c.recordRead("zrange", key, startTime, err)
+	return result, err
+}
+
+// ZRangeByScore calls ZRangeByScore of the wrapped cache and records the metrics.
+func (c *InstrumentedCache) ZRangeByScore(ctx context.Context, key string, min float64, max float64) ([]ZMember, error) {
+	start := time.Now()
+	var result []ZMember
+	collections, err := c.collections()
+	if err == nil {
+		result, err = collections.ZRangeByScore(ctx, key, min, max)
+	}
+	c.recordRead("zrange_by_score", key, start, err)
+	return result, err
+}
+
+// ZRank calls ZRank of the wrapped cache and records the metrics.
+func (c *InstrumentedCache) ZRank(ctx context.Context, key string, member string) (int64, error) {
+	start := time.Now()
+	var result int64
+	collections, err := c.collections()
+	if err == nil {
+		result, err = collections.ZRank(ctx, key, member)
+	}
+	c.recordRead("zrank", key, start, err)
+	return result, err
+}
+
+// ZScore calls ZScore of the wrapped cache and records the metrics.
+func (c *InstrumentedCache) ZScore(ctx context.Context, key string, member string) (float64, error) {
+	start := time.Now()
+	var result float64
+	collections, err := c.collections()
+	if err == nil {
+		result, err = collections.ZScore(ctx, key, member)
+	}
+	c.recordRead("zscore", key, start, err)
+	return result, err
+}
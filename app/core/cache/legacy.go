@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// LegacyCache is the interface of the cache before all operations took a context.
+//
+// Deprecated: Use Cache and pass the request context instead. Existing code can wrap a Cache with NewLegacy.
+type LegacyCache interface {
+	Prefix() string
+	Set(key string, value string, expiration time.Duration) error
+	Get(key string) (string, error)
+	SetBool(key string, value bool, expiration time.Duration) error
+	GetBool(key string) (bool, error)
+	SetInt(key string, value int64, expiration time.Duration) error
+	GetInt(key string) (int64, error)
+	Incr(key string) (int64, error)
+	SetJSON(key string, value interface{}, expiration time.Duration) error
+	GetJSON(key string, result interface{}) error
+	Del(key string) error
+	Close() error
+	TTL(key string) (time.Duration, error)
+}
+
+// LegacyAdapter implements LegacyCache by calling the wrapped Cache with context.Background().
+type LegacyAdapter struct {
+	cache Cache
+}
+
+// NewLegacy wraps the cache so it can be used by code that still expects the LegacyCache interface.
+func NewLegacy(cache Cache) *LegacyAdapter {
+	return &LegacyAdapter{cache: cache}
+}
+
+// Cache returns the wrapped cache, e.g. to migrate single calls to the context-aware interface
+// or to use Collections, which LegacyCache does not offer.
+func (a *LegacyAdapter) Cache() Cache {
+	return a.cache
+}
+
+// Prefix returns the prefix of the wrapped cache.
+func (a *LegacyAdapter) Prefix() string {
+	return a.cache.Prefix()
+}
+
+// Set calls Set of the wrapped cache.
+func (a *LegacyAdapter) Set(key string, value string, expiration time.Duration) error {
+	return a.cache.Set(context.Background(), key, value, expiration)
+}
+
+// Get calls Get of the wrapped cache.
+func (a *LegacyAdapter) Get(key string) (string, error) {
+	return a.cache.Get(context.Background(), key)
+}
+
+// SetBool calls SetBool of the wrapped cache.
+func (a *LegacyAdapter) SetBool(key string, value bool, expiration time.Duration) error {
+	return a.cache.SetBool(context.Background(), key, value, expiration)
+}
+
+// GetBool calls GetBool of the wrapped cache.
+func (a *LegacyAdapter) GetBool(key string) (bool, error) {
+	return a.cache.GetBool(context.Background(), key)
+}
+
+// SetInt calls SetInt of the wrapped cache.
+func (a *LegacyAdapter) SetInt(key string, value int64, expiration time.Duration) error {
+	return a.cache.SetInt(context.Background(), key, value, expiration)
+}
+
+// GetInt calls GetInt of the wrapped cache.
+func (a *LegacyAdapter) GetInt(key string) (int64, error) {
+	return a.cache.GetInt(context.Background(), key)
+}
+
+// Incr calls Incr of the wrapped cache.
+func (a *LegacyAdapter) Incr(key string) (int64, error) {
+	return a.cache.Incr(context.Background(), key)
+}
+
+// SetJSON calls SetJSON of the wrapped cache.
+func (a *LegacyAdapter) SetJSON(key string, value interface{}, expiration time.Duration) error {
+	return a.cache.SetJSON(context.Background(), key, value, expiration)
+}
+
+// GetJSON calls GetJSON of the wrapped cache.
+func (a *LegacyAdapter) GetJSON(key string, result interface{}) error {
+	return a.cache.GetJSON(context.Background(), key, result)
+}
+
+// Del calls Del of the wrapped cache.
+func (a *LegacyAdapter) Del(key string) error {
+	return a.cache.Del(context.Background(), key)
+}
+
+// Close closes the wrapped cache.
+func (a *LegacyAdapter) Close() error {
+	return a.cache.Close()
+}
+
+// TTL calls TTL of the wrapped cache.
+func (a *LegacyAdapter) TTL(key string) (time.Duration, error) {
+	return a.cache.TTL(context.Background(), key)
+}
@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLegacyAdapter(t *testing.T) {
+	t.Run("implements LegacyCache", func(t *testing.T) {
+		assert.Implements(t, (*LegacyCache)(nil), &LegacyAdapter{})
+	})
+
+	t.Run("calls the wrapped cache", func(t *testing.T) {
+		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
+			legacy := NewLegacy(client)
+			assert.Equal(t, "testPrefix", legacy.Prefix())
+			assert.Equal(t, client, legacy.Cache())
+
+			require.NoError(t, legacy.SetJSON("user", testStruct{Name: "Jane", Age: 42}, time.Minute))
+			result := testStruct{}
+			require.NoError(t, legacy.GetJSON("user", &result))
+			assert.Equal(t, testStruct{Name: "Jane", Age: 42}, result)
+
+			count, err := legacy.Incr("counter")
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), count)
+			count, err = legacy.GetInt("counter")
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), count)
+
+			ttl, err := legacy.TTL("user")
+			require.NoError(t, err)
+			assert.Equal(t, time.Minute, ttl)
+
+			require.NoError(t, legacy.Del("user"))
+			_, err = legacy.Get("user")
+			assert.Equal(t, ErrNotFound, err)
+		})
+	})
+}
+
+func TestContextCancellation(t *testing.T) {
+	withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
+		require.NoError(t, redis.Set("testPrefix:someKey", "someValue"))
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := client.Get(ctx, "someKey")
+		assert.Equal(t, context.Canceled, err)
+		err = client.Set(ctx, "someKey", "otherValue", 0)
+		assert.Equal(t, context.Canceled, err)
+		redis.CheckGet(t, "testPrefix:someKey", "someValue")
+	})
+}
@@ -0,0 +1,328 @@
+package cache
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"toolkit/app/core/observance"
+)
+
+// Default settings of Loader.
+const (
+	DefaultLockTTL          = 10 * time.Second
+	DefaultLockPollInterval = 50 * time.Millisecond
+)
+
+// LoadFunc loads a value that is not in the cache, e.g. from the database.
+// It should return ErrNotFound if the value does not exist.
+type LoadFunc func(ctx context.Context) (interface{}, error)
+
+// LoaderConfig holds the settings for Loader. All features are disabled if their setting is zero.
+type LoaderConfig struct {
+	// NegativeTTL is the time ErrNotFound returned by the load function is cached, so requests
+	// for values that do not exist do not hit the database every time.
+	NegativeTTL time.Duration
+	// StaleTTL is the time values are kept after they expired. They are returned if the load function fails.
+	StaleTTL time.Duration
+	// EarlyRefreshBeta enables the probabilistic refresh of values shortly before they expire, so usually a single
+	// request loads the new value while the others still use the cached one. The probability increases the
+	// closer the expiry and the longer the load function takes. 1 is a good default, higher values refresh earlier.
+	EarlyRefreshBeta float64
+	// Locker is used to acquire a lock before the load function is called, so only one instance of the service
+	// loads the value. The other instances wait up to LockTTL for the value to appear in the cache.
+	// An early refresh is skipped if the lock is held by another instance, the cached value is returned instead.
+	Locker  Locker
+	LockTTL time.Duration
+}
+
+// Loader implements the cache-aside pattern with protection against cache stampedes: concurrent requests
+// for the same key within the process share one call of the load function.
+//
+// The values are stored together with their expiry and the duration of the load function,
+// so keys written by the Loader should only be read via the Loader. They are serialized with the Encoding
+// of the cache if it provides one (RedisClient, MemoryCache, NearCache and InstrumentedCache do).
+type Loader struct {
+	cache  Cache
+	logger observance.Logger
+	config LoaderConfig
+	calls  *singleflight
+	now    func() time.Time
+	random func() float64
+	// values encodes the loaded values with the codec of the cache, envelope encodes and compresses the loadedValue.
+	values   Encoding
+	envelope Encoding
+}
+
+// loadedValue is stored in the cache by the Loader.
+type loadedValue struct {
+	// Value is the loaded value encoded with the codec of the cache.
+	Value    string `json:"v,omitempty" msgpack:"v,omitempty"`
+	NotFound bool   `json:"nf,omitempty" msgpack:"nf,omitempty"`
+	// ExpiresAt is the time in unix milliseconds after which the value is considered stale, 0 means never.
+	ExpiresAt int64 `json:"e,omitempty" msgpack:"e,omitempty"`
+	// LoadDuration is the duration of the load function in milliseconds, it is used for the early refresh.
+	LoadDuration int64 `json:"d,omitempty" msgpack:"d,omitempty"`
+}
+
+// NewLoader creates a new Loader. Errors of the cache are logged with level warning,
+// the load function is called in that case.
+func NewLoader(cache Cache, logger observance.Logger, config LoaderConfig) *Loader {
+	if config.Locker != nil && config.LockTTL <= 0 {
+		config.LockTTL = DefaultLockTTL
+	}
+
+	// The value is compressed as part of the envelope. The protobuf codec only supports proto messages,
+	// so the envelope is encoded with msgpack in that case.
+	encoding := encodingOf(cache)
+	values := Encoding{Codec: encoding.Codec}
+	if encoding.codec().ID() == ProtobufCodec.ID() {
+		encoding.Codec = MsgpackCodec
+	}
+
+	return &Loader{
+		cache:    cache,
+		logger:   logger,
+		config:   config,
+		calls:    &singleflight{calls: map[string]*singleflightCall{}},
+		now:      time.Now,
+		random:   rand.Float64,
+		values:   values,
+		envelope: encoding,
+	}
+}
+
+// GetOrSetJSON parses the value of the key into result. If the key is not in the cache or expired,
+// the load function is called and its result is saved in the cache with the given TTL (0 means no expiration).
+// It returns ErrNotFound if the load function returned ErrNotFound (or a cached ErrNotFound, see NegativeTTL).
+func (l *Loader) GetOrSetJSON(ctx context.Context, key string, ttl time.Duration, result interface{}, load LoadFunc) error {
+	cached := l.read(ctx, key)
+	if cached != nil && !cached.expired(l.now()) {
+		if l.refreshEarly(cached) {
+			if loaded, err := l.load(ctx, key, ttl, load, cached, true); err == nil {
+				return loaded.decode(result)
+			}
+		}
+		return cached.decode(result)
+	}
+
+	loaded, err := l.load(ctx, key, ttl, load, cached, false)
+	if err != nil {
+		if cached != nil && !cached.NotFound && l.config.StaleTTL > 0 && err != ErrNotFound {
+			l.logger.WithField("key", key).WithError(err).Warn("failed to load value, serving stale value from cache")
+			return cached.decode(result)
+		}
+		return err
+	}
+	return loaded.decode(result)
+}
+
+// load calls the load function once per key at the same time and saves the result in the cache.
+// The load function gets a context that is not canceled with the context of the caller, since other callers
+// share its result. An early refresh returns ErrLockNotAcquired instead of waiting for another instance.
+func (l *Loader) load(ctx context.Context, key string, ttl time.Duration, load LoadFunc, previous *loadedValue, refresh bool) (*loadedValue, error) {
+	return l.calls.do(ctx, key, func(ctx context.Context) (*loadedValue, error) {
+		if l.config.Locker == nil {
+			return l.loadAndStore(ctx, key, ttl, load)
+		}
+
+		lock, err := l.config.Locker.Acquire(ctx, key+":lock", l.config.LockTTL)
+		switch {
+		case err == ErrLockNotAcquired && refresh:
+			return nil, err
+		case err == ErrLockNotAcquired:
+			if loaded := l.waitForValue(ctx, key, previous); loaded != nil {
+				return loaded, nil
+			}
+		case err != nil:
+			l.logger.WithField("key", key).WithError(err).Warn("failed to acquire cache lock")
+		default:
+			defer func() {
+				if err := lock.Release(ctx); err != nil && err != ErrLockNotHeld {
+					l.logger.WithField("key", key).WithError(err).Warn("failed to release cache lock")
+				}
+			}()
+			// Another instance might have stored the value while this one waited for the lock.
+			if loaded := l.read(ctx, key); loaded != nil && loaded.newerThan(previous) && !loaded.expired(l.now()) {
+				return loaded, nil
+			}
+		}
+		return l.loadAndStore(ctx, key, ttl, load)
+	})
+}
+
+func (l *Loader) loadAndStore(ctx context.Context, key string, ttl time.Duration, load LoadFunc) (*loadedValue, error) {
+	start := l.now()
+	value, err := load(ctx)
+	loaded := &loadedValue{LoadDuration: l.now().Sub(start).Milliseconds()}
+
+	switch {
+	case err == ErrNotFound && l.config.NegativeTTL > 0:
+		loaded.NotFound = true
+		ttl = l.config.NegativeTTL
+	case err != nil:
+		return nil, err
+	default:
+		loaded.Value, err = l.values.Encode(value)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not encode loaded value")
+		}
+	}
+
+	storageTTL := time.Duration(0)
+	if ttl > 0 {
+		loaded.ExpiresAt = l.now().Add(ttl).UnixNano() / int64(time.Millisecond)
+		storageTTL = ttl
+		if !loaded.NotFound {
+			storageTTL += l.config.StaleTTL
+		}
+	}
+
+	serialized, err := l.envelope.Encode(loaded)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not encode loaded value")
+	}
+	if err := l.cache.Set(ctx, key, serialized, storageTTL); err != nil {
+		l.logger.WithField("key", key).WithError(err).Warn("failed to save loaded value in cache")
+	}
+	return loaded, nil
+}
+
+// waitForValue polls the cache until another instance saved a new value or LockTTL passed.
+func (l *Loader) waitForValue(ctx context.Context, key string, previous *loadedValue) *loadedValue {
+	deadline := l.now().Add(l.config.LockTTL)
+	for l.now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(DefaultLockPollInterval):
+		}
+
+		if loaded := l.read(ctx, key); loaded != nil && loaded.newerThan(previous) {
+			return loaded
+		}
+	}
+	return nil
+}
+
+// read returns the cached value or nil if it was not found or could not be read.
+func (l *Loader) read(ctx context.Context, key string) *loadedValue {
+	serialized, err := l.cache.Get(ctx, key)
+	if err != nil {
+		if err != ErrNotFound {
+			l.logger.WithField("key", key).WithError(err).Warn("failed to read value from cache")
+		}
+		return nil
+	}
+
+	loaded := &loadedValue{}
+	if err := l.envelope.Decode(serialized, loaded); err != nil || (loaded.Value == "" && !loaded.NotFound) {
+		// The value was not written by the Loader.
+		return nil
+	}
+	return loaded
+}
+
+// refreshEarly decides whether the value is loaded again before it expires ("XFetch" algorithm):
+// now - loadDuration * beta * ln(random) >= expiry.
+func (l *Loader) refreshEarly(cached *loadedValue) bool {
+	if l.config.EarlyRefreshBeta <= 0 || cached.ExpiresAt == 0 {
+		return false
+	}
+
+	gap := float64(cached.LoadDuration) * l.config.EarlyRefreshBeta * -math.Log(l.random())
+	now := l.now().UnixNano() / int64(time.Millisecond)
+	return float64(now)+gap >= float64(cached.ExpiresAt)
+}
+
+func (v *loadedValue) expired(now time.Time) bool {
+	return v.ExpiresAt != 0 && now.UnixNano()/int64(time.Millisecond) >= v.ExpiresAt
+}
+
+func (v *loadedValue) newerThan(previous *loadedValue) bool {
+	return previous == nil || v.ExpiresAt != previous.ExpiresAt
+}
+
+func (v *loadedValue) decode(result interface{}) error {
+	if v.NotFound {
+		return ErrNotFound
+	}
+	// The header of the value identifies the codec, so any Encoding can decode it.
+	return Encoding{}.Decode(v.Value, result)
+}
+
+// singleflight makes sure a function is only executed once per key at the same time,
+// concurrent callers wait for the result of the running call.
+type singleflight struct {
+	calls map[string]*singleflightCall
+	mutex sync.Mutex
+}
+
+type singleflightCall struct {
+	done   chan struct{}
+	result *loadedValue
+	err    error
+	panic  interface{}
+}
+
+// do runs fn in the background with a context that keeps the values but not the cancellation of ctx,
+// so a canceled caller does not fail the others. Every caller stops waiting when its own context is done.
+// If fn panics, the caller that started it panics as well and the other callers get an error.
+func (s *singleflight) do(ctx context.Context, key string, fn func(ctx context.Context) (*loadedValue, error)) (*loadedValue, error) {
+	s.mutex.Lock()
+	call, running := s.calls[key]
+	if !running {
+		call = &singleflightCall{done: make(chan struct{})}
+		s.calls[key] = call
+		go s.run(detachedContext{ctx}, key, call, fn)
+	}
+	s.mutex.Unlock()
+
+	select {
+	case <-call.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if call.panic != nil && !running {
+		panic(call.panic)
+	}
+	return call.result, call.err
+}
+
+func (s *singleflight) run(ctx context.Context, key string, call *singleflightCall, fn func(ctx context.Context) (*loadedValue, error)) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			call.panic = recovered
+			call.err = errors.Errorf("load function panicked: %v", recovered)
+		}
+		s.mutex.Lock()
+		delete(s.calls, key)
+		s.mutex.Unlock()
+		close(call.done)
+	}()
+	call.result, call.err = fn(ctx)
+}
+
+// detachedContext keeps the values of the parent context, e.g. the span, but is never canceled.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
@@ -0,0 +1,318 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"toolkit/app/core/observance"
+)
+
+type testUser struct {
+	Name string `json:"name"`
+}
+
+// newTestLoader returns a Loader on a MemoryCache that share a fake clock which can be moved with the returned function.
+func newTestLoader(config LoaderConfig) (*Loader, observance.TestLogger, func(time.Duration)) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	mutex := sync.Mutex{}
+	clock := func() time.Time {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		now = now.Add(d)
+	}
+
+	memory := NewMemory(MemoryConfig{})
+	memory.now = clock
+	logger := observance.NewTestLogger()
+	loader := NewLoader(memory, logger, config)
+	loader.now = clock
+	loader.random = func() float64 { return 1 }
+	return loader, logger, advance
+}
+
+func TestLoader(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("loads and caches the value", func(t *testing.T) {
+		loader, logger, advance := newTestLoader(LoaderConfig{})
+		calls := 0
+		load := func(ctx context.Context) (interface{}, error) {
+			calls++
+			return testUser{Name: "user" + strconv.Itoa(calls)}, nil
+		}
+
+		user := testUser{}
+		require.NoError(t, loader.GetOrSetJSON(ctx, "user", time.Minute, &user, load))
+		assert.Equal(t, "user1", user.Name)
+		require.NoError(t, loader.GetOrSetJSON(ctx, "user", time.Minute, &user, load))
+		assert.Equal(t, "user1", user.Name)
+		assert.Equal(t, 1, calls)
+
+		advance(time.Minute)
+		require.NoError(t, loader.GetOrSetJSON(ctx, "user", time.Minute, &user, load))
+		assert.Equal(t, "user2", user.Name)
+		logger.RequireNoErrors(t)
+	})
+
+	t.Run("concurrent callers share one load", func(t *testing.T) {
+		loader, _, _ := newTestLoader(LoaderConfig{})
+		calls := int32(0)
+		release := make(chan struct{})
+		load := func(ctx context.Context) (interface{}, error) {
+			atomic.AddInt32(&calls, 1)
+			<-release
+			return testUser{Name: "user"}, nil
+		}
+
+		wg := sync.WaitGroup{}
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				user := testUser{}
+				assert.NoError(t, loader.GetOrSetJSON(ctx, "user", time.Minute, &user, load))
+				assert.Equal(t, "user", user.Name)
+			}()
+		}
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+		wg.Wait()
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("callers are not canceled by each other", func(t *testing.T) {
+		loader, _, _ := newTestLoader(LoaderConfig{})
+		started := make(chan struct{})
+		release := make(chan struct{})
+		loadErr := make(chan error, 1)
+		load := func(ctx context.Context) (interface{}, error) {
+			close(started)
+			<-release
+			loadErr <- ctx.Err()
+			return testUser{Name: "user"}, nil
+		}
+
+		firstCtx, cancelFirst := context.WithCancel(ctx)
+		first := make(chan error)
+		go func() {
+			user := testUser{}
+			first <- loader.GetOrSetJSON(firstCtx, "user", time.Minute, &user, load)
+		}()
+		<-started
+
+		timeoutCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		user := testUser{}
+		assert.Equal(t, context.DeadlineExceeded, loader.GetOrSetJSON(timeoutCtx, "user", time.Minute, &user, load),
+			"waiters stop waiting when their context is done")
+
+		second := make(chan error)
+		go func() {
+			user := testUser{}
+			second <- loader.GetOrSetJSON(ctx, "user", time.Minute, &user, load)
+		}()
+		cancelFirst()
+		assert.Equal(t, context.Canceled, <-first)
+
+		close(release)
+		require.NoError(t, <-second)
+		assert.NoError(t, <-loadErr, "the load function is not canceled with the first caller")
+	})
+
+	t.Run("caches not found with NegativeTTL", func(t *testing.T) {
+		loader, _, advance := newTestLoader(LoaderConfig{NegativeTTL: 10 * time.Second})
+		calls := 0
+		load := func(ctx context.Context) (interface{}, error) {
+			calls++
+			return nil, ErrNotFound
+		}
+
+		user := testUser{}
+		assert.Equal(t, ErrNotFound, loader.GetOrSetJSON(ctx, "user", time.Minute, &user, load))
+		assert.Equal(t, ErrNotFound, loader.GetOrSetJSON(ctx, "user", time.Minute, &user, load))
+		assert.Equal(t, 1, calls)
+
+		advance(10 * time.Second)
+		assert.Equal(t, ErrNotFound, loader.GetOrSetJSON(ctx, "user", time.Minute, &user, load))
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("does not cache not found without NegativeTTL", func(t *testing.T) {
+		loader, _, _ := newTestLoader(LoaderConfig{})
+		calls := 0
+		load := func(ctx context.Context) (interface{}, error) {
+			calls++
+			return nil, ErrNotFound
+		}
+
+		user := testUser{}
+		assert.Equal(t, ErrNotFound, loader.GetOrSetJSON(ctx, "user", time.Minute, &user, load))
+		assert.Equal(t, ErrNotFound, loader.GetOrSetJSON(ctx, "user", time.Minute, &user, load))
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("serves stale value if the load function fails", func(t *testing.T) {
+		loader, logger, advance := newTestLoader(LoaderConfig{StaleTTL: time.Hour})
+		user := testUser{}
+		require.NoError(t, loader.GetOrSetJSON(ctx, "user", time.Minute, &user, func(ctx context.Context) (interface{}, error) {
+			return testUser{Name: "user"}, nil
+		}))
+
+		advance(30 * time.Minute)
+		failing := func(ctx context.Context) (interface{}, error) {
+			return nil, errors.New("database down")
+		}
+		user = testUser{}
+		require.NoError(t, loader.GetOrSetJSON(ctx, "user", time.Minute, &user, failing))
+		assert.Equal(t, "user", user.Name)
+		logger.AssertLogged(t, "warn", "serving stale value", observance.Fields{"key": "user"})
+
+		advance(time.Hour)
+		assert.EqualError(t, loader.GetOrSetJSON(ctx, "user", time.Minute, &user, failing), "database down")
+	})
+
+	t.Run("returns error of the load function without StaleTTL", func(t *testing.T) {
+		loader, _, advance := newTestLoader(LoaderConfig{})
+		user := testUser{}
+		require.NoError(t, loader.GetOrSetJSON(ctx, "user", time.Minute, &user, func(ctx context.Context) (interface{}, error) {
+			return testUser{Name: "user"}, nil
+		}))
+
+		advance(time.Minute)
+		err := loader.GetOrSetJSON(ctx, "user", time.Minute, &user, func(ctx context.Context) (interface{}, error) {
+			return nil, errors.New("database down")
+		})
+		assert.EqualError(t, err, "database down")
+	})
+
+	t.Run("refreshes early shortly before the expiry", func(t *testing.T) {
+		loader, _, advance := newTestLoader(LoaderConfig{EarlyRefreshBeta: 1})
+		calls := 0
+		load := func(ctx context.Context) (interface{}, error) {
+			calls++
+			advance(time.Second)
+			return testUser{Name: "user"}, nil
+		}
+
+		user := testUser{}
+		require.NoError(t, loader.GetOrSetJSON(ctx, "user", time.Minute, &user, load))
+		assert.Equal(t, 1, calls)
+
+		// gap = 1s load duration * beta 1 * -ln(random)
+		loader.random = func() float64 { return 0.5 }
+		advance(50 * time.Second)
+		require.NoError(t, loader.GetOrSetJSON(ctx, "user", time.Minute, &user, load))
+		assert.Equal(t, 1, calls, "not refreshed 10s before the expiry")
+
+		advance(9500 * time.Millisecond)
+		require.NoError(t, loader.GetOrSetJSON(ctx, "user", time.Minute, &user, load))
+		assert.Equal(t, 2, calls, "refreshed 0.5s before the expiry")
+	})
+
+	t.Run("skips the early refresh if another instance holds the lock", func(t *testing.T) {
+		locker := NewMemoryLocker(LockerConfig{})
+		loader, _, advance := newTestLoader(LoaderConfig{EarlyRefreshBeta: 1, Locker: locker})
+		calls := 0
+		load := func(ctx context.Context) (interface{}, error) {
+			calls++
+			advance(time.Second)
+			return testUser{Name: "user" + strconv.Itoa(calls)}, nil
+		}
+
+		user := testUser{}
+		require.NoError(t, loader.GetOrSetJSON(ctx, "user", time.Minute, &user, load))
+		lock, err := locker.Acquire(ctx, "user:lock", time.Minute)
+		require.NoError(t, err)
+		defer lock.Release(ctx)
+
+		advance(59500 * time.Millisecond)
+		done := make(chan error)
+		go func() {
+			done <- loader.GetOrSetJSON(ctx, "user", time.Minute, &user, load)
+		}()
+		select {
+		case err := <-done:
+			require.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("waited for the lock")
+		}
+		assert.Equal(t, "user1", user.Name)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("ignores values that were not written by the Loader", func(t *testing.T) {
+		loader, _, _ := newTestLoader(LoaderConfig{})
+		require.NoError(t, loader.cache.Set(ctx, "user", "plain", 0))
+		user := testUser{}
+		require.NoError(t, loader.GetOrSetJSON(ctx, "user", time.Minute, &user, func(ctx context.Context) (interface{}, error) {
+			return testUser{Name: "user"}, nil
+		}))
+		assert.Equal(t, "user", user.Name)
+	})
+
+	t.Run("recovers from panics of the load function", func(t *testing.T) {
+		loader, _, _ := newTestLoader(LoaderConfig{})
+		user := testUser{}
+		assert.Panics(t, func() {
+			_ = loader.GetOrSetJSON(ctx, "user", time.Minute, &user, func(ctx context.Context) (interface{}, error) {
+				panic("boom")
+			})
+		})
+		require.NoError(t, loader.GetOrSetJSON(ctx, "user", time.Minute, &user, func(ctx context.Context) (interface{}, error) {
+			return testUser{Name: "user"}, nil
+		}))
+		assert.Equal(t, "user", user.Name)
+	})
+}
+
+func TestLoaderWithLock(t *testing.T) {
+	ctx := context.Background()
+	withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
+		config := LoaderConfig{Locker: NewRedisLocker(client, LockerConfig{}), LockTTL: time.Second}
+		first := NewLoader(client, observance.NewTestLogger(), config)
+		second := NewLoader(client, observance.NewTestLogger(), config)
+
+		calls := int32(0)
+		started := make(chan struct{})
+		release := make(chan struct{})
+		load := func(ctx context.Context) (interface{}, error) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				close(started)
+			}
+			<-release
+			return testUser{Name: "user"}, nil
+		}
+
+		done := make(chan error)
+		go func() {
+			user := testUser{}
+			done <- first.GetOrSetJSON(ctx, "user", time.Minute, &user, load)
+		}()
+		<-started
+		assert.True(t, redis.Exists("testPrefix:{user:lock}"))
+
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			close(release)
+		}()
+		user := testUser{}
+		require.NoError(t, second.GetOrSetJSON(ctx, "user", time.Minute, &user, load))
+		assert.Equal(t, "user", user.Name)
+		require.NoError(t, <-done)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "the second instance waited for the value")
+		assert.False(t, redis.Exists("testPrefix:{user:lock}"))
+	})
+}
@@ -0,0 +1,322 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	mathrand "math/rand"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/pkg/errors"
+)
+
+// Errors returned by Locker implementations.
+var (
+	ErrLockNotAcquired = errors.New("lock is held by someone else")
+	ErrLockNotHeld     = errors.New("lock is not held anymore")
+)
+
+// Default settings of the lockers.
+const (
+	DefaultLockRetryDelay    = 50 * time.Millisecond
+	DefaultLockMaxRetryDelay = time.Second
+)
+
+// MinLockTTL is the smallest TTL of a lock, REDIS expires keys with millisecond precision.
+const MinLockTTL = time.Millisecond
+
+// fencingKeyTTLFactor defines how long the fencing counter of the RedisLocker is kept compared to the TTL of the lock,
+// but at least minFencingKeyTTL. The counter only restarts if the lock was not used for that time.
+const (
+	fencingKeyTTLFactor = 100
+	minFencingKeyTTL    = 24 * time.Hour
+)
+
+// Locker acquires distributed locks so only one instance of the service does something at a time.
+type Locker interface {
+	// Acquire returns ErrLockNotAcquired if the lock is still held by someone else after all retries.
+	// The lock is released automatically after the TTL if Release is not called, the TTL must be at least MinLockTTL.
+	Acquire(ctx context.Context, name string, ttl time.Duration) (Lock, error)
+}
+
+// Lock is a lock that was acquired via a Locker.
+type Lock interface {
+	// Release returns ErrLockNotHeld if the lock expired in the meantime.
+	Release(ctx context.Context) error
+	// Extend resets the TTL of the lock. It returns ErrLockNotHeld if the lock expired in the meantime.
+	Extend(ctx context.Context, ttl time.Duration) error
+	// FencingToken increases with every acquisition of a lock with the same name. Storage systems can reject
+	// writes with a lower token than they have seen before, so a process that lost its lock, e.g. because it
+	// was paused longer than the TTL, can not overwrite the results of the new owner.
+	FencingToken() int64
+	// Lost returns a channel that is closed if the automatic renewal failed and the lock is not held anymore.
+	// It is never closed if AutoRenew is disabled.
+	Lost() <-chan struct{}
+}
+
+// LockerConfig holds the settings for the lockers. All features are disabled if their setting is zero.
+type LockerConfig struct {
+	// RetryCount is the number of further attempts to acquire a lock that is held by someone else.
+	RetryCount int
+	// RetryDelay is the delay before the first retry (default 50ms), it doubles with every retry up to
+	// MaxRetryDelay (default 1s). A random jitter of up to 50% is added so competing instances do not retry in sync.
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+	// AutoRenew extends the lock to its TTL every third of the TTL until it is released,
+	// so long running jobs keep the lock while short TTLs still free it quickly if the instance crashes.
+	AutoRenew bool
+}
+
+func (c LockerConfig) withDefaults() LockerConfig {
+	if c.RetryDelay <= 0 {
+		c.RetryDelay = DefaultLockRetryDelay
+	}
+	if c.MaxRetryDelay < c.RetryDelay {
+		c.MaxRetryDelay = DefaultLockMaxRetryDelay
+		if c.MaxRetryDelay < c.RetryDelay {
+			c.MaxRetryDelay = c.RetryDelay
+		}
+	}
+	return c
+}
+
+// lockBackend implements the storage specific operations of a lock. The methods return false
+// if the lock is not held by the owner with the token anymore.
+type lockBackend interface {
+	extend(ctx context.Context, ttl time.Duration) (bool, error)
+	release(ctx context.Context) (bool, error)
+}
+
+// acquire calls try until the lock was acquired, the retries are exhausted or the context is done.
+// On success, the automatic renewal is started if it is enabled.
+func (c LockerConfig) acquire(ctx context.Context, ttl time.Duration, try func() (lockBackend, int64, error)) (Lock, error) {
+	if err := validateLockTTL(ttl); err != nil {
+		return nil, err
+	}
+
+	delay := c.RetryDelay
+	for attempt := 0; ; attempt++ {
+		backend, fencingToken, err := try()
+		if err == nil {
+			return newLockHandle(backend, fencingToken, ttl, c.AutoRenew), nil
+		}
+		if err != ErrLockNotAcquired || attempt >= c.RetryCount {
+			return nil, err
+		}
+
+		jitter := time.Duration(mathrand.Int63n(int64(delay)/2 + 1))
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay + jitter):
+		}
+		delay *= 2
+		if delay > c.MaxRetryDelay {
+			delay = c.MaxRetryDelay
+		}
+	}
+}
+
+// lockHandle implements Lock on top of a lockBackend including the automatic renewal.
+type lockHandle struct {
+	backend      lockBackend
+	fencingToken int64
+	ttl          time.Duration
+	lost         chan struct{}
+	stop         chan struct{}
+	stopped      chan struct{}
+	stopOnce     sync.Once
+}
+
+func newLockHandle(backend lockBackend, fencingToken int64, ttl time.Duration, autoRenew bool) *lockHandle {
+	h := &lockHandle{
+		backend:      backend,
+		fencingToken: fencingToken,
+		ttl:          ttl,
+		lost:         make(chan struct{}),
+		stop:         make(chan struct{}),
+		stopped:      make(chan struct{}),
+	}
+	if autoRenew {
+		go h.renew()
+	} else {
+		close(h.stopped)
+	}
+	return h
+}
+
+func (h *lockHandle) Release(ctx context.Context) error {
+	h.stopRenewal()
+	released, err := h.backend.release(ctx)
+	if err != nil {
+		return errors.Wrap(err, "could not release lock")
+	}
+	if !released {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+func (h *lockHandle) Extend(ctx context.Context, ttl time.Duration) error {
+	if err := validateLockTTL(ttl); err != nil {
+		return err
+	}
+	extended, err := h.backend.extend(ctx, ttl)
+	if err != nil {
+		return errors.Wrap(err, "could not extend lock")
+	}
+	if !extended {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+func (h *lockHandle) FencingToken() int64 {
+	return h.fencingToken
+}
+
+func (h *lockHandle) Lost() <-chan struct{} {
+	return h.lost
+}
+
+// renew extends the lock every third of the TTL. Failed extensions are retried with the next tick,
+// the lock is considered lost if it is not held anymore or could not be extended within the TTL.
+func (h *lockHandle) renew() {
+	defer close(h.stopped)
+	ticker := time.NewTicker(h.ttl / 3)
+	defer ticker.Stop()
+
+	lastExtended := time.Now()
+	for {
+		select {
+		case <-h.stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), h.ttl/3)
+		err := h.Extend(ctx, h.ttl)
+		cancel()
+		if err == nil {
+			lastExtended = time.Now()
+			continue
+		}
+		if err == ErrLockNotHeld || time.Since(lastExtended) >= h.ttl {
+			close(h.lost)
+			return
+		}
+	}
+}
+
+func (h *lockHandle) stopRenewal() {
+	h.stopOnce.Do(func() { close(h.stop) })
+	<-h.stopped
+}
+
+func validateLockTTL(ttl time.Duration) error {
+	if ttl < MinLockTTL {
+		return errors.Errorf("lock TTL must be at least %s, got %s", MinLockTTL, ttl)
+	}
+	return nil
+}
+
+// acquireScript sets the lock if it is free, increments the fencing token and refreshes the TTL of the counter.
+var acquireScript = redis.NewScript(`
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	local token = redis.call("INCR", KEYS[2])
+	redis.call("PEXPIRE", KEYS[2], ARGV[3])
+	return token
+end
+return 0`)
+
+// extendScript resets the TTL only if the lock still contains the token of the owner.
+// The fencing counter is refreshed as well, so it does not expire while the lock is held.
+var extendScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	redis.call("PEXPIRE", KEYS[2], ARGV[3])
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+// releaseScript deletes the lock only if it still contains the token of the owner,
+// so a lock that expired and was acquired by someone else is not released.
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// RedisLocker implements Locker with REDIS. The lock is a key with a random token that is set via SET NX,
+// it uses the prefix of the client. The fencing tokens are counted in a second key with the suffix ":fencing"
+// that expires if the lock was not used for 100 times its TTL, but at least a day. Both keys use the name as hash tag unless it already contains one,
+// so they are stored in the same slot of a REDIS Cluster.
+type RedisLocker struct {
+	client *RedisClient
+	config LockerConfig
+}
+
+// NewRedisLocker creates a new RedisLocker.
+func NewRedisLocker(client *RedisClient, config LockerConfig) *RedisLocker {
+	return &RedisLocker{client: client, config: config.withDefaults()}
+}
+
+// Acquire acquires the lock, see LockerConfig for the retries and the automatic renewal.
+func (l *RedisLocker) Acquire(ctx context.Context, name string, ttl time.Duration) (Lock, error) {
+	if hashTag(name) == "" {
+		name = HashTag(name)
+	}
+	key := l.client.prefixedKey(name)
+	fencingKey := l.client.prefixedKey(name + ":fencing")
+
+	return l.config.acquire(ctx, ttl, func() (lockBackend, int64, error) {
+		token, err := newLockToken()
+		if err != nil {
+			return nil, 0, err
+		}
+
+		fencingToken, err := acquireScript.Run(l.client.Client(ctx), []string{key, fencingKey},
+			token, ttl.Milliseconds(), fencingKeyTTL(ttl).Milliseconds()).Int64()
+		if err != nil && err != redis.Nil {
+			return nil, 0, errors.Wrap(err, "could not acquire lock")
+		}
+		if fencingToken == 0 {
+			return nil, 0, ErrLockNotAcquired
+		}
+		return &redisLock{client: l.client, key: key, fencingKey: fencingKey, token: token}, fencingToken, nil
+	})
+}
+
+type redisLock struct {
+	client     *RedisClient
+	key        string
+	fencingKey string
+	token      string
+}
+
+func (l *redisLock) extend(ctx context.Context, ttl time.Duration) (bool, error) {
+	extended, err := extendScript.Run(l.client.Client(ctx), []string{l.key, l.fencingKey},
+		l.token, ttl.Milliseconds(), fencingKeyTTL(ttl).Milliseconds()).Int()
+	return extended == 1, err
+}
+
+func (l *redisLock) release(ctx context.Context) (bool, error) {
+	released, err := releaseScript.Run(l.client.Client(ctx), []string{l.key}, l.token).Int()
+	return released == 1, err
+}
+
+func fencingKeyTTL(ttl time.Duration) time.Duration {
+	if ttl*fencingKeyTTLFactor < minFencingKeyTTL {
+		return minFencingKeyTTL
+	}
+	return ttl * fencingKeyTTLFactor
+}
+
+func newLockToken() (string, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return "", errors.Wrap(err, "could not create lock token")
+	}
+	return hex.EncodeToString(token), nil
+}
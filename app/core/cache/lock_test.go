@@ -0,0 +1,241 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisLocker(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("acquire and release", func(t *testing.T) {
+		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
+			locker := NewRedisLocker(client, LockerConfig{})
+			lock, err := locker.Acquire(ctx, "job", time.Minute)
+			require.NoError(t, err)
+			assert.True(t, redis.Exists("testPrefix:{job}"))
+			assert.Equal(t, time.Minute, redis.TTL("testPrefix:{job}"))
+			assert.Equal(t, int64(1), lock.FencingToken())
+
+			_, err = locker.Acquire(ctx, "job", time.Minute)
+			assert.Equal(t, ErrLockNotAcquired, err)
+
+			require.NoError(t, lock.Release(ctx))
+			assert.False(t, redis.Exists("testPrefix:{job}"))
+			assert.Equal(t, ErrLockNotHeld, lock.Release(ctx))
+
+			lock, err = locker.Acquire(ctx, "job", time.Minute)
+			require.NoError(t, err)
+			assert.Equal(t, int64(2), lock.FencingToken())
+			assert.True(t, redis.Exists("testPrefix:{job}:fencing"))
+			assert.Equal(t, 24*time.Hour, redis.TTL("testPrefix:{job}:fencing"))
+		})
+	})
+
+	t.Run("fencing key expires", func(t *testing.T) {
+		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
+			lock, err := NewRedisLocker(client, LockerConfig{}).Acquire(ctx, "job", time.Hour)
+			require.NoError(t, err)
+			assert.Equal(t, 100*time.Hour, redis.TTL("testPrefix:{job}:fencing"))
+
+			redis.FastForward(30 * time.Minute)
+			require.NoError(t, lock.Extend(ctx, time.Hour))
+			assert.Equal(t, 100*time.Hour, redis.TTL("testPrefix:{job}:fencing"), "refreshed while the lock is held")
+
+			redis.FastForward(101 * time.Hour)
+			assert.False(t, redis.Exists("testPrefix:{job}:fencing"))
+		})
+	})
+
+	t.Run("invalid TTL", func(t *testing.T) {
+		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
+			locker := NewRedisLocker(client, LockerConfig{})
+			for _, ttl := range []time.Duration{0, -time.Second, time.Microsecond} {
+				_, err := locker.Acquire(ctx, "job", ttl)
+				assert.EqualError(t, err, "lock TTL must be at least 1ms, got "+ttl.String())
+			}
+			assert.False(t, redis.Exists("testPrefix:{job}"))
+
+			lock, err := locker.Acquire(ctx, "job", time.Minute)
+			require.NoError(t, err)
+			assert.EqualError(t, lock.Extend(ctx, 0), "lock TTL must be at least 1ms, got 0s")
+		})
+	})
+
+	t.Run("does not release or extend a lock of someone else", func(t *testing.T) {
+		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
+			locker := NewRedisLocker(client, LockerConfig{})
+			lock, err := locker.Acquire(ctx, "job", time.Minute)
+			require.NoError(t, err)
+			redis.FastForward(time.Minute)
+
+			other, err := locker.Acquire(ctx, "job", time.Minute)
+			require.NoError(t, err)
+			assert.Greater(t, other.FencingToken(), lock.FencingToken())
+			assert.Equal(t, ErrLockNotHeld, lock.Extend(ctx, time.Hour))
+			assert.Equal(t, ErrLockNotHeld, lock.Release(ctx))
+			assert.Equal(t, time.Minute, redis.TTL("testPrefix:{job}"))
+			require.NoError(t, other.Release(ctx))
+		})
+	})
+
+	t.Run("extend", func(t *testing.T) {
+		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
+			lock, err := NewRedisLocker(client, LockerConfig{}).Acquire(ctx, "job", time.Minute)
+			require.NoError(t, err)
+			require.NoError(t, lock.Extend(ctx, time.Hour))
+			assert.Equal(t, time.Hour, redis.TTL("testPrefix:{job}"))
+		})
+	})
+
+	t.Run("keeps an existing hash tag", func(t *testing.T) {
+		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
+			_, err := NewRedisLocker(client, LockerConfig{}).Acquire(ctx, "job:{42}", time.Minute)
+			require.NoError(t, err)
+			assert.True(t, redis.Exists("testPrefix:job:{42}"))
+			assert.True(t, redis.Exists("testPrefix:job:{42}:fencing"))
+		})
+	})
+
+	t.Run("retries until the lock is free", func(t *testing.T) {
+		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
+			locker := NewRedisLocker(client, LockerConfig{RetryCount: 20, RetryDelay: 10 * time.Millisecond, MaxRetryDelay: 20 * time.Millisecond})
+			lock, err := locker.Acquire(ctx, "job", time.Minute)
+			require.NoError(t, err)
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				_ = lock.Release(ctx)
+			}()
+
+			other, err := locker.Acquire(ctx, "job", time.Minute)
+			require.NoError(t, err)
+			require.NoError(t, other.Release(ctx))
+		})
+	})
+
+	t.Run("returns error of REDIS", func(t *testing.T) {
+		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
+			redis.Close()
+			_, err := NewRedisLocker(client, LockerConfig{RetryCount: 3}).Acquire(ctx, "job", time.Minute)
+			assert.Error(t, err)
+			assert.NotEqual(t, ErrLockNotAcquired, err)
+		})
+	})
+}
+
+func TestMemoryLocker(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("implements Locker", func(t *testing.T) {
+		assert.Implements(t, (*Locker)(nil), NewMemoryLocker(LockerConfig{}))
+	})
+
+	t.Run("acquire, extend and release", func(t *testing.T) {
+		now := time.Now()
+		locker := NewMemoryLocker(LockerConfig{})
+		locker.now = func() time.Time { return now }
+
+		lock, err := locker.Acquire(ctx, "job", time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), lock.FencingToken())
+		_, err = locker.Acquire(ctx, "job", time.Minute)
+		assert.Equal(t, ErrLockNotAcquired, err)
+
+		other, err := locker.Acquire(ctx, "other", time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), other.FencingToken())
+
+		require.NoError(t, lock.Extend(ctx, 2*time.Minute))
+		now = now.Add(time.Minute)
+		_, err = locker.Acquire(ctx, "job", time.Minute)
+		assert.Equal(t, ErrLockNotAcquired, err)
+
+		require.NoError(t, lock.Release(ctx))
+		assert.Equal(t, ErrLockNotHeld, lock.Release(ctx))
+		lock, err = locker.Acquire(ctx, "job", time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), lock.FencingToken())
+	})
+
+	t.Run("expired lock is acquired by someone else", func(t *testing.T) {
+		now := time.Now()
+		locker := NewMemoryLocker(LockerConfig{})
+		locker.now = func() time.Time { return now }
+
+		lock, err := locker.Acquire(ctx, "job", time.Minute)
+		require.NoError(t, err)
+		now = now.Add(time.Minute)
+		other, err := locker.Acquire(ctx, "job", time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, ErrLockNotHeld, lock.Extend(ctx, time.Minute))
+		assert.Equal(t, ErrLockNotHeld, lock.Release(ctx))
+		require.NoError(t, other.Release(ctx))
+	})
+
+	t.Run("invalid TTL", func(t *testing.T) {
+		_, err := NewMemoryLocker(LockerConfig{}).Acquire(ctx, "job", 0)
+		assert.EqualError(t, err, "lock TTL must be at least 1ms, got 0s")
+	})
+
+	t.Run("gives up after the retries", func(t *testing.T) {
+		locker := NewMemoryLocker(LockerConfig{RetryCount: 2, RetryDelay: time.Millisecond})
+		_, err := locker.Acquire(ctx, "job", time.Minute)
+		require.NoError(t, err)
+
+		start := time.Now()
+		_, err = locker.Acquire(ctx, "job", time.Minute)
+		assert.Equal(t, ErrLockNotAcquired, err)
+		assert.True(t, time.Since(start) >= 3*time.Millisecond, "waited for the retries")
+	})
+
+	t.Run("stops retrying when the context is done", func(t *testing.T) {
+		locker := NewMemoryLocker(LockerConfig{RetryCount: 100, RetryDelay: time.Second})
+		_, err := locker.Acquire(ctx, "job", time.Minute)
+		require.NoError(t, err)
+
+		timeoutCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		_, err = locker.Acquire(timeoutCtx, "job", time.Minute)
+		assert.Equal(t, context.DeadlineExceeded, err)
+	})
+
+	t.Run("renews the lock automatically", func(t *testing.T) {
+		locker := NewMemoryLocker(LockerConfig{AutoRenew: true})
+		lock, err := locker.Acquire(ctx, "job", 30*time.Millisecond)
+		require.NoError(t, err)
+
+		time.Sleep(100 * time.Millisecond)
+		_, err = locker.Acquire(ctx, "job", time.Minute)
+		assert.Equal(t, ErrLockNotAcquired, err)
+		select {
+		case <-lock.Lost():
+			t.Fatal("lock was lost")
+		default:
+		}
+
+		require.NoError(t, lock.Release(ctx))
+		_, err = locker.Acquire(ctx, "job", time.Minute)
+		assert.NoError(t, err)
+	})
+
+	t.Run("reports a lost lock", func(t *testing.T) {
+		locker := NewMemoryLocker(LockerConfig{AutoRenew: true})
+		lock, err := locker.Acquire(ctx, "job", 30*time.Millisecond)
+		require.NoError(t, err)
+		locker.mutex.Lock()
+		delete(locker.locks, "job")
+		locker.mutex.Unlock()
+
+		select {
+		case <-lock.Lost():
+		case <-time.After(time.Second):
+			t.Fatal("lost lock was not reported")
+		}
+		assert.Equal(t, ErrLockNotHeld, lock.Release(ctx))
+	})
+}
@@ -0,0 +1,450 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultMaxEntries is the number of keys a MemoryCache holds if no limit was configured.
+const DefaultMaxEntries = 10000
+
+// ErrClosed is returned by MemoryCache for all operations after Close was called.
+var ErrClosed = errors.New("cache is closed")
+
+// MemoryConfig holds the settings for MemoryCache.
+type MemoryConfig struct {
+	// Prefix is added in front of all keys separated with ":" like in RedisClient (optional).
+	Prefix string
+	// MaxEntries is the maximum number of keys. If it is exceeded, the least recently used key is evicted.
+	MaxEntries int
+	// Encoding defines how SetJSON serializes the values like in RedisClient (optional).
+	Encoding Encoding
+}
+
+// MemoryCache is an in-process implementation of the Cache interface, e.g. for local development and tests.
+// It is safe for concurrent use. Expired keys are removed when they are accessed, the number of keys is limited
+// by MaxEntries with least recently used eviction so the memory usage stays bounded.
+type MemoryCache struct {
+	prefix     string
+	encoding   Encoding
+	maxEntries int
+	entries    map[string]*list.Element
+	lru        *list.List
+	closed     bool
+	mutex      sync.Mutex
+	now        func() time.Time
+	// subscriptions holds the subscriptions per prefixed channel, see PubSub.
+	subscriptions map[string]map[*memorySubscription]bool
+}
+
+type memoryEntry struct {
+	key   string
+	value string
+	// collection holds the hash, list, set or sorted set if the key is not a string, see Collections.
+	collection interface{}
+	expiresAt  time.Time
+}
+
+// NewMemory creates a new MemoryCache.
+func NewMemory(config MemoryConfig) *MemoryCache {
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = DefaultMaxEntries
+	}
+
+	return &MemoryCache{
+		prefix:     config.Prefix,
+		encoding:   config.Encoding,
+		maxEntries: config.MaxEntries,
+		entries:    map[string]*list.Element{},
+		lru:        list.New(),
+		now:        time.Now,
+	}
+}
+
+// Prefix returns the prefix string that was defined for the cache.
+func (m *MemoryCache) Prefix() string {
+	return m.prefix
+}
+
+// Encoding returns the encoding of SetJSON, GetJSON and MGetJSON.
+func (m *MemoryCache) Encoding() Encoding {
+	return m.encoding
+}
+
+// Len returns the number of keys in the cache including expired keys that were not removed yet.
+func (m *MemoryCache) Len() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.lru.Len()
+}
+
+// Set saves a key value pair. Zero expiration means the key has no expiration time.
+func (m *MemoryCache) Set(ctx context.Context, key string, value string, expiration time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+
+	m.set(m.prefixedKey(key), value, m.expiresAt(expiration))
+	return nil
+}
+
+// Get retrieves a value. If the value was not found or is expired ErrNotFound will be returned.
+func (m *MemoryCache) Get(ctx context.Context, key string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.closed {
+		return "", ErrClosed
+	}
+
+	entry, ok := m.get(m.prefixedKey(key))
+	if !ok {
+		return "", ErrNotFound
+	}
+	if entry.collection != nil {
+		return "", ErrWrongType
+	}
+	return entry.value, nil
+}
+
+// SetBool saves a boolean value. Zero expiration means the key has no expiration time.
+func (m *MemoryCache) SetBool(ctx context.Context, key string, value bool, expiration time.Duration) error {
+	return m.Set(ctx, key, strconv.FormatBool(value), expiration)
+}
+
+// GetBool retrieves a boolean value.
+func (m *MemoryCache) GetBool(ctx context.Context, key string) (bool, error) {
+	result, err := m.Get(ctx, key)
+	if err != nil {
+		return false, err
+	}
+
+	return strconv.ParseBool(result)
+}
+
+// SetInt saves an integer value. Zero expiration means the key has no expiration time.
+func (m *MemoryCache) SetInt(ctx context.Context, key string, value int64, expiration time.Duration) error {
+	return m.Set(ctx, key, strconv.FormatInt(value, 10), expiration)
+}
+
+// GetInt retrieves an integer value.
+func (m *MemoryCache) GetInt(ctx context.Context, key string) (int64, error) {
+	result, err := m.Get(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseInt(result, 10, 64)
+}
+
+// Incr increments a value and returns the new value. Like in REDIS a missing key is treated as 0
+// and the expiration time of an existing key is kept.
+func (m *MemoryCache) Incr(ctx context.Context, key string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.closed {
+		return 0, ErrClosed
+	}
+
+	result, err := m.incr(m.prefixedKey(key))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(result, 10, 64)
+}
+
+// SetJSON saves JSON data as string or uses the configured Encoding. Zero expiration means the key has no expiration time.
+func (m *MemoryCache) SetJSON(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	encoded, err := m.encoding.Encode(value)
+	if err != nil {
+		return err
+	}
+	return m.Set(ctx, key, encoded, expiration)
+}
+
+// GetJSON retrieves stringified JSON data and parses it into the provided struct.
+func (m *MemoryCache) GetJSON(ctx context.Context, key string, result interface{}) error {
+	resultStr, err := m.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	return m.encoding.Decode(resultStr, result)
+}
+
+// Del deletes a key value pair. Deleting a missing key is not an error.
+func (m *MemoryCache) Del(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+
+	if element, ok := m.entries[m.prefixedKey(key)]; ok {
+		m.remove(element)
+	}
+	return nil
+}
+
+// Close removes all keys and closes all subscriptions. All operations after Close return ErrClosed.
+func (m *MemoryCache) Close() error {
+	m.mutex.Lock()
+	m.closed = true
+	m.clear()
+	m.mutex.Unlock()
+
+	m.closeSubscriptions()
+	return nil
+}
+
+// clear removes all keys. The mutex must be held by the caller.
+func (m *MemoryCache) clear() {
+	m.entries = map[string]*list.Element{}
+	m.lru.Init()
+}
+
+// MGet retrieves the values of multiple keys. Keys that were not found are not contained in the result.
+func (m *MemoryCache) MGet(ctx context.Context, keys ...string) (map[string]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.closed {
+		return nil, ErrClosed
+	}
+
+	result := make(map[string]string, len(keys))
+	for _, key := range keys {
+		// Like MGET in REDIS, collections are treated as missing.
+		if entry, ok := m.get(m.prefixedKey(key)); ok && entry.collection == nil {
+			result[key] = entry.value
+		}
+	}
+	return result, nil
+}
+
+// MSet saves multiple key value pairs with the same expiration. Zero expiration means the keys have no expiration time.
+func (m *MemoryCache) MSet(ctx context.Context, values map[string]string, expiration time.Duration) error {
+	batch := NewBatch()
+	for key, value := range values {
+		batch.Set(key, value, expiration)
+	}
+	return m.Exec(ctx, batch)
+}
+
+// MGetJSON retrieves stringified JSON data of multiple keys and parses it into a pointer to a slice or map,
+// see RedisClient.MGetJSON. It returns the keys that were not found.
+func (m *MemoryCache) MGetJSON(ctx context.Context, keys []string, result interface{}) ([]string, error) {
+	values, err := m.MGet(ctx, keys...)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSONMany(m.encoding, keys, values, result)
+}
+
+// DelMany deletes multiple keys. Deleting missing keys is not an error.
+func (m *MemoryCache) DelMany(ctx context.Context, keys ...string) error {
+	batch := NewBatch()
+	for _, key := range keys {
+		batch.Del(key)
+	}
+	return m.Exec(ctx, batch)
+}
+
+// Exec executes the commands of the batch. All batches are executed atomically.
+func (m *MemoryCache) Exec(ctx context.Context, batch *Batch) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+
+	for _, command := range batch.commands {
+		key := m.prefixedKey(command.key)
+		switch command.operation {
+		case batchSet:
+			m.set(key, command.value, m.expiresAt(command.expiration))
+		case batchGet:
+			entry, ok := m.get(key)
+			switch {
+			case !ok:
+				command.err = ErrNotFound
+			case entry.collection != nil:
+				command.err = ErrWrongType
+			default:
+				command.result = entry.value
+			}
+		case batchIncr:
+			command.result, command.err = m.incr(key)
+		case batchDel:
+			if element, ok := m.entries[key]; ok {
+				m.remove(element)
+			}
+		case batchExpire:
+			entry, ok := m.get(key)
+			switch {
+			case !ok:
+				command.err = ErrNotFound
+			case command.expiration <= 0:
+				// Like in REDIS, a key without remaining time expires immediately.
+				m.remove(m.entries[key])
+			default:
+				entry.expiresAt = m.expiresAt(command.expiration)
+			}
+		}
+	}
+	return batch.err()
+}
+
+// TTL returns remaining time to live of the given key.
+// If the key doesn't exist, it returns ErrNotFound, if it has no expiration time ErrNoTTLSet.
+func (m *MemoryCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.closed {
+		return 0, ErrClosed
+	}
+
+	entry, ok := m.get(m.prefixedKey(key))
+	if !ok {
+		return 0, ErrNotFound
+	}
+	if entry.expiresAt.IsZero() {
+		return 0, ErrNoTTLSet
+	}
+	return entry.expiresAt.Sub(m.now()), nil
+}
+
+// incr increments the value of the prefixed key and keeps its expiration time.
+// The mutex must be held by the caller.
+func (m *MemoryCache) incr(key string) (string, error) {
+	current := int64(0)
+	expiresAt := time.Time{}
+	if entry, ok := m.get(key); ok {
+		if entry.collection != nil {
+			return "", ErrWrongType
+		}
+		value, err := strconv.ParseInt(entry.value, 10, 64)
+		if err != nil {
+			return "", errors.Errorf("value of key %q is not an integer", m.unprefixedKey(key))
+		}
+		current = value
+		expiresAt = entry.expiresAt
+	}
+
+	current++
+	result := strconv.FormatInt(current, 10)
+	m.set(key, result, expiresAt)
+	return result, nil
+}
+
+// expiresAt returns the expiration time for the duration, zero means no expiration.
+func (m *MemoryCache) expiresAt(expiration time.Duration) time.Time {
+	if expiration <= 0 {
+		return time.Time{}
+	}
+	return m.now().Add(expiration)
+}
+
+// get returns the entry and marks it as recently used. Expired entries are removed.
+// The mutex must be held by the caller.
+func (m *MemoryCache) get(key string) (*memoryEntry, bool) {
+	element, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*memoryEntry)
+	if m.expired(entry) {
+		m.remove(element)
+		return nil, false
+	}
+	m.lru.MoveToFront(element)
+	return entry, true
+}
+
+// set adds or replaces the entry and evicts entries if MaxEntries is exceeded.
+// The mutex must be held by the caller.
+func (m *MemoryCache) set(key string, value string, expiresAt time.Time) {
+	m.setEntry(&memoryEntry{key: key, value: value, expiresAt: expiresAt})
+}
+
+// setEntry adds or replaces the entry and evicts entries if MaxEntries is exceeded.
+// The mutex must be held by the caller.
+func (m *MemoryCache) setEntry(entry *memoryEntry) {
+	if element, ok := m.entries[entry.key]; ok {
+		element.Value = entry
+		m.lru.MoveToFront(element)
+		return
+	}
+
+	m.entries[entry.key] = m.lru.PushFront(entry)
+	if m.lru.Len() > m.maxEntries {
+		m.evict()
+	}
+}
+
+// evict removes the least recently used entries until MaxEntries is not exceeded anymore.
+// Expired entries are not used anymore, so they end up at the back of the list as well.
+func (m *MemoryCache) evict() {
+	for m.lru.Len() > m.maxEntries {
+		m.remove(m.lru.Back())
+	}
+}
+
+func (m *MemoryCache) remove(element *list.Element) {
+	m.lru.Remove(element)
+	delete(m.entries, element.Value.(*memoryEntry).key)
+}
+
+func (m *MemoryCache) expired(entry *memoryEntry) bool {
+	return !entry.expiresAt.IsZero() && !m.now().Before(entry.expiresAt)
+}
+
+// prefixedKey adds the prefix in front of the key separated with ":".
+func (m *MemoryCache) prefixedKey(key string) string {
+	if m.prefix == "" {
+		return key
+	}
+	return m.prefix + ":" + key
+}
+
+func (m *MemoryCache) unprefixedKey(key string) string {
+	if m.prefix == "" {
+		return key
+	}
+	return strings.TrimPrefix(key, m.prefix+":")
+}
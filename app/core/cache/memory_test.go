@@ -0,0 +1,154 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryCache(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("implements Cache", func(t *testing.T) {
+		assert.Implements(t, (*Cache)(nil), NewMemory(MemoryConfig{}))
+	})
+
+	t.Run("get and set", func(t *testing.T) {
+		c := NewMemory(MemoryConfig{Prefix: "testPrefix"})
+		assert.Equal(t, "testPrefix", c.Prefix())
+
+		_, err := c.Get(ctx, "someKey")
+		assert.Equal(t, ErrNotFound, err)
+		require.NoError(t, c.Set(ctx, "someKey", "someValue", 0))
+		result, err := c.Get(ctx, "someKey")
+		require.NoError(t, err)
+		assert.Equal(t, "someValue", result)
+
+		require.NoError(t, c.SetBool(ctx, "bool", true, 0))
+		boolResult, err := c.GetBool(ctx, "bool")
+		require.NoError(t, err)
+		assert.True(t, boolResult)
+
+		require.NoError(t, c.SetInt(ctx, "int", 42, 0))
+		intResult, err := c.GetInt(ctx, "int")
+		require.NoError(t, err)
+		assert.Equal(t, int64(42), intResult)
+
+		require.NoError(t, c.SetJSON(ctx, "json", testStruct{Name: "Jane", Age: 42}, 0))
+		jsonResult := testStruct{}
+		require.NoError(t, c.GetJSON(ctx, "json", &jsonResult))
+		assert.Equal(t, testStruct{Name: "Jane", Age: 42}, jsonResult)
+		assert.Contains(t, c.entries, "testPrefix:json")
+
+		require.NoError(t, c.Del(ctx, "someKey"))
+		require.NoError(t, c.Del(ctx, "someKey"))
+		_, err = c.Get(ctx, "someKey")
+		assert.Equal(t, ErrNotFound, err)
+	})
+
+	t.Run("expiration", func(t *testing.T) {
+		c := NewMemory(MemoryConfig{})
+		now := time.Now()
+		c.now = func() time.Time { return now }
+
+		require.NoError(t, c.Set(ctx, "someKey", "someValue", 10*time.Minute))
+		require.NoError(t, c.Set(ctx, "persistent", "someValue", 0))
+		ttl, err := c.TTL(ctx, "someKey")
+		require.NoError(t, err)
+		assert.Equal(t, 10*time.Minute, ttl)
+		_, err = c.TTL(ctx, "persistent")
+		assert.Equal(t, ErrNoTTLSet, err)
+		_, err = c.TTL(ctx, "missing")
+		assert.Equal(t, ErrNotFound, err)
+
+		now = now.Add(10 * time.Minute)
+		_, err = c.Get(ctx, "someKey")
+		assert.Equal(t, ErrNotFound, err)
+		_, err = c.TTL(ctx, "someKey")
+		assert.Equal(t, ErrNotFound, err)
+		assert.Equal(t, 1, c.Len())
+	})
+
+	t.Run("incr", func(t *testing.T) {
+		c := NewMemory(MemoryConfig{})
+		now := time.Now()
+		c.now = func() time.Time { return now }
+
+		result, err := c.Incr(ctx, "counter")
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), result)
+		_, err = c.TTL(ctx, "counter")
+		assert.Equal(t, ErrNoTTLSet, err)
+
+		require.NoError(t, c.SetInt(ctx, "counter", 10, time.Minute))
+		now = now.Add(30 * time.Second)
+		result, err = c.Incr(ctx, "counter")
+		require.NoError(t, err)
+		assert.Equal(t, int64(11), result)
+		ttl, err := c.TTL(ctx, "counter")
+		require.NoError(t, err)
+		assert.Equal(t, 30*time.Second, ttl)
+
+		require.NoError(t, c.Set(ctx, "text", "abc", 0))
+		_, err = c.Incr(ctx, "text")
+		assert.EqualError(t, err, `value of key "text" is not an integer`)
+	})
+
+	t.Run("evicts the least recently used keys", func(t *testing.T) {
+		c := NewMemory(MemoryConfig{MaxEntries: 2})
+		require.NoError(t, c.Set(ctx, "a", "1", 0))
+		require.NoError(t, c.Set(ctx, "b", "2", 0))
+		_, err := c.Get(ctx, "a")
+		require.NoError(t, err)
+		require.NoError(t, c.Set(ctx, "c", "3", 0))
+
+		assert.Equal(t, 2, c.Len())
+		_, err = c.Get(ctx, "b")
+		assert.Equal(t, ErrNotFound, err)
+		_, err = c.Get(ctx, "a")
+		assert.NoError(t, err)
+		_, err = c.Get(ctx, "c")
+		assert.NoError(t, err)
+	})
+
+	t.Run("canceled context and closed cache", func(t *testing.T) {
+		c := NewMemory(MemoryConfig{})
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		assert.Equal(t, context.Canceled, c.Set(canceled, "someKey", "someValue", 0))
+
+		require.NoError(t, c.Set(ctx, "someKey", "someValue", 0))
+		require.NoError(t, c.Close())
+		_, err := c.Get(ctx, "someKey")
+		assert.Equal(t, ErrClosed, err)
+		assert.Equal(t, 0, c.Len())
+	})
+
+	t.Run("concurrent use", func(t *testing.T) {
+		c := NewMemory(MemoryConfig{MaxEntries: 50})
+		wg := sync.WaitGroup{}
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					key := strconv.Itoa((i * j) % 80)
+					_ = c.Set(ctx, key, "value", time.Minute)
+					_, _ = c.Get(ctx, key)
+					_, _ = c.Incr(ctx, "counter")
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		assert.LessOrEqual(t, c.Len(), 50)
+		counter, err := c.GetInt(ctx, "counter")
+		require.NoError(t, err)
+		assert.Equal(t, int64(1000), counter)
+	})
+}
@@ -0,0 +1,397 @@
+package cache
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// The collection types stored in memoryEntry.collection.
+type (
+	memoryHash      map[string]string
+	memoryList      struct{ items []string }
+	memorySet       map[string]struct{}
+	memorySortedSet map[string]float64
+)
+
+// HSet sets the fields of the hash.
+func (m *MemoryCache) HSet(ctx context.Context, key string, values map[string]string) error {
+	return m.withCollection(ctx, key, memoryHash{}, len(values) > 0, func(collection interface{}) error {
+		hash := collection.(memoryHash)
+		for field, value := range values {
+			hash[field] = value
+		}
+		return nil
+	})
+}
+
+// HGet returns ErrNotFound if the hash or the field does not exist.
+func (m *MemoryCache) HGet(ctx context.Context, key string, field string) (string, error) {
+	result := ""
+	err := m.withCollection(ctx, key, memoryHash{}, false, func(collection interface{}) error {
+		value, ok := collection.(memoryHash)[field]
+		if !ok {
+			return ErrNotFound
+		}
+		result = value
+		return nil
+	})
+	return result, err
+}
+
+// HGetAll returns a copy of the hash, it is empty if the hash does not exist.
+func (m *MemoryCache) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	result := map[string]string{}
+	err := m.withCollection(ctx, key, memoryHash{}, false, func(collection interface{}) error {
+		for field, value := range collection.(memoryHash) {
+			result[field] = value
+		}
+		return nil
+	})
+	return result, err
+}
+
+// HDel deletes the fields of the hash.
+func (m *MemoryCache) HDel(ctx context.Context, key string, fields ...string) error {
+	return m.withCollection(ctx, key, memoryHash{}, false, func(collection interface{}) error {
+		hash := collection.(memoryHash)
+		for _, field := range fields {
+			delete(hash, field)
+		}
+		return nil
+	})
+}
+
+// HIncrBy increments the integer value of the field, a missing field is treated as 0.
+func (m *MemoryCache) HIncrBy(ctx context.Context, key string, field string, increment int64) (int64, error) {
+	result := int64(0)
+	err := m.withCollection(ctx, key, memoryHash{}, true, func(collection interface{}) error {
+		hash := collection.(memoryHash)
+		if value, ok := hash[field]; ok {
+			current, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return errors.Errorf("value of field %q is not an integer", field)
+			}
+			result = current
+		}
+		result += increment
+		hash[field] = strconv.FormatInt(result, 10)
+		return nil
+	})
+	return result, err
+}
+
+// LPush adds the values at the head of the list like REDIS, so the last value is the first element afterwards.
+func (m *MemoryCache) LPush(ctx context.Context, key string, values ...string) (int64, error) {
+	length := 0
+	err := m.withCollection(ctx, key, &memoryList{}, len(values) > 0, func(collection interface{}) error {
+		list := collection.(*memoryList)
+		items := make([]string, 0, len(values)+len(list.items))
+		for i := len(values) - 1; i >= 0; i-- {
+			items = append(items, values[i])
+		}
+		list.items = append(items, list.items...)
+		length = len(list.items)
+		return nil
+	})
+	return int64(length), err
+}
+
+// RPush adds the values at the tail of the list.
+func (m *MemoryCache) RPush(ctx context.Context, key string, values ...string) (int64, error) {
+	length := 0
+	err := m.withCollection(ctx, key, &memoryList{}, len(values) > 0, func(collection interface{}) error {
+		list := collection.(*memoryList)
+		list.items = append(list.items, values...)
+		length = len(list.items)
+		return nil
+	})
+	return int64(length), err
+}
+
+// LPop removes the first element, it returns ErrNotFound if the list is empty.
+func (m *MemoryCache) LPop(ctx context.Context, key string) (string, error) {
+	return m.pop(ctx, key, true)
+}
+
+// RPop removes the last element, it returns ErrNotFound if the list is empty.
+func (m *MemoryCache) RPop(ctx context.Context, key string) (string, error) {
+	return m.pop(ctx, key, false)
+}
+
+func (m *MemoryCache) pop(ctx context.Context, key string, head bool) (string, error) {
+	result := ""
+	err := m.withCollection(ctx, key, &memoryList{}, false, func(collection interface{}) error {
+		list := collection.(*memoryList)
+		if len(list.items) == 0 {
+			return ErrNotFound
+		}
+		if head {
+			result, list.items = list.items[0], list.items[1:]
+		} else {
+			result, list.items = list.items[len(list.items)-1], list.items[:len(list.items)-1]
+		}
+		return nil
+	})
+	return result, err
+}
+
+// LRange returns the elements between the start and stop index (inclusive), negative indexes count from the end.
+func (m *MemoryCache) LRange(ctx context.Context, key string, start int64, stop int64) ([]string, error) {
+	result := []string{}
+	err := m.withCollection(ctx, key, &memoryList{}, false, func(collection interface{}) error {
+		items := collection.(*memoryList).items
+		from, to := rangeIndexes(start, stop, len(items))
+		result = append(result, items[from:to]...)
+		return nil
+	})
+	return result, err
+}
+
+// LTrim removes all elements that are not between the start and stop index (inclusive).
+func (m *MemoryCache) LTrim(ctx context.Context, key string, start int64, stop int64) error {
+	return m.withCollection(ctx, key, &memoryList{}, false, func(collection interface{}) error {
+		list := collection.(*memoryList)
+		from, to := rangeIndexes(start, stop, len(list.items))
+		list.items = append([]string{}, list.items[from:to]...)
+		return nil
+	})
+}
+
+// LLen returns the length of the list, 0 if it does not exist.
+func (m *MemoryCache) LLen(ctx context.Context, key string) (int64, error) {
+	length := 0
+	err := m.withCollection(ctx, key, &memoryList{}, false, func(collection interface{}) error {
+		length = len(collection.(*memoryList).items)
+		return nil
+	})
+	return int64(length), err
+}
+
+// SAdd adds the members to the set and returns the number of members that were not in the set before.
+func (m *MemoryCache) SAdd(ctx context.Context, key string, members ...string) (int64, error) {
+	added := int64(0)
+	err := m.withCollection(ctx, key, memorySet{}, len(members) > 0, func(collection interface{}) error {
+		set := collection.(memorySet)
+		for _, member := range members {
+			if _, ok := set[member]; !ok {
+				set[member] = struct{}{}
+				added++
+			}
+		}
+		return nil
+	})
+	return added, err
+}
+
+// SRem removes the members from the set and returns the number of members that were removed.
+func (m *MemoryCache) SRem(ctx context.Context, key string, members ...string) (int64, error) {
+	removed := int64(0)
+	err := m.withCollection(ctx, key, memorySet{}, false, func(collection interface{}) error {
+		set := collection.(memorySet)
+		for _, member := range members {
+			if _, ok := set[member]; ok {
+				delete(set, member)
+				removed++
+			}
+		}
+		return nil
+	})
+	return removed, err
+}
+
+// SMembers returns the members in no particular order.
+func (m *MemoryCache) SMembers(ctx context.Context, key string) ([]string, error) {
+	result := []string{}
+	err := m.withCollection(ctx, key, memorySet{}, false, func(collection interface{}) error {
+		for member := range collection.(memorySet) {
+			result = append(result, member)
+		}
+		return nil
+	})
+	return result, err
+}
+
+// SIsMember checks whether the member is in the set.
+func (m *MemoryCache) SIsMember(ctx context.Context, key string, member string) (bool, error) {
+	found := false
+	err := m.withCollection(ctx, key, memorySet{}, false, func(collection interface{}) error {
+		_, found = collection.(memorySet)[member]
+		return nil
+	})
+	return found, err
+}
+
+// ZAdd adds the members or updates their score and returns the number of members that were added.
+func (m *MemoryCache) ZAdd(ctx context.Context, key string, members ...ZMember) (int64, error) {
+	added := int64(0)
+	err := m.withCollection(ctx, key, memorySortedSet{}, len(members) > 0, func(collection interface{}) error {
+		set := collection.(memorySortedSet)
+		for _, member := range members {
+			if _, ok := set[member.Member]; !ok {
+				added++
+			}
+			set[member.Member] = member.Score
+		}
+		return nil
+	})
+	return added, err
+}
+
+// ZRem removes the members and returns the number of members that were removed.
+func (m *MemoryCache) ZRem(ctx context.Context, key string, members ...string) (int64, error) {
+	removed := int64(0)
+	err := m.withCollection(ctx, key, memorySortedSet{}, false, func(collection interface{}) error {
+		set := collection.(memorySortedSet)
+		for _, member := range members {
+			if _, ok := set[member]; ok {
+				delete(set, member)
+				removed++
+			}
+		}
+		return nil
+	})
+	return removed, err
+}
+
+// ZRange returns the members between the start and stop rank (inclusive) ordered by score.
+func (m *MemoryCache) ZRange(ctx context.Context, key string, start int64, stop int64) ([]ZMember, error) {
+	result := []ZMember{}
+	err := m.withCollection(ctx, key, memorySortedSet{}, false, func(collection interface{}) error {
+		members := collection.(memorySortedSet).sorted()
+		from, to := rangeIndexes(start, stop, len(members))
+		result = append(result, members[from:to]...)
+		return nil
+	})
+	return result, err
+}
+
+// ZRangeByScore returns the members with a score between min and max (inclusive) ordered by score.
+func (m *MemoryCache) ZRangeByScore(ctx context.Context, key string, min float64, max float64) ([]ZMember, error) {
+	result := []ZMember{}
+	err := m.withCollection(ctx, key, memorySortedSet{}, false, func(collection interface{}) error {
+		for _, member := range collection.(memorySortedSet).sorted() {
+			if member.Score >= min && member.Score <= max {
+				result = append(result, member)
+			}
+		}
+		return nil
+	})
+	return result, err
+}
+
+// ZRank returns the position of the member ordered by score, ErrNotFound if it is not in the sorted set.
+func (m *MemoryCache) ZRank(ctx context.Context, key string, member string) (int64, error) {
+	rank := int64(0)
+	err := m.withCollection(ctx, key, memorySortedSet{}, false, func(collection interface{}) error {
+		for i, current := range collection.(memorySortedSet).sorted() {
+			if current.Member == member {
+				rank = int64(i)
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+	return rank, err
+}
+
+// ZScore returns the score of the member, ErrNotFound if it is not in the sorted set.
+func (m *MemoryCache) ZScore(ctx context.Context, key string, member string) (float64, error) {
+	score := float64(0)
+	err := m.withCollection(ctx, key, memorySortedSet{}, false, func(collection interface{}) error {
+		value, ok := collection.(memorySortedSet)[member]
+		if !ok {
+			return ErrNotFound
+		}
+		score = value
+		return nil
+	})
+	return score, err
+}
+
+// withCollection calls fn with the collection of the key while the mutex is held. If the key does not exist,
+// fn is called with the empty collection which is only saved if create is true. It returns ErrWrongType if
+// the key holds a different type of value. Collections without elements are removed afterwards like in REDIS.
+func (m *MemoryCache) withCollection(ctx context.Context, key string, empty interface{}, create bool, fn func(collection interface{}) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+
+	key = m.prefixedKey(key)
+	collection := empty
+	if entry, ok := m.get(key); ok {
+		if entry.collection == nil || reflect.TypeOf(entry.collection) != reflect.TypeOf(empty) {
+			return ErrWrongType
+		}
+		collection = entry.collection
+	} else if create {
+		m.setEntry(&memoryEntry{key: key, collection: collection})
+	}
+
+	err := fn(collection)
+	if element, ok := m.entries[key]; ok && collectionLen(collection) == 0 {
+		m.remove(element)
+	}
+	return err
+}
+
+func collectionLen(collection interface{}) int {
+	switch collection := collection.(type) {
+	case memoryHash:
+		return len(collection)
+	case *memoryList:
+		return len(collection.items)
+	case memorySet:
+		return len(collection)
+	case memorySortedSet:
+		return len(collection)
+	default:
+		return 0
+	}
+}
+
+// sorted returns the members ordered by score and members with the same score lexicographically.
+func (s memorySortedSet) sorted() []ZMember {
+	members := make([]ZMember, 0, len(s))
+	for member, score := range s {
+		members = append(members, ZMember{Member: member, Score: score})
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].Score != members[j].Score {
+			return members[i].Score < members[j].Score
+		}
+		return members[i].Member < members[j].Member
+	})
+	return members
+}
+
+// rangeIndexes converts the start and stop index (inclusive, negative counts from the end) like in REDIS
+// into slice bounds for a collection with the given length.
+func rangeIndexes(start int64, stop int64, length int) (int, int) {
+	n := int64(length)
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop || start >= n {
+		return 0, 0
+	}
+	return int(start), int(stop) + 1
+}
@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryLocker is an in-process implementation of the Locker interface, e.g. for local development and tests.
+// Locks only exclude other users of the same MemoryLocker.
+type MemoryLocker struct {
+	config        LockerConfig
+	locks         map[string]*memoryLockEntry
+	fencingTokens map[string]int64
+	mutex         sync.Mutex
+	now           func() time.Time
+}
+
+type memoryLockEntry struct {
+	token     int64
+	expiresAt time.Time
+}
+
+// NewMemoryLocker creates a new MemoryLocker.
+func NewMemoryLocker(config LockerConfig) *MemoryLocker {
+	return &MemoryLocker{
+		config:        config.withDefaults(),
+		locks:         map[string]*memoryLockEntry{},
+		fencingTokens: map[string]int64{},
+		now:           time.Now,
+	}
+}
+
+// Acquire acquires the lock, see LockerConfig for the retries and the automatic renewal.
+func (m *MemoryLocker) Acquire(ctx context.Context, name string, ttl time.Duration) (Lock, error) {
+	return m.config.acquire(ctx, ttl, func() (lockBackend, int64, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, 0, err
+		}
+
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+		if m.held(name) {
+			return nil, 0, ErrLockNotAcquired
+		}
+
+		// The fencing token also identifies the owner since it is unique per name.
+		m.fencingTokens[name]++
+		token := m.fencingTokens[name]
+		m.locks[name] = &memoryLockEntry{token: token, expiresAt: m.expiresAt(ttl)}
+		return &memoryLock{locker: m, name: name, token: token}, token, nil
+	})
+}
+
+// held returns whether the lock is held and not expired. The mutex must be held by the caller.
+func (m *MemoryLocker) held(name string) bool {
+	entry, ok := m.locks[name]
+	return ok && m.now().Before(entry.expiresAt)
+}
+
+// owner returns the entry of the lock if it is still held by the owner with the token.
+// The mutex must be held by the caller.
+func (m *MemoryLocker) owner(name string, token int64) (*memoryLockEntry, bool) {
+	if !m.held(name) || m.locks[name].token != token {
+		return nil, false
+	}
+	return m.locks[name], true
+}
+
+func (m *MemoryLocker) expiresAt(ttl time.Duration) time.Time {
+	return m.now().Add(ttl)
+}
+
+type memoryLock struct {
+	locker *MemoryLocker
+	name   string
+	token  int64
+}
+
+func (l *memoryLock) extend(ctx context.Context, ttl time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	l.locker.mutex.Lock()
+	defer l.locker.mutex.Unlock()
+	entry, ok := l.locker.owner(l.name, l.token)
+	if !ok {
+		return false, nil
+	}
+	entry.expiresAt = l.locker.expiresAt(ttl)
+	return true, nil
+}
+
+func (l *memoryLock) release(ctx context.Context) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	l.locker.mutex.Lock()
+	defer l.locker.mutex.Unlock()
+	if _, ok := l.locker.owner(l.name, l.token); !ok {
+		return false, nil
+	}
+	delete(l.locker.locks, l.name)
+	return true, nil
+}
@@ -0,0 +1,68 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"toolkit/app/core/cache"
+	"toolkit/app/core/cache/cachemock"
+	"toolkit/app/core/observance"
+)
+
+// The tests that use the mocks are in an external test package since cachemock imports cache.
+
+func TestMocks(t *testing.T) {
+	assert.Implements(t, (*cache.LegacyCache)(nil), &cachemock.LegacyCache{})
+	assert.Implements(t, (*cache.Cache)(nil), &cachemock.Cache{})
+	assert.Implements(t, (*cache.Collections)(nil), &cachemock.Collections{})
+	assert.Implements(t, (*cache.PubSub)(nil), &cachemock.PubSub{})
+	assert.Implements(t, (*cache.Subscription)(nil), &cachemock.Subscription{})
+}
+
+func TestInstrumentedCacheError(t *testing.T) {
+	cacheMock := &cachemock.Cache{}
+	cacheMock.On("Del", mock.Anything, "user:1").Return(errors.New("connection lost"))
+	metrics := observance.NewTestMeasurer()
+	logger := observance.NewTestLogger()
+	c := cache.NewInstrumented(cacheMock, metrics, logger, cache.InstrumentationConfig{KeyPrefixes: []string{"user"}})
+
+	err := c.Del(context.Background(), "user:1")
+	assert.EqualError(t, err, "connection lost")
+
+	metrics.AssertCounter(t, cache.MetricOperations, observance.Labels{"cache": "", "operation": "del", "prefix": "user", "result": "error"}, 1)
+	assert.Equal(t, "warning", logger.LastEntry().Level)
+	assert.Equal(t, "cache operation failed", logger.LastEntry().Message)
+	assert.Equal(t, "user:1", logger.LastEntry().Data["key"])
+	cacheMock.AssertExpectations(t)
+}
+
+func TestExecBatchFallback(t *testing.T) {
+	ctx := context.Background()
+	mockCache := &cachemock.Cache{}
+	mockCache.On("Set", ctx, "key", "value", time.Minute).Return(nil)
+	mockCache.On("Get", ctx, "missing").Return("", cache.ErrNotFound)
+	mockCache.On("Incr", ctx, "counter").Return(int64(5), nil)
+	mockCache.On("Get", ctx, "existing").Return("value", nil)
+	mockCache.On("Set", ctx, "existing", "value", time.Hour).Return(nil)
+
+	batch := cache.NewBatch()
+	batch.Set("key", "value", time.Minute)
+	missing := batch.Get("missing")
+	incr := batch.Incr("counter")
+	expire := batch.Expire("existing", time.Hour)
+	require.NoError(t, cache.ExecBatch(ctx, mockCache, batch))
+	assert.Equal(t, cache.ErrNotFound, missing.Err())
+	counter, err := incr.Int()
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), counter)
+	assert.NoError(t, expire.Err())
+	mockCache.AssertExpectations(t)
+
+	assert.EqualError(t, cache.ExecBatch(ctx, mockCache, cache.NewTransaction()), "cache does not support transactions")
+	mockCache.AssertNotCalled(t, "Del", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,463 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/pkg/errors"
+	"toolkit/app/core/observance"
+)
+
+// Names of the metrics recorded by NearCache.
+const (
+	MetricNearLocalRequests    = "cache_near_local_requests_total"
+	MetricNearInvalidations    = "cache_near_invalidations_total"
+	MetricNearSubscriptionDown = "cache_near_subscription_down"
+)
+
+// ResultBypass is used as "result" label of MetricNearLocalRequests in addition to ResultHit and ResultMiss
+// if the local cache was not used because the invalidation subscription is broken.
+const ResultBypass = "bypass"
+
+// Default settings of NearCache.
+const (
+	DefaultNearLocalTTL            = 5 * time.Second
+	DefaultNearMaxEntries          = 1000
+	DefaultNearHealthCheckInterval = 5 * time.Second
+	nearInvalidationChannel        = "cache-invalidation"
+)
+
+// resubscribeDelay is the time to wait before the subscription is retried after it failed.
+var resubscribeDelay = time.Second
+
+// NearConfig holds the settings for NearCache.
+type NearConfig struct {
+	// Name is added as label "cache" to all metrics (optional).
+	Name string
+	// LocalTTL is the time a value is kept in the local cache, it bounds how long an instance might
+	// serve a stale value if an invalidation message gets lost (default 5s).
+	LocalTTL time.Duration
+	// MaxEntries is the number of keys in the local cache (default 1000).
+	MaxEntries int
+	// Channel is the pub/sub channel for the invalidations. It defaults to "cache-invalidation" with the prefix
+	// of the REDIS client, so all instances that share the prefix also share the channel.
+	Channel string
+	// HealthCheckInterval defines how often the subscription is checked if no messages arrive (default 5s).
+	HealthCheckInterval time.Duration
+}
+
+// NearCache is a two-tier cache that keeps a small local LRU cache in front of REDIS for hot keys.
+// Writes and deletes are published via REDIS pub/sub so all instances evict their local copy.
+// If the subscription breaks, the local cache is cleared and bypassed until the subscription is restored,
+// so no stale values are served because of missed invalidations.
+// Collections are always read from REDIS, writes to them publish an invalidation since the key
+// might have held a value that is cached locally before.
+type NearCache struct {
+	remote  *RedisClient
+	local   *MemoryCache
+	metrics observance.Measurer
+	logger  observance.Logger
+	config  NearConfig
+	pubsub  *redis.PubSub
+	// id identifies the instance so it ignores its own invalidations, it already evicted the key locally.
+	id string
+
+	// generation is incremented with every invalidation so values that were fetched from REDIS
+	// while an invalidation arrived are not stored locally.
+	generation uint64
+	mutex      sync.Mutex
+	active     int32
+	closed     int32
+	done       chan struct{}
+}
+
+// NewNear creates a new NearCache in front of the REDIS client and subscribes to the invalidation channel.
+func NewNear(remote *RedisClient, metrics observance.Measurer, logger observance.Logger, config NearConfig) (*NearCache, error) {
+	if config.LocalTTL <= 0 {
+		config.LocalTTL = DefaultNearLocalTTL
+	}
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = DefaultNearMaxEntries
+	}
+	if config.HealthCheckInterval <= 0 {
+		config.HealthCheckInterval = DefaultNearHealthCheckInterval
+	}
+	if config.Channel == "" {
+		config.Channel = remote.prefixedKey(nearInvalidationChannel)
+	}
+
+	pubsub := remote.Redis.Subscribe(config.Channel)
+	if _, err := pubsub.Receive(); err != nil {
+		pubsub.Close()
+		return nil, errors.Wrap(err, "could not subscribe to cache invalidations")
+	}
+
+	n := &NearCache{
+		remote:  remote,
+		local:   NewMemory(MemoryConfig{MaxEntries: config.MaxEntries}),
+		metrics: metrics,
+		logger:  logger,
+		config:  config,
+		pubsub:  pubsub,
+		id:      newInstanceID(),
+		active:  1,
+		done:    make(chan struct{}),
+	}
+	n.metrics.SetGaugeWithLabels(MetricNearSubscriptionDown, 0, observance.Labels{"cache": n.config.Name})
+	go n.listen()
+	return n, nil
+}
+
+// Prefix returns the prefix of the REDIS client.
+func (n *NearCache) Prefix() string {
+	return n.remote.Prefix()
+}
+
+// Encoding returns the encoding of the REDIS client.
+func (n *NearCache) Encoding() Encoding {
+	return n.remote.encoding
+}
+
+// Set saves the value in REDIS and publishes an invalidation for the key.
+func (n *NearCache) Set(ctx context.Context, key string, value string, expiration time.Duration) error {
+	if err := n.remote.Set(ctx, key, value, expiration); err != nil {
+		return err
+	}
+	n.publishInvalidation(ctx, key)
+	return nil
+}
+
+// Get returns the value from the local cache or, if it is not found there, from REDIS.
+// Values read from REDIS are stored in the local cache for LocalTTL.
+func (n *NearCache) Get(ctx context.Context, key string) (string, error) {
+	if atomic.LoadInt32(&n.active) == 0 {
+		n.recordLocal(ResultBypass)
+		return n.remote.Get(ctx, key)
+	}
+
+	if value, err := n.local.Get(ctx, key); err == nil {
+		n.recordLocal(ResultHit)
+		return value, nil
+	}
+	n.recordLocal(ResultMiss)
+
+	generation := atomic.LoadUint64(&n.generation)
+	value, err := n.remote.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	n.storeLocally(key, value, generation)
+	return value, nil
+}
+
+// SetBool saves a boolean value, see Set.
+func (n *NearCache) SetBool(ctx context.Context, key string, value bool, expiration time.Duration) error {
+	return n.Set(ctx, key, strconv.FormatBool(value), expiration)
+}
+
+// GetBool retrieves a boolean value, see Get.
+func (n *NearCache) GetBool(ctx context.Context, key string) (bool, error) {
+	result, err := n.Get(ctx, key)
+	if err != nil {
+		return false, err
+	}
+
+	return strconv.ParseBool(result)
+}
+
+// SetInt saves an integer value, see Set.
+func (n *NearCache) SetInt(ctx context.Context, key string, value int64, expiration time.Duration) error {
+	return n.Set(ctx, key, strconv.FormatInt(value, 10), expiration)
+}
+
+// GetInt retrieves an integer value, see Get.
+func (n *NearCache) GetInt(ctx context.Context, key string) (int64, error) {
+	result, err := n.Get(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseInt(result, 10, 64)
+}
+
+// Incr increments the value in REDIS and publishes an invalidation for the key.
+func (n *NearCache) Incr(ctx context.Context, key string) (int64, error) {
+	result, err := n.remote.Incr(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	n.publishInvalidation(ctx, key)
+	return result, nil
+}
+
+// SetJSON saves JSON data as string with the Encoding of the REDIS client, see Set.
+func (n *NearCache) SetJSON(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	encoded, err := n.remote.encoding.Encode(value)
+	if err != nil {
+		return err
+	}
+	return n.Set(ctx, key, encoded, expiration)
+}
+
+// GetJSON retrieves stringified JSON data and parses it into the provided struct, see Get.
+func (n *NearCache) GetJSON(ctx context.Context, key string, result interface{}) error {
+	resultStr, err := n.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	return n.remote.encoding.Decode(resultStr, result)
+}
+
+// Del deletes the key from REDIS and publishes an invalidation for the key.
+func (n *NearCache) Del(ctx context.Context, key string) error {
+	if err := n.remote.Del(ctx, key); err != nil {
+		return err
+	}
+	n.publishInvalidation(ctx, key)
+	return nil
+}
+
+// TTL returns the remaining time to live of the key in REDIS.
+func (n *NearCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return n.remote.TTL(ctx, key)
+}
+
+// MGet returns the values from the local cache and fetches the missing keys from REDIS in one round trip.
+func (n *NearCache) MGet(ctx context.Context, keys ...string) (map[string]string, error) {
+	if atomic.LoadInt32(&n.active) == 0 {
+		for range keys {
+			n.recordLocal(ResultBypass)
+		}
+		return n.remote.MGet(ctx, keys...)
+	}
+
+	result := make(map[string]string, len(keys))
+	remoteKeys := []string{}
+	for _, key := range keys {
+		if value, err := n.local.Get(ctx, key); err == nil {
+			n.recordLocal(ResultHit)
+			result[key] = value
+			continue
+		}
+		n.recordLocal(ResultMiss)
+		remoteKeys = append(remoteKeys, key)
+	}
+	if len(remoteKeys) == 0 {
+		return result, nil
+	}
+
+	generation := atomic.LoadUint64(&n.generation)
+	values, err := n.remote.MGet(ctx, remoteKeys...)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range values {
+		result[key] = value
+		n.storeLocally(key, value, generation)
+	}
+	return result, nil
+}
+
+// MSet saves the values in REDIS and publishes one invalidation for all keys.
+func (n *NearCache) MSet(ctx context.Context, values map[string]string, expiration time.Duration) error {
+	err := n.remote.MSet(ctx, values, expiration)
+	// Some keys might have been written even if the pipeline failed.
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	n.publishInvalidation(ctx, keys...)
+	return err
+}
+
+// MGetJSON retrieves stringified JSON data of multiple keys and parses it into a pointer to a slice or map,
+// see RedisClient.MGetJSON. It returns the keys that were not found.
+func (n *NearCache) MGetJSON(ctx context.Context, keys []string, result interface{}) ([]string, error) {
+	values, err := n.MGet(ctx, keys...)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSONMany(n.remote.encoding, keys, values, result)
+}
+
+// DelMany deletes the keys from REDIS and publishes one invalidation for all keys.
+func (n *NearCache) DelMany(ctx context.Context, keys ...string) error {
+	err := n.remote.DelMany(ctx, keys...)
+	n.publishInvalidation(ctx, keys...)
+	return err
+}
+
+// Exec executes the batch in REDIS and publishes one invalidation for all keys that were written.
+// Get commands in the batch always read from REDIS.
+func (n *NearCache) Exec(ctx context.Context, batch *Batch) error {
+	err := n.remote.Exec(ctx, batch)
+	keys := []string{}
+	invalidated := map[string]bool{}
+	for _, command := range batch.commands {
+		if command.writes() && !invalidated[command.key] {
+			invalidated[command.key] = true
+			keys = append(keys, command.key)
+		}
+	}
+	n.publishInvalidation(ctx, keys...)
+	return err
+}
+
+// Close stops the subscription and closes the REDIS client.
+func (n *NearCache) Close() error {
+	if !atomic.CompareAndSwapInt32(&n.closed, 0, 1) {
+		return nil
+	}
+
+	err := n.pubsub.Close()
+	<-n.done
+	n.local.Close()
+	if closeErr := n.remote.Close(); closeErr != nil {
+		return closeErr
+	}
+	return err
+}
+
+// publishInvalidation evicts the keys locally and notifies the other instances with one message
+// "<instance ID> <JSON array of the keys>". If publishing fails, the error is only logged since the values
+// were written. The other instances serve the old values for at most LocalTTL.
+func (n *NearCache) publishInvalidation(ctx context.Context, keys ...string) {
+	if len(keys) == 0 {
+		return
+	}
+
+	n.invalidate(keys...)
+	// Encoding a string slice cannot fail.
+	encoded, _ := json.Marshal(keys)
+	if err := n.remote.Client(ctx).Publish(n.config.Channel, n.id+" "+string(encoded)).Err(); err != nil {
+		n.logger.WithFields(observance.Fields{
+			"cache": n.config.Name,
+			"keys":  keys,
+		}).WithError(err).Warn("failed to publish cache invalidation")
+	}
+}
+
+func (n *NearCache) invalidate(keys ...string) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	atomic.AddUint64(&n.generation, 1)
+	_ = n.local.DelMany(context.Background(), keys...)
+}
+
+// storeLocally saves the value in the local cache unless an invalidation happened since it was read from REDIS.
+func (n *NearCache) storeLocally(key string, value string, generation uint64) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if atomic.LoadUint64(&n.generation) != generation || atomic.LoadInt32(&n.active) == 0 {
+		return
+	}
+	_ = n.local.Set(context.Background(), key, value, n.config.LocalTTL)
+}
+
+// clearLocal removes all keys from the local cache.
+func (n *NearCache) clearLocal() {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	atomic.AddUint64(&n.generation, 1)
+	n.local.mutex.Lock()
+	n.local.clear()
+	n.local.mutex.Unlock()
+}
+
+// listen handles the invalidation messages and detects broken subscriptions. Broken subscriptions are
+// re-established automatically by the REDIS client, in the meantime the local cache is bypassed.
+func (n *NearCache) listen() {
+	defer close(n.done)
+	for {
+		msg, err := n.pubsub.ReceiveTimeout(n.config.HealthCheckInterval)
+		if atomic.LoadInt32(&n.closed) == 1 {
+			return
+		}
+
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				if err := n.pubsub.Ping(); err != nil {
+					n.deactivate(err)
+				}
+				continue
+			}
+			n.deactivate(err)
+			time.Sleep(resubscribeDelay)
+			continue
+		}
+
+		switch msg := msg.(type) {
+		case *redis.Message:
+			n.handleInvalidation(msg.Payload)
+		case *redis.Subscription:
+			if msg.Kind == "subscribe" {
+				n.activate()
+			}
+		}
+	}
+}
+
+// handleInvalidation evicts the keys of an invalidation message published by another instance.
+func (n *NearCache) handleInvalidation(payload string) {
+	parts := strings.SplitN(payload, " ", 2)
+	if len(parts) != 2 || parts[0] == n.id {
+		return
+	}
+
+	keys := []string{}
+	if err := json.Unmarshal([]byte(parts[1]), &keys); err != nil {
+		n.logger.WithField("cache", n.config.Name).WithError(err).Warn("received invalid cache invalidation")
+		return
+	}
+	n.invalidate(keys...)
+	for range keys {
+		n.metrics.IncrementWithLabels(MetricNearInvalidations, observance.Labels{"cache": n.config.Name})
+	}
+}
+
+// deactivate bypasses the local cache since invalidations might be missed.
+func (n *NearCache) deactivate(err error) {
+	if !atomic.CompareAndSwapInt32(&n.active, 1, 0) {
+		return
+	}
+	n.clearLocal()
+	n.metrics.SetGaugeWithLabels(MetricNearSubscriptionDown, 1, observance.Labels{"cache": n.config.Name})
+	n.logger.WithField("cache", n.config.Name).WithError(err).
+		Warn("cache invalidation subscription broken, local cache is bypassed")
+}
+
+// activate uses the local cache again after the subscription was restored.
+func (n *NearCache) activate() {
+	if !atomic.CompareAndSwapInt32(&n.active, 0, 1) {
+		return
+	}
+	n.clearLocal()
+	n.metrics.SetGaugeWithLabels(MetricNearSubscriptionDown, 0, observance.Labels{"cache": n.config.Name})
+	n.logger.WithField("cache", n.config.Name).Info("cache invalidation subscription restored")
+}
+
+// newInstanceID returns a random ID, the invalidation messages are only unique per process if this fails.
+func newInstanceID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(id)
+}
+
+func (n *NearCache) recordLocal(result string) {
+	n.metrics.IncrementWithLabels(MetricNearLocalRequests, observance.Labels{
+		"cache":  n.config.Name,
+		"result": result,
+	})
+}
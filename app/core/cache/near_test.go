@@ -0,0 +1,202 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/go-redis/redis/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"toolkit/app/core/observance"
+)
+
+func TestNearCache(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("implements Cache", func(t *testing.T) {
+		assert.Implements(t, (*Cache)(nil), &NearCache{})
+		assert.Implements(t, (*Collections)(nil), &NearCache{})
+	})
+
+	t.Run("serves hot keys locally and invalidates all instances", func(t *testing.T) {
+		redis, err := miniredis.Run()
+		require.NoError(t, err)
+		defer redis.Close()
+
+		metrics := observance.NewTestMeasurer()
+		first := newNearCache(t, redis, metrics)
+		defer first.Close()
+		second := newNearCache(t, redis, observance.NewTestMeasurer())
+		defer second.Close()
+
+		require.NoError(t, first.Set(ctx, "feature", "on", 0))
+		for i := 0; i < 3; i++ {
+			result, err := first.Get(ctx, "feature")
+			require.NoError(t, err)
+			assert.Equal(t, "on", result)
+		}
+		metrics.AssertCounter(t, MetricNearLocalRequests, observance.Labels{"cache": "main", "result": "miss"}, 1)
+		metrics.AssertCounter(t, MetricNearLocalRequests, observance.Labels{"cache": "main", "result": "hit"}, 2)
+
+		// A write on the other instance evicts the local copy.
+		require.NoError(t, second.Set(ctx, "feature", "off", 0))
+		assert.Eventually(t, func() bool {
+			result, err := first.Get(ctx, "feature")
+			return err == nil && result == "off"
+		}, time.Second, 5*time.Millisecond)
+		metrics.AssertCounter(t, MetricNearInvalidations, observance.Labels{"cache": "main"}, 1)
+
+		require.NoError(t, second.Del(ctx, "feature"))
+		assert.Eventually(t, func() bool {
+			_, err := first.Get(ctx, "feature")
+			return err == ErrNotFound
+		}, time.Second, 5*time.Millisecond)
+
+		// Local values expire after the local TTL even without invalidation.
+		require.NoError(t, first.SetInt(ctx, "counter", 1, 0))
+		_, err = first.GetInt(ctx, "counter")
+		require.NoError(t, err)
+		redis.Set("testPrefix:counter", "5")
+		result, err := first.GetInt(ctx, "counter")
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), result)
+		time.Sleep(60 * time.Millisecond)
+		result, err = first.GetInt(ctx, "counter")
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), result)
+	})
+
+	t.Run("publishes one invalidation for multiple keys", func(t *testing.T) {
+		redis, err := miniredis.Run()
+		require.NoError(t, err)
+		defer redis.Close()
+
+		metrics := observance.NewTestMeasurer()
+		first := newNearCache(t, redis, metrics)
+		defer first.Close()
+		second := newNearCache(t, redis, observance.NewTestMeasurer())
+		defer second.Close()
+
+		require.NoError(t, first.MSet(ctx, map[string]string{"a": "1", "b": "2"}, time.Minute))
+		_, err = first.MGet(ctx, "a", "b")
+		require.NoError(t, err)
+
+		pubsub := second.remote.Redis.Subscribe("testPrefix:cache-invalidation")
+		defer pubsub.Close()
+		_, err = pubsub.Receive()
+		require.NoError(t, err)
+
+		require.NoError(t, second.DelMany(ctx, "a", "b"))
+		msg, err := pubsub.ReceiveTimeout(time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, second.id+` ["a","b"]`, msg.(*goredis.Message).Payload)
+		_, err = pubsub.ReceiveTimeout(20 * time.Millisecond)
+		assert.Error(t, err, "no message per key")
+
+		assert.Eventually(t, func() bool {
+			values, err := first.MGet(ctx, "a", "b")
+			return err == nil && len(values) == 0
+		}, time.Second, 5*time.Millisecond)
+		metrics.AssertCounter(t, MetricNearInvalidations, observance.Labels{"cache": "main"}, 2)
+	})
+
+	t.Run("collection writes invalidate all instances", func(t *testing.T) {
+		redis, err := miniredis.Run()
+		require.NoError(t, err)
+		defer redis.Close()
+
+		metrics := observance.NewTestMeasurer()
+		first := newNearCache(t, redis, metrics)
+		defer first.Close()
+		second := newNearCache(t, redis, observance.NewTestMeasurer())
+		defer second.Close()
+
+		require.NoError(t, first.Set(ctx, "feature", "on", 0))
+		_, err = first.Get(ctx, "feature")
+		require.NoError(t, err)
+
+		// The key expired in REDIS and became a hash before the local copy expired.
+		redis.Del("testPrefix:feature")
+		require.NoError(t, second.HSet(ctx, "feature", map[string]string{"state": "on"}))
+		assert.Eventually(t, func() bool {
+			_, err := first.Get(ctx, "feature")
+			return err != nil
+		}, time.Second, 5*time.Millisecond)
+		metrics.AssertCounter(t, MetricNearInvalidations, observance.Labels{"cache": "main"}, 1)
+
+		state, err := first.HGet(ctx, "feature", "state")
+		require.NoError(t, err)
+		assert.Equal(t, "on", state)
+	})
+
+	t.Run("ignores invalid invalidations", func(t *testing.T) {
+		redis, err := miniredis.Run()
+		require.NoError(t, err)
+		defer redis.Close()
+
+		client, err := NewRedis(redis.Host(), redis.Port(), "testPrefix")
+		require.NoError(t, err)
+		logger := observance.NewTestLogger()
+		c, err := NewNear(client, observance.NewTestMeasurer(), logger, NearConfig{Name: "main"})
+		require.NoError(t, err)
+		defer c.Close()
+
+		c.handleInvalidation("other feature")
+		logger.AssertLogged(t, "warn", "received invalid cache invalidation", observance.Fields{"cache": "main"})
+	})
+
+	t.Run("bypasses the local cache while the subscription is broken", func(t *testing.T) {
+		defer func(delay time.Duration) { resubscribeDelay = delay }(resubscribeDelay)
+		resubscribeDelay = 10 * time.Millisecond
+
+		redis, err := miniredis.Run()
+		require.NoError(t, err)
+		defer redis.Close()
+
+		metrics := observance.NewTestMeasurer()
+		logger := observance.NewTestLogger()
+		client, err := NewRedis(redis.Host(), redis.Port(), "testPrefix")
+		require.NoError(t, err)
+		c, err := NewNear(client, metrics, logger, NearConfig{Name: "main", HealthCheckInterval: 20 * time.Millisecond})
+		require.NoError(t, err)
+		defer c.Close()
+
+		require.NoError(t, c.Set(ctx, "feature", "on", 0))
+		_, err = c.Get(ctx, "feature")
+		require.NoError(t, err)
+
+		redis.Close()
+		assert.Eventually(t, func() bool {
+			value, _ := metrics.Gauge(MetricNearSubscriptionDown, observance.Labels{"cache": "main"})
+			return value == 1
+		}, time.Second, 5*time.Millisecond)
+		logger.AssertLogged(t, "warn", "cache invalidation subscription broken", observance.Fields{"cache": "main"})
+		_, err = c.Get(ctx, "feature")
+		assert.Error(t, err)
+		metrics.AssertCounter(t, MetricNearLocalRequests, observance.Labels{"cache": "main", "result": "bypass"}, 1)
+
+		require.NoError(t, redis.Restart())
+		redis.Set("testPrefix:feature", "off")
+		// The first command might fail because the connection in the pool is broken.
+		assert.Eventually(t, func() bool {
+			result, err := c.Get(ctx, "feature")
+			return err == nil && result == "off"
+		}, time.Second, 5*time.Millisecond)
+
+		assert.Eventually(t, func() bool {
+			value, _ := metrics.Gauge(MetricNearSubscriptionDown, observance.Labels{"cache": "main"})
+			return value == 0
+		}, time.Second, 5*time.Millisecond)
+		logger.AssertLogged(t, "info", "cache invalidation subscription restored", nil)
+	})
+}
+
+func newNearCache(t *testing.T, redis *miniredis.Miniredis, metrics observance.Measurer) *NearCache {
+	client, err := NewRedis(redis.Host(), redis.Port(), "testPrefix")
+	require.NoError(t, err)
+	c, err := NewNear(client, metrics, observance.NewTestLogger(), NearConfig{Name: "main", LocalTTL: 50 * time.Millisecond})
+	require.NoError(t, err)
+	return c
+}
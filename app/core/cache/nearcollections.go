@@ -0,0 +1,170 @@
+package cache
+
+import "context"
+
+// HSet calls HSet of the REDIS client and publishes an invalidation for the key.
+func (n *NearCache) HSet(ctx context.Context, key string, values map[string]string) error {
+	if err := n.remote.HSet(ctx, key, values); err != nil {
+		return err
+	}
+	n.publishInvalidation(ctx, key)
+	return nil
+}
+
+// HGet calls HGet of the REDIS client.
+func (n *NearCache) HGet(ctx context.Context, key string, field string) (string, error) {
+	return n.remote.HGet(ctx, key, field)
+}
+
+// HGetAll calls HGetAll of the REDIS client.
+func (n *NearCache) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	return n.remote.HGetAll(ctx, key)
+}
+
+// HDel calls HDel of the REDIS client and publishes an invalidation for the key.
+func (n *NearCache) HDel(ctx context.Context, key string, fields ...string) error {
+	if err := n.remote.HDel(ctx, key, fields...); err != nil {
+		return err
+	}
+	n.publishInvalidation(ctx, key)
+	return nil
+}
+
+// HIncrBy calls HIncrBy of the REDIS client and publishes an invalidation for the key.
+func (n *NearCache) HIncrBy(ctx context.Context, key string, field string, increment int64) (int64, error) {
+	result, err := n.remote.HIncrBy(ctx, key, field, increment)
+	if err != nil {
+		return result, err
+	}
+	n.publishInvalidation(ctx, key)
+	return result, nil
+}
+
+// LPush calls LPush of the REDIS client and publishes an invalidation for the key.
+func (n *NearCache) LPush(ctx context.Context, key string, values ...string) (int64, error) {
+	result, err := n.remote.LPush(ctx, key, values...)
+	if err != nil {
+		return result, err
+	}
+	n.publishInvalidation(ctx, key)
+	return result, nil
+}
+
+// RPush calls RPush of the REDIS client and publishes an invalidation for the key.
+func (n *NearCache) RPush(ctx context.Context, key string, values ...string) (int64, error) {
+	result, err := n.remote.RPush(ctx, key, values...)
+	if err != nil {
+		return result, err
+	}
+	n.publishInvalidation(ctx, key)
+	return result, nil
+}
+
+// LPop calls LPop of the REDIS client and publishes an invalidation for the key.
+func (n *NearCache) LPop(ctx context.Context, key string) (string, error) {
+	result, err := n.remote.LPop(ctx, key)
+	if err != nil {
+		return result, err
+	}
+	n.publishInvalidation(ctx, key)
+	return result, nil
+}
+
+// RPop calls RPop of the REDIS client and publishes an invalidation for the key.
+func (n *NearCache) RPop(ctx context.Context, key string) (string, error) {
+	result, err := n.remote.RPop(ctx, key)
+	if err != nil {
+		return result, err
+	}
+	n.publishInvalidation(ctx, key)
+	return result, nil
+}
+
+// LRange calls LRange of the REDIS client.
+func (n *NearCache) LRange(ctx context.Context, key string, start int64, stop int64) ([]string, error) {
+	return n.remote.LRange(ctx, key, start, stop)
+}
+
+// LTrim calls LTrim of the REDIS client and publishes an invalidation for the key.
+func (n *NearCache) LTrim(ctx context.Context, key string, start int64, stop int64) error {
+	if err := n.remote.LTrim(ctx, key, start, stop); err != nil {
+		return err
+	}
+	n.publishInvalidation(ctx, key)
+	return nil
+}
+
+// LLen calls LLen of the REDIS client.
+func (n *NearCache) LLen(ctx context.Context, key string) (int64, error) {
+	return n.remote.LLen(ctx, key)
+}
+
+// SAdd calls SAdd of the REDIS client and publishes an invalidation for the key.
+func (n *NearCache) SAdd(ctx context.Context, key string, members ...string) (int64, error) {
+	result, err := n.remote.SAdd(ctx, key, members...)
+	if err != nil {
+		return result, err
+	}
+	n.publishInvalidation(ctx, key)
+	return result, nil
+}
+
+// SRem calls SRem of the REDIS client and publishes an invalidation for the key.
+func (n *NearCache) SRem(ctx context.Context, key string, members ...string) (int64, error) {
+	result, err := n.remote.SRem(ctx, key, members...)
+	if err != nil {
+		return result, err
+	}
+	n.publishInvalidation(ctx, key)
+	return result, nil
+}
+
+// SMembers calls SMembers of the REDIS client.
+func (n *NearCache) SMembers(ctx context.Context, key string) ([]string, error) {
+	return n.remote.SMembers(ctx, key)
+}
+
+// SIsMember calls SIsMember of the REDIS client.
+func (n *NearCache) SIsMember(ctx context.Context, key string, member string) (bool, error) {
+	return n.remote.SIsMember(ctx, key, member)
+}
+
+// ZAdd calls ZAdd of the REDIS client and publishes an invalidation for the key.
+func (n *NearCache) ZAdd(ctx context.Context, key string, members ...ZMember) (int64, error) {
+	result, err := n.remote.ZAdd(ctx, key, members...)
+	if err != nil {
+		return result, err
+	}
+	n.publishInvalidation(ctx, key)
+	return result, nil
+}
+
+// ZRem calls ZRem of the REDIS client and publishes an invalidation for the key.
+func (n *NearCache) ZRem(ctx context.Context, key string, members ...string) (int64, error) {
+	result, err := n.remote.ZRem(ctx, key, members...)
+	if err != nil {
+		return result, err
+	}
+	n.publishInvalidation(ctx, key)
+	return result, nil
+}
+
+// ZRange calls ZRange of the REDIS client.
+func (n *NearCache) ZRange(ctx context.Context, key string, start int64, stop int64) ([]ZMember, error) {
+	return n.remote.ZRange(ctx, key, start, stop)
+}
+
+// ZRangeByScore calls ZRangeByScore of the REDIS client.
+func (n *NearCache) ZRangeByScore(ctx context.Context, key string, min float64, max float64) ([]ZMember, error) {
+	return n.remote.ZRangeByScore(ctx, key, min, max)
+}
+
+// ZRank calls ZRank of the REDIS client.
+func (n *NearCache) ZRank(ctx context.Context, key string, member string) (int64, error) {
+	return n.remote.ZRank(ctx, key, member)
+}
+
+// ZScore calls ZScore of the REDIS client.
+func (n *NearCache) ZScore(ctx context.Context, key string, member string) (float64, error) {
+	return n.remote.ZScore(ctx, key, member)
+}
@@ -0,0 +1,322 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/pkg/errors"
+)
+
+// pubSubHealthCheckInterval defines how often a subscription is checked with a ping if no messages arrive.
+var pubSubHealthCheckInterval = 5 * time.Second
+
+// PubSub broadcasts messages to all subscribers of a channel, e.g. to notify all instances of a service
+// about domain events. Messages are not persisted, subscribers only receive the messages that are published
+// while they are connected. Channels are prefixed like keys.
+type PubSub interface {
+	Publish(ctx context.Context, channel string, payload string) error
+	// PublishJSON publishes the value encoded as JSON, see Message.JSON.
+	PublishJSON(ctx context.Context, channel string, value interface{}) error
+	// Subscribe calls the handler for every message on the channels until the context is done or the
+	// subscription is closed. It returns once the subscription is active.
+	Subscribe(ctx context.Context, channels []string, handler MessageHandler) (Subscription, error)
+}
+
+// Message is a message that was received on a subscribed channel.
+type Message struct {
+	// Channel is the name of the channel without the prefix.
+	Channel string
+	Payload string
+}
+
+// JSON parses the JSON payload into the result.
+func (m Message) JSON(result interface{}) error {
+	return json.Unmarshal([]byte(m.Payload), result)
+}
+
+// MessageHandler handles the messages of a subscription. The messages are handled one by one in the order
+// they were received. The context is the context that was passed to Subscribe.
+type MessageHandler func(ctx context.Context, message Message)
+
+// Subscription is an active subscription to one or more channels.
+type Subscription interface {
+	// Close unsubscribes from the channels and waits until the running handler returned.
+	// It must not be called from within the handler.
+	Close() error
+}
+
+// Publish sends the payload to all subscribers of the channel.
+// Redis `PUBLISH channel payload` command.
+func (r *RedisClient) Publish(ctx context.Context, channel string, payload string) error {
+	return r.Client(ctx).Publish(r.prefixedKey(channel), payload).Err()
+}
+
+// PublishJSON sends the value encoded as JSON to all subscribers of the channel.
+func (r *RedisClient) PublishJSON(ctx context.Context, channel string, value interface{}) error {
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return r.Publish(ctx, channel, string(bytes))
+}
+
+// Subscribe subscribes to the channels and calls the handler for every message in a separate goroutine.
+// If the connection breaks, the REDIS client reconnects and subscribes again automatically. Messages that
+// are published in the meantime are lost. The subscription is closed when the context is done.
+func (r *RedisClient) Subscribe(ctx context.Context, channels []string, handler MessageHandler) (Subscription, error) {
+	if len(channels) == 0 {
+		return nil, errors.New("at least one channel is required")
+	}
+
+	names := make(map[string]string, len(channels))
+	prefixed := make([]string, 0, len(channels))
+	for _, channel := range channels {
+		names[r.prefixedKey(channel)] = channel
+		prefixed = append(prefixed, r.prefixedKey(channel))
+	}
+
+	pubsub := r.Redis.Subscribe(prefixed...)
+	for range prefixed {
+		if _, err := pubsub.Receive(); err != nil {
+			pubsub.Close()
+			return nil, errors.Wrap(err, "could not subscribe to channels")
+		}
+	}
+
+	s := &redisSubscription{
+		pubsub:   pubsub,
+		channels: names,
+		handler:  handler,
+		closing:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go s.listen(ctx)
+	go s.closeWhenDone(ctx)
+	return s, nil
+}
+
+type redisSubscription struct {
+	pubsub *redis.PubSub
+	// channels maps the prefixed names to the names that were passed to Subscribe.
+	channels map[string]string
+	handler  MessageHandler
+	closed   int32
+	closing  chan struct{}
+	done     chan struct{}
+}
+
+// Close unsubscribes from the channels and waits until the running handler returned.
+func (s *redisSubscription) Close() error {
+	if !atomic.CompareAndSwapInt32(&s.closed, 0, 1) {
+		<-s.done
+		return nil
+	}
+
+	close(s.closing)
+	err := s.pubsub.Close()
+	<-s.done
+	return err
+}
+
+func (s *redisSubscription) closeWhenDone(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+		_ = s.Close()
+	case <-s.closing:
+	}
+}
+
+// listen passes the messages to the handler. Broken connections are detected with a ping if no messages
+// arrive and re-established by the REDIS client with the next receive.
+func (s *redisSubscription) listen(ctx context.Context) {
+	defer close(s.done)
+	for {
+		msg, err := s.pubsub.ReceiveTimeout(pubSubHealthCheckInterval)
+		if atomic.LoadInt32(&s.closed) == 1 {
+			return
+		}
+
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				_ = s.pubsub.Ping()
+				continue
+			}
+			select {
+			case <-s.closing:
+				return
+			case <-time.After(resubscribeDelay):
+			}
+			continue
+		}
+
+		if msg, ok := msg.(*redis.Message); ok {
+			s.handler(ctx, Message{Channel: s.channels[msg.Channel], Payload: msg.Payload})
+		}
+	}
+}
+
+// Publish sends the payload to all subscribers of the channel.
+func (m *MemoryCache) Publish(ctx context.Context, channel string, payload string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+
+	for subscription := range m.subscriptions[m.prefixedKey(channel)] {
+		subscription.push(Message{Channel: channel, Payload: payload})
+	}
+	return nil
+}
+
+// PublishJSON sends the value encoded as JSON to all subscribers of the channel.
+func (m *MemoryCache) PublishJSON(ctx context.Context, channel string, value interface{}) error {
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return m.Publish(ctx, channel, string(bytes))
+}
+
+// Subscribe subscribes to the channels and calls the handler for every message in a separate goroutine.
+// The subscription is closed when the context is done or the cache is closed.
+func (m *MemoryCache) Subscribe(ctx context.Context, channels []string, handler MessageHandler) (Subscription, error) {
+	if len(channels) == 0 {
+		return nil, errors.New("at least one channel is required")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.closed {
+		return nil, ErrClosed
+	}
+
+	s := &memorySubscription{
+		cache:    m,
+		channels: make([]string, 0, len(channels)),
+		handler:  handler,
+		notify:   make(chan struct{}, 1),
+		closing:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if m.subscriptions == nil {
+		m.subscriptions = map[string]map[*memorySubscription]bool{}
+	}
+	for _, channel := range channels {
+		channel = m.prefixedKey(channel)
+		if m.subscriptions[channel] == nil {
+			m.subscriptions[channel] = map[*memorySubscription]bool{}
+		}
+		m.subscriptions[channel][s] = true
+		s.channels = append(s.channels, channel)
+	}
+
+	go s.listen(ctx)
+	go s.closeWhenDone(ctx)
+	return s, nil
+}
+
+// closeSubscriptions closes all subscriptions, the mutex must not be held by the caller
+// because the handlers might still use the cache.
+func (m *MemoryCache) closeSubscriptions() {
+	m.mutex.Lock()
+	subscriptions := map[*memorySubscription]bool{}
+	for _, channel := range m.subscriptions {
+		for subscription := range channel {
+			subscriptions[subscription] = true
+		}
+	}
+	m.mutex.Unlock()
+
+	for subscription := range subscriptions {
+		_ = subscription.Close()
+	}
+}
+
+type memorySubscription struct {
+	cache    *MemoryCache
+	channels []string
+	handler  MessageHandler
+
+	queue     []Message
+	mutex     sync.Mutex
+	notify    chan struct{}
+	closeOnce sync.Once
+	closing   chan struct{}
+	done      chan struct{}
+}
+
+// Close unsubscribes from the channels and waits until the running handler returned.
+// Messages that were not handled yet are dropped.
+func (s *memorySubscription) Close() error {
+	s.closeOnce.Do(func() {
+		s.cache.mutex.Lock()
+		for _, channel := range s.channels {
+			delete(s.cache.subscriptions[channel], s)
+			if len(s.cache.subscriptions[channel]) == 0 {
+				delete(s.cache.subscriptions, channel)
+			}
+		}
+		s.cache.mutex.Unlock()
+		close(s.closing)
+	})
+	<-s.done
+	return nil
+}
+
+// push queues the message without blocking the publisher.
+func (s *memorySubscription) push(message Message) {
+	s.mutex.Lock()
+	s.queue = append(s.queue, message)
+	s.mutex.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *memorySubscription) closeWhenDone(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+		_ = s.Close()
+	case <-s.closing:
+	}
+}
+
+func (s *memorySubscription) listen(ctx context.Context) {
+	defer close(s.done)
+	for {
+		select {
+		case <-s.closing:
+			return
+		case <-s.notify:
+		}
+
+		s.mutex.Lock()
+		queue := s.queue
+		s.queue = nil
+		s.mutex.Unlock()
+
+		for _, message := range queue {
+			select {
+			case <-s.closing:
+				return
+			default:
+			}
+			s.handler(ctx, message)
+		}
+	}
+}
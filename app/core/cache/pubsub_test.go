@@ -0,0 +1,162 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withPubSub runs the test with REDIS and the in-memory cache.
+func withPubSub(t *testing.T, fn func(t *testing.T, pubsub PubSub)) {
+	t.Run("redis", func(t *testing.T) {
+		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
+			fn(t, client)
+		})
+	})
+
+	t.Run("memory", func(t *testing.T) {
+		fn(t, NewMemory(MemoryConfig{Prefix: "testPrefix"}))
+	})
+}
+
+// collect returns a handler that sends the messages to the returned channel.
+func collect() (MessageHandler, chan Message) {
+	messages := make(chan Message, 100)
+	return func(ctx context.Context, message Message) {
+		messages <- message
+	}, messages
+}
+
+func receive(t *testing.T, messages chan Message) Message {
+	t.Helper()
+	select {
+	case message := <-messages:
+		return message
+	case <-time.After(time.Second):
+		t.Fatal("no message received")
+		return Message{}
+	}
+}
+
+func TestPubSub(t *testing.T) {
+	ctx := context.Background()
+
+	withPubSub(t, func(t *testing.T, pubsub PubSub) {
+		handler, messages := collect()
+		subscription, err := pubsub.Subscribe(ctx, []string{"users", "orders"}, handler)
+		require.NoError(t, err)
+		defer subscription.Close()
+
+		require.NoError(t, pubsub.Publish(ctx, "users", "created"))
+		require.NoError(t, pubsub.Publish(ctx, "other", "ignored"))
+		require.NoError(t, pubsub.Publish(ctx, "users", "deleted"))
+		require.NoError(t, pubsub.PublishJSON(ctx, "orders", testUser{Name: "Jane"}))
+
+		assert.Equal(t, Message{Channel: "users", Payload: "created"}, receive(t, messages))
+		assert.Equal(t, Message{Channel: "users", Payload: "deleted"}, receive(t, messages))
+		message := receive(t, messages)
+		assert.Equal(t, "orders", message.Channel)
+		var user testUser
+		require.NoError(t, message.JSON(&user))
+		assert.Equal(t, "Jane", user.Name)
+
+		require.NoError(t, subscription.Close())
+		require.NoError(t, subscription.Close())
+		require.NoError(t, pubsub.Publish(ctx, "users", "after close"))
+		select {
+		case message := <-messages:
+			t.Fatalf("unexpected message %v", message)
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		_, err = pubsub.Subscribe(ctx, nil, handler)
+		assert.EqualError(t, err, "at least one channel is required")
+	})
+}
+
+func TestPubSubShutdown(t *testing.T) {
+	withPubSub(t, func(t *testing.T, pubsub PubSub) {
+		ctx, cancel := context.WithCancel(context.Background())
+		started := make(chan struct{})
+		finished := make(chan struct{})
+		subscription, err := pubsub.Subscribe(ctx, []string{"events"}, func(ctx context.Context, message Message) {
+			close(started)
+			<-ctx.Done()
+			time.Sleep(20 * time.Millisecond)
+			close(finished)
+		})
+		require.NoError(t, err)
+
+		require.NoError(t, pubsub.Publish(context.Background(), "events", "shutdown"))
+		<-started
+		cancel()
+		require.NoError(t, subscription.Close())
+		select {
+		case <-finished:
+		default:
+			t.Fatal("Close returned before the handler finished")
+		}
+	})
+}
+
+func TestRedisPubSub(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("channels are prefixed", func(t *testing.T) {
+		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
+			handler, messages := collect()
+			subscription, err := client.Subscribe(ctx, []string{"events"}, handler)
+			require.NoError(t, err)
+			defer subscription.Close()
+
+			assert.Equal(t, []string{"testPrefix:events"}, redis.PubSubChannels(""))
+			redis.Publish("testPrefix:events", "raw")
+			assert.Equal(t, Message{Channel: "events", Payload: "raw"}, receive(t, messages))
+		})
+	})
+
+	t.Run("resubscribes after the connection broke", func(t *testing.T) {
+		defer func(delay time.Duration) { resubscribeDelay = delay }(resubscribeDelay)
+		defer func(interval time.Duration) { pubSubHealthCheckInterval = interval }(pubSubHealthCheckInterval)
+		resubscribeDelay = 10 * time.Millisecond
+		pubSubHealthCheckInterval = 20 * time.Millisecond
+
+		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
+			handler, messages := collect()
+			subscription, err := client.Subscribe(ctx, []string{"events"}, handler)
+			require.NoError(t, err)
+			defer subscription.Close()
+
+			redis.Close()
+			time.Sleep(50 * time.Millisecond)
+			require.NoError(t, redis.Restart())
+
+			assert.Eventually(t, func() bool {
+				return len(redis.PubSubChannels("")) == 1
+			}, time.Second, 5*time.Millisecond)
+			// The first command might fail because the connection in the pool is broken.
+			assert.Eventually(t, func() bool {
+				return client.Publish(ctx, "events", "reconnected") == nil
+			}, time.Second, 5*time.Millisecond)
+			assert.Equal(t, Message{Channel: "events", Payload: "reconnected"}, receive(t, messages))
+		})
+	})
+}
+
+func TestMemoryPubSubClose(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemory(MemoryConfig{})
+	handler, _ := collect()
+	_, err := c.Subscribe(ctx, []string{"events"}, handler)
+	require.NoError(t, err)
+
+	require.NoError(t, c.Close())
+	assert.Empty(t, c.subscriptions)
+	assert.Equal(t, ErrClosed, c.Publish(ctx, "events", "closed"))
+	_, err = c.Subscribe(ctx, []string{"events"}, handler)
+	assert.Equal(t, ErrClosed, err)
+}
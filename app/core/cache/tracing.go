@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-redis/redis/v7"
+	"toolkit/app/core/observance"
+)
+
+// tracingSpanKey is the context key under which the hook stores the span of the current command.
+type tracingSpanKey struct{}
+
+// tracingHook is a go-redis hook that creates a span for every command or pipeline
+// that is executed with a context containing a span, i.e. via the methods of RedisClient or RedisClient.Client.
+type tracingHook struct{}
+
+func (tracingHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	_, span := observance.StartChildSpan(ctx, "redis."+cmd.Name(), observance.SpanKindClient)
+	if span == nil {
+		return ctx, nil
+	}
+	span.SetAttribute("db.system", "redis")
+	span.SetAttribute("db.operation", cmd.Name())
+	if key := commandKey(cmd); key != "" {
+		span.SetAttribute("db.redis.key", key)
+	}
+	return context.WithValue(ctx, tracingSpanKey{}, span), nil
+}
+
+func (tracingHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	span, _ := ctx.Value(tracingSpanKey{}).(*observance.Span)
+	if err := cmd.Err(); err != nil && err != redis.Nil {
+		span.RecordError(err)
+	}
+	span.End()
+	return nil
+}
+
+func (tracingHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	_, span := observance.StartChildSpan(ctx, "redis.pipeline", observance.SpanKindClient)
+	if span == nil {
+		return ctx, nil
+	}
+	span.SetAttribute("db.system", "redis")
+	span.SetAttribute("db.operation", "pipeline")
+	span.SetAttribute("db.redis.commands", len(cmds))
+	return context.WithValue(ctx, tracingSpanKey{}, span), nil
+}
+
+func (tracingHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	span, _ := ctx.Value(tracingSpanKey{}).(*observance.Span)
+	for _, cmd := range cmds {
+		if err := cmd.Err(); err != nil && err != redis.Nil {
+			span.RecordError(err)
+			break
+		}
+	}
+	span.End()
+	return nil
+}
+
+// commandKey returns the first argument after the command name which is the key for most commands.
+// The values of the command are never returned as they might contain sensitive data.
+func commandKey(cmd redis.Cmder) string {
+	args := cmd.Args()
+	if len(args) < 2 {
+		return ""
+	}
+	return fmt.Sprint(args[1])
+}
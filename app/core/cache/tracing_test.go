@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"toolkit/app/core/observance"
+)
+
+func TestTracing(t *testing.T) {
+	t.Run("commands create child spans", func(t *testing.T) {
+		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
+			exporter := &exporterStub{}
+			tracer := observance.NewTracer("test-app", exporter, observance.NewTestLogger())
+			ctx, parent := tracer.Start(context.Background(), "parent", observance.SpanKindServer)
+
+			require.NoError(t, client.Set(ctx, "someKey", "secretValue", 0))
+			_, err := client.Get(ctx, "missingKey")
+			assert.Equal(t, ErrNotFound, err)
+			redis.SetError("server down")
+			_, err = client.Get(ctx, "someKey")
+			assert.Error(t, err)
+			parent.End()
+			require.NoError(t, tracer.Close(context.Background()))
+
+			spans := exporter.spans
+			require.Len(t, spans, 4)
+			assert.Equal(t, "redis.set", spans[0].Name)
+			assert.Equal(t, observance.SpanKindClient, spans[0].Kind)
+			assert.Equal(t, parent.SpanContext().SpanID.String(), spans[0].ParentSpanID)
+			assert.Equal(t, "redis", spans[0].Attributes["db.system"])
+			assert.Equal(t, "testPrefix:someKey", spans[0].Attributes["db.redis.key"])
+			assert.NotContains(t, spans[0].Attributes, "secretValue")
+			assert.Equal(t, "redis.get", spans[1].Name)
+			assert.Equal(t, observance.StatusUnset, spans[1].StatusCode)
+			assert.Equal(t, observance.StatusError, spans[2].StatusCode)
+			assert.Equal(t, "parent", spans[3].Name)
+		})
+	})
+
+	t.Run("pipeline", func(t *testing.T) {
+		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
+			exporter := &exporterStub{}
+			tracer := observance.NewTracer("test-app", exporter, observance.NewTestLogger())
+			ctx, parent := tracer.Start(context.Background(), "parent", observance.SpanKindServer)
+
+			pipe := client.Client(ctx).Pipeline()
+			pipe.Set("a", "1", 0)
+			pipe.Set("b", "2", 0)
+			_, err := pipe.Exec()
+			require.NoError(t, err)
+			parent.End()
+			require.NoError(t, tracer.Close(context.Background()))
+
+			require.Len(t, exporter.spans, 2)
+			assert.Equal(t, "redis.pipeline", exporter.spans[0].Name)
+			assert.Equal(t, 2, exporter.spans[0].Attributes["db.redis.commands"])
+		})
+	})
+
+	t.Run("no spans without parent", func(t *testing.T) {
+		withRedis(t, func(redis *miniredis.Miniredis, client *RedisClient) {
+			require.NoError(t, client.Set(context.Background(), "someKey", "someValue", 0))
+			redis.CheckGet(t, "testPrefix:someKey", "someValue")
+		})
+	})
+}
+
+type exporterStub struct {
+	spans []observance.SpanData
+}
+
+func (e *exporterStub) ExportSpans(ctx context.Context, spans []observance.SpanData) error {
+	e.spans = append(e.spans, spans...)
+	return nil
+}
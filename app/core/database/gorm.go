@@ -32,6 +32,7 @@ func (g GormLogrus) Print(v ...interface{}) {
 // SetupGORM loads the ORM with the given configuration
 // The setup includes sending a ping and creating the database if it didn't exist.
 // A logger will be activated if logLevel is 'debug'.
+// Callbacks are registered that create spans for all statements executed with a context (see WithContext).
 func SetupGORM(config Config, logger observance.Logger) (*gorm.DB, error) {
 	if db != nil {
 		return db, nil
@@ -67,6 +68,8 @@ func SetupGORM(config Config, logger observance.Logger) (*gorm.DB, error) {
 		}
 	}
 
+	RegisterTracingCallbacks(db)
+
 	if logger.Level() == "debug" || logger.Level() == "trace" {
 		db.LogMode(true)
 		gormLogger := GormLogrus{logger}
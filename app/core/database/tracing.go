@@ -0,0 +1,95 @@
+package database
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/jinzhu/gorm"
+	"toolkit/app/core/observance"
+)
+
+const (
+	// contextKey is the key under which the context for tracing is stored in the GORM settings.
+	contextKey = "observance:context"
+	// spanKey is the key under which the span of the current statement is stored in the GORM scope.
+	spanKey = "observance:span"
+)
+
+// WithContext returns a GORM handle that creates a span for each statement as child of the span in the context.
+// If the context does not contain a span, no spans are created.
+//
+//	db := database.WithContext(db, ctx)
+//	db.Find(&users)
+func WithContext(db *gorm.DB, ctx context.Context) *gorm.DB {
+	return db.Set(contextKey, ctx)
+}
+
+// RegisterTracingCallbacks adds the GORM callbacks that create a span for each create, query, update,
+// delete and raw query statement. The span contains the sanitized SQL, the table and the number of affected rows.
+func RegisterTracingCallbacks(db *gorm.DB) {
+	callback := db.Callback()
+	callback.Create().Before("gorm:create").Register("observance:before_create", startSpan("create"))
+	callback.Create().After("gorm:create").Register("observance:after_create", endSpan)
+	callback.Query().Before("gorm:query").Register("observance:before_query", startSpan("query"))
+	callback.Query().After("gorm:query").Register("observance:after_query", endSpan)
+	callback.Update().Before("gorm:update").Register("observance:before_update", startSpan("update"))
+	callback.Update().After("gorm:update").Register("observance:after_update", endSpan)
+	callback.Delete().Before("gorm:delete").Register("observance:before_delete", startSpan("delete"))
+	callback.Delete().After("gorm:delete").Register("observance:after_delete", endSpan)
+	callback.RowQuery().Before("gorm:row_query").Register("observance:before_row_query", startSpan("row_query"))
+	callback.RowQuery().After("gorm:row_query").Register("observance:after_row_query", endSpan)
+}
+
+func startSpan(operation string) func(scope *gorm.Scope) {
+	return func(scope *gorm.Scope) {
+		value, ok := scope.Get(contextKey)
+		if !ok {
+			return
+		}
+		ctx, ok := value.(context.Context)
+		if !ok {
+			return
+		}
+
+		_, span := observance.StartChildSpan(ctx, "gorm."+operation, observance.SpanKindClient)
+		if span == nil {
+			return
+		}
+		span.SetAttribute("db.system", scope.Dialect().GetName())
+		span.SetAttribute("db.operation", operation)
+		scope.InstanceSet(spanKey, span)
+	}
+}
+
+func endSpan(scope *gorm.Scope) {
+	value, ok := scope.InstanceGet(spanKey)
+	if !ok {
+		return
+	}
+	span, ok := value.(*observance.Span)
+	if !ok {
+		return
+	}
+
+	span.SetAttribute("db.statement", sanitizeSQL(scope.SQL))
+	span.SetAttribute("db.sql.table", scope.TableName())
+	span.SetAttribute("db.rows_affected", scope.DB().RowsAffected)
+	if scope.HasError() && !gorm.IsRecordNotFoundError(scope.DB().Error) {
+		span.RecordError(scope.DB().Error)
+	}
+	span.End()
+}
+
+var (
+	// stringLiterals matches single quoted strings.
+	stringLiterals = regexp.MustCompile(`'(?:[^']|'')*'`)
+	// numberLiterals matches numbers that are not part of an identifier or a placeholder like "$1".
+	numberLiterals = regexp.MustCompile(`(^|[^\w$])\d+(?:\.\d+)?\b`)
+)
+
+// sanitizeSQL replaces literals in the statement with "?" so no user data ends up in the spans.
+// Values passed as arguments are not part of the SQL and do not need to be replaced.
+func sanitizeSQL(sql string) string {
+	sql = stringLiterals.ReplaceAllString(sql, "?")
+	return numberLiterals.ReplaceAllString(sql, "${1}?")
+}
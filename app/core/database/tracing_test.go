@@ -0,0 +1,88 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"toolkit/app/core/observance"
+)
+
+type user struct {
+	ID   int
+	Name string
+}
+
+func TestTracingCallbacks(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	db, err := gorm.Open("mysql", sqlDB)
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetLogger(GormLogrus{observance.NewTestLogger()})
+	RegisterTracingCallbacks(db)
+
+	exporter := &exporterStub{}
+	tracer := observance.NewTracer("test-app", exporter, observance.NewTestLogger())
+	ctx, parent := tracer.Start(context.Background(), "parent", observance.SpanKindServer)
+
+	mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "Jane"))
+	mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE").WillReturnError(errors.New("connection lost"))
+	mock.ExpectRollback()
+
+	users := []user{}
+	require.NoError(t, WithContext(db, ctx).Where("name = 'Jane' AND id > 5").Find(&users).Error)
+	assert.True(t, WithContext(db, ctx).First(&user{}).RecordNotFound())
+	assert.Error(t, WithContext(db, ctx).Delete(&user{ID: 1}).Error)
+	// Statements without context do not create spans.
+	mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+	require.NoError(t, db.Find(&users).Error)
+
+	parent.End()
+	require.NoError(t, tracer.Close(context.Background()))
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	spans := exporter.spans
+	require.Len(t, spans, 4)
+	assert.Equal(t, "gorm.query", spans[0].Name)
+	assert.Equal(t, observance.SpanKindClient, spans[0].Kind)
+	assert.Equal(t, parent.SpanContext().SpanID.String(), spans[0].ParentSpanID)
+	assert.Equal(t, "mysql", spans[0].Attributes["db.system"])
+	assert.Equal(t, "users", spans[0].Attributes["db.sql.table"])
+	assert.Equal(t, "SELECT * FROM `users`  WHERE (name = ? AND id > ?)", spans[0].Attributes["db.statement"])
+	assert.Equal(t, int64(1), spans[0].Attributes["db.rows_affected"])
+	assert.Equal(t, observance.StatusUnset, spans[1].StatusCode)
+	assert.Equal(t, "gorm.delete", spans[2].Name)
+	assert.Equal(t, observance.StatusError, spans[2].StatusCode)
+	assert.Equal(t, "connection lost", spans[2].StatusMessage)
+	assert.Equal(t, "parent", spans[3].Name)
+}
+
+func TestSanitizeSQL(t *testing.T) {
+	tests := map[string]string{
+		"SELECT * FROM users WHERE id = 1":                     "SELECT * FROM users WHERE id = ?",
+		"SELECT * FROM users WHERE name = 'O''Brien'":          "SELECT * FROM users WHERE name = ?",
+		"SELECT * FROM table1 WHERE id = $1 AND price > 10.5":  "SELECT * FROM table1 WHERE id = $1 AND price > ?",
+		`INSERT INTO "users" ("name") VALUES ($1)`:             `INSERT INTO "users" ("name") VALUES ($1)`,
+		"UPDATE `users` SET `age` = 30 WHERE `users`.`id` = 7": "UPDATE `users` SET `age` = ? WHERE `users`.`id` = ?",
+	}
+	for sql, expected := range tests {
+		assert.Equal(t, expected, sanitizeSQL(sql))
+	}
+}
+
+type exporterStub struct {
+	spans []observance.SpanData
+}
+
+func (e *exporterStub) ExportSpans(ctx context.Context, spans []observance.SpanData) error {
+	e.spans = append(e.spans, spans...)
+	return nil
+}
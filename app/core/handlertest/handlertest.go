@@ -16,8 +16,6 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
-	"toolkit/app/core/toolkit"
-	"toolkit/app/core/observance"
 )
 
 // Suite holds the general properties to run handler tests.
@@ -69,9 +67,7 @@ func (s *Suite) CallHandler(t *testing.T, handlerFunc echo.HandlerFunc, params *
 	addHeaders(req, params.Headers)
 	rec := httptest.NewRecorder()
 
-	obs := &observance.Obs{Logger: observance.NewTestLogger()}
-	e, _ := toolkit.MustNewServer(obs, "")
-	ctx := e.NewContext(req, rec)
+	ctx := echo.New().NewContext(req, rec)
 
 	addPathParams(ctx, params.PathParams)
 
@@ -10,6 +10,7 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"toolkit/app/core/observance"
 )
 
 type TestMock struct {
@@ -294,3 +295,18 @@ func TestCallHandler_SleepBeforeAssert(t *testing.T) {
 	assert.False(t, tNew.Failed())
 	assert.Greater(t, int64(time.Since(now)), int64(p.SleepBeforeAssert))
 }
+
+func TestCallHandler_Instrumentation(t *testing.T) {
+	s := Suite{}
+	metrics := observance.NewTestMeasurer()
+	obs := &observance.Obs{Logger: observance.NewTestLogger(), Metrics: metrics}
+
+	handler := func(c echo.Context) error {
+		obs.Metrics.IncrementWithLabels("requests_total", observance.Labels{"route": "/"})
+		return nil
+	}
+
+	_, err := s.CallHandler(t, handler, nil, nil)
+	assert.NoError(t, err)
+	metrics.AssertCounter(t, "requests_total", observance.Labels{"route": "/"}, 1)
+}
@@ -0,0 +1,105 @@
+package httpclient
+
+import (
+	"sync"
+	"time"
+)
+
+type breakerState int
+
+const (
+	stateClosed breakerState = iota
+	stateOpen
+	stateHalfOpen
+)
+
+// breakers keeps one circuit breaker state per host.
+// A circuit opens after `threshold` consecutive failures. Once `openTimeout` passed,
+// a single trial request is let through. Its result closes the circuit again or keeps it open.
+type breakers struct {
+	threshold   int
+	openTimeout time.Duration
+	hosts       map[string]*breaker
+	mutex       sync.Mutex
+	now         func() time.Time
+}
+
+type breaker struct {
+	state    breakerState
+	failures int
+	openedAt time.Time
+}
+
+func newBreakers(threshold int, openTimeout time.Duration) *breakers {
+	return &breakers{
+		threshold:   threshold,
+		openTimeout: openTimeout,
+		hosts:       map[string]*breaker{},
+		now:         time.Now,
+	}
+}
+
+// allow checks whether a request to the host may be sent.
+func (b *breakers) allow(host string) bool {
+	if b.threshold <= 0 {
+		return true
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	hostBreaker, ok := b.hosts[host]
+	if !ok {
+		return true
+	}
+
+	switch hostBreaker.state {
+	case stateOpen:
+		if b.now().Sub(hostBreaker.openedAt) < b.openTimeout {
+			return false
+		}
+		hostBreaker.state = stateHalfOpen
+		return true
+	case stateHalfOpen:
+		// The trial request is still running.
+		return false
+	default:
+		return true
+	}
+}
+
+// record updates the state of the host with the result of a request.
+func (b *breakers) record(host string, success bool) {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	hostBreaker, ok := b.hosts[host]
+	if !ok {
+		hostBreaker = &breaker{}
+		b.hosts[host] = hostBreaker
+	}
+
+	if success {
+		hostBreaker.state = stateClosed
+		hostBreaker.failures = 0
+		return
+	}
+
+	hostBreaker.failures++
+	if hostBreaker.state == stateHalfOpen || hostBreaker.failures >= b.threshold {
+		hostBreaker.state = stateOpen
+		hostBreaker.openedAt = b.now()
+	}
+}
+
+// abort is called if a request was canceled by the caller. If it was the trial request,
+// the next request becomes the trial request.
+func (b *breakers) abort(host string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if hostBreaker, ok := b.hosts[host]; ok && hostBreaker.state == stateHalfOpen {
+		hostBreaker.state = stateOpen
+	}
+}
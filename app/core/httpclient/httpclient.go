@@ -0,0 +1,301 @@
+package httpclient
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"toolkit/app/core/observance"
+)
+
+// Names of the metrics that are recorded for every attempt of an outgoing request.
+// Both have the labels "client", "host", "method" and "status".
+const (
+	MetricRequests        = "http_client_requests_total"
+	MetricRequestDuration = "http_client_request_duration_seconds"
+)
+
+// Default values that are used if the corresponding config value is not set.
+const (
+	DefaultTimeout            = 10 * time.Second
+	DefaultRetryBaseDelay     = 100 * time.Millisecond
+	DefaultRetryMaxDelay      = 5 * time.Second
+	DefaultBreakerOpenTimeout = 30 * time.Second
+	DefaultRequestIDHeader    = "X-Request-ID"
+)
+
+// ErrCircuitOpen is returned when a request is not sent because too many requests to the host failed before.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// Config contains the settings for the outgoing requests of a client.
+type Config struct {
+	// Name identifies the client in logs and metrics, e.g. the name of the called service.
+	Name string
+	// Timeout is the maximum duration of one attempt including reading the response body.
+	Timeout time.Duration
+	// HostTimeouts overrides the timeout for specific hosts. The key is the host as used in the URL, e.g. "api:8080".
+	HostTimeouts map[string]time.Duration
+	// MaxRetries is the number of retries for idempotent requests that failed because of a network error
+	// or with the status 429, 502, 503 or 504. Retries are disabled if it is 0.
+	MaxRetries int
+	// RetryBaseDelay is the delay before the first retry, it doubles with every further retry (with jitter).
+	RetryBaseDelay time.Duration
+	// RetryMaxDelay is the upper limit for the delay between two attempts.
+	RetryMaxDelay time.Duration
+	// BreakerThreshold is the number of consecutive failures after which no requests are sent to a host
+	// for the duration of BreakerOpenTimeout. The circuit breaker is disabled if it is 0.
+	BreakerThreshold int
+	// BreakerOpenTimeout is the duration after which a single trial request is sent to a host with an open circuit.
+	BreakerOpenTimeout time.Duration
+	// RequestIDHeader is the header used for passing on the request ID found in the request context.
+	RequestIDHeader string
+	// Transport sends the requests, http.DefaultTransport is used if it is nil.
+	Transport http.RoundTripper
+}
+
+// New creates an http.Client for calling other services. See Transport for the features.
+func New(obs *observance.Obs, config Config) *http.Client {
+	return &http.Client{Transport: NewTransport(obs, config)}
+}
+
+// Transport is an http.RoundTripper that instruments and protects outgoing requests:
+//   - the request ID and the trace context of the request context are sent along
+//   - every attempt is logged and measured, a client span is created if the request context contains a span
+//   - every attempt has a timeout that can be configured per host
+//   - idempotent requests are retried with jittered exponential backoff
+//   - a circuit breaker per host stops sending requests after consecutive failures
+type Transport struct {
+	obs      *observance.Obs
+	config   Config
+	next     http.RoundTripper
+	breakers *breakers
+}
+
+// NewTransport creates a new Transport, missing config values are set to their defaults.
+func NewTransport(obs *observance.Obs, config Config) *Transport {
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultTimeout
+	}
+	if config.RetryBaseDelay <= 0 {
+		config.RetryBaseDelay = DefaultRetryBaseDelay
+	}
+	if config.RetryMaxDelay <= 0 {
+		config.RetryMaxDelay = DefaultRetryMaxDelay
+	}
+	if config.BreakerOpenTimeout <= 0 {
+		config.BreakerOpenTimeout = DefaultBreakerOpenTimeout
+	}
+	if config.RequestIDHeader == "" {
+		config.RequestIDHeader = DefaultRequestIDHeader
+	}
+
+	next := config.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	return &Transport{
+		obs:      obs,
+		config:   config,
+		next:     next,
+		breakers: newBreakers(config.BreakerThreshold, config.BreakerOpenTimeout),
+	}
+}
+
+// RoundTrip sends the request, retrying it if possible.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := observance.StartChildSpan(req.Context(), "HTTP "+req.Method, observance.SpanKindClient)
+	defer span.End()
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.url", req.URL.Scheme+"://"+req.URL.Host+req.URL.Path)
+	span.SetAttribute("net.peer.name", req.URL.Host)
+
+	maxAttempts := 1
+	if isRetryable(req) {
+		maxAttempts += t.config.MaxRetries
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := t.send(ctx, req, attempt)
+		if attempt >= maxAttempts || !shouldRetry(resp, err) || ctx.Err() != nil {
+			if err != nil {
+				span.RecordError(err)
+				return nil, err
+			}
+			span.SetAttribute("http.status_code", resp.StatusCode)
+			if resp.StatusCode >= http.StatusInternalServerError {
+				span.SetStatus(observance.StatusError, "request failed with status "+strconv.Itoa(resp.StatusCode))
+			}
+			return resp, nil
+		}
+
+		if resp != nil {
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		delay := t.backoff(attempt)
+		t.logger(ctx).WithFields(observance.Fields{
+			"attempt": attempt,
+			"delay":   delay.String(),
+		}).Info("retrying outgoing request")
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			span.RecordError(ctx.Err())
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// send makes a single attempt of the request.
+func (t *Transport) send(ctx context.Context, req *http.Request, attempt int) (*http.Response, error) {
+	host := req.URL.Host
+	labels := observance.Labels{"client": t.config.Name, "host": host, "method": req.Method}
+	logger := t.logger(ctx).WithFields(observance.Fields{
+		"client":  t.config.Name,
+		"method":  req.Method,
+		"url":     req.URL.Scheme + "://" + host + req.URL.Path,
+		"attempt": attempt,
+	})
+
+	if !t.breakers.allow(host) {
+		labels["status"] = "circuit_open"
+		t.increment(labels)
+		logger.Warn("outgoing request not sent, circuit breaker is open")
+		return nil, ErrCircuitOpen
+	}
+
+	attemptCtx, cancel := context.WithTimeout(ctx, t.timeout(req))
+	out := req.Clone(attemptCtx)
+	if attempt > 1 && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			cancel()
+			return nil, errors.Wrap(err, "could not rewind request body for retry")
+		}
+		out.Body = body
+	}
+	t.setHeaders(ctx, out)
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(out)
+	if err != nil {
+		cancel()
+		// Requests canceled by the caller are not a sign of an unhealthy host.
+		if ctx.Err() == nil {
+			t.breakers.record(host, false)
+		} else {
+			t.breakers.abort(host)
+		}
+		labels["status"] = "error"
+		t.measure(labels, start)
+		logger.WithError(err).Warn("outgoing request failed")
+		return nil, err
+	}
+
+	t.breakers.record(host, resp.StatusCode < http.StatusInternalServerError)
+	labels["status"] = strconv.Itoa(resp.StatusCode)
+	t.measure(labels, start)
+	logger.WithFields(observance.Fields{
+		"status":   resp.StatusCode,
+		"duration": time.Since(start).String(),
+	}).Debug("outgoing request finished")
+
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// setHeaders adds the request ID and the trace context unless the headers were set by the caller.
+func (t *Transport) setHeaders(ctx context.Context, req *http.Request) {
+	if requestID := observance.RequestIDFromContext(ctx); requestID != "" && req.Header.Get(t.config.RequestIDHeader) == "" {
+		req.Header.Set(t.config.RequestIDHeader, requestID)
+	}
+
+	spanContext := observance.SpanContextFromContext(ctx)
+	if spanContext.IsValid() && req.Header.Get(observance.TraceParentHeader) == "" {
+		req.Header.Set(observance.TraceParentHeader, spanContext.TraceParent())
+		if spanContext.TraceState != "" {
+			req.Header.Set(observance.TraceStateHeader, spanContext.TraceState)
+		}
+	}
+}
+
+func (t *Transport) timeout(req *http.Request) time.Duration {
+	if timeout, ok := t.config.HostTimeouts[req.URL.Host]; ok {
+		return timeout
+	}
+	if timeout, ok := t.config.HostTimeouts[req.URL.Hostname()]; ok {
+		return timeout
+	}
+	return t.config.Timeout
+}
+
+// backoff returns the delay before the next attempt. The delay doubles with every attempt up to RetryMaxDelay,
+// a random value between half and the full delay is used so clients do not retry at the same time.
+func (t *Transport) backoff(attempt int) time.Duration {
+	delay := t.config.RetryMaxDelay
+	if attempt < 32 && t.config.RetryBaseDelay<<uint(attempt-1) < delay {
+		delay = t.config.RetryBaseDelay << uint(attempt-1)
+	}
+	half := int64(delay / 2)
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+func (t *Transport) logger(ctx context.Context) observance.Logger {
+	return t.obs.CopyWithContext(ctx).Logger
+}
+
+func (t *Transport) increment(labels observance.Labels) {
+	if t.obs.Metrics != nil {
+		t.obs.Metrics.IncrementWithLabels(MetricRequests, labels)
+	}
+}
+
+func (t *Transport) measure(labels observance.Labels, start time.Time) {
+	if t.obs.Metrics != nil {
+		t.obs.Metrics.IncrementWithLabels(MetricRequests, labels)
+		t.obs.Metrics.ObserveDurationSince(MetricRequestDuration, start, labels)
+	}
+}
+
+// isRetryable checks whether the request can safely be sent again.
+func isRetryable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+	default:
+		return false
+	}
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return err != ErrCircuitOpen
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// cancelOnClose releases the timeout context of the attempt when the response body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
@@ -0,0 +1,261 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"toolkit/app/core/observance"
+)
+
+func TestPropagation(t *testing.T) {
+	var headers http.Header
+	var mutex sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		headers = r.Header.Clone()
+	}))
+	defer server.Close()
+
+	exporter := &exporterStub{}
+	tracer := observance.NewTracer("test-app", exporter, observance.NewTestLogger())
+	ctx, parent := tracer.Start(context.Background(), "parent", observance.SpanKindServer)
+	ctx = observance.ContextWithRequestID(ctx, "testRequestId")
+
+	obs, metrics := newTestObs()
+	client := New(obs, Config{Name: "users"})
+	resp := get(t, client, ctx, server.URL+"/users?secret=1")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	parent.End()
+	require.NoError(t, tracer.Close(context.Background()))
+
+	spans := exporter.spans
+	require.Len(t, spans, 2)
+	assert.Equal(t, "HTTP GET", spans[0].Name)
+	assert.Equal(t, observance.SpanKindClient, spans[0].Kind)
+	assert.Equal(t, server.URL+"/users", spans[0].Attributes["http.url"])
+	assert.Equal(t, http.StatusOK, spans[0].Attributes["http.status_code"])
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, "testRequestId", headers.Get("X-Request-ID"))
+	assert.Equal(t, "00-"+spans[0].TraceID+"-"+spans[0].SpanID+"-01", headers.Get("traceparent"))
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	labels := observance.Labels{"client": "users", "host": host, "method": "GET", "status": "200"}
+	metrics.AssertCounter(t, MetricRequests, labels, 1)
+	metrics.AssertObserved(t, MetricRequestDuration, labels)
+
+	entry := obs.Logger.(observance.TestLogger).LastEntry()
+	assert.Equal(t, "outgoing request finished", entry.Message)
+	assert.Equal(t, server.URL+"/users", entry.Data["url"])
+	assert.Equal(t, spans[0].TraceID, entry.Data["traceId"])
+}
+
+func TestRetries(t *testing.T) {
+	t.Run("idempotent requests are retried", func(t *testing.T) {
+		var calls int32
+		var bodies []string
+		var mutex sync.Mutex
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			mutex.Lock()
+			bodies = append(bodies, string(body))
+			mutex.Unlock()
+			if atomic.AddInt32(&calls, 1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		obs, metrics := newTestObs()
+		client := New(obs, Config{MaxRetries: 3, RetryBaseDelay: time.Millisecond})
+		req, err := http.NewRequest(http.MethodPut, server.URL, bytes.NewBufferString("payload"))
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+		assert.EqualValues(t, 3, atomic.LoadInt32(&calls))
+		mutex.Lock()
+		assert.Equal(t, []string{"payload", "payload", "payload"}, bodies)
+		mutex.Unlock()
+		host := strings.TrimPrefix(server.URL, "http://")
+		metrics.AssertCounter(t, MetricRequests, observance.Labels{"client": "", "host": host, "method": "PUT", "status": "503"}, 2)
+	})
+
+	t.Run("last response is returned when retries are exhausted", func(t *testing.T) {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		obs, _ := newTestObs()
+		client := New(obs, Config{MaxRetries: 2, RetryBaseDelay: time.Millisecond})
+		resp := get(t, client, context.Background(), server.URL)
+		assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+		assert.EqualValues(t, 3, atomic.LoadInt32(&calls))
+	})
+
+	t.Run("non-idempotent requests and client errors are not retried", func(t *testing.T) {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			if r.Method == http.MethodPost {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+		defer server.Close()
+
+		obs, _ := newTestObs()
+		client := New(obs, Config{MaxRetries: 3, RetryBaseDelay: time.Millisecond})
+		resp, err := client.Post(server.URL, "text/plain", strings.NewReader("payload"))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+		resp = get(t, client, context.Background(), server.URL)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.EqualValues(t, 2, atomic.LoadInt32(&calls))
+	})
+
+	t.Run("waiting for a retry stops when the context is canceled", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		obs, _ := newTestObs()
+		client := New(obs, Config{MaxRetries: 3, RetryBaseDelay: time.Minute, RetryMaxDelay: time.Minute})
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		require.NoError(t, err)
+		_, err = client.Do(req.WithContext(ctx))
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	transport := NewTransport(&observance.Obs{}, Config{RetryBaseDelay: 100 * time.Millisecond, RetryMaxDelay: time.Second})
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{5, time.Second},
+		{100, time.Second},
+	}
+	for _, test := range tests {
+		for i := 0; i < 20; i++ {
+			delay := transport.backoff(test.attempt)
+			assert.True(t, delay >= test.max/2 && delay <= test.max, "attempt %d: %s", test.attempt, delay)
+		}
+	}
+}
+
+func TestHostTimeouts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	obs, metrics := newTestObs()
+	client := New(obs, Config{
+		Timeout:      time.Second,
+		HostTimeouts: map[string]time.Duration{serverURL.Hostname(): 10 * time.Millisecond},
+	})
+
+	_, err = client.Get(server.URL)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	metrics.AssertCounter(t, MetricRequests, observance.Labels{"client": "", "host": serverURL.Host, "method": "GET", "status": "error"}, 1)
+	entry := obs.Logger.(observance.TestLogger).LastEntry()
+	assert.Equal(t, "outgoing request failed", entry.Message)
+	assert.True(t, errors.Is(entry.Data["error"].(error), context.DeadlineExceeded), "the error is logged as error")
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var failing int32 = 1
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	obs, metrics := newTestObs()
+	transport := NewTransport(obs, Config{BreakerThreshold: 2, BreakerOpenTimeout: time.Minute})
+	now := time.Now()
+	transport.breakers.now = func() time.Time { return now }
+	client := &http.Client{Transport: transport}
+
+	assert.Equal(t, http.StatusInternalServerError, get(t, client, context.Background(), server.URL).StatusCode)
+	assert.Equal(t, http.StatusInternalServerError, get(t, client, context.Background(), server.URL).StatusCode)
+	_, err := client.Get(server.URL)
+	assert.True(t, errors.Is(err, ErrCircuitOpen))
+	assert.EqualValues(t, 2, atomic.LoadInt32(&calls))
+	host := strings.TrimPrefix(server.URL, "http://")
+	metrics.AssertCounter(t, MetricRequests, observance.Labels{"client": "", "host": host, "method": "GET", "status": "circuit_open"}, 1)
+
+	// The trial request fails, so the circuit stays open.
+	now = now.Add(time.Minute)
+	assert.Equal(t, http.StatusInternalServerError, get(t, client, context.Background(), server.URL).StatusCode)
+	_, err = client.Get(server.URL)
+	assert.True(t, errors.Is(err, ErrCircuitOpen))
+
+	// The trial request succeeds and closes the circuit.
+	atomic.StoreInt32(&failing, 0)
+	now = now.Add(time.Minute)
+	assert.Equal(t, http.StatusOK, get(t, client, context.Background(), server.URL).StatusCode)
+	assert.Equal(t, http.StatusOK, get(t, client, context.Background(), server.URL).StatusCode)
+	assert.EqualValues(t, 5, atomic.LoadInt32(&calls))
+}
+
+func get(t *testing.T, client *http.Client, ctx context.Context, url string) *http.Response {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+	resp, err := client.Do(req.WithContext(ctx))
+	require.NoError(t, err)
+	_, _ = ioutil.ReadAll(resp.Body)
+	require.NoError(t, resp.Body.Close())
+	return resp
+}
+
+func newTestObs() (*observance.Obs, *observance.TestMeasurer) {
+	metrics := observance.NewTestMeasurer()
+	return &observance.Obs{Logger: observance.NewTestLogger(), Metrics: metrics}, metrics
+}
+
+type exporterStub struct {
+	spans []observance.SpanData
+}
+
+func (e *exporterStub) ExportSpans(ctx context.Context, spans []observance.SpanData) error {
+	e.spans = append(e.spans, spans...)
+	return nil
+}
@@ -0,0 +1,429 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	mathrand "math/rand"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"toolkit/app/core/observance"
+)
+
+// Names of the metrics recorded by Queue. All have the labels "queue" and "type",
+// MetricProcessed and MetricDuration also have the label "result" (ResultSuccess, ResultRetry or ResultDead).
+const (
+	MetricEnqueued  = "jobs_enqueued_total"
+	MetricProcessed = "jobs_processed_total"
+	MetricDuration  = "job_duration_seconds"
+)
+
+// Values of the "result" label.
+const (
+	ResultSuccess = "success"
+	ResultRetry   = "retry"
+	ResultDead    = "dead"
+)
+
+// Default values that are used if the corresponding config value is not set.
+const (
+	DefaultConcurrency       = 5
+	DefaultMaxAttempts       = 5
+	DefaultRetryBaseDelay    = time.Second
+	DefaultRetryMaxDelay     = time.Hour
+	DefaultVisibilityTimeout = 5 * time.Minute
+	DefaultPollInterval      = time.Second
+)
+
+// ErrNoJob is returned by Backend.Fetch if no job became available.
+var ErrNoJob = errors.New("no job available")
+
+// Job is a unit of work that is processed in the background by the handler registered for its type.
+type Job struct {
+	ID      string          `json:"id"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+	// Attempt is the number of the current attempt starting with 1. Deliveries that were not finished
+	// within the visibility timeout, e.g. because the worker crashed, count as attempts as well.
+	Attempt    int       `json:"attempt"`
+	EnqueuedAt time.Time `json:"enqueuedAt"`
+	// LastError is the error of the previous attempt.
+	LastError   string `json:"lastError,omitempty"`
+	RequestID   string `json:"requestId,omitempty"`
+	TraceParent string `json:"traceParent,omitempty"`
+
+	// receipt identifies the delivery in the backend, e.g. the ID of the stream entry.
+	receipt string
+}
+
+// JSON parses the JSON payload into the result.
+func (j *Job) JSON(result interface{}) error {
+	return json.Unmarshal(j.Payload, result)
+}
+
+// Handler processes the jobs of one type. If it returns an error, the job is retried with backoff
+// unless the error was marked with Permanent. The context is canceled after the visibility timeout.
+type Handler func(ctx context.Context, job *Job) error
+
+// Permanent marks the error so the job is moved to the dead-letter queue without further retries,
+// e.g. if the payload is invalid.
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+func isPermanent(err error) bool {
+	var permanent permanentError
+	return errors.As(err, &permanent)
+}
+
+// Backend stores the jobs. The stored Attempt of a job is the number of attempts that were already made,
+// Fetch increases it by the number of deliveries.
+type Backend interface {
+	// Enqueue adds the job. It becomes available at runAt, immediately if runAt is zero or in the past.
+	Enqueue(ctx context.Context, job *Job, runAt time.Time) error
+	// Fetch returns the next available job or ErrNoJob if no job became available within the block duration.
+	// Jobs that were fetched but not finished with Ack, Retry or Dead within the visibility timeout are
+	// delivered again.
+	Fetch(ctx context.Context, consumer string, visibilityTimeout time.Duration, block time.Duration) (*Job, error)
+	// Ack removes the job after it was processed successfully.
+	Ack(ctx context.Context, job *Job) error
+	// Retry removes the job and adds it again, it becomes available at runAt.
+	Retry(ctx context.Context, job *Job, runAt time.Time) error
+	// Dead moves the job to the dead-letter queue.
+	Dead(ctx context.Context, job *Job) error
+	// DeadLetters returns up to count jobs of the dead-letter queue, the newest first.
+	DeadLetters(ctx context.Context, count int64) ([]*Job, error)
+}
+
+// Config contains the settings of the Queue.
+type Config struct {
+	// Name identifies the queue in logs and metrics.
+	Name string
+	// Concurrency is the number of jobs that are processed at the same time.
+	Concurrency int
+	// MaxAttempts is the number of attempts after which a failing job is moved to the dead-letter queue.
+	MaxAttempts int
+	// RetryBaseDelay is the delay before the first retry, it doubles with every further retry (with jitter).
+	RetryBaseDelay time.Duration
+	// RetryMaxDelay is the upper limit for the delay between two attempts.
+	RetryMaxDelay time.Duration
+	// VisibilityTimeout is the maximum duration of one attempt. If a job is not finished within that time,
+	// e.g. because the worker crashed, it is delivered again to another worker.
+	VisibilityTimeout time.Duration
+	// PollInterval is the maximum time a worker waits for new jobs before it checks for delayed and stuck jobs.
+	PollInterval time.Duration
+}
+
+// Queue enqueues jobs and processes them with the registered handlers after Start was called.
+// Services that only enqueue jobs do not need to call Start.
+type Queue struct {
+	backend  Backend
+	obs      *observance.Obs
+	config   Config
+	consumer string
+	handlers map[string]Handler
+	mutex    sync.RWMutex
+
+	startOnce    sync.Once
+	closeOnce    sync.Once
+	stop         chan struct{}
+	stopFetching context.CancelFunc
+	fetchContext context.Context
+	cancelJobs   context.CancelFunc
+	jobContext   context.Context
+	workers      sync.WaitGroup
+}
+
+// New creates a new Queue, missing config values are set to their defaults.
+func New(backend Backend, obs *observance.Obs, config Config) *Queue {
+	if config.Concurrency <= 0 {
+		config.Concurrency = DefaultConcurrency
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = DefaultMaxAttempts
+	}
+	if config.RetryBaseDelay <= 0 {
+		config.RetryBaseDelay = DefaultRetryBaseDelay
+	}
+	if config.RetryMaxDelay <= 0 {
+		config.RetryMaxDelay = DefaultRetryMaxDelay
+	}
+	if config.VisibilityTimeout <= 0 {
+		config.VisibilityTimeout = DefaultVisibilityTimeout
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = DefaultPollInterval
+	}
+
+	q := &Queue{
+		backend:  backend,
+		obs:      obs,
+		config:   config,
+		consumer: consumerName(),
+		handlers: map[string]Handler{},
+		stop:     make(chan struct{}),
+	}
+	q.fetchContext, q.stopFetching = context.WithCancel(context.Background())
+	q.jobContext, q.cancelJobs = context.WithCancel(context.Background())
+	return q
+}
+
+// Handle registers the handler for the jobs of the given type.
+func (q *Queue) Handle(jobType string, handler Handler) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.handlers[jobType] = handler
+}
+
+// Enqueue adds a job with the payload encoded as JSON and returns its ID. The request ID and the trace context
+// of the context are stored with the job, so the logs and spans of the handler can be correlated with the request.
+func (q *Queue) Enqueue(ctx context.Context, jobType string, payload interface{}) (string, error) {
+	return q.EnqueueIn(ctx, 0, jobType, payload)
+}
+
+// EnqueueIn adds a job that is processed after the delay, see Enqueue.
+func (q *Queue) EnqueueIn(ctx context.Context, delay time.Duration, jobType string, payload interface{}) (string, error) {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return "", errors.Wrap(err, "could not encode job payload")
+	}
+
+	ctx, span := observance.StartChildSpan(ctx, "enqueue "+jobType, observance.SpanKindProducer)
+	defer span.End()
+
+	job := &Job{
+		ID:         newID(),
+		Type:       jobType,
+		Payload:    encoded,
+		EnqueuedAt: time.Now().UTC(),
+		RequestID:  observance.RequestIDFromContext(ctx),
+	}
+	if spanContext := observance.SpanContextFromContext(ctx); spanContext.IsValid() {
+		job.TraceParent = spanContext.TraceParent()
+	}
+	span.SetAttribute("job.id", job.ID)
+
+	var runAt time.Time
+	if delay > 0 {
+		runAt = time.Now().Add(delay)
+	}
+	if err := q.backend.Enqueue(ctx, job, runAt); err != nil {
+		span.RecordError(err)
+		return "", errors.Wrap(err, "could not enqueue job")
+	}
+	q.obs.Metrics.IncrementWithLabels(MetricEnqueued, observance.Labels{"queue": q.config.Name, "type": jobType})
+	return job.ID, nil
+}
+
+// DeadLetters returns up to count jobs that failed permanently, the newest first.
+func (q *Queue) DeadLetters(ctx context.Context, count int64) ([]*Job, error) {
+	return q.backend.DeadLetters(ctx, count)
+}
+
+// Start starts processing the jobs with Concurrency workers in the background.
+func (q *Queue) Start() {
+	q.startOnce.Do(func() {
+		for i := 0; i < q.config.Concurrency; i++ {
+			q.workers.Add(1)
+			go q.work()
+		}
+	})
+}
+
+// Close stops fetching new jobs and waits until the running jobs are finished. If they do not finish before
+// the context is done, their contexts are canceled and an error is returned. Jobs that are not finished
+// are delivered again after the visibility timeout.
+func (q *Queue) Close(ctx context.Context) error {
+	q.closeOnce.Do(func() {
+		close(q.stop)
+		q.stopFetching()
+	})
+
+	finished := make(chan struct{})
+	go func() {
+		q.workers.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		q.cancelJobs()
+		return nil
+	case <-ctx.Done():
+		q.cancelJobs()
+		return errors.Wrap(ctx.Err(), "running jobs did not finish")
+	}
+}
+
+// work fetches and processes jobs until the queue is closed.
+func (q *Queue) work() {
+	defer q.workers.Done()
+	for {
+		select {
+		case <-q.stop:
+			return
+		default:
+		}
+
+		job, err := q.backend.Fetch(q.fetchContext, q.consumer, q.config.VisibilityTimeout, q.config.PollInterval)
+		if err == ErrNoJob {
+			continue
+		}
+		if err != nil {
+			if q.fetchContext.Err() != nil {
+				return
+			}
+			q.obs.Logger.WithField("queue", q.config.Name).WithError(err).Warn("failed to fetch job")
+			select {
+			case <-q.stop:
+				return
+			case <-time.After(q.config.PollInterval):
+			}
+			continue
+		}
+		q.process(job)
+	}
+}
+
+// process runs the handler and acknowledges, retries or buries the job depending on the result.
+func (q *Queue) process(job *Job) {
+	ctx := q.jobContext
+	if job.RequestID != "" {
+		ctx = observance.ContextWithRequestID(ctx, job.RequestID)
+	}
+	if remote, err := observance.ParseTraceParent(job.TraceParent); err == nil {
+		ctx = observance.ContextWithRemoteSpanContext(ctx, remote)
+	}
+	var span *observance.Span
+	if q.obs.Tracer != nil {
+		ctx, span = q.obs.Tracer.Start(ctx, "job "+job.Type, observance.SpanKindConsumer)
+		span.SetAttribute("job.id", job.ID)
+		span.SetAttribute("job.attempt", job.Attempt)
+	}
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, q.config.VisibilityTimeout)
+	defer cancel()
+
+	logger := q.obs.CopyWithContext(ctx).Logger.WithFields(observance.Fields{
+		"queue":   q.config.Name,
+		"jobType": job.Type,
+		"jobId":   job.ID,
+		"attempt": job.Attempt,
+	})
+	if job.RequestID != "" {
+		logger = logger.WithField("requestId", job.RequestID)
+	}
+
+	start := time.Now()
+	err := q.run(ctx, job, logger)
+	if err != nil {
+		span.RecordError(err)
+	}
+
+	// The handler might still use the job, so the error is stored in a copy.
+	failed := *job
+	if err != nil {
+		failed.LastError = err.Error()
+	}
+
+	result := ResultSuccess
+	switch {
+	case err == nil:
+		err = q.backend.Ack(context.Background(), job)
+	case isPermanent(err) || job.Attempt >= q.config.MaxAttempts:
+		result = ResultDead
+		logger.WithError(err).Error("job failed permanently and was moved to the dead-letter queue")
+		err = q.backend.Dead(context.Background(), &failed)
+	default:
+		result = ResultRetry
+		delay := q.backoff(job.Attempt)
+		logger.WithError(err).WithField("retryIn", delay.String()).Warn("job failed and will be retried")
+		err = q.backend.Retry(context.Background(), &failed, time.Now().Add(delay))
+	}
+	if err != nil {
+		logger.WithError(err).Error("failed to finish job, it is delivered again after the visibility timeout")
+	}
+
+	labels := observance.Labels{"queue": q.config.Name, "type": job.Type, "result": result}
+	q.obs.Metrics.IncrementWithLabels(MetricProcessed, labels)
+	q.obs.Metrics.ObserveDurationSince(MetricDuration, start, labels)
+}
+
+// run calls the handler of the job. Panics are recovered and returned as error so the job is retried.
+func (q *Queue) run(ctx context.Context, job *Job, logger observance.Logger) (err error) {
+	if job.Attempt > q.config.MaxAttempts {
+		return Permanent(errors.Errorf("job was delivered %d times without being finished", job.Attempt))
+	}
+
+	q.mutex.RLock()
+	handler, ok := q.handlers[job.Type]
+	q.mutex.RUnlock()
+	if !ok {
+		return Permanent(errors.Errorf("no handler registered for job type %q", job.Type))
+	}
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			logger.WithField("stack", string(debug.Stack())).Error(fmt.Sprintf("job handler panicked: %v", recovered))
+			err = errors.Errorf("job handler panicked: %v", recovered)
+		}
+	}()
+	return handler(ctx, job)
+}
+
+// backoff returns the delay before the next attempt. The delay doubles with every attempt up to RetryMaxDelay,
+// a random value between half and the full delay is used so failed jobs are not retried at the same time.
+func (q *Queue) backoff(attempt int) time.Duration {
+	delay := q.config.RetryBaseDelay
+	for i := 1; i < attempt; i++ {
+		// Doubling stops before it could overflow.
+		if delay >= q.config.RetryMaxDelay/2 {
+			delay = q.config.RetryMaxDelay
+			break
+		}
+		delay *= 2
+	}
+	if delay > q.config.RetryMaxDelay {
+		delay = q.config.RetryMaxDelay
+	}
+	half := int64(delay / 2)
+	return time.Duration(half + mathrand.Int63n(half+1))
+}
+
+// consumerName identifies the process in the consumer group.
+func consumerName() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "worker"
+	}
+	return hostname + "-" + strconv.Itoa(os.Getpid()) + "-" + newID()[:8]
+}
+
+// newID returns a random ID, it falls back to the current time if no random bytes are available.
+func newID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16) + "00000000"
+	}
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,357 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"toolkit/app/core/cache"
+	"toolkit/app/core/observance"
+)
+
+type email struct {
+	To string `json:"to"`
+}
+
+// withBackends runs the test with the REDIS and the in-memory backend.
+func withBackends(t *testing.T, fn func(t *testing.T, backend Backend)) {
+	t.Run("redis", func(t *testing.T) {
+		redis, err := miniredis.Run()
+		require.NoError(t, err)
+		defer redis.Close()
+
+		client, err := cache.NewRedis(redis.Host(), redis.Port(), "testPrefix")
+		require.NoError(t, err)
+		defer client.Close()
+		backend, err := NewRedisBackend(context.Background(), client, "mails")
+		require.NoError(t, err)
+		fn(t, backend)
+	})
+
+	t.Run("memory", func(t *testing.T) {
+		fn(t, NewMemoryBackend())
+	})
+}
+
+type testQueue struct {
+	*Queue
+	logger  observance.TestLogger
+	metrics *observance.TestMeasurer
+}
+
+func newTestQueue(t *testing.T, backend Backend, config Config) *testQueue {
+	logger := observance.NewTestLogger()
+	metrics := observance.NewTestMeasurer()
+	config.Name = "mails"
+	if config.PollInterval == 0 {
+		config.PollInterval = 10 * time.Millisecond
+	}
+	if config.RetryBaseDelay == 0 {
+		config.RetryBaseDelay = 10 * time.Millisecond
+	}
+	q := New(backend, &observance.Obs{Logger: logger, Metrics: metrics}, config)
+	t.Cleanup(func() {
+		_ = q.Close(context.Background())
+	})
+	return &testQueue{Queue: q, logger: logger, metrics: metrics}
+}
+
+func TestQueue(t *testing.T) {
+	labels := func(result string) observance.Labels {
+		return observance.Labels{"queue": "mails", "type": "send", "result": result}
+	}
+
+	t.Run("processes jobs with the handler of their type", func(t *testing.T) {
+		withBackends(t, func(t *testing.T, backend Backend) {
+			q := newTestQueue(t, backend, Config{})
+			received := make(chan *Job, 10)
+			q.Handle("send", func(ctx context.Context, job *Job) error {
+				var payload email
+				require.NoError(t, job.JSON(&payload))
+				assert.Equal(t, "jane@example.com", payload.To)
+				assert.Equal(t, "request-1", observance.RequestIDFromContext(ctx))
+				received <- job
+				return nil
+			})
+			q.Start()
+
+			ctx := observance.ContextWithRequestID(context.Background(), "request-1")
+			id, err := q.Enqueue(ctx, "send", email{To: "jane@example.com"})
+			require.NoError(t, err)
+
+			job := receive(t, received)
+			assert.Equal(t, id, job.ID)
+			assert.Equal(t, 1, job.Attempt)
+			q.metrics.AssertCounter(t, MetricEnqueued, observance.Labels{"queue": "mails", "type": "send"}, 1)
+			assert.Eventually(t, func() bool {
+				return q.metrics.Counter(MetricProcessed, labels(ResultSuccess)) == 1
+			}, time.Second, 5*time.Millisecond)
+			q.metrics.AssertObserved(t, MetricDuration, labels(ResultSuccess))
+		})
+	})
+
+	t.Run("continues the trace of the request", func(t *testing.T) {
+		q := newTestQueue(t, NewMemoryBackend(), Config{})
+		tracer := observance.NewTracer("test-app", observance.NewWriterExporter(ioutil.Discard), q.logger)
+		defer tracer.Close(context.Background())
+		q.obs.Tracer = tracer
+		traces := make(chan observance.SpanContext, 1)
+		q.Handle("send", func(ctx context.Context, job *Job) error {
+			traces <- observance.SpanContextFromContext(ctx)
+			return nil
+		})
+		q.Start()
+
+		ctx, span := tracer.Start(context.Background(), "POST /mails", observance.SpanKindServer)
+		_, err := q.Enqueue(ctx, "send", email{})
+		require.NoError(t, err)
+		span.End()
+
+		select {
+		case trace := <-traces:
+			assert.Equal(t, span.SpanContext().TraceID, trace.TraceID)
+			assert.NotEqual(t, span.SpanContext().SpanID, trace.SpanID)
+		case <-time.After(time.Second):
+			t.Fatal("no job received")
+		}
+	})
+
+	t.Run("retries failed jobs with backoff", func(t *testing.T) {
+		withBackends(t, func(t *testing.T, backend Backend) {
+			q := newTestQueue(t, backend, Config{})
+			received := make(chan *Job, 10)
+			q.Handle("send", func(ctx context.Context, job *Job) error {
+				received <- job
+				if job.Attempt < 3 {
+					return errors.New("mail server unavailable")
+				}
+				return nil
+			})
+			q.Start()
+
+			start := time.Now()
+			_, err := q.Enqueue(context.Background(), "send", email{To: "jane@example.com"})
+			require.NoError(t, err)
+
+			assert.Equal(t, 1, receive(t, received).Attempt)
+			second := receive(t, received)
+			assert.Equal(t, 2, second.Attempt)
+			assert.Equal(t, "mail server unavailable", second.LastError)
+			assert.Equal(t, 3, receive(t, received).Attempt)
+			// 5-10ms before the second and 10-20ms before the third attempt
+			assert.True(t, time.Since(start) >= 15*time.Millisecond)
+
+			assert.Eventually(t, func() bool {
+				return q.metrics.Counter(MetricProcessed, labels(ResultSuccess)) == 1
+			}, time.Second, 5*time.Millisecond)
+			q.metrics.AssertCounter(t, MetricProcessed, labels(ResultRetry), 2)
+			q.logger.AssertLogged(t, "warn", "job failed and will be retried", observance.Fields{"jobType": "send", "attempt": 2})
+		})
+	})
+
+	t.Run("moves jobs to the dead-letter queue", func(t *testing.T) {
+		withBackends(t, func(t *testing.T, backend Backend) {
+			q := newTestQueue(t, backend, Config{MaxAttempts: 2})
+			var calls int32
+			q.Handle("send", func(ctx context.Context, job *Job) error {
+				atomic.AddInt32(&calls, 1)
+				return errors.New("mailbox full")
+			})
+			q.Handle("validate", func(ctx context.Context, job *Job) error {
+				atomic.AddInt32(&calls, 1)
+				return Permanent(errors.New("invalid address"))
+			})
+			q.Handle("panic", func(ctx context.Context, job *Job) error {
+				panic("boom")
+			})
+			q.Start()
+
+			ctx := context.Background()
+			sendID, err := q.Enqueue(ctx, "send", email{})
+			require.NoError(t, err)
+			assert.Eventually(t, func() bool {
+				return q.metrics.Counter(MetricProcessed, labels(ResultDead)) == 1
+			}, time.Second, 5*time.Millisecond)
+			_, err = q.Enqueue(ctx, "validate", email{})
+			require.NoError(t, err)
+			_, err = q.Enqueue(ctx, "unknown", email{})
+			require.NoError(t, err)
+			assert.Eventually(t, func() bool {
+				letters, err := q.DeadLetters(ctx, 10)
+				return err == nil && len(letters) == 3
+			}, time.Second, 5*time.Millisecond)
+			assert.Equal(t, int32(3), atomic.LoadInt32(&calls), "permanent errors are not retried")
+
+			letters, err := q.DeadLetters(ctx, 2)
+			require.NoError(t, err)
+			require.Len(t, letters, 2)
+			lastErrors := map[string]string{letters[0].Type: letters[0].LastError, letters[1].Type: letters[1].LastError}
+			assert.Equal(t, "invalid address", lastErrors["validate"])
+			assert.Equal(t, `no handler registered for job type "unknown"`, lastErrors["unknown"])
+			letters, err = q.DeadLetters(ctx, 10)
+			require.NoError(t, err)
+			assert.Equal(t, sendID, letters[2].ID)
+			assert.Equal(t, 2, letters[2].Attempt)
+			assert.Equal(t, "mailbox full", letters[2].LastError)
+			q.logger.AssertLogged(t, "error", "job failed permanently", observance.Fields{"jobId": sendID})
+
+			_, err = q.Enqueue(ctx, "panic", email{})
+			require.NoError(t, err)
+			assert.Eventually(t, func() bool {
+				letters, err := q.DeadLetters(ctx, 1)
+				return err == nil && len(letters) == 1 && letters[0].LastError == "job handler panicked: boom"
+			}, time.Second, 5*time.Millisecond)
+			q.logger.AssertLogged(t, "error", "job handler panicked: boom", nil)
+		})
+	})
+
+	t.Run("delays jobs", func(t *testing.T) {
+		withBackends(t, func(t *testing.T, backend Backend) {
+			q := newTestQueue(t, backend, Config{})
+			received := make(chan time.Time, 10)
+			q.Handle("send", func(ctx context.Context, job *Job) error {
+				received <- time.Now()
+				return nil
+			})
+			q.Start()
+
+			start := time.Now()
+			_, err := q.EnqueueIn(context.Background(), 50*time.Millisecond, "send", email{})
+			require.NoError(t, err)
+			select {
+			case processedAt := <-received:
+				assert.True(t, processedAt.Sub(start) >= 50*time.Millisecond)
+			case <-time.After(time.Second):
+				t.Fatal("delayed job was not processed")
+			}
+		})
+	})
+
+	t.Run("waits for running jobs on shutdown", func(t *testing.T) {
+		withBackends(t, func(t *testing.T, backend Backend) {
+			q := newTestQueue(t, backend, Config{})
+			started := make(chan struct{})
+			var finished int32
+			q.Handle("send", func(ctx context.Context, job *Job) error {
+				close(started)
+				time.Sleep(30 * time.Millisecond)
+				atomic.StoreInt32(&finished, 1)
+				return ctx.Err()
+			})
+			q.Start()
+
+			_, err := q.Enqueue(context.Background(), "send", email{})
+			require.NoError(t, err)
+			<-started
+			require.NoError(t, q.Close(context.Background()))
+			assert.Equal(t, int32(1), atomic.LoadInt32(&finished))
+			q.metrics.AssertCounter(t, MetricProcessed, labels(ResultSuccess), 1)
+		})
+	})
+
+	t.Run("cancels running jobs if the shutdown times out", func(t *testing.T) {
+		q := newTestQueue(t, NewMemoryBackend(), Config{})
+		started := make(chan struct{})
+		q.Handle("send", func(ctx context.Context, job *Job) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		q.Start()
+
+		_, err := q.Enqueue(context.Background(), "send", email{})
+		require.NoError(t, err)
+		<-started
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.EqualError(t, q.Close(ctx), "running jobs did not finish: context deadline exceeded")
+	})
+}
+
+func TestVisibilityTimeout(t *testing.T) {
+	ctx := context.Background()
+
+	withBackends(t, func(t *testing.T, backend Backend) {
+		require.NoError(t, backend.Enqueue(ctx, &Job{ID: "1", Type: "send"}, time.Time{}))
+
+		job, err := backend.Fetch(ctx, "crashed", 20*time.Millisecond, 10*time.Millisecond)
+		require.NoError(t, err)
+		assert.Equal(t, 1, job.Attempt)
+		_, err = backend.Fetch(ctx, "other", 20*time.Millisecond, 10*time.Millisecond)
+		assert.Equal(t, ErrNoJob, err)
+
+		time.Sleep(25 * time.Millisecond)
+		job, err = backend.Fetch(ctx, "other", 20*time.Millisecond, 10*time.Millisecond)
+		require.NoError(t, err)
+		assert.Equal(t, "1", job.ID)
+		assert.Equal(t, 2, job.Attempt)
+
+		require.NoError(t, backend.Ack(ctx, job))
+		time.Sleep(25 * time.Millisecond)
+		_, err = backend.Fetch(ctx, "other", 20*time.Millisecond, 10*time.Millisecond)
+		assert.Equal(t, ErrNoJob, err)
+	})
+}
+
+func TestRedeliveredJobsExceedingMaxAttempts(t *testing.T) {
+	backend := NewMemoryBackend()
+	require.NoError(t, backend.Enqueue(context.Background(), &Job{ID: "1", Type: "send", Attempt: 3}, time.Time{}))
+
+	q := newTestQueue(t, backend, Config{MaxAttempts: 3})
+	q.Handle("send", func(ctx context.Context, job *Job) error {
+		t.Error("handler must not be called")
+		return nil
+	})
+	q.Start()
+
+	assert.Eventually(t, func() bool {
+		letters, _ := q.DeadLetters(context.Background(), 1)
+		return len(letters) == 1 && letters[0].LastError == "job was delivered 4 times without being finished"
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestBackoff(t *testing.T) {
+	t.Run("doubles up to the maximum without overflow", func(t *testing.T) {
+		q := newTestQueue(t, NewMemoryBackend(), Config{MaxAttempts: 100, RetryBaseDelay: time.Minute, RetryMaxDelay: time.Hour})
+		expected := time.Minute
+		for attempt := 1; attempt <= 100; attempt++ {
+			delay := q.backoff(attempt)
+			assert.True(t, delay >= expected/2 && delay <= expected, "attempt %d: %s", attempt, delay)
+			if expected *= 2; expected > time.Hour {
+				expected = time.Hour
+			}
+		}
+	})
+
+	t.Run("retries jobs with many attempts", func(t *testing.T) {
+		backend := NewMemoryBackend()
+		require.NoError(t, backend.Enqueue(context.Background(), &Job{ID: "1", Type: "send", Attempt: 40}, time.Time{}))
+
+		q := newTestQueue(t, backend, Config{MaxAttempts: 100, RetryBaseDelay: time.Minute})
+		q.Handle("send", func(ctx context.Context, job *Job) error {
+			return errors.New("mail server unavailable")
+		})
+		q.Start()
+
+		assert.Eventually(t, func() bool {
+			return q.metrics.Counter(MetricProcessed, observance.Labels{"queue": "mails", "type": "send", "result": ResultRetry}) == 1
+		}, time.Second, 5*time.Millisecond)
+	})
+}
+
+func receive(t *testing.T, jobs chan *Job) *Job {
+	t.Helper()
+	select {
+	case job := <-jobs:
+		return job
+	case <-time.After(time.Second):
+		t.Fatal("no job received")
+		return nil
+	}
+}
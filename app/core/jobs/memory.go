@@ -0,0 +1,192 @@
+package jobs
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryBackend is an in-process implementation of Backend, e.g. for local development and tests.
+// The jobs are lost when the process ends.
+type MemoryBackend struct {
+	ready    []*Job
+	delayed  []delayedJob
+	inFlight map[string]*inFlightJob
+	dead     []*Job
+	mutex    sync.Mutex
+	// notify wakes up a waiting Fetch when a job was added.
+	notify chan struct{}
+	now    func() time.Time
+}
+
+type delayedJob struct {
+	job   *Job
+	runAt time.Time
+}
+
+type inFlightJob struct {
+	job        *Job
+	deliveries int
+	deadline   time.Time
+}
+
+// NewMemoryBackend creates a new MemoryBackend.
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		inFlight: map[string]*inFlightJob{},
+		notify:   make(chan struct{}),
+		now:      time.Now,
+	}
+}
+
+// Enqueue adds the job. It becomes available at runAt, immediately if runAt is zero or in the past.
+func (m *MemoryBackend) Enqueue(ctx context.Context, job *Job, runAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.add(copyJob(job), runAt)
+	return nil
+}
+
+// Fetch returns the next available job or ErrNoJob if no job became available within the block duration.
+// Jobs that are in flight for longer than the visibility timeout are delivered again first.
+func (m *MemoryBackend) Fetch(ctx context.Context, consumer string, visibilityTimeout time.Duration, block time.Duration) (*Job, error) {
+	timeout := time.NewTimer(block)
+	defer timeout.Stop()
+
+	for {
+		m.mutex.Lock()
+		job, wait := m.next(visibilityTimeout)
+		notify := m.notify
+		m.mutex.Unlock()
+		if job != nil {
+			return job, nil
+		}
+
+		var retry <-chan time.Time
+		if wait > 0 {
+			retry = time.After(wait)
+		}
+		select {
+		case <-notify:
+		case <-retry:
+		case <-timeout.C:
+			return nil, ErrNoJob
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Ack removes the job after it was processed successfully.
+func (m *MemoryBackend) Ack(ctx context.Context, job *Job) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.inFlight, job.receipt)
+	return nil
+}
+
+// Retry removes the job and adds it again, it becomes available at runAt.
+func (m *MemoryBackend) Retry(ctx context.Context, job *Job, runAt time.Time) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.inFlight, job.receipt)
+	m.add(copyJob(job), runAt)
+	return nil
+}
+
+// Dead moves the job to the dead-letter queue.
+func (m *MemoryBackend) Dead(ctx context.Context, job *Job) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.inFlight, job.receipt)
+	m.dead = append(m.dead, copyJob(job))
+	return nil
+}
+
+// DeadLetters returns up to count jobs of the dead-letter queue, the newest first.
+func (m *MemoryBackend) DeadLetters(ctx context.Context, count int64) ([]*Job, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	jobs := []*Job{}
+	for i := len(m.dead) - 1; i >= 0 && int64(len(jobs)) < count; i-- {
+		jobs = append(jobs, copyJob(m.dead[i]))
+	}
+	return jobs, nil
+}
+
+// Len returns the number of jobs that are waiting, delayed or in flight.
+func (m *MemoryBackend) Len() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return len(m.ready) + len(m.delayed) + len(m.inFlight)
+}
+
+// add queues the job, the mutex must be held by the caller.
+func (m *MemoryBackend) add(job *Job, runAt time.Time) {
+	job.receipt = ""
+	if runAt.After(m.now()) {
+		m.delayed = append(m.delayed, delayedJob{job: job, runAt: runAt})
+		sort.SliceStable(m.delayed, func(i, j int) bool { return m.delayed[i].runAt.Before(m.delayed[j].runAt) })
+	} else {
+		m.ready = append(m.ready, job)
+	}
+
+	close(m.notify)
+	m.notify = make(chan struct{})
+}
+
+// next returns the next job to deliver or, if there is none, the time until a delayed or in-flight job
+// becomes available (zero if there is none). The mutex must be held by the caller.
+func (m *MemoryBackend) next(visibilityTimeout time.Duration) (*Job, time.Duration) {
+	now := m.now()
+	for len(m.delayed) > 0 && !m.delayed[0].runAt.After(now) {
+		m.ready = append(m.ready, m.delayed[0].job)
+		m.delayed = m.delayed[1:]
+	}
+
+	var wait time.Duration
+	for _, flight := range m.inFlight {
+		if !flight.deadline.After(now) {
+			return m.deliver(flight, visibilityTimeout), 0
+		}
+		if until := flight.deadline.Sub(now); wait == 0 || until < wait {
+			wait = until
+		}
+	}
+
+	if len(m.ready) > 0 {
+		job := m.ready[0]
+		m.ready = m.ready[1:]
+		job.receipt = newID()
+		flight := &inFlightJob{job: job}
+		m.inFlight[job.receipt] = flight
+		return m.deliver(flight, visibilityTimeout), 0
+	}
+
+	if len(m.delayed) > 0 {
+		if until := m.delayed[0].runAt.Sub(now); wait == 0 || until < wait {
+			wait = until
+		}
+	}
+	return nil, wait
+}
+
+// deliver hands out a copy of the job with the attempt increased by the number of deliveries.
+func (m *MemoryBackend) deliver(flight *inFlightJob, visibilityTimeout time.Duration) *Job {
+	flight.deliveries++
+	flight.deadline = m.now().Add(visibilityTimeout)
+	job := copyJob(flight.job)
+	job.Attempt += flight.deliveries
+	return job
+}
+
+func copyJob(job *Job) *Job {
+	jobCopy := *job
+	return &jobCopy
+}
@@ -0,0 +1,265 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/pkg/errors"
+	"toolkit/app/core/cache"
+)
+
+// DefaultDeadLetterMaxLen is the approximate number of jobs that are kept in the dead-letter stream.
+const DefaultDeadLetterMaxLen = 10000
+
+const (
+	redisGroup = "workers"
+	// redisField is the field of the stream entries that contains the job encoded as JSON.
+	redisField = "job"
+	// promoteBatchSize is the maximum number of due delayed jobs moved to the stream per Fetch.
+	promoteBatchSize = 100
+	// reclaimBatchSize is the number of pending jobs that are checked for an expired visibility timeout per Fetch.
+	reclaimBatchSize = 10
+)
+
+// promoteScript moves the delayed jobs that are due from the sorted set to the stream.
+var promoteScript = redis.NewScript(`
+local jobs = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, ARGV[2])
+for _, job in ipairs(jobs) do
+	redis.call("ZREM", KEYS[1], job)
+	redis.call("XADD", KEYS[2], "*", "job", job)
+end
+return #jobs
+`)
+
+// RedisBackend stores the jobs in a REDIS stream that is consumed by a consumer group, so every job is
+// delivered to one worker. Jobs that are not acknowledged within the visibility timeout are claimed by
+// another worker with XCLAIM. Delayed jobs wait in a sorted set until they are due, failed jobs are moved
+// to a separate dead-letter stream. All keys of a queue share a hash tag, so it can be used with REDIS Cluster.
+type RedisBackend struct {
+	client  *cache.RedisClient
+	stream  string
+	delayed string
+	dead    string
+}
+
+// NewRedisBackend creates the stream and the consumer group of the queue if they do not exist yet.
+// The keys start with "jobs:{name}" and the prefix of the client.
+func NewRedisBackend(ctx context.Context, client *cache.RedisClient, name string) (*RedisBackend, error) {
+	key := "jobs:" + cache.HashTag(name)
+	r := &RedisBackend{
+		client:  client,
+		stream:  client.PrefixedKey(key),
+		delayed: client.PrefixedKey(key + ":delayed"),
+		dead:    client.PrefixedKey(key + ":dead"),
+	}
+	if err := r.createGroup(ctx); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Enqueue adds the job to the stream or, if runAt is in the future, to the delayed jobs.
+func (r *RedisBackend) Enqueue(ctx context.Context, job *Job, runAt time.Time) error {
+	_, err := r.client.Client(ctx).TxPipelined(func(pipe redis.Pipeliner) error {
+		return r.add(pipe, job, runAt)
+	})
+	return err
+}
+
+// Fetch moves the due delayed jobs to the stream, claims a job whose visibility timeout expired
+// or reads the next new job from the stream.
+func (r *RedisBackend) Fetch(ctx context.Context, consumer string, visibilityTimeout time.Duration, block time.Duration) (*Job, error) {
+	client := r.client.Client(ctx)
+	now := millis(time.Now())
+	if err := promoteScript.Run(client, []string{r.delayed, r.stream}, now, promoteBatchSize).Err(); err != nil {
+		return nil, errors.Wrap(err, "could not move delayed jobs")
+	}
+
+	job, err := r.reclaim(ctx, consumer, visibilityTimeout)
+	if job != nil || err != nil {
+		return job, r.recreateGroup(ctx, err)
+	}
+
+	streams, err := client.XReadGroup(&redis.XReadGroupArgs{
+		Group:    redisGroup,
+		Consumer: consumer,
+		Streams:  []string{r.stream, ">"},
+		Count:    1,
+		Block:    block,
+	}).Result()
+	if err == redis.Nil {
+		return nil, ErrNoJob
+	}
+	if err != nil {
+		return nil, r.recreateGroup(ctx, errors.Wrap(err, "could not read jobs"))
+	}
+	for _, stream := range streams {
+		for _, message := range stream.Messages {
+			return r.parse(ctx, message, 1)
+		}
+	}
+	return nil, ErrNoJob
+}
+
+// Ack removes the job from the stream.
+func (r *RedisBackend) Ack(ctx context.Context, job *Job) error {
+	_, err := r.client.Client(ctx).TxPipelined(func(pipe redis.Pipeliner) error {
+		r.remove(pipe, job.receipt)
+		return nil
+	})
+	return err
+}
+
+// Retry removes the job from the stream and adds it to the delayed jobs.
+func (r *RedisBackend) Retry(ctx context.Context, job *Job, runAt time.Time) error {
+	_, err := r.client.Client(ctx).TxPipelined(func(pipe redis.Pipeliner) error {
+		r.remove(pipe, job.receipt)
+		return r.add(pipe, job, runAt)
+	})
+	return err
+}
+
+// Dead moves the job from the stream to the dead-letter stream.
+func (r *RedisBackend) Dead(ctx context.Context, job *Job) error {
+	encoded, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return r.bury(ctx, job.receipt, string(encoded))
+}
+
+// DeadLetters returns up to count jobs of the dead-letter stream, the newest first. Entries that could not be
+// parsed are returned as job with the raw value as JSON string in the payload and the parse error as LastError.
+func (r *RedisBackend) DeadLetters(ctx context.Context, count int64) ([]*Job, error) {
+	messages, err := r.client.Client(ctx).XRevRangeN(r.dead, "+", "-", count).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]*Job, 0, len(messages))
+	for _, message := range messages {
+		job := &Job{}
+		value, _ := message.Values[redisField].(string)
+		if err := json.Unmarshal([]byte(value), job); err != nil {
+			// Encoding a string can not fail.
+			raw, _ := json.Marshal(value)
+			job = &Job{Payload: raw, LastError: "could not parse job: " + err.Error()}
+		}
+		job.receipt = message.ID
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// reclaim claims the oldest pending job whose visibility timeout expired. It returns nil if there is none.
+func (r *RedisBackend) reclaim(ctx context.Context, consumer string, visibilityTimeout time.Duration) (*Job, error) {
+	client := r.client.Client(ctx)
+	pending, err := client.XPendingExt(&redis.XPendingExtArgs{
+		Stream: r.stream,
+		Group:  redisGroup,
+		Start:  "-",
+		End:    "+",
+		Count:  reclaimBatchSize,
+	}).Result()
+	if err != nil && err != redis.Nil {
+		return nil, errors.Wrap(err, "could not read pending jobs")
+	}
+
+	for _, entry := range pending {
+		if entry.Idle < visibilityTimeout {
+			continue
+		}
+		// XCLAIM only returns the job if no other worker claimed it in the meantime.
+		messages, err := client.XClaim(&redis.XClaimArgs{
+			Stream:   r.stream,
+			Group:    redisGroup,
+			Consumer: consumer,
+			MinIdle:  visibilityTimeout,
+			Messages: []string{entry.ID},
+		}).Result()
+		if err != nil {
+			return nil, errors.Wrap(err, "could not claim job")
+		}
+		if len(messages) > 0 {
+			return r.parse(ctx, messages[0], int(entry.RetryCount)+1)
+		}
+	}
+	return nil, nil
+}
+
+// parse decodes the job of the stream entry. Entries that can not be decoded are moved to the dead-letter stream.
+func (r *RedisBackend) parse(ctx context.Context, message redis.XMessage, deliveries int) (*Job, error) {
+	value, _ := message.Values[redisField].(string)
+	job := &Job{}
+	if err := json.Unmarshal([]byte(value), job); err != nil {
+		if buryErr := r.bury(ctx, message.ID, value); buryErr != nil {
+			return nil, buryErr
+		}
+		return nil, errors.Wrapf(err, "could not parse job %s, it was moved to the dead letters", message.ID)
+	}
+	job.receipt = message.ID
+	job.Attempt += deliveries
+	return job, nil
+}
+
+// add adds the job to the stream or to the delayed jobs.
+func (r *RedisBackend) add(pipe redis.Pipeliner, job *Job, runAt time.Time) error {
+	encoded, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	if runAt.After(time.Now()) {
+		pipe.ZAdd(r.delayed, &redis.Z{Score: float64(millis(runAt)), Member: string(encoded)})
+		return nil
+	}
+	pipe.XAdd(&redis.XAddArgs{Stream: r.stream, Values: map[string]interface{}{redisField: string(encoded)}})
+	return nil
+}
+
+// remove acknowledges and deletes the stream entry so the stream does not grow.
+func (r *RedisBackend) remove(pipe redis.Pipeliner, id string) {
+	pipe.XAck(r.stream, redisGroup, id)
+	pipe.XDel(r.stream, id)
+}
+
+func (r *RedisBackend) bury(ctx context.Context, id string, value string) error {
+	_, err := r.client.Client(ctx).TxPipelined(func(pipe redis.Pipeliner) error {
+		r.remove(pipe, id)
+		pipe.XAdd(&redis.XAddArgs{
+			Stream:       r.dead,
+			MaxLenApprox: DefaultDeadLetterMaxLen,
+			Values:       map[string]interface{}{redisField: value},
+		})
+		return nil
+	})
+	return err
+}
+
+// recreateGroup creates the consumer group if the error is caused by a missing group, e.g. because the stream
+// was deleted with FLUSHDB, and returns ErrNoJob in that case. Other errors are returned as they are.
+func (r *RedisBackend) recreateGroup(ctx context.Context, err error) error {
+	if err == nil || !strings.HasPrefix(errors.Cause(err).Error(), "NOGROUP") {
+		return err
+	}
+	if err := r.createGroup(ctx); err != nil {
+		return err
+	}
+	return ErrNoJob
+}
+
+// createGroup creates the stream and the consumer group. Jobs that were added before are delivered as well.
+func (r *RedisBackend) createGroup(ctx context.Context) error {
+	err := r.client.Client(ctx).XGroupCreateMkStream(r.stream, redisGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return errors.Wrap(err, "could not create consumer group")
+	}
+	return nil
+}
+
+// millis returns the time as UNIX timestamp in milliseconds, it is used as score of the delayed jobs.
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
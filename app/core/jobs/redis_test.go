@@ -0,0 +1,139 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/go-redis/redis/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"toolkit/app/core/cache"
+)
+
+func TestRedisBackend(t *testing.T) {
+	ctx := context.Background()
+	redis, err := miniredis.Run()
+	require.NoError(t, err)
+	defer redis.Close()
+	client, err := cache.NewRedis(redis.Host(), redis.Port(), "testPrefix")
+	require.NoError(t, err)
+	defer client.Close()
+
+	backend, err := NewRedisBackend(ctx, client, "mails")
+	require.NoError(t, err)
+	_, err = NewRedisBackend(ctx, client, "mails")
+	require.NoError(t, err, "existing consumer group")
+	reset := func(t *testing.T) {
+		redis.FlushAll()
+		require.NoError(t, backend.createGroup(ctx))
+	}
+
+	t.Run("keys share a hash tag", func(t *testing.T) {
+		require.NoError(t, backend.Enqueue(ctx, &Job{ID: "1", Type: "send"}, time.Time{}))
+		require.NoError(t, backend.Enqueue(ctx, &Job{ID: "2", Type: "send"}, time.Now().Add(time.Hour)))
+		assert.ElementsMatch(t, []string{"testPrefix:jobs:{mails}", "testPrefix:jobs:{mails}:delayed"}, redis.Keys())
+
+		job, err := backend.Fetch(ctx, "worker", time.Minute, 10*time.Millisecond)
+		require.NoError(t, err)
+		require.NoError(t, backend.Dead(ctx, job))
+		assert.Contains(t, redis.Keys(), "testPrefix:jobs:{mails}:dead")
+		redis.FlushAll()
+	})
+
+	t.Run("recreates the consumer group", func(t *testing.T) {
+		_, err := backend.Fetch(ctx, "worker", time.Minute, 10*time.Millisecond)
+		assert.Equal(t, ErrNoJob, err)
+
+		require.NoError(t, backend.Enqueue(ctx, &Job{ID: "1", Type: "send"}, time.Time{}))
+		job, err := backend.Fetch(ctx, "worker", time.Minute, 10*time.Millisecond)
+		require.NoError(t, err)
+		assert.Equal(t, "1", job.ID)
+		require.NoError(t, backend.Ack(ctx, job))
+	})
+
+	t.Run("moves invalid entries to the dead letters", func(t *testing.T) {
+		_, err := client.Client(ctx).XAdd(&goredis.XAddArgs{Stream: "testPrefix:jobs:{mails}", Values: map[string]interface{}{"job": "invalid"}}).Result()
+		require.NoError(t, err)
+
+		_, err = backend.Fetch(ctx, "worker", time.Minute, 10*time.Millisecond)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "could not parse job")
+		letters, err := backend.DeadLetters(ctx, 1)
+		require.NoError(t, err)
+		require.Len(t, letters, 1)
+		assert.JSONEq(t, `"invalid"`, string(letters[0].Payload))
+		assert.Contains(t, letters[0].LastError, "could not parse job")
+		reset(t)
+	})
+
+	t.Run("moves due delayed jobs to the stream", func(t *testing.T) {
+		require.NoError(t, backend.Enqueue(ctx, &Job{ID: "1", Type: "send"}, time.Now().Add(50*time.Millisecond)))
+		_, err := backend.Fetch(ctx, "worker", time.Minute, 10*time.Millisecond)
+		assert.Equal(t, ErrNoJob, err)
+		assert.True(t, redis.Exists("testPrefix:jobs:{mails}:delayed"))
+
+		time.Sleep(50 * time.Millisecond)
+		job, err := backend.Fetch(ctx, "worker", time.Minute, 10*time.Millisecond)
+		require.NoError(t, err)
+		assert.Equal(t, "1", job.ID)
+		assert.False(t, redis.Exists("testPrefix:jobs:{mails}:delayed"))
+		require.NoError(t, backend.Ack(ctx, job))
+		reset(t)
+	})
+
+	t.Run("claims jobs after the visibility timeout", func(t *testing.T) {
+		require.NoError(t, backend.Enqueue(ctx, &Job{ID: "1", Type: "send"}, time.Time{}))
+		job, err := backend.Fetch(ctx, "crashed", 20*time.Millisecond, 10*time.Millisecond)
+		require.NoError(t, err)
+
+		pending, err := client.Client(ctx).XPending("testPrefix:jobs:{mails}", "workers").Result()
+		require.NoError(t, err)
+		assert.Equal(t, map[string]int64{"crashed": 1}, pending.Consumers)
+		_, err = backend.Fetch(ctx, "worker", 20*time.Millisecond, 10*time.Millisecond)
+		assert.Equal(t, ErrNoJob, err, "not claimed before the timeout")
+
+		time.Sleep(25 * time.Millisecond)
+		claimed, err := backend.Fetch(ctx, "worker", 20*time.Millisecond, 10*time.Millisecond)
+		require.NoError(t, err)
+		assert.Equal(t, job.ID, claimed.ID)
+		pending, err = client.Client(ctx).XPending("testPrefix:jobs:{mails}", "workers").Result()
+		require.NoError(t, err)
+		assert.Equal(t, map[string]int64{"worker": 1}, pending.Consumers)
+
+		require.NoError(t, backend.Ack(ctx, claimed))
+		length, err := client.Client(ctx).XLen("testPrefix:jobs:{mails}").Result()
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), length)
+		reset(t)
+	})
+
+	t.Run("counts attempts across retries and claims", func(t *testing.T) {
+		fetch := func(consumer string) *Job {
+			job, err := backend.Fetch(ctx, consumer, 20*time.Millisecond, 10*time.Millisecond)
+			require.NoError(t, err)
+			return job
+		}
+
+		require.NoError(t, backend.Enqueue(ctx, &Job{ID: "1", Type: "send"}, time.Time{}))
+		job := fetch("worker")
+		assert.Equal(t, 1, job.Attempt)
+		require.NoError(t, backend.Retry(ctx, job, time.Time{}))
+		job = fetch("worker")
+		assert.Equal(t, 2, job.Attempt)
+
+		// The worker crashes, the job is claimed by another worker.
+		time.Sleep(25 * time.Millisecond)
+		job = fetch("other")
+		assert.Equal(t, 3, job.Attempt)
+		time.Sleep(25 * time.Millisecond)
+		job = fetch("worker")
+		assert.Equal(t, 4, job.Attempt)
+
+		require.NoError(t, backend.Retry(ctx, job, time.Time{}))
+		job = fetch("worker")
+		assert.Equal(t, 5, job.Attempt)
+		require.NoError(t, backend.Ack(ctx, job))
+	})
+}
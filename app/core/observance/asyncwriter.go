@@ -0,0 +1,199 @@
+package observance
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// Drop policies that define what happens if the buffer of an AsyncWriter is full.
+const (
+	// DropNewest discards the data that should be written (default).
+	DropNewest = "drop_newest"
+	// DropOldest discards the oldest buffered data to make room for the new data.
+	DropOldest = "drop_oldest"
+	// Block waits until there is space in the buffer.
+	Block = "block"
+)
+
+// defaultLogBufferSize is the number of writes an AsyncWriter buffers if no size was configured.
+const defaultLogBufferSize = 1024
+
+// AsyncWriter buffers the writes and passes them to the underlying writer in the background,
+// so slow outputs like files or network connections do not block the application.
+type AsyncWriter struct {
+	writer  io.Writer
+	policy  string
+	queue   chan []byte
+	flush   chan chan struct{}
+	done    chan struct{}
+	dropped uint64
+	closed  bool
+	mutex   sync.RWMutex
+	// closing is closed at the start of Close so a blocked Write gives up.
+	closing     chan struct{}
+	closingOnce sync.Once
+}
+
+// NewAsyncWriter creates a new AsyncWriter that buffers up to bufferSize writes. The drop policy defines
+// what happens if the buffer is full, see DropNewest, DropOldest and Block.
+func NewAsyncWriter(w io.Writer, bufferSize int, dropPolicy string) (*AsyncWriter, error) {
+	if bufferSize <= 0 {
+		bufferSize = defaultLogBufferSize
+	}
+	switch dropPolicy {
+	case "":
+		dropPolicy = DropNewest
+	case DropNewest, DropOldest, Block:
+	default:
+		return nil, fmt.Errorf("unknown drop policy %q", dropPolicy)
+	}
+
+	a := &AsyncWriter{
+		writer:  w,
+		policy:  dropPolicy,
+		queue:   make(chan []byte, bufferSize),
+		flush:   make(chan chan struct{}),
+		done:    make(chan struct{}),
+		closing: make(chan struct{}),
+	}
+	go a.continuouslyWrite()
+	return a, nil
+}
+
+// Write queues a copy of the data. It never returns an error, data that is dropped is counted (see Dropped).
+func (a *AsyncWriter) Write(p []byte) (int, error) {
+	data := make([]byte, len(p))
+	copy(data, p)
+
+	// The read lock prevents Close from closing the queue during the send, Close signals closing
+	// before it takes the write lock so a blocked send never blocks it.
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	if a.closed {
+		atomic.AddUint64(&a.dropped, 1)
+		return len(p), nil
+	}
+
+	switch a.policy {
+	case Block:
+		select {
+		case a.queue <- data:
+		case <-a.closing:
+			atomic.AddUint64(&a.dropped, 1)
+		}
+	case DropOldest:
+		for {
+			select {
+			case a.queue <- data:
+				return len(p), nil
+			default:
+			}
+			select {
+			case <-a.queue:
+				atomic.AddUint64(&a.dropped, 1)
+			default:
+			}
+		}
+	default:
+		select {
+		case a.queue <- data:
+		default:
+			atomic.AddUint64(&a.dropped, 1)
+		}
+	}
+	return len(p), nil
+}
+
+// Dropped returns the number of writes that were discarded because the buffer was full.
+func (a *AsyncWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&a.dropped)
+}
+
+// Flush waits until all data that was written so far was passed to the underlying writer.
+func (a *AsyncWriter) Flush(ctx context.Context) error {
+	flushed := make(chan struct{})
+	select {
+	case a.flush <- flushed:
+	case <-a.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close writes the buffered data and closes the underlying writer if it is an io.Closer (except stdout and stderr).
+// Data written after Close, including blocked writes of the Block policy, is dropped.
+func (a *AsyncWriter) Close(ctx context.Context) error {
+	a.closingOnce.Do(func() { close(a.closing) })
+	a.mutex.Lock()
+	if a.closed {
+		a.mutex.Unlock()
+		return nil
+	}
+	a.closed = true
+	close(a.queue)
+	a.mutex.Unlock()
+
+	select {
+	case <-a.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if a.writer == os.Stdout || a.writer == os.Stderr {
+		return nil
+	}
+	if closer, ok := a.writer.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (a *AsyncWriter) continuouslyWrite() {
+	defer close(a.done)
+	for {
+		select {
+		case data, ok := <-a.queue:
+			if !ok {
+				return
+			}
+			a.write(data)
+		case flushed := <-a.flush:
+			a.drain()
+			close(flushed)
+		}
+	}
+}
+
+// drain writes everything that is currently buffered.
+func (a *AsyncWriter) drain() {
+	for {
+		select {
+		case data, ok := <-a.queue:
+			if !ok {
+				return
+			}
+			a.write(data)
+		default:
+			return
+		}
+	}
+}
+
+func (a *AsyncWriter) write(data []byte) {
+	if _, err := a.writer.Write(data); err != nil {
+		// The logger can not be used here since this is the output of the logger.
+		fmt.Fprintf(os.Stderr, "failed to write log entry: %v\n", err)
+	}
+}
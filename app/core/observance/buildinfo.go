@@ -0,0 +1,27 @@
+package observance
+
+import "runtime/debug"
+
+// VCSRevision returns the VCS revision that was embedded into the binary by the Go toolchain
+// or an empty string if it is not available, e.g. for test binaries.
+func VCSRevision() string {
+	buildInfo, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+
+	for _, setting := range buildInfo.Settings {
+		if setting.Key == "vcs.revision" {
+			return setting.Value
+		}
+	}
+	return ""
+}
+
+// vcsRevisionOrUnknown returns the VCS revision or "unknown" if it is not available.
+func vcsRevisionOrUnknown() string {
+	if revision := VCSRevision(); revision != "" {
+		return revision
+	}
+	return "unknown"
+}
@@ -15,3 +15,18 @@ func ExampleNewTestLogger() {
 	// error testMessage1 map[testField:testValue]
 	// [{Level:error Message:testMessage1 Data:map[testField:testValue]} {Level:info Message:testMessage2 Data:map[]}]
 }
+
+func ExampleNewTestMeasurer() {
+	metrics := NewTestMeasurer()
+	obs := &Obs{Logger: NewTestLogger(), Metrics: metrics}
+	obs.Metrics.IncrementWithLabels("requests_total", Labels{"status": "200"})
+	obs.Metrics.IncrementWithLabels("requests_total", Labels{"status": "200"})
+	obs.Metrics.SetGauge("queue_size", 12)
+
+	fmt.Println(metrics.Counter("requests_total", Labels{"status": "200"}))
+	fmt.Println(metrics.Gauge("queue_size", nil))
+
+	// Output:
+	// 2
+	// 12 true
+}
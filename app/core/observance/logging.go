@@ -35,7 +35,17 @@ type LogrusLogger struct {
 // Level returns the log level that was set for the logger.
 // Only entries with that level or above with be logged.
 func (l *LogrusLogger) Level() string {
-	return l.basicLogger.Level.String()
+	return l.basicLogger.GetLevel().String()
+}
+
+// SetLevel changes the log level at runtime. It affects all loggers derived from the same base logger.
+func (l *LogrusLogger) SetLevel(level string) error {
+	logrusLogLevel, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	l.basicLogger.SetLevel(logrusLogLevel)
+	return nil
 }
 
 // Trace writes a log entry with level "trace".
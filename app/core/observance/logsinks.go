@@ -0,0 +1,157 @@
+package observance
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Log formats that can be used for a log sink.
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+// Special outputs of a log sink, all other values are treated as file paths.
+const (
+	LogOutputStdout = "stdout"
+	LogOutputStderr = "stderr"
+)
+
+// LogSinkConfig defines an additional output of the logs with its own level and format.
+type LogSinkConfig struct {
+	// Output is LogOutputStdout, LogOutputStderr or the path of a file that is rotated according to the settings below.
+	Output string
+	// Level is the minimum level of the entries written to the sink. It can not be lower than the level of the logger.
+	Level string
+	// Format is LogFormatJSON (default) or LogFormatText.
+	Format string
+	// MaxSize, MaxAge, MaxBackups and Compress define the rotation of files, see RotatingFileConfig.
+	MaxSize    int64
+	MaxAge     time.Duration
+	MaxBackups int
+	Compress   bool
+	// BufferSize is the number of entries that are buffered, the sink is written to in the background.
+	BufferSize int
+	// DropPolicy defines what happens if the buffer is full: DropNewest (default), DropOldest or Block.
+	DropPolicy string
+}
+
+// AddSink writes all entries with the given level or above to the writer in addition to the output of the logger.
+func (l *LogrusLogger) AddSink(level string, format string, w io.Writer) error {
+	logrusLogLevel, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	formatter, err := newFormatter(format)
+	if err != nil {
+		return err
+	}
+
+	l.basicLogger.AddHook(&sinkHook{
+		levels:    logrus.AllLevels[:logrusLogLevel+1],
+		formatter: formatter,
+		writer:    w,
+	})
+	return nil
+}
+
+// sinkHook is a Logrus hook that formats the entries and writes them to the sink.
+type sinkHook struct {
+	levels    []logrus.Level
+	formatter logrus.Formatter
+	writer    io.Writer
+}
+
+func (h *sinkHook) Levels() []logrus.Level {
+	return h.levels
+}
+
+func (h *sinkHook) Fire(entry *logrus.Entry) error {
+	serialized, err := h.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	_, err = h.writer.Write(serialized)
+	return err
+}
+
+func newFormatter(format string) (logrus.Formatter, error) {
+	switch format {
+	case "", LogFormatJSON:
+		return &logrus.JSONFormatter{TimestampFormat: time.RFC3339Nano}, nil
+	case LogFormatText:
+		return &logrus.TextFormatter{TimestampFormat: time.RFC3339Nano, FullTimestamp: true, DisableColors: true}, nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+}
+
+// setUpLogSinks replaces the default output of the logger with the configured sinks.
+// It returns the writers of the sinks so they can be flushed and closed on shutdown.
+func setUpLogSinks(logger Logger, configs []LogSinkConfig) ([]*AsyncWriter, error) {
+	logrusLogger, ok := logger.(*LogrusLogger)
+	if !ok {
+		return nil, fmt.Errorf("log sinks are not supported by %T", logger)
+	}
+
+	writers := []*AsyncWriter{}
+	closeAll := func() {
+		for _, writer := range writers {
+			_ = writer.Close(context.Background())
+		}
+	}
+
+	for _, config := range configs {
+		output, err := newLogOutput(config)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		writer, err := NewAsyncWriter(output, config.BufferSize, config.DropPolicy)
+		if err != nil {
+			if file, ok := output.(*RotatingFile); ok {
+				file.Close()
+			}
+			closeAll()
+			return nil, err
+		}
+		writers = append(writers, writer)
+
+		level := config.Level
+		if level == "" {
+			level = logrusLogger.Level()
+		}
+		if err := logrusLogger.AddSink(level, config.Format, writer); err != nil {
+			closeAll()
+			return nil, err
+		}
+	}
+
+	logrusLogger.SetOutput(ioutil.Discard)
+	return writers, nil
+}
+
+func newLogOutput(config LogSinkConfig) (io.Writer, error) {
+	switch config.Output {
+	case LogOutputStdout:
+		return os.Stdout, nil
+	case LogOutputStderr:
+		return os.Stderr, nil
+	case "":
+		return nil, fmt.Errorf("output of log sink is missing")
+	default:
+		return NewRotatingFile(RotatingFileConfig{
+			Path:       config.Output,
+			MaxSize:    config.MaxSize,
+			MaxAge:     config.MaxAge,
+			MaxBackups: config.MaxBackups,
+			Compress:   config.Compress,
+		})
+	}
+}
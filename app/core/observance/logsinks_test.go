@@ -0,0 +1,352 @@
+package observance
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogSinks(t *testing.T) {
+	t.Run("entries are written to the sinks with their own level and format", func(t *testing.T) {
+		dir := t.TempDir()
+		obs, err := NewObs(Config{
+			AppName:  "test-app",
+			LogLevel: "debug",
+			LogSinks: []LogSinkConfig{
+				{Output: filepath.Join(dir, "all.log")},
+				{Output: filepath.Join(dir, "warnings.log"), Level: "warn", Format: LogFormatText},
+			},
+		})
+		require.NoError(t, err)
+
+		obs.Logger.WithField("userId", 42).Debug("loading user")
+		obs.Logger.Warn("slow query")
+		require.NoError(t, obs.FlushLogs(context.Background()))
+
+		all := readFileLines(t, filepath.Join(dir, "all.log"))
+		require.Len(t, all, 2)
+		entry := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal([]byte(all[0]), &entry))
+		assert.Equal(t, "loading user", entry["msg"])
+		assert.Equal(t, float64(42), entry["userId"])
+		assert.Equal(t, "test-app", entry["name"])
+
+		warnings := readFileLines(t, filepath.Join(dir, "warnings.log"))
+		require.Len(t, warnings, 1)
+		assert.Contains(t, warnings[0], `level=warning msg="slow query"`)
+
+		obs.Logger.Error("shutting down")
+		require.NoError(t, obs.Close(context.Background()))
+		assert.Len(t, readFileLines(t, filepath.Join(dir, "warnings.log")), 2)
+	})
+
+	t.Run("invalid config", func(t *testing.T) {
+		dir := t.TempDir()
+		invalid := map[string]LogSinkConfig{
+			`unknown log format "xml"`:      {Output: filepath.Join(dir, "a.log"), Format: "xml"},
+			`unknown drop policy "random"`:  {Output: filepath.Join(dir, "b.log"), DropPolicy: "random"},
+			`not a valid logrus Level: "x"`: {Output: filepath.Join(dir, "c.log"), Level: "x"},
+			"output of log sink is missing": {},
+		}
+		for expected, sink := range invalid {
+			_, err := NewObs(Config{LogLevel: "info", LogSinks: []LogSinkConfig{sink}})
+			assert.EqualError(t, err, expected)
+		}
+	})
+	t.Run("started parts are closed if the setup fails", func(t *testing.T) {
+		goroutines := runtime.NumGoroutine()
+		_, err := NewObs(Config{
+			LogLevel:        "info",
+			LogSinks:        []LogSinkConfig{{Output: filepath.Join(t.TempDir(), "app.log")}},
+			TracingExporter: TracingExporterStdout,
+			MetricsBackend:  "unknown",
+			MetricsURL:      "localhost:1234",
+		})
+		assert.EqualError(t, err, `unknown metrics backend "unknown"`)
+		// assert.Eventually can not be used since it runs the condition in another goroutine.
+		for i := 0; i < 100 && runtime.NumGoroutine() > goroutines; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.LessOrEqual(t, runtime.NumGoroutine(), goroutines, "the log sink and the tracer were stopped")
+	})
+}
+
+func TestAsyncWriter(t *testing.T) {
+	t.Run("writes in the background", func(t *testing.T) {
+		output := &syncBuffer{}
+		writer, err := NewAsyncWriter(output, 10, "")
+		require.NoError(t, err)
+		_, _ = writer.Write([]byte("first\n"))
+		_, _ = writer.Write([]byte("second\n"))
+		require.NoError(t, writer.Flush(context.Background()))
+		assert.Equal(t, "first\nsecond\n", output.String())
+
+		require.NoError(t, writer.Close(context.Background()))
+		_, _ = writer.Write([]byte("after close\n"))
+		assert.Equal(t, uint64(1), writer.Dropped())
+	})
+
+	policies := map[string]string{
+		DropNewest: "1\n2\n",
+		DropOldest: "1\n4\n",
+		Block:      "1\n2\n3\n4\n",
+	}
+	for policy, expected := range policies {
+		t.Run(policy, func(t *testing.T) {
+			output := &blockingWriter{unblock: make(chan struct{}), started: make(chan struct{})}
+			writer, err := NewAsyncWriter(output, 1, policy)
+			require.NoError(t, err)
+
+			// The first write is taken by the background writer which is blocked, the second one fills the buffer.
+			_, _ = writer.Write([]byte("1\n"))
+			<-output.started
+			_, _ = writer.Write([]byte("2\n"))
+
+			if policy == Block {
+				go func() {
+					time.Sleep(10 * time.Millisecond)
+					close(output.unblock)
+				}()
+			}
+			_, _ = writer.Write([]byte("3\n"))
+			_, _ = writer.Write([]byte("4\n"))
+			if policy != Block {
+				close(output.unblock)
+			}
+
+			require.NoError(t, writer.Close(context.Background()))
+			assert.Equal(t, expected, output.String())
+			assert.True(t, output.closed)
+		})
+	}
+	t.Run("close is not blocked by a blocked write", func(t *testing.T) {
+		output := &blockingWriter{unblock: make(chan struct{}), started: make(chan struct{})}
+		defer close(output.unblock)
+		writer, err := NewAsyncWriter(output, 1, Block)
+		require.NoError(t, err)
+		_, _ = writer.Write([]byte("1\n"))
+		<-output.started
+		_, _ = writer.Write([]byte("2\n"))
+
+		written := make(chan struct{})
+		go func() {
+			_, _ = writer.Write([]byte("3\n"))
+			close(written)
+		}()
+		time.Sleep(10 * time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		closed := make(chan error)
+		go func() { closed <- writer.Close(ctx) }()
+		select {
+		case err := <-closed:
+			assert.Equal(t, context.DeadlineExceeded, err)
+		case <-time.After(2 * time.Second):
+			t.Fatal("close did not return")
+		}
+		<-written
+		assert.Equal(t, uint64(1), writer.Dropped())
+	})
+}
+
+func TestRotatingFile(t *testing.T) {
+	t.Run("rotates and compresses", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "app.log")
+		file, err := NewRotatingFile(RotatingFileConfig{Path: path, MaxSize: 10, Compress: true})
+		require.NoError(t, err)
+		now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+		file.now = func() time.Time { return now }
+
+		_, err = file.Write([]byte("12345678\n"))
+		require.NoError(t, err)
+		_, err = file.Write([]byte("abcdefgh\n"))
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+
+		assert.Equal(t, []string{"app-2020-06-01T12-00-00.000.log.gz", "app.log"}, fileNames(t, dir))
+		current, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "abcdefgh\n", string(current))
+
+		compressed, err := ioutil.ReadFile(filepath.Join(dir, "app-2020-06-01T12-00-00.000.log.gz"))
+		require.NoError(t, err)
+		reader, err := gzip.NewReader(bytes.NewReader(compressed))
+		require.NoError(t, err)
+		content, err := ioutil.ReadAll(reader)
+		require.NoError(t, err)
+		assert.Equal(t, "12345678\n", string(content))
+	})
+
+	t.Run("removes old backups", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "app.log")
+		file, err := NewRotatingFile(RotatingFileConfig{Path: path, MaxSize: 1, MaxBackups: 2, MaxAge: 3 * time.Hour})
+		require.NoError(t, err)
+		now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+		file.now = func() time.Time { return now }
+
+		for i := 0; i < 4; i++ {
+			_, err = file.Write([]byte("x"))
+			require.NoError(t, err)
+			now = now.Add(time.Hour)
+		}
+		require.NoError(t, file.Close())
+		assert.Equal(t, []string{"app-2020-06-01T14-00-00.000.log", "app-2020-06-01T15-00-00.000.log", "app.log"}, fileNames(t, dir))
+
+		// Appends to an existing file and respects its size.
+		file, err = NewRotatingFile(RotatingFileConfig{Path: path, MaxSize: 1, MaxAge: 30 * time.Minute})
+		require.NoError(t, err)
+		file.now = func() time.Time { return now }
+		_, err = file.Write([]byte("y"))
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+		assert.Equal(t, []string{"app-2020-06-01T16-00-00.000.log", "app.log"}, fileNames(t, dir))
+	})
+
+	t.Run("rotations within the same millisecond keep all backups", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "app.log")
+		file, err := NewRotatingFile(RotatingFileConfig{Path: path, MaxSize: 1, MaxBackups: 2})
+		require.NoError(t, err)
+		now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+		file.now = func() time.Time { return now }
+
+		for _, line := range []string{"a", "b", "c", "d"} {
+			_, err = file.Write([]byte(line))
+			require.NoError(t, err)
+		}
+		require.NoError(t, file.Close())
+
+		// The oldest backup "a" was removed, "b" and "c" are the newest ones.
+		assert.Equal(t, []string{"app-2020-06-01T12-00-00.000-1.log", "app-2020-06-01T12-00-00.000-2.log", "app.log"}, fileNames(t, dir))
+		assert.Equal(t, []string{"b"}, readFileLines(t, filepath.Join(dir, "app-2020-06-01T12-00-00.000-1.log")))
+		assert.Equal(t, []string{"c"}, readFileLines(t, filepath.Join(dir, "app-2020-06-01T12-00-00.000-2.log")))
+		assert.Equal(t, []string{"d"}, readFileLines(t, path))
+	})
+}
+
+func TestRotatingFileErrors(t *testing.T) {
+	t.Run("keeps writing if the rotation fails", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "app.log")
+		file, err := NewRotatingFile(RotatingFileConfig{Path: path, MaxSize: 5})
+		require.NoError(t, err)
+		now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+		file.now = func() time.Time { return now }
+
+		// A non-empty directory with the name of the backup makes the rename fail.
+		blocker := filepath.Join(dir, "app-2020-06-01T12-00-00.000.log")
+		require.NoError(t, os.MkdirAll(filepath.Join(blocker, "dir"), 0755))
+
+		_, err = file.Write([]byte("1234\n"))
+		require.NoError(t, err)
+		n, err := file.Write([]byte("abcd\n"))
+		assert.Equal(t, 5, n)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "could not rename log file for rotation")
+
+		_, err = file.Write([]byte("efgh\n"))
+		assert.NoError(t, err, "rotation is not retried immediately")
+
+		require.NoError(t, os.RemoveAll(blocker))
+		now = now.Add(rotationRetryDelay)
+		_, err = file.Write([]byte("ijkl\n"))
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+
+		assert.Equal(t, []string{"1234", "abcd", "efgh"}, readFileLines(t, filepath.Join(dir, "app-2020-06-01T12-01-00.000.log")))
+		assert.Equal(t, []string{"ijkl"}, readFileLines(t, path))
+	})
+
+	t.Run("reports cleanup errors", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "app.log")
+		file, err := NewRotatingFile(RotatingFileConfig{Path: path, MaxSize: 1, Compress: true})
+		require.NoError(t, err)
+		now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+		file.now = func() time.Time { return now }
+		cleanupErrors := make(chan error, 10)
+		file.onCleanupError = func(err error) { cleanupErrors <- err }
+
+		// The compressed file can not be created if a directory with its name exists.
+		require.NoError(t, os.Mkdir(filepath.Join(dir, "app-2020-06-01T12-00-00.000.log.gz"), 0755))
+		_, err = file.Write([]byte("a"))
+		require.NoError(t, err)
+		_, err = file.Write([]byte("b"))
+		require.NoError(t, err, "the write does not fail because of the compression")
+		require.NoError(t, file.Close())
+
+		require.Len(t, cleanupErrors, 1)
+		assert.Contains(t, (<-cleanupErrors).Error(), "could not create compressed log file")
+		assert.Equal(t, []string{"b"}, readFileLines(t, path))
+	})
+}
+
+func readFileLines(t *testing.T, path string) []string {
+	content, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	return strings.Split(strings.TrimSpace(string(content)), "\n")
+}
+
+func fileNames(t *testing.T, dir string) []string {
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	names := []string{}
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+type syncBuffer struct {
+	buffer bytes.Buffer
+	mutex  sync.Mutex
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.String()
+}
+
+// blockingWriter blocks all writes until unblock is closed.
+type blockingWriter struct {
+	syncBuffer
+	unblock chan struct{}
+	started chan struct{}
+	once    sync.Once
+	closed  bool
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() { close(w.started) })
+	<-w.unblock
+	return w.syncBuffer.Write(p)
+}
+
+func (w *blockingWriter) Close() error {
+	w.closed = true
+	return nil
+}
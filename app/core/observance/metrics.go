@@ -1,51 +1,109 @@
 package observance
 
 import (
+	"context"
+	"net/http"
 	"os"
+	"runtime"
+	"sort"
+	"sync"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/prometheus/client_golang/prometheus/push"
 )
 
 // Measurer defines the generic interface capturing metrics.
+// The methods accepting labels should only be used with label values from a small, bounded set
+// (e.g. operation names or status codes) and always with the same label names for a given metric name.
 type Measurer interface {
 	Increment(name string)
+	IncrementWithLabels(name string, labels Labels)
 	SetGauge(name string, value float64)
 	SetGaugeInt64(name string, value int64)
+	SetGaugeWithLabels(name string, value float64, labels Labels)
 	DurationSince(name string, start time.Time)
+	Observe(name string, value float64, labels Labels)
+	ObserveDurationSince(name string, start time.Time, labels Labels)
 }
 
+// Labels is a type alias to ease reading.
+type Labels = map[string]string
+
 // PrometheusMetrics is an implementation of Measurer.
 type PrometheusMetrics struct {
-	registry *prometheus.Registry
-	pusher   *push.Pusher
-	gauges   map[string]prometheus.Gauge
-	counters map[string]prometheus.Counter
-	logger   Logger
+	registry    *prometheus.Registry
+	pusher      *push.Pusher
+	gauges      map[string]prometheus.Gauge
+	counters    map[string]prometheus.Counter
+	gaugeVecs   map[string]*prometheus.GaugeVec
+	counterVecs map[string]*prometheus.CounterVec
+	histograms  map[string]*prometheus.HistogramVec
+	logger      Logger
+	mutex       sync.Mutex
+	// deleteOnClose defines whether the metrics of the grouping are deleted from the Pushgateway in Close.
+	deleteOnClose bool
+	// pushing is set if continuouslyPush was started, Close waits for it to stop then.
+	pushing  bool
+	stop     chan struct{}
+	stopped  chan struct{}
+	stopOnce sync.Once
 }
 
+const (
+	// defaultFlushInterval is used if no valid flush interval was provided.
+	defaultFlushInterval = 10 * time.Second
+	// maxPushBackoff is the upper limit for the time between two pushes after push failures.
+	maxPushBackoff = 5 * time.Minute
+)
+
 // NewPrometheusMetrics creates a new metrics instance to collect metrics.
+// The metrics are pushed to the Pushgateway in the given interval (default 10s) until Close is called.
 func NewPrometheusMetrics(url, appName string, flushInterval time.Duration, logger Logger) *PrometheusMetrics {
+	if flushInterval <= 0 {
+		flushInterval = defaultFlushInterval
+	}
+
+	m := newPrometheusMetrics(url, appName, logger)
+	m.pushing = true
+	ticker := time.NewTicker(flushInterval)
+	go func() {
+		defer ticker.Stop()
+		m.continuouslyPush(flushInterval, ticker.C)
+	}()
+
+	return m
+}
+
+// newPrometheusMetrics creates the metrics instance without starting the pushes.
+func newPrometheusMetrics(url, appName string, logger Logger) *PrometheusMetrics {
 	registry := prometheus.NewRegistry()
 
 	pusher := push.New(url, appName).
 		Grouping("instance", hostName()).
 		Gatherer(registry)
 
-	go continuouslyPush(pusher, flushInterval, logger)
-
 	return &PrometheusMetrics{
-		registry: registry,
-		pusher:   pusher,
-		gauges:   make(map[string]prometheus.Gauge),
-		counters: make(map[string]prometheus.Counter),
-		logger:   logger,
+		registry:    registry,
+		pusher:      pusher,
+		gauges:      make(map[string]prometheus.Gauge),
+		counters:    make(map[string]prometheus.Counter),
+		gaugeVecs:   make(map[string]*prometheus.GaugeVec),
+		counterVecs: make(map[string]*prometheus.CounterVec),
+		histograms:  make(map[string]*prometheus.HistogramVec),
+		logger:      logger,
+		stop:        make(chan struct{}),
+		stopped:     make(chan struct{}),
 	}
 }
 
 // Increment is used to count occurances. It can only be used for values that never decrease.
 func (m *PrometheusMetrics) Increment(name string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
 	counter, ok := m.counters[name]
 	if !ok {
 		counter = prometheus.NewCounter(prometheus.CounterOpts{
@@ -57,8 +115,34 @@ func (m *PrometheusMetrics) Increment(name string) {
 	counter.Inc()
 }
 
+// IncrementWithLabels is used to count occurances per label combination.
+// The label names of the first call determine the label names of the metric.
+func (m *PrometheusMetrics) IncrementWithLabels(name string, labels Labels) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	counterVec, ok := m.counterVecs[name]
+	if !ok {
+		counterVec = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: name,
+		}, labelNames(labels))
+		m.counterVecs[name] = counterVec
+		m.register(name, counterVec)
+	}
+
+	counter, err := counterVec.GetMetricWith(labels)
+	if err != nil {
+		m.logInvalidLabels(name, err)
+		return
+	}
+	counter.Inc()
+}
+
 // SetGauge is used to track a float64 value over time.
 func (m *PrometheusMetrics) SetGauge(name string, value float64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
 	gauge, ok := m.gauges[name]
 	if !ok {
 		gauge = prometheus.NewGauge(prometheus.GaugeOpts{
@@ -73,6 +157,9 @@ func (m *PrometheusMetrics) SetGauge(name string, value float64) {
 // SetGaugeInt64 is used to track an int64 value over time.
 // The integer value will be converted to a float to fit the prometheus API.
 func (m *PrometheusMetrics) SetGaugeInt64(name string, value int64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
 	gauge, ok := m.gauges[name]
 	if !ok {
 		gauge = prometheus.NewGauge(prometheus.GaugeOpts{
@@ -84,6 +171,29 @@ func (m *PrometheusMetrics) SetGaugeInt64(name string, value int64) {
 	gauge.Set(float64(value))
 }
 
+// SetGaugeWithLabels is used to track a float64 value over time per label combination.
+// The label names of the first call determine the label names of the metric.
+func (m *PrometheusMetrics) SetGaugeWithLabels(name string, value float64, labels Labels) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	gaugeVec, ok := m.gaugeVecs[name]
+	if !ok {
+		gaugeVec = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: name,
+		}, labelNames(labels))
+		m.gaugeVecs[name] = gaugeVec
+		m.register(name, gaugeVec)
+	}
+
+	gauge, err := gaugeVec.GetMetricWith(labels)
+	if err != nil {
+		m.logInvalidLabels(name, err)
+		return
+	}
+	gauge.Set(value)
+}
+
 // DurationSince is a utility method that accepts a metrics name and start time.
 // It then calculates the duration between the start time and now.
 // The result is converted to milliseconds and then tracked using SetGauge.
@@ -92,20 +202,186 @@ func (m *PrometheusMetrics) DurationSince(name string, start time.Time) {
 	m.SetGauge(name, durationInMs)
 }
 
+// Observe adds a value to the distribution (histogram) with the given name.
+// The default Prometheus buckets are used which are suited for durations in seconds.
+// The label names of the first call determine the label names of the metric.
+func (m *PrometheusMetrics) Observe(name string, value float64, labels Labels) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	histogramVec, ok := m.histograms[name]
+	if !ok {
+		histogramVec = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    name,
+			Buckets: prometheus.DefBuckets,
+		}, labelNames(labels))
+		m.histograms[name] = histogramVec
+		m.register(name, histogramVec)
+	}
+
+	histogram, err := histogramVec.GetMetricWith(labels)
+	if err != nil {
+		m.logInvalidLabels(name, err)
+		return
+	}
+	histogram.Observe(value)
+}
+
+// ObserveDurationSince is a utility method that calculates the duration between the start time and now.
+// The result in seconds is added to the distribution (histogram) with the given name using Observe.
+func (m *PrometheusMetrics) ObserveDurationSince(name string, start time.Time, labels Labels) {
+	m.Observe(name, time.Since(start).Seconds(), labels)
+}
+
+// RegisterRuntimeCollectors adds the standard Go runtime collector (memory, goroutines, GC)
+// and the process collector (CPU, file descriptors, resident memory) to the registry.
+func (m *PrometheusMetrics) RegisterRuntimeCollectors() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.register("go_collector", prometheus.NewGoCollector())
+	m.register("process_collector", prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+}
+
+// Handler returns an HTTP handler that serves all registered metrics in the Prometheus text format,
+// so they can also be scraped in addition to being pushed.
+func (m *PrometheusMetrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// RegisterBuildInfo adds the gauge "build_info" with the constant value 1 to the registry.
+// It carries the app name, the version, the Go version and the VCS revision the binary was built from as labels.
+func (m *PrometheusMetrics) RegisterBuildInfo(appName string, version string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	buildInfo := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "build_info",
+		Help: "A metric with a constant '1' value labeled by app name, version, Go version and VCS revision.",
+		ConstLabels: prometheus.Labels{
+			"app":       appName,
+			"version":   version,
+			"goversion": runtime.Version(),
+			"revision":  vcsRevisionOrUnknown(),
+		},
+	})
+	buildInfo.Set(1)
+	m.register("build_info", buildInfo)
+}
+
 func (m *PrometheusMetrics) register(name string, collector prometheus.Collector) {
 	if err := m.registry.Register(collector); err != nil {
 		m.logger.WithField("metric", name).WithError(err).Error("failed to register metric")
 	}
 }
 
-// continuouslyPush calls the Add method of pusher periodically so the metrics get pushed to Prometheus.
-func continuouslyPush(pusher *push.Pusher, flushInterval time.Duration, logger Logger) {
-	for range time.Tick(flushInterval) {
-		err := pusher.Add()
-		if err != nil {
-			logger.WithError(err).Error("failed to push metrics")
+func (m *PrometheusMetrics) logInvalidLabels(name string, err error) {
+	m.logger.WithField("metric", name).WithError(err).Error("labels do not match the registered metric")
+}
+
+// labelNames returns the sorted names of the given labels.
+func labelNames(labels Labels) []string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Close stops pushing the metrics periodically and does a final push so metrics recorded shortly
+// before the shutdown are not lost. If deleting was activated, the metrics of the grouping are removed
+// from the Pushgateway afterwards. Close returns early with the context error if the context is done first.
+func (m *PrometheusMetrics) Close(ctx context.Context) error {
+	m.stopOnce.Do(func() {
+		close(m.stop)
+	})
+
+	if m.pushing {
+		select {
+		case <-m.stopped:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		result <- m.flush()
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// flush pushes the metrics one last time and deletes them afterwards if configured.
+func (m *PrometheusMetrics) flush() error {
+	if err := m.pusher.Push(); err != nil {
+		return errors.Wrap(err, "final push of metrics failed")
+	}
+
+	if !m.deleteOnClose {
+		return nil
+	}
+
+	if err := m.pusher.Delete(); err != nil {
+		return errors.Wrap(err, "deleting metrics failed")
+	}
+	return nil
+}
+
+// continuouslyPush calls the Add method of pusher on every tick until Close is called, so the metrics get
+// pushed to Prometheus. The ticks are passed in so tests can control them. After a failed push the ticks are
+// skipped for an exponentially growing time (up to maxPushBackoff) so an unavailable Pushgateway does not
+// lead to an error log every interval.
+func (m *PrometheusMetrics) continuouslyPush(flushInterval time.Duration, ticks <-chan time.Time) {
+	defer close(m.stopped)
+
+	failures := 0
+	var now, nextPush time.Time
+	for {
+		select {
+		case <-m.stop:
+			return
+		case now = <-ticks:
+			if now.Before(nextPush) {
+				continue
+			}
+		}
+
+		err := m.pusher.Add()
+		if err == nil {
+			if failures > 0 {
+				m.logger.WithField("failures", failures).Info("pushing metrics succeeded again")
+			}
+			failures = 0
+			continue
+		}
+
+		failures++
+		backoff := pushBackoff(flushInterval, failures)
+		nextPush = now.Add(backoff)
+		m.logger.WithFields(Fields{
+			"failures": failures,
+			"retryIn":  backoff.String(),
+		}).WithError(err).Error("failed to push metrics")
+	}
+}
+
+// pushBackoff returns the exponentially increasing waiting time after the given number of consecutive failures.
+func pushBackoff(flushInterval time.Duration, failures int) time.Duration {
+	wait := flushInterval
+	for i := 0; i < failures; i++ {
+		wait *= 2
+		if wait >= maxPushBackoff {
+			return maxPushBackoff
 		}
 	}
+	return wait
 }
 
 func hostName() string {
@@ -1,9 +1,12 @@
 package observance
 
 import (
+	"context"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"runtime"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -36,6 +39,131 @@ func TestNewPrometheusMetrics(t *testing.T) {
 	})
 }
 
+func TestClose(t *testing.T) {
+	t.Run("final push", func(t *testing.T) {
+		var methods []string
+		var mutex sync.Mutex
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			methods = append(methods, r.Method)
+			assertBodyContains(t, r, "test_metric")
+			w.WriteHeader(http.StatusAccepted)
+		}))
+		defer ts.Close()
+
+		m := NewPrometheusMetrics(ts.URL, "test-app", time.Hour, NewTestLogger())
+		m.Increment("test_metric")
+
+		err := m.Close(context.Background())
+		assert.NoError(t, err)
+		mutex.Lock()
+		assert.Equal(t, []string{http.MethodPut}, methods)
+		mutex.Unlock()
+
+		// Further calls only push again.
+		err = m.Close(context.Background())
+		assert.NoError(t, err)
+		mutex.Lock()
+		assert.Equal(t, []string{http.MethodPut, http.MethodPut}, methods)
+		mutex.Unlock()
+	})
+
+	t.Run("final push and delete", func(t *testing.T) {
+		var methods []string
+		var mutex sync.Mutex
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			methods = append(methods, r.Method)
+			w.WriteHeader(http.StatusAccepted)
+		}))
+		defer ts.Close()
+
+		m := NewPrometheusMetrics(ts.URL, "test-app", time.Hour, NewTestLogger())
+		m.deleteOnClose = true
+
+		err := m.Close(context.Background())
+		assert.NoError(t, err)
+		mutex.Lock()
+		assert.Equal(t, []string{http.MethodPut, http.MethodDelete}, methods)
+		mutex.Unlock()
+	})
+
+	t.Run("push fails", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer ts.Close()
+
+		m := NewPrometheusMetrics(ts.URL, "test-app", time.Hour, NewTestLogger())
+		err := m.Close(context.Background())
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "final push of metrics failed")
+	})
+
+	t.Run("context done", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(100 * time.Millisecond)
+			w.WriteHeader(http.StatusAccepted)
+		}))
+		defer ts.Close()
+
+		m := NewPrometheusMetrics(ts.URL, "test-app", time.Hour, NewTestLogger())
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		err := m.Close(ctx)
+		assert.Equal(t, context.DeadlineExceeded, err)
+	})
+}
+
+func TestPushBackoff(t *testing.T) {
+	t.Run("backoff grows exponentially up to the maximum", func(t *testing.T) {
+		assert.Equal(t, 2*time.Second, pushBackoff(time.Second, 1))
+		assert.Equal(t, 8*time.Second, pushBackoff(time.Second, 3))
+		assert.Equal(t, maxPushBackoff, pushBackoff(time.Second, 20))
+	})
+
+	t.Run("failing pushes are retried less often", func(t *testing.T) {
+		var callCounter uint64
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddUint64(&callCounter, 1)
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer ts.Close()
+
+		logger := NewTestLogger()
+		m := newPrometheusMetrics(ts.URL, "test-app", logger)
+		ticks := make(chan time.Time)
+		go m.continuouslyPush(time.Second, ticks)
+
+		// Without backoff every tick would push, with backoff the pushes happen after 1s, 3s (+2s) and 7s (+4s).
+		start := time.Now()
+		for i := 1; i <= 10; i++ {
+			ticks <- start.Add(time.Duration(i) * time.Second)
+		}
+		m.stopOnce.Do(func() { close(m.stop) })
+		<-m.stopped
+
+		assert.Equal(t, uint64(3), atomic.LoadUint64(&callCounter))
+		assert.Equal(t, "failed to push metrics", logger.LastEntry().Message)
+	})
+}
+
+func TestPrometheusMetricsClose(t *testing.T) {
+	t.Run("returns without waiting if pushing was not started", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+		}))
+		defer ts.Close()
+
+		m := newPrometheusMetrics(ts.URL, "test-app", NewTestLogger())
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		assert.NoError(t, m.Close(ctx))
+	})
+}
+
 func TestMetricTypes(t *testing.T) {
 	var m Measurer
 	cases := []struct {
@@ -58,6 +186,22 @@ func TestMetricTypes(t *testing.T) {
 			"DurationSince",
 			func(name string) { m.DurationSince(name, time.Now()) },
 		},
+		{
+			"IncrementWithLabels",
+			func(name string) { m.IncrementWithLabels(name, Labels{"operation": "get"}) },
+		},
+		{
+			"SetGaugeWithLabels",
+			func(name string) { m.SetGaugeWithLabels(name, 123.456, Labels{"operation": "get"}) },
+		},
+		{
+			"Observe",
+			func(name string) { m.Observe(name, 0.3, nil) },
+		},
+		{
+			"ObserveDurationSince",
+			func(name string) { m.ObserveDurationSince(name, time.Now(), Labels{"operation": "get"}) },
+		},
 	}
 
 	for _, test := range cases {
@@ -78,7 +222,74 @@ func TestMetricTypes(t *testing.T) {
 	}
 }
 
-func TestMeasurer(t *testing.T) {
+func TestMetricsWithLabels(t *testing.T) {
+	t.Run("values per label combination", func(t *testing.T) {
+		logger := NewTestLogger()
+		m := NewPrometheusMetrics("http://localhost", "test-app", time.Hour, logger)
+
+		m.IncrementWithLabels("test_total", Labels{"operation": "get", "result": "hit"})
+		m.IncrementWithLabels("test_total", Labels{"result": "hit", "operation": "get"})
+		m.IncrementWithLabels("test_total", Labels{"operation": "get", "result": "miss"})
+		m.Observe("test_duration_seconds", 0.2, Labels{"operation": "get"})
+
+		families, err := m.registry.Gather()
+		assert.NoError(t, err)
+		assert.Len(t, families, 2)
+		assert.Equal(t, "test_duration_seconds", families[0].GetName())
+		assert.Equal(t, uint64(1), families[0].GetMetric()[0].GetHistogram().GetSampleCount())
+		assert.Equal(t, "test_total", families[1].GetName())
+		assert.Len(t, families[1].GetMetric(), 2)
+		assert.Equal(t, float64(2), families[1].GetMetric()[0].GetCounter().GetValue())
+		assert.Empty(t, logger.Entries())
+	})
+
+	t.Run("labels not matching the first call are logged", func(t *testing.T) {
+		logger := NewTestLogger()
+		m := NewPrometheusMetrics("http://localhost", "test-app", time.Hour, logger)
+
+		m.IncrementWithLabels("test_total", Labels{"operation": "get"})
+		m.IncrementWithLabels("test_total", Labels{"other": "get"})
+
+		assert.Equal(t, "labels do not match the registered metric", logger.LastEntry().Message)
+		assert.Equal(t, "test_total", logger.LastEntry().Data["metric"])
+	})
+}
+
+func TestRuntimeCollectorsAndBuildInfo(t *testing.T) {
+	logger := NewTestLogger()
+	m := NewPrometheusMetrics("http://localhost", "test-app", time.Hour, logger)
+	m.RegisterBuildInfo("test-app", "1.2.3")
+	m.RegisterRuntimeCollectors()
+
+	families, err := m.registry.Gather()
+	assert.NoError(t, err)
+	assert.Empty(t, logger.Entries())
+
+	names := map[string]bool{}
+	for _, family := range families {
+		names[family.GetName()] = true
+		if family.GetName() != "build_info" {
+			continue
+		}
+
+		metric := family.GetMetric()[0]
+		assert.Equal(t, float64(1), metric.GetGauge().GetValue())
+		labels := map[string]string{}
+		for _, label := range metric.GetLabel() {
+			labels[label.GetName()] = label.GetValue()
+		}
+		assert.Equal(t, "test-app", labels["app"])
+		assert.Equal(t, "1.2.3", labels["version"])
+		assert.Equal(t, runtime.Version(), labels["goversion"])
+		assert.NotEmpty(t, labels["revision"])
+	}
+
+	assert.True(t, names["build_info"])
+	assert.True(t, names["go_goroutines"])
+	assert.True(t, names["go_memstats_alloc_bytes"])
+}
+
+func TestPrometheusMeasurer(t *testing.T) {
 	assert.Implements(t, (*Measurer)(nil), &PrometheusMetrics{})
 }
 
@@ -1,38 +1,70 @@
 package observance
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"os"
 	"runtime/debug"
 	"time"
 )
 
 // Config contains all config variables for setting up observability (logging, metrics).
 type Config struct {
-	AppName              string
-	LogLevel             string
-	SentryURL            string
-	Version              string
+	AppName   string
+	LogLevel  string
+	SentryURL string
+	Version   string
+	// MetricsBackend selects where the metrics are sent to: MetricsBackendPrometheus (default),
+	// MetricsBackendStatsD or MetricsBackendDogStatsD.
+	MetricsBackend string
+	// MetricsURL is the URL of the Prometheus Pushgateway or the StatsD agent ("udp://host:port" or "unix:///path").
 	MetricsURL           string
 	MetricsFlushInterval time.Duration
+	// MetricsDeleteOnShutdown defines whether the metrics of this instance are deleted from the Pushgateway when Close is called.
+	MetricsDeleteOnShutdown bool
+	// MetricsRuntimeCollectors activates the standard Go runtime and process metrics (memory, goroutines, GC etc.).
+	MetricsRuntimeCollectors bool
+	// TracingExporter activates tracing and defines where the spans are sent to: TracingExporterStdout,
+	// TracingExporterFile or TracingExporterOTLP. Tracing is disabled if it is empty.
+	TracingExporter string
+	// TracingURL is the file path for TracingExporterFile or the collector endpoint for TracingExporterOTLP.
+	TracingURL string
+	// TracingHeaders are sent with every request to the OTLP collector, e.g. for authentication (optional).
+	TracingHeaders map[string]string
 	// LoggedHeaders is map of header names and log field names. If those headers are present in the request,
 	// the method CopyWithRequest will add them to the logger with the given field name.
 	// E.g. map[string]string{"FastBill-RequestId": "requestId"} means that if the header "FastBill-RequestId" was found
 	// in the request headers the value will be added to the logger under the name "requestId".
 	LoggedHeaders map[string]string
+	// LogSinks replace the default output of the logger (stdout) with one or more sinks that have their own
+	// level and format, e.g. JSON to stdout and warnings to a rotating file (optional).
+	LogSinks []LogSinkConfig
 }
 
+// Available metrics backends.
+const (
+	MetricsBackendPrometheus = "prometheus"
+	MetricsBackendStatsD     = "statsd"
+	MetricsBackendDogStatsD  = "dogstatsd"
+)
+
 // Obs is a wrapper for all things that helps to observe the operation of
 // the service: logging, monitoring, tracing
 type Obs struct {
 	Logger        Logger
 	Metrics       Measurer
+	Tracer        *Tracer
 	loggedHeaders map[string]string
+	logSinks      []*AsyncWriter
 }
 
 // NewObs creates a new observance instance for logging.
 // Optional: If a Sentry URL was provided logs with level error will be sent to Sentry.
-// Optional: If a metrics URL was provided a Prometheus Pushgateway metrics can be captured.
+// Optional: If a tracing exporter was provided spans are created and exported.
+// Optional: If a metrics URL was provided metrics can be captured and sent to the configured backend.
+// For the Prometheus Pushgateway the "build_info" metric is always registered, the Go runtime and process metrics
+// only if activated in the config.
 func NewObs(config Config) (*Obs, error) {
 	log, err := NewLogrus(config.LogLevel, config.AppName, config.SentryURL, config.Version)
 	if err != nil {
@@ -44,11 +76,51 @@ func NewObs(config Config) (*Obs, error) {
 		loggedHeaders: config.LoggedHeaders,
 	}
 
+	if len(config.LogSinks) > 0 {
+		obs.logSinks, err = setUpLogSinks(log, config.LogSinks)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// closeAll stops the parts that were already started if a later part can not be set up.
+	closeAll := func(err error) (*Obs, error) {
+		_ = obs.Close(context.Background())
+		return nil, err
+	}
+
+	if config.TracingExporter != "" {
+		exporter, err := newSpanExporter(config)
+		if err != nil {
+			return closeAll(err)
+		}
+		obs.Tracer = NewTracer(config.AppName, exporter, log)
+	}
+
 	if config.MetricsURL == "" {
 		return obs, nil
 	}
 
+	switch config.MetricsBackend {
+	case MetricsBackendStatsD, MetricsBackendDogStatsD:
+		dogStatsD := config.MetricsBackend == MetricsBackendDogStatsD
+		metrics, err := NewStatsDMetrics(config.MetricsURL, config.AppName, dogStatsD, config.MetricsFlushInterval, log)
+		if err != nil {
+			return closeAll(err)
+		}
+		obs.Metrics = metrics
+		return obs, nil
+	case "", MetricsBackendPrometheus:
+	default:
+		return closeAll(fmt.Errorf("unknown metrics backend %q", config.MetricsBackend))
+	}
+
 	metrics := NewPrometheusMetrics(config.MetricsURL, config.AppName, config.MetricsFlushInterval, log)
+	metrics.deleteOnClose = config.MetricsDeleteOnShutdown
+	metrics.RegisterBuildInfo(config.AppName, config.Version)
+	if config.MetricsRuntimeCollectors {
+		metrics.RegisterRuntimeCollectors()
+	}
 	obs.Metrics = metrics
 	return obs, nil
 }
@@ -72,14 +144,106 @@ func (o *Obs) CopyWithRequest(r *http.Request) *Obs {
 		}
 	}
 
+	return obs.CopyWithContext(r.Context())
+}
+
+// CopyWithContext creates a new observance that adds the trace ID and span ID of the span
+// in the context to all log messages. If the context does not contain a span the observance is returned as is.
+func (o *Obs) CopyWithContext(ctx context.Context) *Obs {
+	spanContext := SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return o
+	}
+
+	obCopy := *o
+	obs := &obCopy
+	obs.Logger = obs.Logger.WithFields(Fields{
+		"traceId": spanContext.TraceID.String(),
+		"spanId":  spanContext.SpanID.String(),
+	})
 	return obs
 }
 
+// StartSpan starts a new span as child of the span in the context or as new trace.
+// If tracing was not set up, no span is created and the returned span is nil. Since all
+// methods of Span can be called on nil, the result can be used without checking.
+func (o *Obs) StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	if o.Tracer == nil {
+		return ctx, nil
+	}
+	return o.Tracer.Start(ctx, name, SpanKindInternal)
+}
+
+// Close shuts down the parts of the observance that run in the background, e.g. pushing the metrics.
+// It should be called when the service shuts down so the last metrics, spans and log entries are not lost.
+// The log sinks are closed last so entries logged while the other parts shut down are not lost.
+func (o *Obs) Close(ctx context.Context) error {
+	var firstErr error
+	if o.Tracer != nil {
+		firstErr = o.Tracer.Close(ctx)
+	}
+
+	if closer, ok := o.Metrics.(interface{ Close(context.Context) error }); ok {
+		if err := closer.Close(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	for _, sink := range o.logSinks {
+		if err := sink.Close(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// FlushLogs waits until all log entries were written to the log sinks.
+func (o *Obs) FlushLogs(ctx context.Context) error {
+	for _, sink := range o.logSinks {
+		if err := sink.Flush(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newSpanExporter creates the span exporter defined in the config.
+func newSpanExporter(config Config) (SpanExporter, error) {
+	switch config.TracingExporter {
+	case TracingExporterStdout:
+		return NewWriterExporter(os.Stdout), nil
+	case TracingExporterFile:
+		return NewFileExporter(config.TracingURL)
+	case TracingExporterOTLP:
+		return NewOTLPExporter(config.TracingURL, config.TracingHeaders), nil
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", config.TracingExporter)
+	}
+}
+
 // PanicRecover can be used to recover panics in the main thread and log the messages.
 func (o *Obs) PanicRecover() {
 	if r := recover(); r != nil {
 		// According to Russ Cox (leader of the Go team) capturing the stack trace here works:
 		// https://groups.google.com/d/msg/golang-nuts/MB8GyW5j2UY/m_YYy7mGYbIJ .
-		o.Logger.WithField("stack", string(debug.Stack())).Error(fmt.Sprintf("%v", r))
+		o.ReportPanic(r, debug.Stack())
+	}
+}
+
+// ReportPanic logs a recovered panic with its stack trace at error level, so it is also sent to Sentry if configured.
+func (o *Obs) ReportPanic(recovered interface{}, stack []byte) {
+	logger := o.Logger.WithField("stack", string(stack))
+	if err, ok := recovered.(error); ok {
+		logger = logger.WithError(err)
 	}
+	logger.Error(fmt.Sprintf("%v", recovered))
+}
+
+// Go runs the function in a new goroutine. Panics in the function are recovered and reported
+// like in PanicRecover instead of crashing the whole service.
+func (o *Obs) Go(fn func()) {
+	go func() {
+		defer o.PanicRecover()
+		fn()
+	}()
 }
@@ -2,8 +2,10 @@ package observance
 
 import (
 	"bytes"
+	"errors"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -68,3 +70,35 @@ func TestCopyWithRequest(t *testing.T) {
 	})
 
 }
+
+func TestGo(t *testing.T) {
+	logger := NewTestLogger()
+	obs := &Obs{Logger: logger}
+
+	done := make(chan struct{})
+	obs.Go(func() {
+		defer close(done)
+		panic(errors.New("boom"))
+	})
+	<-done
+
+	assert.Eventually(t, func() bool { return len(logger.Entries()) == 1 }, time.Second, time.Millisecond)
+	entry := logger.LastEntry()
+	assert.Equal(t, "error", entry.Level)
+	assert.Equal(t, "boom", entry.Message)
+	assert.Equal(t, "boom", entry.Data["error"].(error).Error())
+	assert.Contains(t, entry.Data["stack"], "TestGo")
+}
+
+func TestPanicRecover(t *testing.T) {
+	logger := NewTestLogger()
+	obs := &Obs{Logger: logger}
+
+	func() {
+		defer obs.PanicRecover()
+		panic("something went wrong")
+	}()
+
+	logger.AssertLogged(t, "error", "something went wrong", nil)
+	assert.Contains(t, logger.LastEntry().Data["stack"], "TestPanicRecover")
+}
@@ -0,0 +1,20 @@
+package observance
+
+import "context"
+
+type requestIDKey struct{}
+
+// ContextWithRequestID returns a copy of the context that contains the ID of the incoming request,
+// so it can be passed on to the services that are called while handling the request.
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext returns the request ID stored in the context or an empty string.
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
@@ -0,0 +1,334 @@
+package observance
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// defaultMaxLogFileSize is the size after which a log file is rotated if no size was configured.
+const defaultMaxLogFileSize = 100 * 1024 * 1024
+
+// rotationRetryDelay is the time after which a failed rotation is retried, the current file is used in the meantime.
+const rotationRetryDelay = time.Minute
+
+// backupTimeFormat is used in the names of rotated files, e.g. "app-2020-06-01T12-00-00.000.log".
+// Further rotations within the same millisecond get a counter suffix, e.g. "app-2020-06-01T12-00-00.000-1.log".
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// RotatingFileConfig defines when a log file is rotated and how long the rotated files are kept.
+type RotatingFileConfig struct {
+	Path string
+	// MaxSize is the size in bytes after which the file is rotated (default 100 MB).
+	MaxSize int64
+	// MaxAge is the duration after which rotated files are deleted, they are kept forever if it is 0.
+	MaxAge time.Duration
+	// MaxBackups is the number of rotated files that are kept, all are kept if it is 0.
+	MaxBackups int
+	// Compress defines whether rotated files are compressed with gzip.
+	Compress bool
+}
+
+// RotatingFile is an io.WriteCloser that writes to a file and rotates it when it reaches the maximum size.
+// The rotated files are renamed with a timestamp. They are compressed and old files are removed in the background,
+// so writes are not blocked. Errors of the background cleanup are printed to stderr.
+type RotatingFile struct {
+	config           RotatingFileConfig
+	file             *os.File
+	size             int64
+	retryRotationAt  time.Time
+	mutex            sync.Mutex
+	now              func() time.Time
+	onCleanupError   func(err error)
+	cleanups         chan time.Time
+	cleanupsFinished chan struct{}
+	closeOnce        sync.Once
+
+	// lastBackupTime and backupCounter make the names of rotations within the same millisecond unique.
+	lastBackupTime string
+	backupCounter  int
+}
+
+// NewRotatingFile opens or creates the file. New entries are appended if the file exists.
+func NewRotatingFile(config RotatingFileConfig) (*RotatingFile, error) {
+	if config.MaxSize <= 0 {
+		config.MaxSize = defaultMaxLogFileSize
+	}
+
+	f := &RotatingFile{
+		config:           config,
+		now:              time.Now,
+		onCleanupError:   printCleanupError,
+		cleanups:         make(chan time.Time, 1),
+		cleanupsFinished: make(chan struct{}),
+	}
+	if err := f.open(config.Path); err != nil {
+		return nil, err
+	}
+	go f.cleanUp()
+	return f, nil
+}
+
+// Write writes the data to the file, rotating it beforehand if the data would exceed the maximum size.
+// If the rotation fails, the data is still written to the current file and the rotation error is returned.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	var rotationErr error
+	if f.size > 0 && f.size+int64(len(p)) > f.config.MaxSize && !f.now().Before(f.retryRotationAt) {
+		rotationErr = f.rotate()
+		if f.file == nil {
+			return 0, rotationErr
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	if err != nil {
+		return n, err
+	}
+	return n, rotationErr
+}
+
+// Sync commits the content of the file to disk.
+func (f *RotatingFile) Sync() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Sync()
+}
+
+// Close closes the file and waits until the rotated files are compressed and cleaned up.
+func (f *RotatingFile) Close() error {
+	f.mutex.Lock()
+	var err error
+	if f.file != nil {
+		err = f.file.Close()
+		f.file = nil
+	}
+	f.mutex.Unlock()
+
+	f.closeOnce.Do(func() { close(f.cleanups) })
+	<-f.cleanupsFinished
+	return err
+}
+
+func (f *RotatingFile) open(path string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.Wrap(err, "could not open log file")
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return errors.Wrap(err, "could not read size of log file")
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+// rotate renames the current file, opens a new one and triggers the cleanup of the rotated files.
+// If the file can not be renamed or the new file can not be opened, the previous file is opened again
+// and the rotation is retried after rotationRetryDelay, so logging continues in the meantime.
+func (f *RotatingFile) rotate() error {
+	now := f.now()
+	if err := f.file.Close(); err != nil {
+		f.retryRotationAt = now.Add(rotationRetryDelay)
+		return errors.Wrap(err, "could not close log file for rotation")
+	}
+	f.file = nil
+
+	backup := f.backupName(now)
+	if err := os.Rename(f.config.Path, backup); err != nil {
+		return f.reopen(f.config.Path, now, errors.Wrap(err, "could not rename log file for rotation"))
+	}
+	if err := f.open(f.config.Path); err != nil {
+		return f.reopen(backup, now, err)
+	}
+
+	// Only the latest rotation time is needed, the cleanup handles all rotated files at once.
+	select {
+	case f.cleanups <- now:
+	default:
+		select {
+		case <-f.cleanups:
+		default:
+		}
+		f.cleanups <- now
+	}
+	return nil
+}
+
+// reopen opens the previous file after a failed rotation and returns the cause of the failure.
+func (f *RotatingFile) reopen(path string, now time.Time, cause error) error {
+	f.retryRotationAt = now.Add(rotationRetryDelay)
+	if err := f.open(path); err != nil {
+		return errors.Wrapf(err, "could not reopen log file after failed rotation (%v)", cause)
+	}
+	return cause
+}
+
+// cleanUp compresses and removes the rotated files after every rotation until the file is closed.
+func (f *RotatingFile) cleanUp() {
+	defer close(f.cleanupsFinished)
+	for now := range f.cleanups {
+		if f.config.Compress {
+			if err := f.compressBackups(); err != nil {
+				f.onCleanupError(err)
+			}
+		}
+		if err := f.removeOldBackups(now); err != nil {
+			f.onCleanupError(err)
+		}
+	}
+}
+
+func printCleanupError(err error) {
+	fmt.Fprintf(os.Stderr, "could not clean up rotated log files: %v\n", err)
+}
+
+// backupName adds the timestamp between the name and the extension of the file.
+// If the previous rotation had the same timestamp, a counter is appended so the backup is not overwritten.
+func (f *RotatingFile) backupName(t time.Time) string {
+	ext := filepath.Ext(f.config.Path)
+	base := strings.TrimSuffix(f.config.Path, ext)
+	timestamp := t.UTC().Format(backupTimeFormat)
+	if timestamp != f.lastBackupTime {
+		f.lastBackupTime = timestamp
+		f.backupCounter = 0
+		return base + "-" + timestamp + ext
+	}
+	f.backupCounter++
+	return base + "-" + timestamp + "-" + strconv.Itoa(f.backupCounter) + ext
+}
+
+// compressBackups compresses all rotated files that are not compressed yet.
+func (f *RotatingFile) compressBackups() error {
+	backups, err := f.backups()
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(f.config.Path)
+	for _, backup := range backups {
+		if !strings.HasSuffix(backup.name, ".gz") {
+			if err := compressFile(filepath.Join(dir, backup.name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// removeOldBackups deletes the rotated files that exceed MaxBackups or are older than MaxAge at the given time.
+func (f *RotatingFile) removeOldBackups(now time.Time) error {
+	if f.config.MaxBackups <= 0 && f.config.MaxAge <= 0 {
+		return nil
+	}
+
+	backups, err := f.backups()
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(f.config.Path)
+	for i, backup := range backups {
+		tooMany := f.config.MaxBackups > 0 && i >= f.config.MaxBackups
+		tooOld := f.config.MaxAge > 0 && now.Sub(backup.rotated) > f.config.MaxAge
+		if tooMany || tooOld {
+			if err := os.Remove(filepath.Join(dir, backup.name)); err != nil {
+				return errors.Wrap(err, "could not remove rotated log file")
+			}
+		}
+	}
+	return nil
+}
+
+type backupFile struct {
+	name    string
+	rotated time.Time
+	counter int
+}
+
+// backups returns the rotated files, the newest first.
+func (f *RotatingFile) backups() ([]backupFile, error) {
+	ext := filepath.Ext(f.config.Path)
+	prefix := filepath.Base(strings.TrimSuffix(f.config.Path, ext)) + "-"
+	dir := filepath.Dir(f.config.Path)
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not list rotated log files")
+	}
+
+	backups := []backupFile{}
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		timestamp := strings.TrimSuffix(strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".gz"), ext)
+		counter := 0
+		if len(timestamp) > len(backupTimeFormat) && timestamp[len(backupTimeFormat)] == '-' {
+			if counter, err = strconv.Atoi(timestamp[len(backupTimeFormat)+1:]); err != nil {
+				continue
+			}
+			timestamp = timestamp[:len(backupTimeFormat)]
+		}
+		rotated, err := time.Parse(backupTimeFormat, timestamp)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backupFile{name: name, rotated: rotated, counter: counter})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		if backups[i].rotated.Equal(backups[j].rotated) {
+			return backups[i].counter > backups[j].counter
+		}
+		return backups[i].rotated.After(backups[j].rotated)
+	})
+	return backups, nil
+}
+
+// compressFile replaces the file with a gzip compressed version.
+func compressFile(path string) (returnErr error) {
+	source, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "could not open rotated log file for compression")
+	}
+	defer source.Close()
+
+	target, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.Wrap(err, "could not create compressed log file")
+	}
+	defer func() {
+		if err := target.Close(); err != nil && returnErr == nil {
+			returnErr = err
+		}
+	}()
+
+	writer := gzip.NewWriter(target)
+	if _, err := io.Copy(writer, source); err != nil {
+		return errors.Wrap(err, "could not compress rotated log file")
+	}
+	if err := writer.Close(); err != nil {
+		return errors.Wrap(err, "could not compress rotated log file")
+	}
+	source.Close()
+	return os.Remove(path)
+}
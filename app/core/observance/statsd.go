@@ -0,0 +1,282 @@
+package observance
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxUDPPacketSize keeps UDP packets below the typical MTU to avoid fragmentation.
+	maxUDPPacketSize = 1432
+	// maxUnixPacketSize is the packet size recommended for DogStatsD over Unix domain sockets.
+	maxUnixPacketSize = 8192
+	// maxBufferedSamples is the number of histogram samples after which the buffer is flushed early.
+	maxBufferedSamples = 1000
+)
+
+// StatsDMetrics is an implementation of Measurer that sends the metrics to a StatsD or DogStatsD agent.
+// Counters are summed up and for gauges only the last value is kept until the metrics are flushed.
+// Observed values are buffered and sent individually since they can not be aggregated on the client side.
+// For DogStatsD the labels are sent as tags, for plain StatsD the label values are appended to the metric name.
+type StatsDMetrics struct {
+	conn          net.Conn
+	maxPacketSize int
+	namespace     string
+	dogStatsD     bool
+	counters      map[string]int64
+	gauges        map[string]float64
+	samples       []string
+	logger        Logger
+	mutex         sync.Mutex
+	stop          chan struct{}
+	stopped       chan struct{}
+	stopOnce      sync.Once
+}
+
+// NewStatsDMetrics creates a new metrics instance that sends the metrics to the StatsD agent at the given URL
+// in the given interval (default 10s) until Close is called. The URL can have the form "udp://host:port",
+// "unix:///path/to/socket" or "host:port". The app name is used as namespace for all metric names.
+// Set dogStatsD to true to send the labels as DogStatsD tags.
+func NewStatsDMetrics(agentURL string, appName string, dogStatsD bool, flushInterval time.Duration, logger Logger) (*StatsDMetrics, error) {
+	network, address, err := parseAgentURL(agentURL)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not connect to StatsD agent")
+	}
+
+	maxPacketSize := maxUDPPacketSize
+	if network == "unixgram" {
+		maxPacketSize = maxUnixPacketSize
+	}
+
+	if flushInterval <= 0 {
+		flushInterval = defaultFlushInterval
+	}
+
+	namespace := ""
+	if appName != "" {
+		namespace = sanitizeStatsD(appName) + "."
+	}
+
+	m := &StatsDMetrics{
+		conn:          conn,
+		maxPacketSize: maxPacketSize,
+		namespace:     namespace,
+		dogStatsD:     dogStatsD,
+		counters:      make(map[string]int64),
+		gauges:        make(map[string]float64),
+		logger:        logger,
+		stop:          make(chan struct{}),
+		stopped:       make(chan struct{}),
+	}
+
+	go m.continuouslyFlush(flushInterval)
+
+	return m, nil
+}
+
+// Increment is used to count occurances. It can only be used for values that never decrease.
+func (m *StatsDMetrics) Increment(name string) {
+	m.IncrementWithLabels(name, nil)
+}
+
+// IncrementWithLabels is used to count occurances per label combination.
+func (m *StatsDMetrics) IncrementWithLabels(name string, labels Labels) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.counters[m.metricName(name, labels)]++
+}
+
+// SetGauge is used to track a float64 value over time.
+func (m *StatsDMetrics) SetGauge(name string, value float64) {
+	m.SetGaugeWithLabels(name, value, nil)
+}
+
+// SetGaugeInt64 is used to track an int64 value over time.
+func (m *StatsDMetrics) SetGaugeInt64(name string, value int64) {
+	m.SetGaugeWithLabels(name, float64(value), nil)
+}
+
+// SetGaugeWithLabels is used to track a float64 value over time per label combination.
+func (m *StatsDMetrics) SetGaugeWithLabels(name string, value float64, labels Labels) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.gauges[m.metricName(name, labels)] = value
+}
+
+// DurationSince is a utility method that accepts a metrics name and start time.
+// It then calculates the duration between the start time and now.
+// The result is converted to milliseconds and then tracked using SetGauge.
+func (m *StatsDMetrics) DurationSince(name string, start time.Time) {
+	durationInMs := float64(time.Since(start).Round(time.Millisecond) / time.Millisecond)
+	m.SetGauge(name, durationInMs)
+}
+
+// Observe adds a value to the distribution with the given name. It is sent as histogram ("h"),
+// plain StatsD agents need to support histograms like DogStatsD, Telegraf or the Prometheus statsd_exporter.
+func (m *StatsDMetrics) Observe(name string, value float64, labels Labels) {
+	m.mutex.Lock()
+	m.samples = append(m.samples, m.line(m.metricName(name, labels), formatStatsDValue(value), "h"))
+	flushNow := len(m.samples) >= maxBufferedSamples
+	m.mutex.Unlock()
+
+	if flushNow {
+		m.flush()
+	}
+}
+
+// ObserveDurationSince is a utility method that calculates the duration between the start time and now.
+// The result is observed in seconds like with the Prometheus backend, see Observe.
+func (m *StatsDMetrics) ObserveDurationSince(name string, start time.Time, labels Labels) {
+	m.Observe(name, time.Since(start).Seconds(), labels)
+}
+
+// Close stops flushing the metrics periodically, sends the remaining metrics and closes the connection.
+// If the context is done first, the remaining metrics are dropped and the context error is returned.
+func (m *StatsDMetrics) Close(ctx context.Context) error {
+	m.stopOnce.Do(func() {
+		close(m.stop)
+	})
+
+	select {
+	case <-m.stopped:
+	case <-ctx.Done():
+		_ = m.conn.Close()
+		return ctx.Err()
+	}
+
+	m.flush()
+	return m.conn.Close()
+}
+
+// continuouslyFlush sends the aggregated metrics to the agent periodically.
+func (m *StatsDMetrics) continuouslyFlush(flushInterval time.Duration) {
+	defer close(m.stopped)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			m.flush()
+		}
+	}
+}
+
+// flush sends all aggregated and buffered metrics to the agent and resets them.
+// The lines are combined into as few packets as possible without exceeding the maximum packet size.
+func (m *StatsDMetrics) flush() {
+	m.mutex.Lock()
+	lines := make([]string, 0, len(m.counters)+len(m.gauges)+len(m.samples))
+	for name, value := range m.counters {
+		lines = append(lines, m.line(name, strconv.FormatInt(value, 10), "c"))
+	}
+	for name, value := range m.gauges {
+		lines = append(lines, m.line(name, formatStatsDValue(value), "g"))
+	}
+	lines = append(lines, m.samples...)
+	m.counters = make(map[string]int64)
+	m.gauges = make(map[string]float64)
+	m.samples = nil
+	m.mutex.Unlock()
+
+	packet := bytes.Buffer{}
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > m.maxPacketSize {
+			m.write(packet.Bytes())
+			packet.Reset()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	if packet.Len() > 0 {
+		m.write(packet.Bytes())
+	}
+}
+
+func (m *StatsDMetrics) write(packet []byte) {
+	if _, err := m.conn.Write(packet); err != nil {
+		m.logger.WithError(err).Error("failed to send metrics to StatsD agent")
+	}
+}
+
+// metricName returns the name under which the metric is aggregated. For DogStatsD the tags
+// are part of it separated by "|#", for plain StatsD the label values are appended to the name.
+func (m *StatsDMetrics) metricName(name string, labels Labels) string {
+	names := labelNames(labels)
+	if len(names) == 0 {
+		return m.namespace + name
+	}
+
+	parts := make([]string, 0, len(names))
+	if !m.dogStatsD {
+		for _, labelName := range names {
+			parts = append(parts, strings.Replace(sanitizeStatsD(labels[labelName]), ".", "_", -1))
+		}
+		return m.namespace + name + "." + strings.Join(parts, ".")
+	}
+
+	for _, labelName := range names {
+		parts = append(parts, sanitizeStatsD(labelName)+":"+sanitizeStatsD(labels[labelName]))
+	}
+	return m.namespace + name + "|#" + strings.Join(parts, ",")
+}
+
+// line creates one line in the StatsD format "name:value|type" or "name:value|type|#tags" for DogStatsD.
+func (m *StatsDMetrics) line(metricName string, value string, metricType string) string {
+	if i := strings.Index(metricName, "|#"); i >= 0 {
+		return metricName[:i] + ":" + value + "|" + metricType + metricName[i:]
+	}
+	return metricName + ":" + value + "|" + metricType
+}
+
+// parseAgentURL returns the network and address to connect to the StatsD agent.
+func parseAgentURL(agentURL string) (string, string, error) {
+	if !strings.Contains(agentURL, "://") {
+		return "udp", agentURL, nil
+	}
+
+	parsedURL, err := url.Parse(agentURL)
+	if err != nil {
+		return "", "", errors.Wrap(err, "invalid StatsD agent URL")
+	}
+
+	switch parsedURL.Scheme {
+	case "udp":
+		return "udp", parsedURL.Host, nil
+	case "unix":
+		return "unixgram", parsedURL.Path, nil
+	default:
+		return "", "", errors.Errorf("unsupported scheme %q for StatsD agent URL", parsedURL.Scheme)
+	}
+}
+
+func formatStatsDValue(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// sanitizeStatsD replaces all characters that have a special meaning in the StatsD protocol.
+func sanitizeStatsD(value string) string {
+	return statsDReplacer.Replace(value)
+}
+
+var statsDReplacer = strings.NewReplacer(":", "_", "|", "_", "@", "_", "#", "_", ",", "_", "\n", "_", " ", "_")
@@ -0,0 +1,187 @@
+package observance
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsDMetrics(t *testing.T) {
+	t.Run("StatsD over UDP", func(t *testing.T) {
+		agent := newAgent(t, "udp", "127.0.0.1:0")
+		defer agent.Close()
+
+		m, err := NewStatsDMetrics("udp://"+agent.LocalAddr().String(), "test-app", false, time.Hour, NewTestLogger())
+		require.NoError(t, err)
+
+		m.Increment("requests")
+		m.Increment("requests")
+		m.IncrementWithLabels("cache_total", Labels{"result": "hit", "operation": "get"})
+		m.SetGauge("queue_size", 10)
+		m.SetGaugeInt64("queue_size", 12)
+		m.ObserveDurationSince("duration_seconds", time.Now().Add(-1500*time.Millisecond), nil)
+		require.NoError(t, m.Close(context.Background()))
+
+		lines := readLines(t, agent)
+		require.Len(t, lines, 4)
+		assert.Equal(t, []string{
+			"test-app.cache_total.get.hit:1|c",
+			"test-app.queue_size:12|g",
+			"test-app.requests:2|c",
+		}, []string{lines[0], lines[2], lines[3]})
+
+		// Durations are observed in seconds.
+		histogram := strings.TrimPrefix(lines[1], "test-app.duration_seconds:")
+		require.True(t, strings.HasSuffix(histogram, "|h"), lines[1])
+		seconds, err := strconv.ParseFloat(strings.TrimSuffix(histogram, "|h"), 64)
+		require.NoError(t, err, lines[1])
+		assert.True(t, seconds >= 1.5 && seconds < 60, lines[1])
+	})
+
+	t.Run("DogStatsD with tags", func(t *testing.T) {
+		agent := newAgent(t, "udp", "127.0.0.1:0")
+		defer agent.Close()
+
+		m, err := NewStatsDMetrics(agent.LocalAddr().String(), "test-app", true, time.Hour, NewTestLogger())
+		require.NoError(t, err)
+
+		m.IncrementWithLabels("cache_total", Labels{"result": "hit", "operation": "get"})
+		m.IncrementWithLabels("cache_total", Labels{"result": "hit", "operation": "get"})
+		m.IncrementWithLabels("cache_total", Labels{"result": "miss", "operation": "get"})
+		m.SetGaugeWithLabels("pool_size", 3, Labels{"pool": "main"})
+		m.Observe("duration_seconds", 0.25, Labels{"operation": "get"})
+		require.NoError(t, m.Close(context.Background()))
+
+		assert.Equal(t, []string{
+			"test-app.cache_total:1|c|#operation:get,result:miss",
+			"test-app.cache_total:2|c|#operation:get,result:hit",
+			"test-app.duration_seconds:0.25|h|#operation:get",
+			"test-app.pool_size:3|g|#pool:main",
+		}, readLines(t, agent))
+	})
+
+	t.Run("DogStatsD over Unix socket", func(t *testing.T) {
+		socket := filepath.Join(t.TempDir(), "dsd.socket")
+		agent := newAgent(t, "unixgram", socket)
+		defer agent.Close()
+
+		m, err := NewStatsDMetrics("unix://"+socket, "test-app", true, time.Hour, NewTestLogger())
+		require.NoError(t, err)
+
+		m.Increment("requests")
+		require.NoError(t, m.Close(context.Background()))
+
+		assert.Equal(t, []string{"test-app.requests:1|c"}, readLines(t, agent))
+	})
+
+	t.Run("periodic flush and packet size", func(t *testing.T) {
+		agent := newAgent(t, "udp", "127.0.0.1:0")
+		defer agent.Close()
+
+		m, err := NewStatsDMetrics(agent.LocalAddr().String(), "", false, 20*time.Millisecond, NewTestLogger())
+		require.NoError(t, err)
+		defer m.Close(context.Background())
+
+		for i := 0; i < 200; i++ {
+			m.Observe("some_distribution", float64(i), nil)
+		}
+
+		packetCount := 0
+		lineCount := 0
+		buffer := make([]byte, 65536)
+		require.NoError(t, agent.SetReadDeadline(time.Now().Add(time.Second)))
+		for lineCount < 200 {
+			n, _, err := agent.ReadFrom(buffer)
+			require.NoError(t, err)
+			assert.True(t, n <= maxUDPPacketSize)
+			packetCount++
+			lineCount += len(strings.Split(string(buffer[:n]), "\n"))
+		}
+		assert.Equal(t, 200, lineCount)
+		assert.True(t, packetCount > 1)
+	})
+
+	t.Run("distributions are histograms", func(t *testing.T) {
+		agent := newAgent(t, "udp", "127.0.0.1:0")
+		defer agent.Close()
+
+		m, err := NewStatsDMetrics(agent.LocalAddr().String(), "test-app", false, time.Hour, NewTestLogger())
+		require.NoError(t, err)
+
+		m.Observe("response_size_bytes", 512, Labels{"operation": "get"})
+		require.NoError(t, m.Close(context.Background()))
+
+		assert.Equal(t, []string{"test-app.response_size_bytes.get:512|h"}, readLines(t, agent))
+	})
+
+	t.Run("close closes the connection if the context is done", func(t *testing.T) {
+		agent := newAgent(t, "udp", "127.0.0.1:0")
+		defer agent.Close()
+
+		m, err := NewStatsDMetrics(agent.LocalAddr().String(), "test-app", false, time.Hour, NewTestLogger())
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		// Either the flush loop stopped in time or the context was done first.
+		_ = m.Close(ctx)
+		_, err = m.conn.Write([]byte("requests:1|c"))
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid URL", func(t *testing.T) {
+		_, err := NewStatsDMetrics("http://localhost:8125", "test-app", false, time.Hour, NewTestLogger())
+		assert.EqualError(t, err, `unsupported scheme "http" for StatsD agent URL`)
+	})
+}
+
+func TestNewObsWithStatsD(t *testing.T) {
+	agent := newAgent(t, "udp", "127.0.0.1:0")
+	defer agent.Close()
+
+	obs, err := NewObs(Config{
+		AppName:        "test-app",
+		LogLevel:       "debug",
+		MetricsBackend: MetricsBackendDogStatsD,
+		MetricsURL:     "udp://" + agent.LocalAddr().String(),
+	})
+	require.NoError(t, err)
+	assert.IsType(t, &StatsDMetrics{}, obs.Metrics)
+
+	obs.Metrics.Increment("requests")
+	require.NoError(t, obs.Close(context.Background()))
+	assert.Equal(t, []string{"test-app.requests:1|c"}, readLines(t, agent))
+
+	_, err = NewObs(Config{LogLevel: "debug", MetricsBackend: "unknown", MetricsURL: "localhost:1234"})
+	assert.EqualError(t, err, `unknown metrics backend "unknown"`)
+}
+
+func TestStatsDMeasurer(t *testing.T) {
+	assert.Implements(t, (*Measurer)(nil), &StatsDMetrics{})
+}
+
+func newAgent(t *testing.T, network string, address string) net.PacketConn {
+	agent, err := net.ListenPacket(network, address)
+	require.NoError(t, err, "error in test setup")
+	return agent
+}
+
+// readLines reads one packet from the agent and returns the sorted lines.
+func readLines(t *testing.T, agent net.PacketConn) []string {
+	buffer := make([]byte, 65536)
+	require.NoError(t, agent.SetReadDeadline(time.Now().Add(time.Second)))
+	n, _, err := agent.ReadFrom(buffer)
+	require.NoError(t, err)
+
+	lines := strings.Split(string(buffer[:n]), "\n")
+	sort.Strings(lines)
+	return lines
+}
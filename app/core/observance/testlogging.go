@@ -1,8 +1,14 @@
 package observance
 
 import (
+	"fmt"
+	"sort"
+	"strings"
+
 	"github.com/sirupsen/logrus"
 	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TestLogger is an extended Logger interface for testing.
@@ -12,6 +18,51 @@ type TestLogger interface {
 	LastEntry() TestLogEntry
 	Entries() []TestLogEntry
 	Reset()
+	AssertLogged(t assert.TestingT, level string, msgSubstring string, fields Fields) bool
+	AssertNotLogged(t assert.TestingT, level string, msgSubstring string, fields Fields) bool
+	AssertLoggedInOrder(t assert.TestingT, expected ...LogMatch) bool
+	RequireNoErrors(t require.TestingT)
+}
+
+// LogMatch describes an expected log entry. An empty level matches all levels, the message matches
+// if it contains the given string and the entry needs to contain the fields with equal values (it may contain more).
+type LogMatch struct {
+	Level   string
+	Message string
+	Fields  Fields
+}
+
+// Matches checks whether the log entry fulfils the expectation.
+func (m LogMatch) Matches(entry TestLogEntry) bool {
+	if m.Level != "" && normalizeLevel(m.Level) != entry.Level {
+		return false
+	}
+	if !strings.Contains(entry.Message, m.Message) {
+		return false
+	}
+	for key, value := range m.Fields {
+		actual, ok := entry.Data[key]
+		if !ok || !assert.ObjectsAreEqualValues(value, actual) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m LogMatch) String() string {
+	level := m.Level
+	if level == "" {
+		level = "any level"
+	}
+	return fmt.Sprintf("%s message containing %q with fields %v", level, m.Message, m.Fields)
+}
+
+// LogCaptureT is the part of testing.TB that is needed for CaptureLogs.
+type LogCaptureT interface {
+	Helper()
+	Cleanup(func())
+	Failed() bool
+	Logf(format string, args ...interface{})
 }
 
 // TestLogEntry represents one recorded log entry in the test logger.
@@ -67,3 +118,119 @@ func NewTestLogger() TestLogger {
 		result: hook,
 	}
 }
+
+// AssertLogged asserts that at least one entry with the given level that contains the message substring
+// and the fields was logged. An empty level matches all levels.
+func (l *LogrusTestLogger) AssertLogged(t assert.TestingT, level string, msgSubstring string, fields Fields) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	match := LogMatch{Level: level, Message: msgSubstring, Fields: fields}
+	for _, entry := range l.Entries() {
+		if match.Matches(entry) {
+			return true
+		}
+	}
+	return assert.Fail(t, "no log entry found: "+match.String(), l.recorded())
+}
+
+// AssertNotLogged asserts that no entry with the given level that contains the message substring and the fields was logged.
+func (l *LogrusTestLogger) AssertNotLogged(t assert.TestingT, level string, msgSubstring string, fields Fields) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	match := LogMatch{Level: level, Message: msgSubstring, Fields: fields}
+	for _, entry := range l.Entries() {
+		if match.Matches(entry) {
+			return assert.Fail(t, "unexpected log entry found: "+match.String(), l.recorded())
+		}
+	}
+	return true
+}
+
+// AssertLoggedInOrder asserts that entries matching the expectations were logged in the given order.
+// Other entries may have been logged before, between or after them.
+func (l *LogrusTestLogger) AssertLoggedInOrder(t assert.TestingT, expected ...LogMatch) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	next := 0
+	for _, entry := range l.Entries() {
+		if next < len(expected) && expected[next].Matches(entry) {
+			next++
+		}
+	}
+	if next == len(expected) {
+		return true
+	}
+	return assert.Fail(t, fmt.Sprintf("log entry %d of the sequence not found: %s", next+1, expected[next]), l.recorded())
+}
+
+// RequireNoErrors stops the test if an entry with level error or above was logged.
+func (l *LogrusTestLogger) RequireNoErrors(t require.TestingT) {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	for _, entry := range l.Entries() {
+		if entry.Level == "error" || entry.Level == "fatal" || entry.Level == "panic" {
+			assert.Fail(t, fmt.Sprintf("unexpected %s log entry: %q", entry.Level, entry.Message), l.recorded())
+			t.FailNow()
+			return
+		}
+	}
+}
+
+// recorded lists all recorded log entries to ease debugging failed assertions.
+func (l *LogrusTestLogger) recorded() string {
+	lines := []string{"recorded logs:"}
+	for _, entry := range l.Entries() {
+		lines = append(lines, formatEntry(entry))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// CaptureLogs creates a new TestLogger for the current test (or t.Run) that writes all recorded entries
+// to the test output if the test failed. Passing tests stay quiet.
+func CaptureLogs(t LogCaptureT) TestLogger {
+	t.Helper()
+	logger := NewTestLogger()
+	t.Cleanup(func() {
+		if !t.Failed() {
+			return
+		}
+		entries := logger.Entries()
+		t.Logf("%d log entries were recorded:", len(entries))
+		for _, entry := range entries {
+			t.Logf("%s", formatEntry(entry))
+		}
+	})
+	return logger
+}
+
+// formatEntry formats the entry in a logfmt-like way with sorted fields.
+func formatEntry(entry TestLogEntry) string {
+	keys := make([]string, 0, len(entry.Data))
+	for key := range entry.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := []string{"level=" + entry.Level, fmt.Sprintf("msg=%q", entry.Message)}
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%v", key, entry.Data[key]))
+	}
+	return strings.Join(parts, " ")
+}
+
+// normalizeLevel converts level names like "warn" to the names used in the entries, e.g. "warning".
+func normalizeLevel(level string) string {
+	parsed, err := logrus.ParseLevel(level)
+	if err != nil {
+		return level
+	}
+	return parsed.String()
+}
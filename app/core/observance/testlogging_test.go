@@ -0,0 +1,132 @@
+package observance
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTestLogger(t *testing.T) {
+	t.Run("AssertLogged", func(t *testing.T) {
+		logger := NewTestLogger()
+		logger.WithFields(Fields{"userId": 42, "action": "login"}).Info("user logged in successfully")
+		logger.Warn("slow request")
+
+		assert.True(t, logger.AssertLogged(t, "info", "logged in", Fields{"userId": 42}))
+		assert.True(t, logger.AssertLogged(t, "", "logged in", nil))
+		assert.True(t, logger.AssertLogged(t, "warn", "slow", nil))
+
+		mockT := &testing.T{}
+		assert.False(t, logger.AssertLogged(mockT, "error", "logged in", nil))
+		assert.False(t, logger.AssertLogged(mockT, "info", "logged in", Fields{"userId": 43}))
+		assert.False(t, logger.AssertLogged(mockT, "info", "logged out", nil))
+		assert.True(t, mockT.Failed())
+	})
+
+	t.Run("AssertNotLogged", func(t *testing.T) {
+		logger := NewTestLogger()
+		logger.WithError(errors.New("timeout")).Error("request failed")
+
+		assert.True(t, logger.AssertNotLogged(t, "info", "request failed", nil))
+		assert.True(t, logger.AssertNotLogged(t, "error", "request failed", Fields{"error": "other"}))
+
+		mockT := &testing.T{}
+		assert.False(t, logger.AssertNotLogged(mockT, "error", "failed", nil))
+		assert.True(t, mockT.Failed())
+	})
+
+	t.Run("AssertLoggedInOrder", func(t *testing.T) {
+		logger := NewTestLogger()
+		logger.Info("started")
+		logger.Debug("loading")
+		logger.WithField("step", 2).Info("processing")
+		logger.Info("finished")
+
+		assert.True(t, logger.AssertLoggedInOrder(t,
+			LogMatch{Level: "info", Message: "started"},
+			LogMatch{Message: "processing", Fields: Fields{"step": 2}},
+			LogMatch{Message: "finished"},
+		))
+
+		mockT := &testing.T{}
+		assert.False(t, logger.AssertLoggedInOrder(mockT,
+			LogMatch{Message: "finished"},
+			LogMatch{Message: "started"},
+		))
+		assert.True(t, mockT.Failed())
+	})
+
+	t.Run("RequireNoErrors", func(t *testing.T) {
+		logger := NewTestLogger()
+		logger.Warn("only a warning")
+		logger.RequireNoErrors(t)
+
+		logger.Error("broken")
+		fake := &fakeT{}
+		logger.RequireNoErrors(fake)
+		assert.True(t, fake.failed)
+		assert.True(t, fake.stopped)
+	})
+}
+
+func TestCaptureLogs(t *testing.T) {
+	t.Run("logs are dumped if the test failed", func(t *testing.T) {
+		fake := &fakeT{}
+		logger := CaptureLogs(fake)
+		logger.WithField("id", 7).Info("first")
+		logger.Warn("second")
+		fake.failed = true
+		fake.runCleanups()
+
+		assert.Equal(t, []string{
+			"2 log entries were recorded:",
+			`level=info msg="first" id=7`,
+			`level=warning msg="second"`,
+		}, fake.logs)
+	})
+
+	t.Run("passing tests stay quiet", func(t *testing.T) {
+		fake := &fakeT{}
+		CaptureLogs(fake).Info("message")
+		fake.runCleanups()
+		assert.Empty(t, fake.logs)
+	})
+}
+
+// fakeT records failures, logs and cleanups so the behavior for failed tests can be checked.
+type fakeT struct {
+	failed   bool
+	stopped  bool
+	logs     []string
+	cleanups []func()
+}
+
+func (f *fakeT) Helper() {}
+
+func (f *fakeT) Cleanup(fn func()) {
+	f.cleanups = append(f.cleanups, fn)
+}
+
+func (f *fakeT) Failed() bool {
+	return f.failed
+}
+
+func (f *fakeT) Logf(format string, args ...interface{}) {
+	f.logs = append(f.logs, fmt.Sprintf(format, args...))
+}
+
+func (f *fakeT) Errorf(format string, args ...interface{}) {
+	f.failed = true
+}
+
+func (f *fakeT) FailNow() {
+	f.stopped = true
+}
+
+func (f *fakeT) runCleanups() {
+	for _, fn := range f.cleanups {
+		fn()
+	}
+}
@@ -0,0 +1,189 @@
+package observance
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMeasurer is an implementation of Measurer for testing.
+// It records all metrics in memory and provides assertions to check them.
+type TestMeasurer struct {
+	mutex        sync.Mutex
+	counters     map[string]int
+	gauges       map[string]float64
+	observations map[string][]float64
+}
+
+// NewTestMeasurer creates a new TestMeasurer that can be used to create a test observance instance.
+func NewTestMeasurer() *TestMeasurer {
+	return &TestMeasurer{
+		counters:     make(map[string]int),
+		gauges:       make(map[string]float64),
+		observations: make(map[string][]float64),
+	}
+}
+
+// Increment records that the counter was incremented.
+func (m *TestMeasurer) Increment(name string) {
+	m.IncrementWithLabels(name, nil)
+}
+
+// IncrementWithLabels records that the counter with the given labels was incremented.
+func (m *TestMeasurer) IncrementWithLabels(name string, labels Labels) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.counters[metricKey(name, labels)]++
+}
+
+// SetGauge records the value of the gauge.
+func (m *TestMeasurer) SetGauge(name string, value float64) {
+	m.SetGaugeWithLabels(name, value, nil)
+}
+
+// SetGaugeInt64 records the value of the gauge converted to float64.
+func (m *TestMeasurer) SetGaugeInt64(name string, value int64) {
+	m.SetGaugeWithLabels(name, float64(value), nil)
+}
+
+// SetGaugeWithLabels records the value of the gauge with the given labels.
+func (m *TestMeasurer) SetGaugeWithLabels(name string, value float64, labels Labels) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.gauges[metricKey(name, labels)] = value
+}
+
+// DurationSince records the duration since start in milliseconds as gauge, the same way PrometheusMetrics does.
+func (m *TestMeasurer) DurationSince(name string, start time.Time) {
+	durationInMs := float64(time.Since(start).Round(time.Millisecond) / time.Millisecond)
+	m.SetGauge(name, durationInMs)
+}
+
+// Observe records the observed value.
+func (m *TestMeasurer) Observe(name string, value float64, labels Labels) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	key := metricKey(name, labels)
+	m.observations[key] = append(m.observations[key], value)
+}
+
+// ObserveDurationSince records the duration since start in seconds as observed value.
+func (m *TestMeasurer) ObserveDurationSince(name string, start time.Time, labels Labels) {
+	m.Observe(name, time.Since(start).Seconds(), labels)
+}
+
+// Counter returns how often the counter with the given name and labels was incremented.
+func (m *TestMeasurer) Counter(name string, labels Labels) int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.counters[metricKey(name, labels)]
+}
+
+// Gauge returns the last value of the gauge with the given name and labels and whether it was set at all.
+func (m *TestMeasurer) Gauge(name string, labels Labels) (float64, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	value, ok := m.gauges[metricKey(name, labels)]
+	return value, ok
+}
+
+// Observations returns all values that were observed for the given name and labels.
+func (m *TestMeasurer) Observations(name string, labels Labels) []float64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return append([]float64{}, m.observations[metricKey(name, labels)]...)
+}
+
+// Reset clears the recorded metrics to start fresh.
+func (m *TestMeasurer) Reset() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.counters = make(map[string]int)
+	m.gauges = make(map[string]float64)
+	m.observations = make(map[string][]float64)
+}
+
+// AssertCounter asserts that the counter with the given name and labels was incremented exactly n times.
+func (m *TestMeasurer) AssertCounter(t assert.TestingT, name string, labels Labels, n int) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	got := m.Counter(name, labels)
+	if got == n {
+		return true
+	}
+	return assert.Fail(t, fmt.Sprintf("counter %s was incremented %d times, expected %d", metricKey(name, labels), got, n), m.recorded())
+}
+
+// AssertGaugeBetween asserts that the last value of the gauge with the given name and labels is within [min, max].
+func (m *TestMeasurer) AssertGaugeBetween(t assert.TestingT, name string, labels Labels, min float64, max float64) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	got, ok := m.Gauge(name, labels)
+	if !ok {
+		return assert.Fail(t, fmt.Sprintf("gauge %s was not set", metricKey(name, labels)), m.recorded())
+	}
+	if got < min || got > max {
+		return assert.Fail(t, fmt.Sprintf("gauge %s has value %v, expected between %v and %v", metricKey(name, labels), got, min, max))
+	}
+	return true
+}
+
+// AssertObserved asserts that at least one value was observed for the given name and labels.
+func (m *TestMeasurer) AssertObserved(t assert.TestingT, name string, labels Labels) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	if len(m.Observations(name, labels)) > 0 {
+		return true
+	}
+	return assert.Fail(t, fmt.Sprintf("no value was observed for %s", metricKey(name, labels)), m.recorded())
+}
+
+// recorded lists all recorded metrics to ease debugging failed assertions.
+func (m *TestMeasurer) recorded() string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	lines := []string{}
+	for key, value := range m.counters {
+		lines = append(lines, fmt.Sprintf("counter %s: %d", key, value))
+	}
+	for key, value := range m.gauges {
+		lines = append(lines, fmt.Sprintf("gauge %s: %v", key, value))
+	}
+	for key, values := range m.observations {
+		lines = append(lines, fmt.Sprintf("observed %s: %v", key, values))
+	}
+	sort.Strings(lines)
+	return "recorded metrics:\n" + strings.Join(lines, "\n")
+}
+
+// metricKey returns a unique key for the metric name and labels in the format `name{label1="value1",label2="value2"}`.
+func metricKey(name string, labels Labels) string {
+	names := labelNames(labels)
+	if len(names) == 0 {
+		return name
+	}
+
+	parts := make([]string, 0, len(names))
+	for _, labelName := range names {
+		parts = append(parts, fmt.Sprintf("%s=%q", labelName, labels[labelName]))
+	}
+	return name + "{" + strings.Join(parts, ",") + "}"
+}
@@ -0,0 +1,65 @@
+package observance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTestMeasurer(t *testing.T) {
+	t.Run("implements Measurer", func(t *testing.T) {
+		assert.Implements(t, (*Measurer)(nil), NewTestMeasurer())
+	})
+
+	t.Run("AssertCounter", func(t *testing.T) {
+		m := NewTestMeasurer()
+		m.Increment("plain_total")
+		m.IncrementWithLabels("test_total", Labels{"a": "1", "b": "2"})
+		m.IncrementWithLabels("test_total", Labels{"b": "2", "a": "1"})
+
+		assert.True(t, m.AssertCounter(t, "plain_total", nil, 1))
+		assert.True(t, m.AssertCounter(t, "test_total", Labels{"a": "1", "b": "2"}, 2))
+
+		mockT := &testing.T{}
+		assert.False(t, m.AssertCounter(mockT, "test_total", Labels{"a": "1"}, 2))
+		assert.True(t, mockT.Failed())
+	})
+
+	t.Run("AssertGaugeBetween", func(t *testing.T) {
+		m := NewTestMeasurer()
+		m.SetGaugeInt64("queue_size", 10)
+		m.SetGaugeWithLabels("pool_size", 3, Labels{"pool": "main"})
+		m.DurationSince("duration_ms", time.Now().Add(-20*time.Millisecond))
+
+		assert.True(t, m.AssertGaugeBetween(t, "queue_size", nil, 10, 10))
+		assert.True(t, m.AssertGaugeBetween(t, "pool_size", Labels{"pool": "main"}, 1, 5))
+		assert.True(t, m.AssertGaugeBetween(t, "duration_ms", nil, 20, 1000))
+
+		mockT := &testing.T{}
+		assert.False(t, m.AssertGaugeBetween(mockT, "queue_size", nil, 11, 20))
+		assert.False(t, m.AssertGaugeBetween(mockT, "unknown", nil, 0, 20))
+		assert.True(t, mockT.Failed())
+	})
+
+	t.Run("AssertObserved", func(t *testing.T) {
+		m := NewTestMeasurer()
+		m.Observe("size", 3, Labels{"type": "user"})
+		m.ObserveDurationSince("duration_seconds", time.Now(), nil)
+
+		assert.True(t, m.AssertObserved(t, "size", Labels{"type": "user"}))
+		assert.True(t, m.AssertObserved(t, "duration_seconds", nil))
+		assert.Equal(t, []float64{3}, m.Observations("size", Labels{"type": "user"}))
+
+		mockT := &testing.T{}
+		assert.False(t, m.AssertObserved(mockT, "size", nil))
+		assert.True(t, mockT.Failed())
+	})
+
+	t.Run("Reset", func(t *testing.T) {
+		m := NewTestMeasurer()
+		m.Increment("plain_total")
+		m.Reset()
+		assert.Equal(t, 0, m.Counter("plain_total", nil))
+	})
+}
@@ -0,0 +1,239 @@
+package observance
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Available tracing exporters that can be set in the config.
+const (
+	TracingExporterStdout = "stdout"
+	TracingExporterFile   = "file"
+	TracingExporterOTLP   = "otlp"
+)
+
+// WriterExporter writes the spans as JSON lines to the given writer.
+type WriterExporter struct {
+	writer io.Writer
+	mutex  sync.Mutex
+}
+
+// NewWriterExporter creates a new exporter that writes one JSON object per span to the writer, e.g. os.Stdout.
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{writer: w}
+}
+
+// NewFileExporter creates a new exporter that appends one JSON object per span to the file with the given path.
+func NewFileExporter(path string) (*WriterExporter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not open file for tracing")
+	}
+	return NewWriterExporter(file), nil
+}
+
+// ExportSpans writes the spans to the writer.
+func (e *WriterExporter) ExportSpans(ctx context.Context, spans []SpanData) error {
+	buffer := bytes.Buffer{}
+	encoder := json.NewEncoder(&buffer)
+	for _, span := range spans {
+		if err := encoder.Encode(span); err != nil {
+			return err
+		}
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	_, err := e.writer.Write(buffer.Bytes())
+	return err
+}
+
+// OTLPExporter sends the spans to an OpenTelemetry collector using OTLP/HTTP with JSON encoding.
+type OTLPExporter struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+// NewOTLPExporter creates a new exporter that sends the spans to the given collector endpoint.
+// If the endpoint does not end with "/v1/traces" the path is added. The headers are sent with every request,
+// e.g. for authentication.
+func NewOTLPExporter(endpoint string, headers map[string]string) *OTLPExporter {
+	url := strings.TrimSuffix(endpoint, "/")
+	if !strings.HasSuffix(url, "/v1/traces") {
+		url += "/v1/traces"
+	}
+
+	return &OTLPExporter{
+		url:     url,
+		headers: headers,
+		client:  &http.Client{Timeout: defaultExportInterval},
+	}
+}
+
+// ExportSpans sends the spans to the collector.
+func (e *OTLPExporter) ExportSpans(ctx context.Context, spans []SpanData) error {
+	body, err := json.Marshal(otlpRequest(spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range e.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "could not send spans to collector")
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("collector responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// The following types represent the JSON encoding of the OTLP ExportTraceServiceRequest,
+// see https://github.com/open-telemetry/opentelemetry-proto.
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              SpanKind        `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    StatusCode `json:"code"`
+	Message string     `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+// otlpRequest groups the spans by service name and converts them into the OTLP format.
+func otlpRequest(spans []SpanData) otlpTraces {
+	request := otlpTraces{}
+	indexByService := map[string]int{}
+	for _, span := range spans {
+		index, ok := indexByService[span.ServiceName]
+		if !ok {
+			index = len(request.ResourceSpans)
+			indexByService[span.ServiceName] = index
+			request.ResourceSpans = append(request.ResourceSpans, otlpResourceSpans{
+				Resource: otlpResource{
+					Attributes: []otlpAttribute{otlpAttr("service.name", span.ServiceName)},
+				},
+				ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "toolkit/app/core/observance"}}},
+			})
+		}
+
+		attributes := make([]otlpAttribute, 0, len(span.Attributes))
+		for _, key := range attributeKeys(span.Attributes) {
+			attributes = append(attributes, otlpAttr(key, span.Attributes[key]))
+		}
+
+		scopeSpans := &request.ResourceSpans[index].ScopeSpans[0]
+		scopeSpans.Spans = append(scopeSpans.Spans, otlpSpan{
+			TraceID:           span.TraceID,
+			SpanID:            span.SpanID,
+			ParentSpanID:      span.ParentSpanID,
+			Name:              span.Name,
+			Kind:              span.Kind,
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+			Attributes:        attributes,
+			Status:            otlpStatus{Code: span.StatusCode, Message: span.StatusMessage},
+		})
+	}
+	return request
+}
+
+func otlpAttr(key string, value interface{}) otlpAttribute {
+	attribute := otlpAttribute{Key: key}
+	switch v := value.(type) {
+	case string:
+		attribute.Value.StringValue = &v
+	case bool:
+		attribute.Value.BoolValue = &v
+	case int:
+		attribute.Value.IntValue = stringPtr(strconv.FormatInt(int64(v), 10))
+	case int64:
+		attribute.Value.IntValue = stringPtr(strconv.FormatInt(v, 10))
+	case uint64:
+		attribute.Value.IntValue = stringPtr(strconv.FormatUint(v, 10))
+	case float64:
+		attribute.Value.DoubleValue = &v
+	default:
+		attribute.Value.StringValue = stringPtr(fmt.Sprintf("%v", v))
+	}
+	return attribute
+}
+
+func attributeKeys(attributes map[string]interface{}) []string {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,488 @@
+package observance
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Header names used for the W3C trace context propagation, see https://www.w3.org/TR/trace-context/.
+const (
+	TraceParentHeader = "traceparent"
+	TraceStateHeader  = "tracestate"
+)
+
+// SpanKind describes the relationship between the span and its parent, the values match OpenTelemetry.
+type SpanKind int
+
+// Available span kinds.
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+	SpanKindProducer SpanKind = 4
+	SpanKindConsumer SpanKind = 5
+)
+
+// StatusCode is the status of a finished span, the values match OpenTelemetry.
+type StatusCode int
+
+// Available status codes.
+const (
+	StatusUnset StatusCode = 0
+	StatusOK    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+const (
+	// spanQueueSize is the number of finished spans that can wait for the export, further spans are dropped.
+	spanQueueSize = 2048
+	// maxExportBatchSize is the maximum number of spans that are exported together.
+	maxExportBatchSize = 512
+	// defaultExportInterval is the maximum time a finished span waits for the export.
+	defaultExportInterval = 5 * time.Second
+)
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+// String returns the lowercase hex representation of the trace ID.
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// IsValid returns false if all bytes are zero.
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+// String returns the lowercase hex representation of the span ID.
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// IsValid returns false if all bytes are zero.
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+// SpanContext holds the data of a span that is propagated to other services.
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Sampled    bool
+	TraceState string
+	Remote     bool
+}
+
+// IsValid returns true if trace ID and span ID are set.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// TraceParent returns the value for the "traceparent" header, e.g. "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+func (sc SpanContext) TraceParent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceParent parses the value of a "traceparent" header into a remote SpanContext.
+func ParseTraceParent(traceParent string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(traceParent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, errors.Errorf("invalid traceparent %q", traceParent)
+	}
+	// The W3C Trace Context only allows lowercase hex digits, hex.Decode would accept uppercase ones.
+	for _, part := range parts[:4] {
+		if strings.Trim(part, "0123456789abcdef") != "" {
+			return SpanContext{}, errors.Errorf("invalid traceparent %q", traceParent)
+		}
+	}
+	if parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return SpanContext{}, errors.Errorf("unsupported traceparent version in %q", traceParent)
+	}
+
+	sc := SpanContext{Remote: true}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, errors.Wrap(err, "invalid trace ID in traceparent")
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, errors.Wrap(err, "invalid span ID in traceparent")
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return SpanContext{}, errors.Wrap(err, "invalid flags in traceparent")
+	}
+	if !sc.IsValid() {
+		return SpanContext{}, errors.Errorf("invalid traceparent %q", traceParent)
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, nil
+}
+
+// Span represents one operation within a trace. Spans are created via Tracer.Start or Obs.StartSpan
+// and need to be finished by calling End. All methods can be called on a nil span, they do nothing in that case.
+type Span struct {
+	tracer       *Tracer
+	spanContext  SpanContext
+	parentSpanID SpanID
+	name         string
+	kind         SpanKind
+	start        time.Time
+	mutex        sync.Mutex
+	end          time.Time
+	attributes   map[string]interface{}
+	status       StatusCode
+	statusMsg    string
+	ended        bool
+}
+
+// SpanContext returns the data of the span that is propagated to other services.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.spanContext
+}
+
+// SetName replaces the name of the span, e.g. once the route of a request is known.
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.name = name
+}
+
+// SetAttribute adds a key value pair to the span. The value should be a string, bool, integer or float.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.attributes[key] = value
+}
+
+// SetStatus sets the status of the span.
+func (s *Span) SetStatus(code StatusCode, msg string) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.status = code
+	s.statusMsg = msg
+}
+
+// RecordError marks the span as failed with the error message. Nil errors are ignored.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.SetStatus(StatusError, err.Error())
+}
+
+// End finishes the span and hands it over for the export. Only the first call has an effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	data := s.data()
+	s.mutex.Unlock()
+
+	if s.spanContext.Sampled {
+		s.tracer.enqueue(data)
+	}
+}
+
+// data returns a snapshot of the span for the export. The mutex needs to be held by the caller.
+func (s *Span) data() SpanData {
+	attributes := make(map[string]interface{}, len(s.attributes))
+	for key, value := range s.attributes {
+		attributes[key] = value
+	}
+
+	data := SpanData{
+		ServiceName:   s.tracer.serviceName,
+		TraceID:       s.spanContext.TraceID.String(),
+		SpanID:        s.spanContext.SpanID.String(),
+		Name:          s.name,
+		Kind:          s.kind,
+		Start:         s.start,
+		End:           s.end,
+		Attributes:    attributes,
+		StatusCode:    s.status,
+		StatusMessage: s.statusMsg,
+	}
+	if s.parentSpanID.IsValid() {
+		data.ParentSpanID = s.parentSpanID.String()
+	}
+	return data
+}
+
+// SpanData is the exported representation of a finished span.
+type SpanData struct {
+	ServiceName   string                 `json:"service"`
+	TraceID       string                 `json:"traceId"`
+	SpanID        string                 `json:"spanId"`
+	ParentSpanID  string                 `json:"parentSpanId,omitempty"`
+	Name          string                 `json:"name"`
+	Kind          SpanKind               `json:"kind"`
+	Start         time.Time              `json:"start"`
+	End           time.Time              `json:"end"`
+	Attributes    map[string]interface{} `json:"attributes,omitempty"`
+	StatusCode    StatusCode             `json:"statusCode"`
+	StatusMessage string                 `json:"statusMessage,omitempty"`
+}
+
+// SpanExporter sends finished spans to a tracing backend.
+type SpanExporter interface {
+	ExportSpans(ctx context.Context, spans []SpanData) error
+}
+
+// Tracer creates spans and exports them in batches in the background.
+type Tracer struct {
+	serviceName string
+	exporter    SpanExporter
+	logger      Logger
+	queue       chan SpanData
+	flush       chan chan struct{}
+	stop        chan struct{}
+	stopped     chan struct{}
+	stopOnce    sync.Once
+}
+
+// NewTracer creates a new tracer that exports the finished spans with the given exporter.
+// The spans are exported in batches at least every 5 seconds. If the export can not keep up, spans are dropped.
+func NewTracer(serviceName string, exporter SpanExporter, logger Logger) *Tracer {
+	t := &Tracer{
+		serviceName: serviceName,
+		exporter:    exporter,
+		logger:      logger,
+		queue:       make(chan SpanData, spanQueueSize),
+		flush:       make(chan chan struct{}),
+		stop:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+
+	go t.continuouslyExport(defaultExportInterval)
+
+	return t
+}
+
+// Start creates a new span. If the context contains a span, the new span becomes its child,
+// otherwise a new trace is started. The returned context contains the new span.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	parent := SpanContextFromContext(ctx)
+
+	spanContext := SpanContext{Sampled: true}
+	if parent.IsValid() {
+		spanContext.TraceID = parent.TraceID
+		spanContext.Sampled = parent.Sampled
+		spanContext.TraceState = parent.TraceState
+	} else {
+		spanContext.TraceID = newTraceID()
+	}
+	spanContext.SpanID = newSpanID()
+
+	span := &Span{
+		tracer:       t,
+		spanContext:  spanContext,
+		parentSpanID: parent.SpanID,
+		name:         name,
+		kind:         kind,
+		start:        time.Now(),
+		attributes:   make(map[string]interface{}),
+	}
+	return ContextWithSpan(ctx, span), span
+}
+
+// Flush exports all spans that were finished so far.
+func (t *Tracer) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	select {
+	case t.flush <- done:
+	case <-t.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close exports the remaining spans and stops the background export.
+// It returns early with the context error if the context is done first.
+func (t *Tracer) Close(ctx context.Context) error {
+	if err := t.Flush(ctx); err != nil {
+		return err
+	}
+
+	t.stopOnce.Do(func() {
+		close(t.stop)
+	})
+
+	select {
+	case <-t.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *Tracer) enqueue(span SpanData) {
+	select {
+	case t.queue <- span:
+	default:
+		t.logger.WithField("span", span.Name).Warn("span was dropped because the export queue is full")
+	}
+}
+
+// continuouslyExport collects the finished spans and exports them when the batch is full or the interval passed.
+func (t *Tracer) continuouslyExport(interval time.Duration) {
+	defer close(t.stopped)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	batch := make([]SpanData, 0, maxExportBatchSize)
+	export := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.exporter.ExportSpans(context.Background(), batch); err != nil {
+			t.logger.WithField("spans", len(batch)).WithError(err).Error("failed to export spans")
+		}
+		batch = make([]SpanData, 0, maxExportBatchSize)
+	}
+	drain := func() {
+		for {
+			select {
+			case span := <-t.queue:
+				batch = append(batch, span)
+				if len(batch) >= maxExportBatchSize {
+					export()
+				}
+			default:
+				export()
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case span := <-t.queue:
+			batch = append(batch, span)
+			if len(batch) >= maxExportBatchSize {
+				export()
+			}
+		case <-ticker.C:
+			export()
+		case done := <-t.flush:
+			drain()
+			close(done)
+		case <-t.stop:
+			drain()
+			return
+		}
+	}
+}
+
+type spanContextKey struct{}
+
+type remoteSpanContextKey struct{}
+
+// ContextWithSpan returns a copy of the context that contains the span.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, span)
+}
+
+// ContextWithRemoteSpanContext returns a copy of the context that contains the span context
+// received from another service. Spans started with that context become children of the remote span.
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteSpanContextKey{}, sc)
+}
+
+// SpanFromContext returns the span stored in the context or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(spanContextKey{}).(*Span)
+	return span
+}
+
+// SpanContextFromContext returns the span context of the current span or the remote span context stored in the context.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if span := SpanFromContext(ctx); span != nil {
+		return span.SpanContext()
+	}
+	if ctx == nil {
+		return SpanContext{}
+	}
+	sc, _ := ctx.Value(remoteSpanContextKey{}).(SpanContext)
+	return sc
+}
+
+// StartChildSpan starts a child span of the span stored in the context using the same tracer.
+// If the context does not contain a span, no span is created and nil is returned.
+// That way libraries can create spans without creating new traces for operations outside of a request.
+func StartChildSpan(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	return parent.tracer.Start(ctx, name, kind)
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		randomBytes(id[:])
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		randomBytes(id[:])
+	}
+	return id
+}
+
+func randomBytes(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("could not generate random ID: %v", err))
+	}
+}
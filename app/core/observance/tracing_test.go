@@ -0,0 +1,272 @@
+package observance
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraceParent(t *testing.T) {
+	t.Run("parse and format", func(t *testing.T) {
+		traceParent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+		sc, err := ParseTraceParent(traceParent)
+		require.NoError(t, err)
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+		assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+		assert.True(t, sc.Sampled)
+		assert.True(t, sc.Remote)
+		assert.Equal(t, traceParent, sc.TraceParent())
+	})
+
+	t.Run("not sampled", func(t *testing.T) {
+		sc, err := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+		require.NoError(t, err)
+		assert.False(t, sc.Sampled)
+	})
+
+	t.Run("invalid values", func(t *testing.T) {
+		invalid := []string{
+			"",
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+			"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+			"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+			"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+			"00-xbf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-00F067AA0BA902B7-01",
+		}
+		for _, value := range invalid {
+			_, err := ParseTraceParent(value)
+			assert.Error(t, err, value)
+		}
+	})
+}
+
+func TestTracer(t *testing.T) {
+	t.Run("parent and child spans", func(t *testing.T) {
+		exporter := &exporterStub{}
+		tracer := NewTracer("test-app", exporter, NewTestLogger())
+
+		ctx, parent := tracer.Start(context.Background(), "parent", SpanKindServer)
+		parent.SetAttribute("http.method", "GET")
+		_, child := StartChildSpan(ctx, "child", SpanKindClient)
+		child.RecordError(errors.New("failed"))
+		child.End()
+		parent.End()
+		parent.End()
+		require.NoError(t, tracer.Close(context.Background()))
+
+		spans := exporter.Spans()
+		require.Len(t, spans, 2)
+		assert.Equal(t, "child", spans[0].Name)
+		assert.Equal(t, "test-app", spans[0].ServiceName)
+		assert.Equal(t, SpanKindClient, spans[0].Kind)
+		assert.Equal(t, StatusError, spans[0].StatusCode)
+		assert.Equal(t, "failed", spans[0].StatusMessage)
+		assert.Equal(t, "parent", spans[1].Name)
+		assert.Equal(t, spans[1].TraceID, spans[0].TraceID)
+		assert.Equal(t, spans[1].SpanID, spans[0].ParentSpanID)
+		assert.Empty(t, spans[1].ParentSpanID)
+		assert.Equal(t, "GET", spans[1].Attributes["http.method"])
+	})
+
+	t.Run("continue remote trace", func(t *testing.T) {
+		exporter := &exporterStub{}
+		tracer := NewTracer("test-app", exporter, NewTestLogger())
+		remote, err := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		require.NoError(t, err)
+
+		_, span := tracer.Start(ContextWithRemoteSpanContext(context.Background(), remote), "server", SpanKindServer)
+		span.End()
+		require.NoError(t, tracer.Flush(context.Background()))
+
+		spans := exporter.Spans()
+		require.Len(t, spans, 1)
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].TraceID)
+		assert.Equal(t, "00f067aa0ba902b7", spans[0].ParentSpanID)
+	})
+
+	t.Run("spans of not sampled traces are not exported", func(t *testing.T) {
+		exporter := &exporterStub{}
+		tracer := NewTracer("test-app", exporter, NewTestLogger())
+		remote, err := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+		require.NoError(t, err)
+
+		_, span := tracer.Start(ContextWithRemoteSpanContext(context.Background(), remote), "server", SpanKindServer)
+		span.End()
+		require.NoError(t, tracer.Close(context.Background()))
+		assert.Empty(t, exporter.Spans())
+	})
+
+	t.Run("no child span without parent", func(t *testing.T) {
+		ctx, span := StartChildSpan(context.Background(), "child", SpanKindClient)
+		assert.Nil(t, span)
+		assert.Equal(t, context.Background(), ctx)
+
+		// All methods can be used on the nil span.
+		span.SetAttribute("key", "value")
+		span.RecordError(errors.New("failed"))
+		span.End()
+		assert.False(t, span.SpanContext().IsValid())
+	})
+
+	t.Run("failed export is logged", func(t *testing.T) {
+		logger := NewTestLogger()
+		tracer := NewTracer("test-app", &exporterStub{err: errors.New("collector down")}, logger)
+		_, span := tracer.Start(context.Background(), "span", SpanKindInternal)
+		span.End()
+		require.NoError(t, tracer.Close(context.Background()))
+		assert.Equal(t, "failed to export spans", logger.LastEntry().Message)
+	})
+}
+
+func TestWriterExporter(t *testing.T) {
+	output := &bytes.Buffer{}
+	tracer := NewTracer("test-app", NewWriterExporter(output), NewTestLogger())
+	_, span := tracer.Start(context.Background(), "some span", SpanKindInternal)
+	span.SetAttribute("key", "value")
+	span.End()
+	require.NoError(t, tracer.Close(context.Background()))
+
+	result := SpanData{}
+	require.NoError(t, json.Unmarshal(output.Bytes(), &result))
+	assert.Equal(t, "some span", result.Name)
+	assert.Equal(t, span.SpanContext().SpanID.String(), result.SpanID)
+	assert.Equal(t, map[string]interface{}{"key": "value"}, result.Attributes)
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var body []byte
+	var mutex sync.Mutex
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "secret", r.Header.Get("Authorization"))
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer collector.Close()
+
+	exporter := NewOTLPExporter(collector.URL, map[string]string{"Authorization": "secret"})
+	tracer := NewTracer("test-app", exporter, NewTestLogger())
+	_, span := tracer.Start(context.Background(), "GET /users", SpanKindServer)
+	span.SetAttribute("http.status_code", 500)
+	span.SetAttribute("http.method", "GET")
+	span.SetStatus(StatusError, "failed")
+	span.End()
+	require.NoError(t, tracer.Close(context.Background()))
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	expected := `{"resourceSpans":[{
+		"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"test-app"}}]},
+		"scopeSpans":[{"scope":{"name":"toolkit/app/core/observance"},"spans":[{
+			"traceId":"` + span.SpanContext().TraceID.String() + `",
+			"spanId":"` + span.SpanContext().SpanID.String() + `",
+			"name":"GET /users",
+			"kind":2,
+			"startTimeUnixNano":"` + jsonField(t, body, "startTimeUnixNano") + `",
+			"endTimeUnixNano":"` + jsonField(t, body, "endTimeUnixNano") + `",
+			"attributes":[
+				{"key":"http.method","value":{"stringValue":"GET"}},
+				{"key":"http.status_code","value":{"intValue":"500"}}
+			],
+			"status":{"code":2,"message":"failed"}
+		}]}]
+	}]}`
+	assert.JSONEq(t, expected, string(body))
+
+	t.Run("collector error", func(t *testing.T) {
+		failingCollector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer failingCollector.Close()
+
+		err := NewOTLPExporter(failingCollector.URL+"/v1/traces", nil).ExportSpans(context.Background(), []SpanData{{Name: "span"}})
+		assert.EqualError(t, err, "collector responded with status 503")
+	})
+}
+
+func TestObsTracing(t *testing.T) {
+	t.Run("trace and span IDs are logged", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "spans.log")
+		obs, err := NewObs(Config{
+			AppName:         "test-app",
+			LogLevel:        "debug",
+			TracingExporter: TracingExporterFile,
+			TracingURL:      file,
+		})
+		require.NoError(t, err)
+		capture := bytes.Buffer{}
+		obs.Logger.SetOutput(&capture)
+
+		ctx, span := obs.StartSpan(context.Background(), "operation")
+		r := httptest.NewRequest("GET", "http://example.com/test", nil).WithContext(ctx)
+		obs.CopyWithRequest(r).Logger.Info("some message")
+		span.End()
+		require.NoError(t, obs.Close(context.Background()))
+
+		got := capture.String()
+		assert.Contains(t, got, `"traceId":"`+span.SpanContext().TraceID.String()+`"`)
+		assert.Contains(t, got, `"spanId":"`+span.SpanContext().SpanID.String()+`"`)
+
+		content, err := ioutil.ReadFile(file)
+		require.NoError(t, err)
+		assert.Contains(t, string(content), `"name":"operation"`)
+	})
+
+	t.Run("no tracing", func(t *testing.T) {
+		obs, err := NewObs(Config{LogLevel: "debug"})
+		require.NoError(t, err)
+		ctx, span := obs.StartSpan(context.Background(), "operation")
+		assert.Nil(t, span)
+		assert.Equal(t, obs, obs.CopyWithContext(ctx))
+	})
+
+	t.Run("unknown exporter", func(t *testing.T) {
+		_, err := NewObs(Config{LogLevel: "debug", TracingExporter: "unknown"})
+		assert.EqualError(t, err, `unknown tracing exporter "unknown"`)
+	})
+}
+
+type exporterStub struct {
+	spans []SpanData
+	err   error
+	mutex sync.Mutex
+}
+
+func (e *exporterStub) ExportSpans(ctx context.Context, spans []SpanData) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.spans = append(e.spans, spans...)
+	return e.err
+}
+
+func (e *exporterStub) Spans() []SpanData {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.spans
+}
+
+// jsonField extracts the value of a string field from the JSON body.
+func jsonField(t *testing.T, body []byte, name string) string {
+	start := strings.Index(string(body), `"`+name+`":"`)
+	require.True(t, start >= 0, "field %s not found", name)
+	value := string(body[start+len(name)+4:])
+	return value[:strings.Index(value, `"`)]
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gofiber/fiber"
+	"toolkit/app/core/observance"
+)
+
+// internalServerErrorMessage is sent to the client instead of the panic value so no internals are leaked.
+const internalServerErrorMessage = "internal server error"
+
+// Recover is a middleware that recovers panics in the following handlers. The panic is logged with the stack trace
+// and the request-specific fields (see RequestObs) via Obs.ReportPanic and the client receives a 500 response
+// with a generic message. It should be registered after Tracing, so the server span is marked as failed.
+func Recover(obs *observance.Obs) func(*fiber.Ctx) {
+	return func(c *fiber.Ctx) {
+		defer func() {
+			if r := recover(); r != nil {
+				reqObs := RequestObs(c)
+				if reqObs == nil {
+					reqObs = obs
+				}
+				reqObs.ReportPanic(r, debug.Stack())
+
+				c.Fasthttp.Response.ResetBody()
+				c.Status(http.StatusInternalServerError)
+				if err := c.JSON(fiber.Map{"message": internalServerErrorMessage}); err != nil {
+					c.SendString(internalServerErrorMessage)
+				}
+			}
+		}()
+		c.Next()
+	}
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gofiber/fiber"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"toolkit/app/core/observance"
+)
+
+func TestRecover(t *testing.T) {
+	t.Run("logs the panic with the request context and hides it from the client", func(t *testing.T) {
+		logger := observance.NewTestLogger()
+		obs := &observance.Obs{Logger: logger, Metrics: observance.NewTestMeasurer()}
+
+		app := fiber.New()
+		app.Use(Recover(obs))
+		app.Use(Tracing(obs))
+		app.Get("/users", func(c *fiber.Ctx) {
+			c.SendString("partial response")
+			panic(errors.New("connection to db:secret@localhost failed"))
+		})
+
+		req := httptest.NewRequest("GET", "/users", nil)
+		req.Header.Set(fiber.HeaderXRequestID, "testRequestId")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"message": "internal server error"}`, string(body))
+
+		logger.AssertLogged(t, "error", "connection to db:secret@localhost failed", observance.Fields{"url": "/users"})
+		assert.Contains(t, logger.LastEntry().Data["stack"], "server.TestRecover")
+	})
+
+	t.Run("is used by the server", func(t *testing.T) {
+		logger := observance.NewTestLogger()
+		spans := &bytes.Buffer{}
+		obs := &observance.Obs{Logger: logger, Metrics: observance.NewTestMeasurer()}
+		obs.Tracer = observance.NewTracer("test-app", observance.NewWriterExporter(spans), logger)
+
+		// The server loads the templates from the working directory.
+		dir := t.TempDir()
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "resources", "templates"), 0755))
+		wd, err := os.Getwd()
+		require.NoError(t, err)
+		require.NoError(t, os.Chdir(dir))
+		defer os.Chdir(wd)
+
+		app, err := NewFiber(obs)
+		require.NoError(t, err)
+		app.Get("/", func(c *fiber.Ctx) {
+			panic("index out of range")
+		})
+
+		resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+		assert.NotEmpty(t, resp.Header.Get(fiber.HeaderXRequestID))
+		logger.AssertLogged(t, "error", "index out of range", nil)
+
+		require.NoError(t, obs.Tracer.Close(context.Background()))
+		server := observance.SpanData{}
+		require.NoError(t, json.Unmarshal(spans.Bytes(), &server))
+		assert.Equal(t, float64(500), server.Attributes["http.status_code"])
+		assert.Equal(t, observance.StatusError, server.StatusCode, "the panic is marked in the server span")
+	})
+}
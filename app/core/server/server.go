@@ -5,7 +5,6 @@ import (
 	"github.com/gofiber/compression"
 	"github.com/gofiber/fiber"
 	"github.com/gofiber/helmet"
-	"github.com/gofiber/recover"
 	"github.com/gofiber/requestid"
 	"github.com/gofiber/template/mustache"
 	"github.com/pkg/errors"
@@ -42,16 +41,11 @@ func NewFiber(obs *observance.Obs, timeout ...string) (*fiber.App, error) {
 	srv.Settings.ReadTimeout = timeoutDuration
 	srv.Settings.WriteTimeout = timeoutDuration
 	srv.Settings.ServerHeader = "Verify-Rest"
-	cfg := recover.Config{
-		Handler: func(c *fiber.Ctx, err error) {
-			c.SendString(err.Error())
-			c.SendStatus(500)
-		},
-	}
-
-	srv.Use(recover.New(cfg))
-	srv.Use(compression.New())
+	// Tracing is registered outside of Recover, so the server span sees the status of recovered panics.
 	srv.Use(requestid.New())
+	srv.Use(Tracing(obs))
+	srv.Use(Recover(obs))
+	srv.Use(compression.New())
 	srv.Use(helmet.New())
 
 	srv.Static("/assets", "./static", fiber.Static{
@@ -61,7 +55,7 @@ func NewFiber(obs *observance.Obs, timeout ...string) (*fiber.App, error) {
 	srv.Settings.Templates = mustache.New("./resources/templates", ".mustache")
 	// Set up graceful shutdown.
 	connsClosed := make(chan struct{})
-	sc := make(chan os.Signal)
+	sc := make(chan os.Signal, 1)
 	go func() {
 		s := <-sc
 		obs.Logger.WithField("signal", s).Warn("shutting down gracefully")
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gofiber/fiber"
+	"toolkit/app/core/observance"
+)
+
+// Keys under which the Tracing middleware stores the request-specific values in the Fiber context.
+const (
+	localsObs     = "toolkit.obs"
+	localsContext = "toolkit.context"
+)
+
+// Tracing is a middleware that creates a request-specific observance for every request (see RequestObs).
+// If tracing is set up in the observance, it also starts a server span per request. The span continues the trace
+// of the caller if the request contains a valid "traceparent" header, otherwise a new trace is started.
+// The span is named after the method and the route template, e.g. "GET /users/:id", so the number of span names
+// stays bounded. The trace and span IDs are added to all log messages of the request-specific logger.
+// The request ID is stored in the request context so outgoing requests can pass it on. The request context
+// is derived from the context of the fasthttp request, so it is canceled when the server shuts down.
+func Tracing(obs *observance.Obs) func(*fiber.Ctx) {
+	return func(c *fiber.Ctx) {
+		var ctx context.Context = c.Fasthttp
+		if remote, err := observance.ParseTraceParent(c.Get(observance.TraceParentHeader)); err == nil {
+			remote.TraceState = c.Get(observance.TraceStateHeader)
+			ctx = observance.ContextWithRemoteSpanContext(ctx, remote)
+		}
+		if requestID := requestID(c); requestID != "" {
+			ctx = observance.ContextWithRequestID(ctx, requestID)
+		}
+
+		var span *observance.Span
+		if obs.Tracer != nil {
+			// The route is only known after the router matched the handler, the name is set when the request is done.
+			ctx, span = obs.Tracer.Start(ctx, c.Method(), observance.SpanKindServer)
+			span.SetAttribute("http.method", c.Method())
+			span.SetAttribute("http.target", c.OriginalURL())
+			span.SetAttribute("http.host", c.Hostname())
+		}
+
+		c.Locals(localsContext, ctx)
+		c.Locals(localsObs, obs.CopyWithRequest(toHTTPRequest(ctx, c)))
+
+		defer func() {
+			// Middleware routes are not used since they match any path, e.g. if no handler was found.
+			if route := c.Route(); route != nil && route.Method != "USE" {
+				span.SetName(c.Method() + " " + route.Path)
+				span.SetAttribute("http.route", route.Path)
+			}
+			status := c.Fasthttp.Response.StatusCode()
+			span.SetAttribute("http.status_code", status)
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(observance.StatusError, fmt.Sprintf("request failed with status %d", status))
+			}
+			span.End()
+		}()
+
+		c.Next()
+	}
+}
+
+// RequestObs returns the request-specific observance created by the Tracing middleware.
+// If the middleware was not applied, nil is returned.
+func RequestObs(c *fiber.Ctx) *observance.Obs {
+	obs, _ := c.Locals(localsObs).(*observance.Obs)
+	return obs
+}
+
+// RequestContext returns the context created by the Tracing middleware that contains the span of the request.
+// It should be passed to all functions called by the handler so they can create child spans.
+// If the middleware was not applied, context.Background() is returned.
+func RequestContext(c *fiber.Ctx) context.Context {
+	ctx, ok := c.Locals(localsContext).(context.Context)
+	if !ok {
+		return context.Background()
+	}
+	return ctx
+}
+
+// SetRequestContext replaces the request context, e.g. so a middleware can add values for the following handlers.
+func SetRequestContext(c *fiber.Ctx, ctx context.Context) {
+	c.Locals(localsContext, ctx)
+}
+
+// requestID returns the ID set by the requestid middleware or, if it was not applied, the ID sent by the caller.
+// The value is copied because Fiber reuses the underlying buffers after the request.
+func requestID(c *fiber.Ctx) string {
+	if id := c.Fasthttp.Response.Header.Peek(fiber.HeaderXRequestID); len(id) > 0 {
+		return string(id)
+	}
+	return string(c.Fasthttp.Request.Header.Peek(fiber.HeaderXRequestID))
+}
+
+// toHTTPRequest creates a net/http request with the method, URL and headers of the Fiber request,
+// so it can be used with Obs.CopyWithRequest.
+func toHTTPRequest(ctx context.Context, c *fiber.Ctx) *http.Request {
+	r := &http.Request{
+		Method:     c.Method(),
+		RequestURI: c.OriginalURL(),
+		Header:     http.Header{},
+	}
+	c.Fasthttp.Request.Header.VisitAll(func(key, value []byte) {
+		r.Header.Add(string(key), string(value))
+	})
+	return r.WithContext(ctx)
+}
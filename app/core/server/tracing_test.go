@@ -0,0 +1,134 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"toolkit/app/core/observance"
+)
+
+func TestTracing(t *testing.T) {
+	t.Run("continues the trace of the caller", func(t *testing.T) {
+		spans := &bytes.Buffer{}
+		logs := &bytes.Buffer{}
+		obs := newTracingObs(t, spans, logs)
+
+		app := fiber.New()
+		app.Use(Tracing(obs))
+		app.Get("/users/:id", func(c *fiber.Ctx) {
+			_, span := observance.StartChildSpan(RequestContext(c), "load users", observance.SpanKindInternal)
+			span.End()
+			RequestObs(c).Logger.Info("loading users")
+			c.SendStatus(http.StatusInternalServerError)
+		})
+
+		req := httptest.NewRequest("GET", "/users/42?page=2", nil)
+		req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		req.Header.Set("FastBill-RequestId", "testRequestId")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+		require.NoError(t, obs.Close(context.Background()))
+
+		lines := strings.Split(strings.TrimSpace(spans.String()), "\n")
+		require.Len(t, lines, 2)
+		child := observance.SpanData{}
+		server := observance.SpanData{}
+		require.NoError(t, json.Unmarshal([]byte(lines[0]), &child))
+		require.NoError(t, json.Unmarshal([]byte(lines[1]), &server))
+
+		assert.Equal(t, "GET /users/:id", server.Name, "the route template keeps the number of span names bounded")
+		assert.Equal(t, "/users/:id", server.Attributes["http.route"])
+		assert.Equal(t, observance.SpanKindServer, server.Kind)
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.TraceID)
+		assert.Equal(t, "00f067aa0ba902b7", server.ParentSpanID)
+		assert.Equal(t, "/users/42?page=2", server.Attributes["http.target"])
+		assert.Equal(t, float64(500), server.Attributes["http.status_code"])
+		assert.Equal(t, observance.StatusError, server.StatusCode)
+		assert.Equal(t, server.SpanID, child.ParentSpanID)
+
+		assert.Contains(t, logs.String(), `"traceId":"4bf92f3577b34da6a3ce929d0e0e4736"`)
+		assert.Contains(t, logs.String(), `"spanId":"`+server.SpanID+`"`)
+		assert.Contains(t, logs.String(), `"requestId":"testRequestId"`)
+		assert.Contains(t, logs.String(), `"url":"/users/42?page=2"`)
+	})
+
+	t.Run("starts a new trace", func(t *testing.T) {
+		spans := &bytes.Buffer{}
+		obs := newTracingObs(t, spans, &bytes.Buffer{})
+
+		app := fiber.New()
+		app.Use(Tracing(obs))
+		app.Get("/", func(c *fiber.Ctx) {
+			assert.Equal(t, "testRequestId", observance.RequestIDFromContext(RequestContext(c)))
+			c.SendStatus(http.StatusOK)
+		})
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(fiber.HeaderXRequestID, "testRequestId")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		require.NoError(t, obs.Close(context.Background()))
+
+		server := observance.SpanData{}
+		require.NoError(t, json.Unmarshal(spans.Bytes(), &server))
+		assert.Empty(t, server.ParentSpanID)
+		assert.Equal(t, observance.StatusUnset, server.StatusCode)
+	})
+
+	t.Run("unknown route", func(t *testing.T) {
+		spans := &bytes.Buffer{}
+		obs := newTracingObs(t, spans, &bytes.Buffer{})
+
+		app := fiber.New()
+		app.Use(Tracing(obs))
+		app.Get("/users", func(c *fiber.Ctx) {})
+
+		_, err := app.Test(httptest.NewRequest("GET", "/unknown/42", nil))
+		require.NoError(t, err)
+		require.NoError(t, obs.Close(context.Background()))
+
+		server := observance.SpanData{}
+		require.NoError(t, json.Unmarshal(spans.Bytes(), &server))
+		assert.Equal(t, "GET", server.Name)
+		assert.Equal(t, "/unknown/42", server.Attributes["http.target"])
+	})
+
+	t.Run("without tracer", func(t *testing.T) {
+		obs := &observance.Obs{Logger: observance.NewTestLogger()}
+
+		app := fiber.New()
+		app.Use(Tracing(obs))
+		app.Get("/", func(c *fiber.Ctx) {
+			assert.NotNil(t, RequestObs(c))
+			assert.Nil(t, observance.SpanFromContext(RequestContext(c)))
+			assert.Equal(t, c.Fasthttp.Done(), RequestContext(c).Done(), "canceled with the fasthttp request context")
+			c.SendStatus(http.StatusOK)
+		})
+
+		resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+}
+
+func newTracingObs(t *testing.T, spans *bytes.Buffer, logs *bytes.Buffer) *observance.Obs {
+	obs, err := observance.NewObs(observance.Config{
+		AppName:       "test-app",
+		LogLevel:      "debug",
+		LoggedHeaders: map[string]string{"FastBill-RequestId": "requestId"},
+	})
+	require.NoError(t, err)
+	obs.Logger.SetOutput(logs)
+	obs.Tracer = observance.NewTracer("test-app", observance.NewWriterExporter(spans), obs.Logger)
+	return obs
+}
@@ -1,10 +1,15 @@
 package toolkit
 
 import (
+	"net/http"
+
 	"github.com/gofiber/fiber"
+	"toolkit/app/core/admin"
+	"toolkit/app/core/audit"
 	"toolkit/app/core/cache"
 	"toolkit/app/core/database"
 	"toolkit/app/core/envloader"
+	"toolkit/app/core/httpclient"
 	"toolkit/app/core/observance"
 	"toolkit/app/core/server"
 
@@ -22,9 +27,21 @@ func MustLoadEnvs(folderPath string) {
 // ObsConfig aliases observance.Config so it will not be necessary to import the observance package for the setup process.
 type ObsConfig = observance.Config
 
+// LogSinkConfig aliases observance.LogSinkConfig so it will not be necessary to import the observance package for the setup process.
+type LogSinkConfig = observance.LogSinkConfig
+
 // DBConfig aliases database.Config so it will not be necessary to import the database package for the setup process.
 type DBConfig = database.Config
 
+// CacheConfig aliases cache.Config so it will not be necessary to import the cache package for the setup process.
+type CacheConfig = cache.Config
+
+// HTTPClientConfig aliases httpclient.Config so it will not be necessary to import the httpclient package for the setup process.
+type HTTPClientConfig = httpclient.Config
+
+// AdminConfig aliases admin.Config so it will not be necessary to import the admin package for the setup process.
+type AdminConfig = admin.Config
+
 // MustNewObs creates a new observalibity instance..
 // It includes the properties "Logger", a Logrus logger that fulfils the Logger interface
 // and "Metrics", a Prometheus Client that fulfils the Measurer interface.
@@ -37,14 +54,39 @@ func MustNewObs(config ObsConfig) *observance.Obs {
 }
 
 // MustNewCache creates a new REDIS cache client that fulfils the Cache interface.
-func MustNewCache(host string, port string, prefix string) *cache.RedisClient {
-	redisCache, err := cache.NewRedis(host, port, prefix)
+// If neither a host nor addresses are configured, an in-memory cache is returned instead,
+// e.g. for local development without REDIS. Both also implement cache.Collections.
+func MustNewCache(config CacheConfig) cache.Cache {
+	if config.Host == "" && len(config.Addrs) == 0 {
+		return cache.NewMemory(cache.MemoryConfig{Prefix: config.Prefix, Encoding: config.Encoding})
+	}
+
+	redisCache, err := cache.NewRedisWithConfig(config)
 	if err != nil {
 		panic(err)
 	}
 	return redisCache
 }
 
+// NewHTTPClient creates an http.Client for calling other services. It passes on the request ID and the trace context,
+// logs and measures all requests and supports per-host timeouts, retries and a circuit breaker.
+func NewHTTPClient(obs *observance.Obs, config HTTPClientConfig) *http.Client {
+	return httpclient.New(obs, config)
+}
+
+// MustStartAdminServer starts the admin server with the debug endpoints on its own address.
+// It should be shut down via Shutdown when the service stops.
+func MustStartAdminServer(obs *observance.Obs, config AdminConfig) *admin.Server {
+	adminServer, err := admin.New(obs, config)
+	if err != nil {
+		panic(err)
+	}
+	if err := adminServer.Start(); err != nil {
+		panic(err)
+	}
+	return adminServer
+}
+
 // MustSetupDB creates a new GORM client.
 func MustSetupDB(config DBConfig, logger observance.Logger) *gorm.DB {
 	db, err := database.SetupGORM(config, logger)
@@ -62,6 +104,14 @@ func MustEnsureDBMigrations(folderPath string, config DBConfig) {
 	}
 }
 
+// MustEnsureAuditMigrations creates or updates the table for the audit log with the migrations bundled in the audit package.
+func MustEnsureAuditMigrations(config DBConfig) {
+	err := audit.EnsureMigrations(config)
+	if err != nil {
+		panic(err)
+	}
+}
+
 // MustNewServer sets up a new Echo server.
 func MustNewFiberServer(obs *observance.Obs) (*fiber.App, chan struct{}) {
 	echoServer, err := server.NewFiber(obs)
@@ -1,19 +1,15 @@
 module toolkit
 
-go 1.14
+go 1.18
 
 require (
-	github.com/akyoto/uuid v1.1.3 // indirect
-	github.com/certifi/gocertifi v0.0.0-20200211180108-c7c1fbc02894 // indirect
+	github.com/DATA-DOG/go-sqlmock v1.4.1
+	github.com/alicebob/miniredis/v2 v2.39.0
 	github.com/evalphobia/logrus_sentry v0.8.2
 	github.com/fastbill/go-httperrors/v2 v2.0.0
-	github.com/getsentry/raven-go v0.2.0 // indirect
-	github.com/go-playground/universal-translator v0.17.0 // indirect
 	github.com/go-playground/validator v9.31.0+incompatible
 	github.com/go-redis/redis/v7 v7.3.0
-	github.com/gobuffalo/here v0.6.2 // indirect
 	github.com/gofiber/compression v0.1.0
-	github.com/gofiber/csrf v0.0.2 // indirect
 	github.com/gofiber/embed v0.0.9
 	github.com/gofiber/fiber v1.10.1
 	github.com/gofiber/helmet v0.1.0
@@ -21,24 +17,61 @@ require (
 	github.com/gofiber/requestid v0.1.0
 	github.com/gofiber/template v1.3.1
 	github.com/golang-migrate/migrate/v4 v4.11.0
-	github.com/golang/protobuf v1.4.2 // indirect
 	github.com/jinzhu/gorm v1.9.12
 	github.com/joho/godotenv v1.3.0
-	github.com/klauspost/compress v1.10.6 // indirect
+	github.com/klauspost/compress v1.10.6
 	github.com/labstack/echo/v4 v4.1.16
 	github.com/labstack/gommon v0.3.0
-	github.com/leodido/go-urn v1.2.0 // indirect
-	github.com/lib/pq v1.5.2 // indirect
 	github.com/markbates/pkger v0.16.0
 	github.com/pkg/errors v0.9.1
 	github.com/prometheus/client_golang v1.6.0
-	github.com/prometheus/common v0.10.0 // indirect
 	github.com/sirupsen/logrus v1.6.0
 	github.com/stretchr/testify v1.5.1
+	github.com/vmihailenco/msgpack/v4 v4.3.12
+	google.golang.org/protobuf v1.24.0
+)
+
+require (
+	github.com/akyoto/uuid v1.1.3 // indirect
+	github.com/andybalholm/brotli v1.0.0 // indirect
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cbroglie/mustache v1.1.0 // indirect
+	github.com/certifi/gocertifi v0.0.0-20200211180108-c7c1fbc02894 // indirect
+	github.com/cespare/xxhash/v2 v2.1.1 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/getsentry/raven-go v0.2.0 // indirect
+	github.com/go-playground/locales v0.13.0 // indirect
+	github.com/go-playground/universal-translator v0.17.0 // indirect
+	github.com/go-sql-driver/mysql v1.5.0 // indirect
+	github.com/gobuffalo/here v0.6.2 // indirect
+	github.com/gofiber/csrf v0.0.2 // indirect
+	github.com/gofiber/utils v0.0.3 // indirect
+	github.com/golang/protobuf v1.4.2 // indirect
+	github.com/google/uuid v1.1.1 // indirect
+	github.com/gorilla/schema v1.1.0 // indirect
+	github.com/hashicorp/errwrap v1.0.0 // indirect
+	github.com/hashicorp/go-multierror v1.1.0 // indirect
+	github.com/jinzhu/inflection v1.0.0 // indirect
+	github.com/leodido/go-urn v1.2.0 // indirect
+	github.com/lib/pq v1.5.2 // indirect
+	github.com/mattn/go-colorable v0.1.6 // indirect
+	github.com/mattn/go-isatty v0.0.12 // indirect
+	github.com/matttproud/golang_protobuf_extensions v1.0.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/prometheus/client_model v0.2.0 // indirect
+	github.com/prometheus/common v0.10.0 // indirect
+	github.com/prometheus/procfs v0.0.11 // indirect
+	github.com/stretchr/objx v0.2.0 // indirect
+	github.com/valyala/bytebufferpool v1.0.0 // indirect
+	github.com/valyala/fasthttp v1.13.1 // indirect
+	github.com/valyala/fasttemplate v1.1.0 // indirect
+	github.com/vmihailenco/tagparser v0.1.1 // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
 	golang.org/x/crypto v0.0.0-20200510223506-06a226fb4e37 // indirect
 	golang.org/x/lint v0.0.0-20200302205851-738671d3881b // indirect
 	golang.org/x/net v0.0.0-20200520182314-0ba52f642ac2 // indirect
 	golang.org/x/sys v0.0.0-20200523222454-059865788121 // indirect
+	golang.org/x/text v0.3.2 // indirect
 	golang.org/x/tools v0.0.0-20200527183253-8e7acdbce89d // indirect
-	google.golang.org/protobuf v1.24.0 // indirect
+	gopkg.in/yaml.v2 v2.3.0 // indirect
 )